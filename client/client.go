@@ -0,0 +1,152 @@
+// Package client is a Go client for a node's JSON-RPC endpoint.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// DefaultTimeout bounds a single RPC round trip.
+const DefaultTimeout = 30 * time.Second
+
+// Error is an error object returned by the node.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Client calls the JSON-RPC methods of one node.
+type Client struct {
+	url   string
+	token string // empty → no Authorization header
+	http  *http.Client
+	id    atomic.Int64
+}
+
+// New creates a Client for the node RPC endpoint at url
+// (e.g. "http://127.0.0.1:8545").
+func New(url string) *Client {
+	return &Client{url: url, http: &http.Client{Timeout: DefaultTimeout}}
+}
+
+// SetAuthToken sends token as a bearer token with every request.
+func (c *Client) SetAuthToken(token string) {
+	c.token = token
+}
+
+// Call invokes method with params and decodes the result into result,
+// which may be nil to discard it. An error returned by the node is
+// reported as *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      c.id.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: read response: %w", method, err)
+	}
+	var out struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	decodeErr := json.Unmarshal(raw, &out)
+	if decodeErr == nil && out.Error != nil {
+		return out.Error
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: http %s", method, resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("%s: decode response: %w", method, decodeErr)
+	}
+	if result == nil || len(out.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(out.Result, result)
+}
+
+// Balance is the result of getBalance.
+type Balance struct {
+	Address string `json:"address"`
+	Balance uint64 `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+}
+
+// Height returns the node's current block height.
+func (c *Client) Height(ctx context.Context) (int64, error) {
+	var h int64
+	err := c.Call(ctx, "getBlockHeight", nil, &h)
+	return h, err
+}
+
+// Balance returns the balance and nonce of address. With pending, the
+// state of the block being produced is included.
+func (c *Client) Balance(ctx context.Context, address string, pending bool) (*Balance, error) {
+	var b Balance
+	err := c.Call(ctx, "getBalance", map[string]any{"address": address, "pending": pending}, &b)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// PendingNonce returns the nonce to sign address's next transaction with,
+// accounting for its transactions still in the node's mempool.
+func (c *Client) PendingNonce(ctx context.Context, address string) (uint64, error) {
+	var out struct {
+		Nonce uint64 `json:"nonce"`
+	}
+	err := c.Call(ctx, "getPendingNonce", map[string]any{"address": address}, &out)
+	return out.Nonce, err
+}
+
+// Asset returns the asset with the given ID.
+func (c *Client) Asset(ctx context.Context, id string) (*core.Asset, error) {
+	var a core.Asset
+	if err := c.Call(ctx, "getAsset", map[string]any{"id": id}, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SendTx submits a signed transaction and returns its ID.
+func (c *Client) SendTx(ctx context.Context, tx *core.Transaction) (string, error) {
+	var out struct {
+		TxID string `json:"tx_id"`
+	}
+	if err := c.Call(ctx, "sendTx", tx, &out); err != nil {
+		return "", err
+	}
+	return out.TxID, nil
+}
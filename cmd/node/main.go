@@ -2,29 +2,25 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
-	"time"
 
 	"github.com/tolelom/tolchain/config"
-	"github.com/tolelom/tolchain/consensus"
-	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/crypto/certgen"
-	"github.com/tolelom/tolchain/events"
-	"github.com/tolelom/tolchain/indexer"
-	"github.com/tolelom/tolchain/network"
-	"github.com/tolelom/tolchain/rpc"
+	"github.com/tolelom/tolchain/node"
 	"github.com/tolelom/tolchain/storage"
-	"github.com/tolelom/tolchain/vm"
+	"github.com/tolelom/tolchain/version"
 	"github.com/tolelom/tolchain/wallet"
 
 	// Import VM modules to trigger their init() self-registration.
 	_ "github.com/tolelom/tolchain/vm/modules/asset"
+	_ "github.com/tolelom/tolchain/vm/modules/custom"
 	_ "github.com/tolelom/tolchain/vm/modules/economy"
 	_ "github.com/tolelom/tolchain/vm/modules/market"
 	_ "github.com/tolelom/tolchain/vm/modules/session"
@@ -34,8 +30,10 @@ func main() {
 	cfgPath := flag.String("config", "config.json", "path to config file")
 	keyPath := flag.String("key", "validator.key", "path to keystore file")
 	genKey := flag.Bool("genkey", false, "generate a new validator key and exit")
+	importKey := flag.String("importkey", "", "import a hex ed25519 private key into the keystore and exit; \"-\" reads it from stdin (keeps it out of ps)")
 	genCerts := flag.String("gencerts", "", "generate CA + node TLS certs into the given directory and exit (requires node ID from config)")
 	flag.Parse()
+	log.Printf("tolchain-node %s", version.String())
 
 	// Read keystore password from environment (not CLI flags — they leak via ps).
 	password := os.Getenv("TOL_PASSWORD")
@@ -57,6 +55,25 @@ func main() {
 		return
 	}
 
+	// ---- import key mode ----
+	if *importKey != "" {
+		privHex := *importKey
+		if privHex == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				log.Fatalf("read key: %v", err)
+			}
+			privHex = string(data)
+		}
+		w, err := wallet.ImportKey(*keyPath, password, privHex)
+		if err != nil {
+			log.Fatalf("import key: %v", err)
+		}
+		fmt.Printf("Imported key. Public key (validator address): %s\n", w.PubKey())
+		fmt.Printf("Saved to: %s\n", *keyPath)
+		return
+	}
+
 	// ---- generate certs mode ----
 	if *genCerts != "" {
 		cfgForCerts, err := loadConfig(*cfgPath)
@@ -86,110 +103,25 @@ func main() {
 	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
 		log.Fatalf("mkdir data dir: %v", err)
 	}
-	db, err := storage.NewLevelDB(cfg.DataDir + "/chain")
+	db, err := storage.Open(cfg.StorageBackend, cfg.DataDir+"/chain")
 	if err != nil {
 		log.Fatalf("open db: %v", err)
 	}
-	defer db.Close()
-
-	stateDB := db // reuse same DB with different key prefixes
+	// State and blocks share one DB with different key prefixes.
 	blockStore := storage.NewLevelBlockStore(db)
 
-	// ---- initialise state ----
-	state := storage.NewStateDB(stateDB)
-
-	// ---- initialise blockchain ----
-	bc := core.NewBlockchain(blockStore)
-	if err := bc.Init(); err != nil {
-		log.Fatalf("blockchain init: %v", err)
-	}
-
-	// ---- genesis block (if fresh chain) ----
-	if bc.Tip() == nil {
-		genesisBlock, err := config.CreateGenesisBlock(cfg, state, privKey)
+	// ---- start all subsystems ----
+	rt := node.New(cfg, privKey, db, blockStore)
+	if cfg.Faucet {
+		faucetKey, err := wallet.LoadKey(cfg.FaucetKeyFile, os.Getenv("TOL_FAUCET_PASSWORD"))
 		if err != nil {
-			log.Fatalf("genesis: %v", err)
+			log.Fatalf("load faucet key: %v", err)
 		}
-		if err := bc.AddBlock(genesisBlock); err != nil {
-			log.Fatalf("add genesis: %v", err)
-		}
-		log.Printf("Genesis block committed: %s", genesisBlock.Hash)
+		rt.SetFaucetKey(faucetKey)
 	}
-
-	// ---- events ----
-	emitter := events.NewEmitter()
-
-	// ---- indexer ----
-	idx := indexer.New(db, emitter)
-
-	// ---- mempool ----
-	mempool := core.NewMempool()
-
-	// ---- VM executor ----
-	exec := vm.NewExecutor(state, emitter)
-
-	// ---- consensus ----
-	poa := consensus.New(cfg, bc, state, mempool, exec, emitter, privKey)
-
-	// ---- TLS ----
-	tlsCfg, err := config.LoadTLSConfig(cfg.TLS)
-	if err != nil {
-		log.Fatalf("tls: %v", err)
-	}
-	if tlsCfg != nil {
-		log.Println("mTLS enabled for P2P")
-	}
-
-	// ---- network ----
-	p2pAddr := fmt.Sprintf(":%d", cfg.P2PPort)
-	node := network.NewNode(cfg.NodeID, p2pAddr, mempool, tlsCfg)
-	syncer := network.NewSyncer(node, bc, poa, exec, state)
-	if err := node.Start(); err != nil {
-		log.Fatalf("p2p start: %v", err)
-	}
-	defer node.Stop()
-	log.Printf("P2P listening on %s", p2pAddr)
-
-	// ---- connect to seed peers ----
-	connectedSeeds := 0
-	for _, sp := range cfg.SeedPeers {
-		if err := node.AddPeer(sp.ID, sp.Addr); err != nil {
-			log.Printf("seed peer %s (%s): %v", sp.ID, sp.Addr, err)
-			continue
-		}
-		// Trigger initial block sync with the newly connected peer.
-		if peer := node.Peer(sp.ID); peer != nil {
-			syncer.SyncWithPeer(peer)
-		}
-		connectedSeeds++
-		log.Printf("Connected to seed peer %s (%s)", sp.ID, sp.Addr)
-	}
-	if len(cfg.SeedPeers) > 0 && connectedSeeds == 0 {
-		log.Println("WARNING: failed to connect to any seed peer — node is isolated")
-	}
-
-	// ---- RPC ----
-	rpcAddr := fmt.Sprintf(":%d", cfg.RPCPort)
-	rpcHandler := rpc.NewHandler(bc, mempool, state, idx, cfg.Genesis.ChainID)
-	rpcServer := rpc.NewServer(rpcAddr, rpcHandler, cfg.RPCAuthToken)
-	if err := rpcServer.Start(); err != nil {
-		log.Fatalf("rpc start: %v", err)
+	if err := rt.Start(); err != nil {
+		log.Fatalf("start: %v", err)
 	}
-	defer rpcServer.Stop()
-	log.Printf("RPC listening on %s", rpcAddr)
-	if cfg.RPCAuthToken != "" {
-		log.Println("RPC Bearer token authentication enabled")
-	}
-
-	// ---- consensus loop ----
-	done := make(chan struct{})
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		poa.Run(2*time.Second, done)
-	}()
-	log.Printf("Consensus running (validator: %s)", privKey.Public().Hex())
 
 	// ---- graceful shutdown ----
 	sigCh := make(chan os.Signal, 1)
@@ -197,11 +129,11 @@ func main() {
 	<-sigCh
 	log.Println("Shutting down...")
 
-	// 1. Stop consensus first (no new blocks written)
-	close(done)
-	wg.Wait()
-
-	// 2. Deferred calls run in LIFO: rpcServer.Stop → node.Stop → db.Close
+	ctx, cancel := context.WithTimeout(context.Background(), rt.ShutdownTimeout())
+	defer cancel()
+	if err := rt.Stop(ctx); err != nil {
+		log.Fatalf("shutdown: %v", err)
+	}
 	log.Println("Shutdown complete.")
 }
 
@@ -210,7 +142,8 @@ func loadConfig(path string) (*config.Config, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("Config file not found at %s, using defaults.", path)
-			return config.DefaultConfig(), nil
+			cfg = config.DefaultConfig()
+			return cfg, cfg.ApplyEnv()
 		}
 		return nil, err
 	}
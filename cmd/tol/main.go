@@ -0,0 +1,21 @@
+// Command tol queries a TOL Chain node and submits signed transactions.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tolelom/tolchain/internal/cli"
+)
+
+func main() {
+	if err := cli.Run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "tol:", err)
+		}
+		os.Exit(1)
+	}
+}
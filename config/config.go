@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/vm"
 )
 
 // TLSConfig holds paths to the PEM files needed for mTLS.
@@ -23,22 +27,93 @@ type SeedPeer struct {
 
 // GenesisConfig describes the chain's initial state.
 type GenesisConfig struct {
-	ChainID string            `json:"chain_id"`
-	Alloc   map[string]uint64 `json:"alloc"` // pubkey hex → initial balance
+	ChainID          string                         `json:"chain_id"`
+	Alloc            map[string]uint64              `json:"alloc"`                        // pubkey hex → initial balance
+	Templates        []core.RegisterTemplatePayload `json:"templates,omitempty"`          // registered in order at genesis
+	Assets           []core.MintAssetPayload        `json:"assets,omitempty"`             // minted in order after templates; owner required
+	StateRootVersion int                            `json:"state_root_version,omitempty"` // 1 flat hash, 2 Merkle tree; 0 → 2; fixed for the chain's life
 }
 
+// MainnetChainID is the chain ID of the production network. Testnet-only
+// features such as the faucet are refused on it.
+const MainnetChainID = "tolchain-mainnet"
+
 // Config holds all node configuration.
 type Config struct {
 	NodeID      string        `json:"node_id"`
 	DataDir     string        `json:"data_dir"`
+	StorageBackend string     `json:"storage_backend,omitempty"` // registered storage engine; empty → "leveldb"
+	SyncWrites  bool          `json:"sync_writes,omitempty"` // fsync block and state commits; false → async
 	RPCPort     int           `json:"rpc_port"`
 	P2PPort     int           `json:"p2p_port"`
 	MaxBlockTxs int           `json:"max_block_txs"` // max transactions per block; 0 → 500
-	Validators   []string      `json:"validators"`              // authorised proposer pubkey hexes
+	MempoolMaxPerAccount int  `json:"mempool_max_per_account,omitempty"` // pending txs per sender; 0 → 64
+	MaxValidFromAhead    int  `json:"max_valid_from_ahead,omitempty"`    // blocks past the next one a tx valid_from may lie; 0 → 1000
+	StuckTxThresholdMs   int  `json:"stuck_tx_threshold_ms,omitempty"`   // pending time after which a tx is logged as stuck; 0 → 600000
+	MempoolIntakeDepth   int  `json:"mempool_intake_depth,omitempty"`    // queue sendTx and gossiped txs for parallel verification; 0 → no queue
+	MempoolIntakeWorkers int  `json:"mempool_intake_workers,omitempty"`  // intake verifier goroutines; 0 → number of CPUs
+	Validators   []Validator   `json:"validators"`              // authorised proposers: pubkey hex or {pubkey, weight, bond}
+	ProposerSelection string   `json:"proposer_selection,omitempty"` // "round_robin" or "random"; empty → round_robin
 	Genesis      GenesisConfig `json:"genesis"`
 	SeedPeers    []SeedPeer    `json:"seed_peers,omitempty"`     // initial peers to connect to
+	AllowedPeerIDs []string    `json:"allowed_peer_ids,omitempty"` // only these node IDs may connect; empty → any
 	TLS          *TLSConfig    `json:"tls,omitempty"`           // nil → plain TCP
 	RPCAuthToken string        `json:"rpc_auth_token,omitempty"` // empty → no auth
+	RPCAdminToken string       `json:"rpc_admin_token,omitempty"` // bearer token for admin methods (dropTx); empty → disabled over TCP
+	RPCUnixSocket       string `json:"rpc_unix_socket,omitempty"`         // also serve RPC on this socket path
+	RPCUnixSocketNoAuth bool   `json:"rpc_unix_socket_no_auth,omitempty"` // skip bearer auth on the socket
+	RPCRequestTimeoutMs int    `json:"rpc_request_timeout_ms,omitempty"`  // per-request processing bound; 0 → none
+	RPCSlowLogMs        int    `json:"rpc_slow_log_ms,omitempty"`         // log requests taking this long; 0 → 1000
+	RPCMaxConnections   int    `json:"rpc_max_connections,omitempty"`     // open TCP connections per RPC listener; 0 → 1000
+	RPCPublicMethods   []string `json:"rpc_public_methods,omitempty"`   // methods served on rpc_port over TCP; empty → all
+	RPCInternalPort    int      `json:"rpc_internal_port,omitempty"`    // second RPC listener, e.g. on a private interface; 0 → none
+	RPCInternalMethods []string `json:"rpc_internal_methods,omitempty"` // methods served on rpc_internal_port; empty → all
+	P2PProxy     string        `json:"p2p_proxy,omitempty"`      // SOCKS5 host:port for outbound peers; empty → direct
+	SyncBatchMaxBytes int `json:"sync_batch_max_bytes,omitempty"` // byte budget of a served blocks batch; 0 → 8 MiB
+	MaxBlockDriftMs   int `json:"max_block_drift_ms,omitempty"`   // accepted lead of a block timestamp; 0 → 15000
+	BlockQuarantineMs int `json:"block_quarantine_ms,omitempty"`  // further lead retried, not rejected; 0 → 60000
+	PeerBanThreshold  int `json:"peer_ban_threshold,omitempty"`   // misbehaviour score that bans a peer; 0 → 100
+	PeerBanDurationMs int `json:"peer_ban_duration_ms,omitempty"` // how long a ban lasts; 0 → 10 minutes
+	MaxPeersPerIP     int `json:"max_peers_per_ip,omitempty"`     // peers one host may hold; 0 → 8
+	AcceptRate        int `json:"accept_rate,omitempty"`          // inbound connections/sec, all hosts; 0 → 50
+	AcceptRatePerIP   int `json:"accept_rate_per_ip,omitempty"`   // inbound connections/sec per host; 0 → 10
+	PingIntervalMs    int `json:"ping_interval_ms,omitempty"`     // keep-alive ping period; 0 → 10000
+	PingMaxMissed     int `json:"ping_max_missed,omitempty"`      // unanswered pings that drop a peer; 0 → 3
+	PeerReadTimeoutMs int `json:"peer_read_timeout_ms,omitempty"` // silence that drops a peer; 0 → 30000
+	SeenTxCacheSize   int `json:"seen_tx_cache_size,omitempty"`   // gossiped txs remembered for dedup; 0 → 20000
+	SeenTxTTLMs       int `json:"seen_tx_ttl_ms,omitempty"`       // how long a gossiped tx is remembered; 0 → 10 minutes
+	TxTimeoutMs  int           `json:"tx_timeout_ms,omitempty"`  // per-tx handler deadline; 0 → none
+	Checkpoints  map[int64]string `json:"checkpoints,omitempty"`  // height → trusted block hash
+	MaxSessionPlayers int        `json:"max_session_players,omitempty"` // players per session; 0 → 100
+	MaxSessionStakes  uint64     `json:"max_session_stakes,omitempty"`  // per-player stake per session; 0 → unlimited
+	MaxAssetPropertiesBytes int  `json:"max_asset_properties_bytes,omitempty"` // serialized properties per minted asset; 0 → 16384
+	MaxAssetPropertyKeys    int  `json:"max_asset_property_keys,omitempty"`    // top-level property keys per minted asset; 0 → 64
+	AssetBurnTombstones     bool `json:"asset_burn_tombstones,omitempty"`      // burn_asset keeps a burned record; false → delete
+	BlockReward  uint64        `json:"block_reward,omitempty"`   // tokens minted to each block's proposer
+	MinTransferAmount      uint64 `json:"min_transfer_amount,omitempty"`      // smallest allowed transfer
+	AccountCreationDeposit uint64 `json:"account_creation_deposit,omitempty"` // burned when a transfer creates an account
+	IdempotencyKeysPerAccount int `json:"idempotency_keys_per_account,omitempty"` // recent tx idempotency keys remembered per sender; 0 → 64
+	EnabledTxTypes []string `json:"enabled_tx_types,omitempty"` // allowed tx types; empty → all registered
+	MinFees        map[string]uint64 `json:"min_fees,omitempty"`  // tx type → smallest accepted fee
+	CustomSchemas  map[string]map[string]string `json:"custom_schemas,omitempty"` // schema name → field → type hint for custom txs
+	FeeEstimateFloor      uint64 `json:"fee_estimate_floor,omitempty"`      // estimateFee lower bound
+	FeeEstimatePercentile int    `json:"fee_estimate_percentile,omitempty"` // mempool fee percentile; 0 → 50
+	EventLog          bool     `json:"event_log,omitempty"`           // persist emitted events for getEvents
+	EventLogRetention int64    `json:"event_log_retention,omitempty"` // heights of events kept; 0 → all
+	TxIndex           bool     `json:"tx_index,omitempty"`            // index executed txs by sender and type
+	TxIndexLimit      int      `json:"tx_index_limit,omitempty"`      // txs kept per sender/type; 0 → 1000
+	MarketHistory     bool     `json:"market_history,omitempty"`      // archive listings and sales for getMarketHistory
+	Faucet               bool   `json:"faucet,omitempty"`                 // enable the faucet RPC (testnets only)
+	FaucetKeyFile        string `json:"faucet_key_file,omitempty"`        // keystore of the funded faucet account
+	FaucetAmount         uint64 `json:"faucet_amount,omitempty"`          // tokens paid per claim
+	FaucetIntervalBlocks int64  `json:"faucet_interval_blocks,omitempty"` // blocks between claims per address; 0 → 100
+	BlockIntervalMs   int      `json:"block_interval_ms,omitempty"`   // block production interval; 0 → 2000
+	ShutdownTimeoutMs int      `json:"shutdown_timeout_ms,omitempty"` // bound on graceful shutdown; 0 → 10000
+
+	MinBlockIntervalMs int `json:"min_block_interval_ms,omitempty"` // least gap between block timestamps; 0 → none
+	MaxBlockIntervalMs int `json:"max_block_interval_ms,omitempty"` // greatest gap between block timestamps; 0 → none
+
+	LegacySignaturesUntil int64 `json:"legacy_signatures_until,omitempty"` // blocks below this height may be signed over the bare hash; 0 → none
 }
 
 // DefaultConfig returns a single-node development configuration.
@@ -56,7 +131,9 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load reads a JSON config file from path and validates required fields.
+// Load reads a JSON config file from path, applies the TOL_* environment
+// overrides (see ApplyEnv) and validates the result. Precedence is
+// environment, then file, then DefaultConfig.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -66,6 +143,9 @@ func Load(path string) (*Config, error) {
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, err
+	}
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation: %w", err)
 	}
@@ -80,10 +160,14 @@ func (c *Config) Validate() error {
 	if c.DataDir == "" {
 		return fmt.Errorf("data_dir must not be empty")
 	}
-	if c.Genesis.ChainID == "" {
-		return fmt.Errorf("genesis.chain_id must not be empty")
+	if c.StorageBackend != "" && !storage.HasBackend(c.StorageBackend) {
+		return fmt.Errorf("storage_backend %q is not registered (registered: %v)", c.StorageBackend, storage.Backends())
+	}
+	if err := c.Genesis.Validate(); err != nil {
+		return err
 	}
-	if c.RPCPort <= 0 || c.RPCPort > 65535 {
+	// rpc_port 0 disables TCP RPC, which is only allowed with a Unix socket.
+	if c.RPCPort < 0 || c.RPCPort > 65535 || (c.RPCPort == 0 && c.RPCUnixSocket == "") {
 		return fmt.Errorf("rpc_port must be 1-65535, got %d", c.RPCPort)
 	}
 	if c.P2PPort <= 0 || c.P2PPort > 65535 {
@@ -92,19 +176,155 @@ func (c *Config) Validate() error {
 	if c.RPCPort == c.P2PPort {
 		return fmt.Errorf("rpc_port and p2p_port must not be the same (%d)", c.RPCPort)
 	}
+	if c.RPCInternalPort < 0 || c.RPCInternalPort > 65535 {
+		return fmt.Errorf("rpc_internal_port must be 0-65535, got %d", c.RPCInternalPort)
+	}
+	if c.RPCInternalPort != 0 && (c.RPCInternalPort == c.RPCPort || c.RPCInternalPort == c.P2PPort) {
+		return fmt.Errorf("rpc_internal_port must differ from rpc_port and p2p_port (%d)", c.RPCInternalPort)
+	}
+	if c.RPCInternalPort == 0 && len(c.RPCInternalMethods) > 0 {
+		return fmt.Errorf("rpc_internal_methods requires rpc_internal_port")
+	}
+	if c.RPCAdminToken != "" && c.RPCAdminToken == c.RPCAuthToken {
+		return fmt.Errorf("rpc_admin_token must differ from rpc_auth_token")
+	}
+	if c.MaxSessionPlayers < 0 {
+		return fmt.Errorf("max_session_players must not be negative, got %d", c.MaxSessionPlayers)
+	}
+	for name, fields := range c.CustomSchemas {
+		if name == "" {
+			return fmt.Errorf("custom_schemas: empty schema name")
+		}
+		if err := vm.Schema(fields).Check(); err != nil {
+			return fmt.Errorf("custom_schemas[%s]: %w", name, err)
+		}
+	}
+	if c.MaxAssetPropertiesBytes < 0 || c.MaxAssetPropertyKeys < 0 {
+		return fmt.Errorf("max_asset_properties_bytes and max_asset_property_keys must not be negative")
+	}
+	params := c.VMParams()
+	for i, p := range c.Genesis.Assets {
+		if err := vm.CheckProperties(params, p.Properties); err != nil {
+			return fmt.Errorf("genesis.assets[%d]: %w", i, err)
+		}
+	}
+	if c.BlockIntervalMs < 0 || c.ShutdownTimeoutMs < 0 {
+		return fmt.Errorf("block_interval_ms and shutdown_timeout_ms must not be negative")
+	}
+	if c.MinBlockIntervalMs < 0 || c.MaxBlockIntervalMs < 0 {
+		return fmt.Errorf("min_block_interval_ms and max_block_interval_ms must not be negative")
+	}
+	if c.LegacySignaturesUntil < 0 {
+		return fmt.Errorf("legacy_signatures_until must not be negative, got %d", c.LegacySignaturesUntil)
+	}
+	if c.MaxBlockIntervalMs > 0 {
+		if floor := max(orDefault(c.BlockIntervalMs, 2000), c.MinBlockIntervalMs); c.MaxBlockIntervalMs <= floor {
+			return fmt.Errorf("max_block_interval_ms (%d) must exceed block_interval_ms and min_block_interval_ms (%d)", c.MaxBlockIntervalMs, floor)
+		}
+	}
+	if c.MempoolMaxPerAccount < 0 {
+		return fmt.Errorf("mempool_max_per_account must not be negative, got %d", c.MempoolMaxPerAccount)
+	}
+	if c.MaxValidFromAhead < 0 {
+		return fmt.Errorf("max_valid_from_ahead must not be negative, got %d", c.MaxValidFromAhead)
+	}
+	if c.IdempotencyKeysPerAccount < 0 {
+		return fmt.Errorf("idempotency_keys_per_account must not be negative, got %d", c.IdempotencyKeysPerAccount)
+	}
+	if c.MempoolIntakeDepth < 0 || c.MempoolIntakeWorkers < 0 {
+		return fmt.Errorf("mempool_intake_depth and mempool_intake_workers must not be negative")
+	}
+	if c.StuckTxThresholdMs < 0 {
+		return fmt.Errorf("stuck_tx_threshold_ms must not be negative, got %d", c.StuckTxThresholdMs)
+	}
+	if c.SyncBatchMaxBytes < 0 {
+		return fmt.Errorf("sync_batch_max_bytes must not be negative, got %d", c.SyncBatchMaxBytes)
+	}
+	if c.RPCRequestTimeoutMs < 0 || c.RPCSlowLogMs < 0 {
+		return fmt.Errorf("rpc_request_timeout_ms and rpc_slow_log_ms must not be negative")
+	}
+	if c.RPCMaxConnections < 0 {
+		return fmt.Errorf("rpc_max_connections must not be negative, got %d", c.RPCMaxConnections)
+	}
+	if c.MaxBlockDriftMs < 0 || c.BlockQuarantineMs < 0 {
+		return fmt.Errorf("max_block_drift_ms and block_quarantine_ms must not be negative")
+	}
+	if c.PeerBanThreshold < 0 || c.PeerBanDurationMs < 0 {
+		return fmt.Errorf("peer_ban_threshold and peer_ban_duration_ms must not be negative")
+	}
+	if c.MaxPeersPerIP < 0 || c.AcceptRate < 0 || c.AcceptRatePerIP < 0 {
+		return fmt.Errorf("max_peers_per_ip, accept_rate and accept_rate_per_ip must not be negative")
+	}
+	if c.PingIntervalMs < 0 || c.PingMaxMissed < 0 || c.PeerReadTimeoutMs < 0 {
+		return fmt.Errorf("ping_interval_ms, ping_max_missed and peer_read_timeout_ms must not be negative")
+	}
+	if ping, read := orDefault(c.PingIntervalMs, 10000), orDefault(c.PeerReadTimeoutMs, 30000); read <= ping {
+		return fmt.Errorf("peer_read_timeout_ms (%d) must exceed ping_interval_ms (%d)", read, ping)
+	}
+	if c.SeenTxCacheSize < 0 || c.SeenTxTTLMs < 0 {
+		return fmt.Errorf("seen_tx_cache_size and seen_tx_ttl_ms must not be negative")
+	}
+	for _, id := range c.AllowedPeerIDs {
+		if id == "" {
+			return fmt.Errorf("allowed_peer_ids: empty node ID")
+		}
+	}
+	if c.EventLogRetention < 0 {
+		return fmt.Errorf("event_log_retention must not be negative, got %d", c.EventLogRetention)
+	}
+	if c.TxIndexLimit < 0 {
+		return fmt.Errorf("tx_index_limit must not be negative, got %d", c.TxIndexLimit)
+	}
+	if c.Faucet {
+		if c.Genesis.ChainID == MainnetChainID {
+			return fmt.Errorf("faucet must not be enabled on %s", MainnetChainID)
+		}
+		if c.FaucetKeyFile == "" || c.FaucetAmount == 0 {
+			return fmt.Errorf("faucet requires faucet_key_file and a positive faucet_amount")
+		}
+	}
+	if c.FaucetIntervalBlocks < 0 {
+		return fmt.Errorf("faucet_interval_blocks must not be negative, got %d", c.FaucetIntervalBlocks)
+	}
+	if c.FeeEstimatePercentile < 0 || c.FeeEstimatePercentile > 100 {
+		return fmt.Errorf("fee_estimate_percentile must be 0-100, got %d", c.FeeEstimatePercentile)
+	}
+	if c.TxTimeoutMs < 0 {
+		return fmt.Errorf("tx_timeout_ms must not be negative, got %d", c.TxTimeoutMs)
+	}
 	if len(c.Validators) == 0 {
 		return fmt.Errorf("validators list must not be empty")
 	}
+	switch c.ProposerSelection {
+	case "", ProposerRoundRobin, ProposerRandom:
+	default:
+		return fmt.Errorf("proposer_selection must be %q or %q, got %q", ProposerRoundRobin, ProposerRandom, c.ProposerSelection)
+	}
 	seen := make(map[string]bool, len(c.Validators))
 	for i, v := range c.Validators {
-		b, err := hex.DecodeString(v)
+		b, err := hex.DecodeString(v.PubKey)
 		if err != nil || len(b) != 32 {
-			return fmt.Errorf("validators[%d]: must be 64-char hex (32 bytes ed25519 pubkey), got %q", i, v)
+			return fmt.Errorf("validators[%d]: must be 64-char hex (32 bytes ed25519 pubkey), got %q", i, v.PubKey)
 		}
-		if seen[v] {
-			return fmt.Errorf("validators[%d]: duplicate pubkey %q", i, v)
+		if seen[v.PubKey] {
+			return fmt.Errorf("validators[%d]: duplicate pubkey %q", i, v.PubKey)
+		}
+		seen[v.PubKey] = true
+		if v.Weight < 0 || v.Weight > MaxValidatorWeight {
+			return fmt.Errorf("validators[%d]: weight must be 0-%d, got %d", i, MaxValidatorWeight, v.Weight)
+		}
+		// A validator needs no genesis balance, but a bond is taken from it.
+		if alloc, ok := c.Genesis.Alloc[v.PubKey]; v.Bond > 0 && !ok {
+			return fmt.Errorf("validators[%d]: bond %d exceeds genesis alloc 0; add %s to genesis.alloc", i, v.Bond, v.PubKey)
+		} else if v.Bond > alloc {
+			return fmt.Errorf("validators[%d]: bond %d exceeds genesis alloc %d", i, v.Bond, alloc)
+		}
+	}
+	for h, hash := range c.Checkpoints {
+		b, err := hex.DecodeString(hash)
+		if h < 0 || err != nil || len(b) != 32 {
+			return fmt.Errorf("checkpoints[%d]: must be a non-negative height with a 64-char hex hash, got %q", h, hash)
 		}
-		seen[v] = true
 	}
 	if c.TLS != nil {
 		t := c.TLS
@@ -117,6 +337,14 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// orDefault returns v, or def when v is zero.
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
 // Save writes the config to path as formatted JSON.
 func Save(cfg *Config, path string) error {
 	data, err := json.MarshalIndent(cfg, "", "  ")
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envOverrides lists the environment variables ApplyEnv reads. Each is
+// named TOL_ plus the upper-cased JSON key, except TOL_CHAIN_ID for
+// genesis.chain_id.
+var envOverrides = []struct {
+	name string
+	set  func(c *Config, v string) error
+}{
+	{"TOL_NODE_ID", func(c *Config, v string) error { c.NodeID = v; return nil }},
+	{"TOL_DATA_DIR", func(c *Config, v string) error { c.DataDir = v; return nil }},
+	{"TOL_CHAIN_ID", func(c *Config, v string) error { c.Genesis.ChainID = v; return nil }},
+	{"TOL_RPC_PORT", func(c *Config, v string) error { return parseInt(v, &c.RPCPort) }},
+	{"TOL_P2P_PORT", func(c *Config, v string) error { return parseInt(v, &c.P2PPort) }},
+	{"TOL_RPC_INTERNAL_PORT", func(c *Config, v string) error { return parseInt(v, &c.RPCInternalPort) }},
+	{"TOL_RPC_AUTH_TOKEN", func(c *Config, v string) error { c.RPCAuthToken = v; return nil }},
+	{"TOL_RPC_ADMIN_TOKEN", func(c *Config, v string) error { c.RPCAdminToken = v; return nil }},
+	{"TOL_RPC_UNIX_SOCKET", func(c *Config, v string) error { c.RPCUnixSocket = v; return nil }},
+	{"TOL_P2P_PROXY", func(c *Config, v string) error { c.P2PProxy = v; return nil }},
+	{"TOL_MAX_BLOCK_TXS", func(c *Config, v string) error { return parseInt(v, &c.MaxBlockTxs) }},
+	{"TOL_BLOCK_INTERVAL_MS", func(c *Config, v string) error { return parseInt(v, &c.BlockIntervalMs) }},
+	{"TOL_SYNC_WRITES", func(c *Config, v string) error { return parseBool(v, &c.SyncWrites) }},
+	{"TOL_VALIDATORS", setValidatorsEnv},
+	{"TOL_SEED_PEERS", setSeedPeersEnv},
+}
+
+// ApplyEnv overrides config fields with the TOL_* environment variables
+// that are set to a non-empty value, so a JSON file can serve as the base
+// of a containerised deployment. It does not validate the result.
+func (c *Config) ApplyEnv() error {
+	for _, o := range envOverrides {
+		v := strings.TrimSpace(os.Getenv(o.name))
+		if v == "" {
+			continue
+		}
+		if err := o.set(c, v); err != nil {
+			return fmt.Errorf("%s: %w", o.name, err)
+		}
+	}
+	return nil
+}
+
+func parseInt(v string, dst *int) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	*dst = n
+	return nil
+}
+
+func parseBool(v string, dst *bool) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", v)
+	}
+	*dst = b
+	return nil
+}
+
+// setValidatorsEnv parses a comma-separated list of pubkey or pubkey:weight.
+func setValidatorsEnv(c *Config, v string) error {
+	var vals []Validator
+	for _, item := range strings.Split(v, ",") {
+		pk, weight, hasWeight := strings.Cut(strings.TrimSpace(item), ":")
+		val := Validator{PubKey: pk}
+		if hasWeight {
+			if err := parseInt(weight, &val.Weight); err != nil {
+				return fmt.Errorf("validator %s: %w", pk, err)
+			}
+		}
+		vals = append(vals, val)
+	}
+	c.Validators = vals
+	return nil
+}
+
+// setSeedPeersEnv parses a comma-separated list of id@host:port.
+func setSeedPeersEnv(c *Config, v string) error {
+	var peers []SeedPeer
+	for _, item := range strings.Split(v, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(item), "@")
+		if !ok || id == "" || addr == "" {
+			return fmt.Errorf("seed peer %q: want id@host:port", item)
+		}
+		peers = append(peers, SeedPeer{ID: id, Addr: addr})
+	}
+	c.SeedPeers = peers
+	return nil
+}
@@ -1,19 +1,114 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/vm"
 )
 
 // GenesisHash is a canonical all-zeros previous hash for the genesis block.
 const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
 
-// CreateGenesisBlock builds and signs block #0 from the config's Alloc map.
-// It also sets initial account balances in state and commits.
+// MaxChainIDLength bounds the length of genesis.chain_id.
+const MaxChainIDLength = 64
+
+// validChainID reports whether id is 1-MaxChainIDLength characters of
+// ASCII letters, digits, '.', '-' and '_'.
+func validChainID(id string) bool {
+	if id == "" || len(id) > MaxChainIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks the genesis section on its own: the chain ID format, the
+// state root version, that every alloc key is a canonical pubkey and the
+// balances sum without overflow, and that the templates and assets would
+// apply cleanly. Errors name the offending field. How validators relate to
+// the alloc is checked by Config.Validate.
+func (g *GenesisConfig) Validate() error {
+	if g.ChainID == "" {
+		return errors.New("genesis.chain_id must not be empty")
+	}
+	if !validChainID(g.ChainID) {
+		return fmt.Errorf("genesis.chain_id %q must be at most %d letters, digits, '.', '-' or '_' (no spaces)",
+			g.ChainID, MaxChainIDLength)
+	}
+	switch core.StateRootVersionOrDefault(g.StateRootVersion) {
+	case core.StateRootFlat, core.StateRootMerkle:
+	default:
+		return fmt.Errorf("genesis.state_root_version must be %d or %d, got %d",
+			core.StateRootFlat, core.StateRootMerkle, g.StateRootVersion)
+	}
+
+	// Sorted, so that the same config always reports the same error.
+	keys := make([]string, 0, len(g.Alloc))
+	for k := range g.Alloc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var supply uint64
+	for _, k := range keys {
+		pub, err := crypto.PubKeyFromHex(k)
+		if err != nil {
+			return fmt.Errorf("genesis.alloc: key %q must be a 64-char hex ed25519 pubkey: %v", k, err)
+		}
+		if pub.Hex() != k {
+			return fmt.Errorf("genesis.alloc: key %q must be lowercase hex (%s)", k, pub.Hex())
+		}
+		if g.Alloc[k] > math.MaxUint64-supply {
+			return fmt.Errorf("genesis.alloc: balances sum to more than %d at %s; lower the allocations", uint64(math.MaxUint64), k)
+		}
+		supply += g.Alloc[k]
+	}
+
+	templates := make(map[string]bool, len(g.Templates))
+	for i, p := range g.Templates {
+		if err := vm.CheckTemplate(&p); err != nil {
+			return fmt.Errorf("genesis.templates[%d]: %w", i, err)
+		}
+		if templates[p.ID] {
+			return fmt.Errorf("genesis.templates[%d]: duplicate template id %q", i, p.ID)
+		}
+		templates[p.ID] = true
+	}
+	for i, p := range g.Assets {
+		if p.TemplateID == "" {
+			return fmt.Errorf("genesis.assets[%d]: template_id required", i)
+		}
+		if !templates[p.TemplateID] {
+			return fmt.Errorf("genesis.assets[%d]: template %q is not in genesis.templates", i, p.TemplateID)
+		}
+		if _, err := crypto.PubKeyFromHex(p.Owner); err != nil {
+			return fmt.Errorf("genesis.assets[%d]: owner must be a 64-char hex ed25519 pubkey: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// CreateGenesisBlock builds and signs block #0 from the config's Alloc map,
+// validator bonds, Templates and Assets. It sets initial account balances,
+// locks the bonds, registers the templates and mints the assets in state,
+// then commits. The header records
+// StateRootVersion and the ParamsHash of cfg; state must already compute
+// roots with that version.
 func CreateGenesisBlock(cfg *Config, state core.State, proposerPriv crypto.PrivateKey) (*core.Block, error) {
 	proposerPub := proposerPriv.Public()
 
-	// Credit all alloc accounts
+	// Credit all alloc accounts; together they are the initial supply.
+	var supply uint64
 	for pubkeyHex, balance := range cfg.Genesis.Alloc {
 		acc := &core.Account{
 			Address: pubkeyHex,
@@ -23,21 +118,131 @@ func CreateGenesisBlock(cfg *Config, state core.State, proposerPriv crypto.Priva
 		if err := state.SetAccount(acc); err != nil {
 			return nil, err
 		}
+		if balance > math.MaxUint64-supply {
+			return nil, errors.New("genesis alloc total overflows")
+		}
+		supply += balance
+	}
+	if err := state.SetTotalSupply(supply); err != nil {
+		return nil, err
+	}
+
+	if err := applyGenesisBonds(cfg, state); err != nil {
+		return nil, err
 	}
 
-	stateRoot := state.ComputeRoot()
+	if err := applyGenesisAssets(cfg.Genesis, cfg.VMParams(), state); err != nil {
+		return nil, err
+	}
+
+	stateRoot, err := state.ComputeRoot()
+	if err != nil {
+		return nil, err
+	}
 	if err := state.Commit(); err != nil {
 		return nil, err
 	}
 
 	block := core.NewBlock(cfg.Genesis.ChainID, 0, GenesisHash, proposerPub.Hex(), nil)
 	block.Header.StateRoot = stateRoot
+	block.Header.StateRootVersion = cfg.Genesis.StateRootVersion
+	block.Header.ParamsHash = cfg.ParamsHash()
 	// Embed chain ID in PrevHash comment via TxRoot for identification
 	block.Header.TxRoot = crypto.Hash([]byte(cfg.Genesis.ChainID))
 	block.Sign(proposerPriv)
 	return block, nil
 }
 
+// applyGenesisBonds moves each validator's bond out of its genesis balance
+// into a locked bond record. The tokens stay part of the total supply.
+func applyGenesisBonds(cfg *Config, state core.State) error {
+	for i, v := range cfg.Validators {
+		if v.Bond == 0 {
+			continue
+		}
+		acc, err := state.GetAccount(v.PubKey)
+		if err != nil {
+			return err
+		}
+		if acc.Balance < v.Bond {
+			return fmt.Errorf("validators[%d]: bond %d exceeds genesis alloc %d", i, v.Bond, acc.Balance)
+		}
+		acc.Balance -= v.Bond
+		if err := state.SetAccount(acc); err != nil {
+			return err
+		}
+		if err := state.SetValidatorBond(&core.ValidatorBond{Validator: v.PubKey, Amount: v.Bond}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyGenesisAssets registers the genesis templates and then mints the
+// genesis assets, both in config order, with the checks the
+// register_template and mint_asset handlers apply under params. Nothing
+// written depends on the proposer or the clock, so every node derives the
+// same state root. No events are emitted; the indexer picks the assets up
+// through GenesisConfig.AssetIDs.
+func applyGenesisAssets(g GenesisConfig, params vm.Params, state core.State) error {
+	for i, p := range g.Templates {
+		if err := vm.CheckTemplate(&p); err != nil {
+			return fmt.Errorf("genesis.templates[%d]: %w", i, err)
+		}
+		if _, err := state.GetTemplate(p.ID); err == nil {
+			return fmt.Errorf("genesis.templates[%d]: template %q already exists", i, p.ID)
+		} else if !errors.Is(err, core.ErrNotFound) {
+			return fmt.Errorf("genesis.templates[%d]: %w", i, err)
+		}
+		t := &core.AssetTemplate{ID: p.ID, Name: p.Name, Schema: p.Schema, Tradeable: p.Tradeable,
+			TransferCooldownBlocks: p.TransferCooldownBlocks}
+		if err := state.SetTemplate(t); err != nil {
+			return err
+		}
+	}
+	for i, p := range g.Assets {
+		if p.TemplateID == "" {
+			return fmt.Errorf("genesis.assets[%d]: template_id required", i)
+		}
+		if err := vm.CheckProperties(params, p.Properties); err != nil {
+			return fmt.Errorf("genesis.assets[%d]: %w", i, err)
+		}
+		tmpl, err := state.GetTemplate(p.TemplateID)
+		if err != nil {
+			return fmt.Errorf("genesis.assets[%d]: template %q not found: %w", i, p.TemplateID, err)
+		}
+		if _, err := crypto.PubKeyFromHex(p.Owner); err != nil {
+			return fmt.Errorf("genesis.assets[%d]: invalid owner pubkey: %w", i, err)
+		}
+		asset := &core.Asset{
+			ID:         GenesisAssetID(i, p.TemplateID),
+			TemplateID: p.TemplateID,
+			Owner:      p.Owner,
+			Properties: p.Properties,
+			Tradeable:  tmpl.Tradeable,
+		}
+		if err := state.SetAsset(asset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenesisAssetID returns the ID of the asset minted from the i-th entry of
+// genesis.assets.
+func GenesisAssetID(i int, templateID string) string {
+	return crypto.Hash([]byte(fmt.Sprintf("genesis:%d:asset:%s", i, templateID)))
+}
+
+// AssetIDs returns the IDs of the genesis assets, in config order.
+func (g *GenesisConfig) AssetIDs() []string {
+	ids := make([]string, len(g.Assets))
+	for i, p := range g.Assets {
+		ids[i] = GenesisAssetID(i, p.TemplateID)
+	}
+	return ids
+}
+
 // IsGenesisHash returns true if the hash is the canonical genesis prev-hash.
 func IsGenesisHash(h string) bool {
 	return h == GenesisHash
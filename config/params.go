@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/vm"
+)
+
+// VMParams maps the config's execution settings onto vm.Params, applying
+// defaults for unset values.
+func (c *Config) VMParams() vm.Params {
+	p := vm.DefaultParams()
+	if c.MaxSessionPlayers > 0 {
+		p.MaxSessionPlayers = c.MaxSessionPlayers
+	}
+	if c.MaxAssetPropertiesBytes > 0 {
+		p.MaxAssetPropertiesBytes = c.MaxAssetPropertiesBytes
+	}
+	if c.MaxAssetPropertyKeys > 0 {
+		p.MaxAssetPropertyKeys = c.MaxAssetPropertyKeys
+	}
+	p.MaxSessionStakes = c.MaxSessionStakes
+	p.BlockReward = c.BlockReward
+	p.MinTransferAmount = c.MinTransferAmount
+	p.AccountCreationDeposit = c.AccountCreationDeposit
+	p.BurnTombstones = c.AssetBurnTombstones
+	if c.IdempotencyKeysPerAccount > 0 {
+		p.IdempotencyKeys = c.IdempotencyKeysPerAccount
+	}
+	if len(c.MinFees) > 0 {
+		p.MinFees = make(map[core.TxType]uint64, len(c.MinFees))
+		for typ, fee := range c.MinFees {
+			p.MinFees[core.TxType(typ)] = fee
+		}
+	}
+	if len(c.CustomSchemas) > 0 {
+		p.CustomSchemas = make(map[string]vm.Schema, len(c.CustomSchemas))
+		for name, fields := range c.CustomSchemas {
+			p.CustomSchemas[name] = vm.Schema(fields)
+		}
+	}
+	return p
+}
+
+// TxTypes returns EnabledTxTypes as core.TxType values; nil means every
+// registered type is enabled.
+func (c *Config) TxTypes() []core.TxType {
+	if len(c.EnabledTxTypes) == 0 {
+		return nil
+	}
+	types := make([]core.TxType, len(c.EnabledTxTypes))
+	for i, t := range c.EnabledTxTypes {
+		types[i] = core.TxType(t)
+	}
+	return types
+}
+
+// ParamsHash hashes the consensus parameters: VMParams with defaults
+// applied and the sorted enabled tx types. Every node of a chain must agree
+// on it; the genesis block records it and a node refuses to start on a
+// chain whose recorded hash differs from its config.
+func (c *Config) ParamsHash() string {
+	types := append([]string(nil), c.EnabledTxTypes...)
+	sort.Strings(types)
+	data, err := json.Marshal(struct {
+		Params  vm.Params
+		TxTypes []string
+	}{c.VMParams(), types})
+	if err != nil {
+		panic("params hash marshal failed: " + err.Error())
+	}
+	return crypto.Hash(data)
+}
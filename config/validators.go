@@ -0,0 +1,69 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Proposer selection modes for Config.ProposerSelection. Every validator
+// must use the same mode.
+const (
+	ProposerRoundRobin = "round_robin" // weighted rotation by height; the default
+	ProposerRandom     = "random"      // weighted pick seeded by the previous block hash
+)
+
+// MaxValidatorWeight bounds a single validator's weight so the expanded
+// proposer schedule stays small.
+const MaxValidatorWeight = 1000
+
+// Validator is an authorised block proposer. In JSON it is either a plain
+// pubkey hex string (weight 1, no bond) or an object
+// {"pubkey": ..., "weight": ..., "bond": ...}.
+type Validator struct {
+	PubKey string `json:"pubkey"`           // ed25519 pubkey hex
+	Weight int    `json:"weight,omitempty"` // relative share of proposer turns; 0 → 1
+	Bond   uint64 `json:"bond,omitempty"`   // tokens moved from its genesis alloc into a locked bond
+}
+
+// Weighted returns the validator's effective weight.
+func (v Validator) Weighted() int {
+	if v.Weight <= 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// UnmarshalJSON accepts both the plain string and the object form.
+func (v *Validator) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*v = Validator{}
+		return json.Unmarshal(data, &v.PubKey)
+	}
+	type plain Validator
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("validator: %w", err)
+	}
+	*v = Validator(p)
+	return nil
+}
+
+// MarshalJSON writes unweighted, unbonded validators as a plain string so
+// configs without weights keep their original form.
+func (v Validator) MarshalJSON() ([]byte, error) {
+	if v.Weight <= 1 && v.Bond == 0 {
+		return json.Marshal(v.PubKey)
+	}
+	type plain Validator
+	return json.Marshal(plain(v))
+}
+
+// ValidatorsOf returns weight-1 validators for the given pubkeys.
+func ValidatorsOf(pubKeys ...string) []Validator {
+	vals := make([]Validator, len(pubKeys))
+	for i, pk := range pubKeys {
+		vals[i] = Validator{PubKey: pk}
+	}
+	return vals
+}
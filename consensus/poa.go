@@ -1,12 +1,16 @@
 // Package consensus implements Proof-of-Authority block production.
-// Validators propose blocks in round-robin order. Each block is signed by
-// the proposer; other nodes verify the signature before accepting the block.
+// Validators propose blocks in a weighted round-robin order, or optionally in a
+// weighted pseudo-random order seeded by the previous block hash. Each block is
+// signed by the proposer; other nodes verify the signature before accepting the
+// block.
 package consensus
 
 import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/tolelom/tolchain/config"
@@ -26,6 +30,29 @@ type PoA struct {
 	emitter *events.Emitter
 	privKey crypto.PrivateKey
 	pubKey  crypto.PublicKey
+
+	schedule   []string      // proposer rotation expanded by validator weight
+	seeded     bool          // pick from schedule by SeededIndex instead of height
+	maxDrift   time.Duration // accepted lead of a block timestamp over the local clock
+	quarantine time.Duration // further lead reported as *core.FutureBlockError
+	minSpacing time.Duration // least timestamp gap to the parent block; 0 → none
+	maxSpacing time.Duration // greatest timestamp gap to the parent block; 0 → none
+	legacyTo   int64         // blocks below this height may carry legacy signatures
+	sync       SyncStatus    // nil → never considered behind
+	paused     atomic.Bool   // set by Pause: no blocks are proposed
+}
+
+// SyncStatus reports whether the node is still catching up with its peers;
+// *network.Syncer implements it.
+type SyncStatus interface {
+	Syncing() bool
+}
+
+// SetSyncStatus makes Run skip block production while s reports that the
+// node is behind its peers, so that a proposer still syncing does not build
+// on a stale tip and fork the chain. Must be called before Run.
+func (p *PoA) SetSyncStatus(s SyncStatus) {
+	p.sync = s
 }
 
 // New creates a PoA engine for the local validator identified by privKey.
@@ -47,21 +74,160 @@ func New(
 		emitter: emitter,
 		privKey: privKey,
 		pubKey:  privKey.Public(),
+
+		schedule:   ProposerSchedule(cfg.Validators),
+		seeded:     cfg.ProposerSelection == config.ProposerRandom,
+		maxDrift:   DefaultMaxBlockDrift,
+		quarantine: DefaultBlockQuarantine,
+	}
+}
+
+// Defaults for SetClockDrift.
+const (
+	DefaultMaxBlockDrift   = 15 * time.Second
+	DefaultBlockQuarantine = 60 * time.Second
+)
+
+// SetClockDrift sets how far a block timestamp may be ahead of the local
+// clock and still be accepted, and for how much further lead the block is
+// reported as a *core.FutureBlockError to be retried rather than rejected.
+// Non-positive values keep the current setting.
+func (p *PoA) SetClockDrift(maxDrift, quarantine time.Duration) {
+	if maxDrift > 0 {
+		p.maxDrift = maxDrift
+	}
+	if quarantine > 0 {
+		p.quarantine = quarantine
+	}
+}
+
+// SetBlockSpacing bounds the gap between a block's timestamp and its
+// parent's: ValidateBlock rejects a block less than minGap after its
+// parent, produced too quickly, or more than maxGap after it. Zero disables
+// a bound. Blocks on top of genesis are exempt, since the genesis timestamp
+// is when the chain was set up rather than when production began. The
+// proposer waits out minGap before producing, and after a halt longer than
+// maxGap it stamps its block maxGap after the tip instead of with the
+// current time, so the chain resumes and catches up with the clock by up to
+// maxGap per block. Every validator must use the same values.
+func (p *PoA) SetBlockSpacing(minGap, maxGap time.Duration) {
+	p.minSpacing, p.maxSpacing = minGap, maxGap
+}
+
+// SetLegacySignaturesUntil accepts blocks below height whose header or
+// transactions are signed over the bare hash, in a version before
+// core.DomainSeparatedVersion, or whose transactions carry cosignatures
+// without naming their cosigners, so that a chain started before either
+// rule can still be synced. From height on, ValidateBlock rejects them with
+// core.ErrLegacySignature or core.ErrUnnamedCosigners. The default 0
+// accepts none. Every validator must use the same value.
+func (p *PoA) SetLegacySignaturesUntil(height int64) {
+	p.legacyTo = height
+}
+
+// ErrTooSoon is returned by ProduceBlock while the minimum block spacing
+// since the tip has not elapsed.
+var ErrTooSoon = errors.New("minimum block spacing not yet elapsed")
+
+// checkSpacing applies the SetBlockSpacing bounds to a block with timestamp
+// ts on top of parent.
+func (p *PoA) checkSpacing(parent *core.Block, ts int64) error {
+	if parent.Header.Height == 0 {
+		return nil
+	}
+	gap := time.Duration(ts - parent.Header.Timestamp)
+	if p.minSpacing > 0 && gap < p.minSpacing {
+		return fmt.Errorf("%w: block %s after its parent, minimum %s", ErrTooSoon, gap, p.minSpacing)
+	}
+	if p.maxSpacing > 0 && gap > p.maxSpacing {
+		return fmt.Errorf("block %s after its parent, maximum %s", gap, p.maxSpacing)
+	}
+	return nil
+}
+
+// ProposerFor returns the pubkey of the validator expected to propose the
+// block at height whose previous block hash is prevHash, or "" if no
+// validators are configured. Under round-robin selection prevHash is
+// ignored; under random selection (proposer_selection "random") the turn is
+// schedule[SeededIndex(prevHash, height, len(schedule))], so a validator's
+// chance is proportional to its weight.
+func (p *PoA) ProposerFor(height int64, prevHash string) string {
+	if len(p.schedule) == 0 {
+		return ""
+	}
+	if p.seeded {
+		return p.schedule[SeededIndex(prevHash, height, len(p.schedule))]
+	}
+	return p.schedule[height%int64(len(p.schedule))]
+}
+
+// Schedule returns a copy of the proposer rotation: each validator's pubkey
+// appears once per unit of weight, in turn order.
+func (p *PoA) Schedule() []string {
+	return slices.Clone(p.schedule)
+}
+
+// UpcomingProposers returns the expected proposers of the n blocks after
+// the tip, starting at the returned height, as IsProposer derives them.
+// Under random selection a turn depends on the previous block's hash, so
+// only the first is known and the rest are "".
+func (p *PoA) UpcomingProposers(n int) (int64, []string) {
+	height, prevHash := int64(1), config.GenesisHash
+	if tip := p.bc.Tip(); tip != nil {
+		height, prevHash = tip.Header.Height+1, tip.Hash
+	}
+	proposers := make([]string, max(n, 0))
+	for i := range proposers {
+		if i > 0 && p.seeded {
+			break
+		}
+		proposers[i] = p.ProposerFor(height+int64(i), prevHash)
+	}
+	return height, proposers
+}
+
+// ErrPaused is returned by ProduceBlock while the engine is paused.
+var ErrPaused = errors.New("node paused")
+
+// Pause stops this node from proposing blocks until Resume, e.g. for a
+// coordinated upgrade. Blocks from other validators are still validated
+// and accepted, so the node keeps syncing.
+func (p *PoA) Pause() {
+	if !p.paused.Swap(true) {
+		log.Printf("[consensus] paused at height %d", p.bc.Height())
+	}
+}
+
+// Resume lets a paused node propose blocks again.
+func (p *PoA) Resume() {
+	if p.paused.Swap(false) {
+		log.Printf("[consensus] resumed at height %d", p.bc.Height())
 	}
 }
 
-// IsProposer reports whether this node should propose the next block.
+// Paused reports whether the node is paused.
+func (p *PoA) Paused() bool {
+	return p.paused.Load()
+}
+
+// IsProposer reports whether this node should propose the next block. A
+// paused node never is.
 func (p *PoA) IsProposer() bool {
-	if len(p.cfg.Validators) == 0 {
+	if p.Paused() {
 		return false
 	}
-	nextHeight := p.bc.Height() + 1
-	idx := int(nextHeight % int64(len(p.cfg.Validators)))
-	return p.cfg.Validators[idx] == p.pubKey.Hex()
+	height, prevHash := int64(1), config.GenesisHash
+	if tip := p.bc.Tip(); tip != nil {
+		height, prevHash = tip.Header.Height+1, tip.Hash
+	}
+	return p.ProposerFor(height, prevHash) == p.pubKey.Hex()
 }
 
 // ProduceBlock builds, signs, executes and commits the next block.
 func (p *PoA) ProduceBlock() (*core.Block, error) {
+	if p.Paused() {
+		return nil, ErrPaused
+	}
 	if !p.IsProposer() {
 		return nil, errors.New("not the proposer for this round")
 	}
@@ -71,27 +237,43 @@ func (p *PoA) ProduceBlock() (*core.Block, error) {
 		limit = 500
 	}
 	txs := p.mempool.Pending(limit)
+	core.SortTxsByNonce(txs)
 
 	tip := p.bc.Tip()
+	if tip != nil && p.minSpacing > 0 {
+		if err := p.checkSpacing(tip, time.Now().UnixNano()); errors.Is(err, ErrTooSoon) {
+			return nil, err
+		}
+	}
 	var prevHash string
 	var nextHeight int64
+	ts := time.Now().UnixNano()
 	if tip == nil {
 		prevHash = config.GenesisHash
 		nextHeight = 1
 	} else {
 		prevHash = tip.Hash
 		nextHeight = tip.Header.Height + 1
+		// Stay within the maximum spacing our own ValidateBlock and our
+		// peers enforce; a timestamp in the past is always accepted.
+		if latest := tip.Header.Timestamp + int64(p.maxSpacing); tip.Header.Height > 0 && p.maxSpacing > 0 && ts > latest {
+			ts = latest
+		}
 	}
 
-	block := core.NewBlock(p.cfg.Genesis.ChainID, nextHeight, prevHash, p.pubKey.Hex(), txs)
-
-	if err := p.exec.ExecuteBlock(block); err != nil {
-		return nil, fmt.Errorf("execute block: %w", err)
+	block, err := p.executeBlock(nextHeight, prevHash, ts, txs)
+	if err != nil {
+		return nil, err
 	}
+	txs = block.Transactions
 
 	// Compute root from the write buffer BEFORE flushing so that if AddBlock
 	// fails the state has not yet been persisted and the node stays consistent.
-	block.Header.StateRoot = p.state.ComputeRoot()
+	root, err := p.state.ComputeRoot()
+	if err != nil {
+		return nil, fmt.Errorf("compute state root: %w", err)
+	}
+	block.Header.StateRoot = root
 	block.Sign(p.privKey)
 
 	if err := p.bc.AddBlock(block); err != nil {
@@ -104,28 +286,59 @@ func (p *PoA) ProduceBlock() (*core.Block, error) {
 			block.Header.Height, err)
 	}
 
-	// Emit after Sign() so block.Hash is set correctly.
-	p.emitter.Emit(events.Event{
-		Type:        events.EventBlockCommit,
-		BlockHeight: block.Header.Height,
-		Data:        map[string]any{"hash": block.Hash, "txs": len(block.Transactions)},
-	})
+	// Publish the block's events only now that it is committed.
+	p.exec.PublishEvents(block)
 
-	txIDs := make([]string, len(txs))
-	for i, tx := range txs {
-		txIDs[i] = tx.ID
-	}
-	p.mempool.Remove(txIDs)
+	p.mempool.RemoveMined(txs)
 
 	return block, nil
 }
 
-// maxBlockTimeDrift is the maximum allowed clock drift for incoming blocks.
-const maxBlockTimeDrift = int64(15 * time.Second)
+// executeBlock builds and executes a block of txs with timestamp ts on top
+// of prevHash. A transaction that fails execution would fail every later
+// attempt too, so it is evicted from the mempool, reported as
+// EventTxRejected and the block is rebuilt without it. State is left as it was on error.
+func (p *PoA) executeBlock(height int64, prevHash string, ts int64, txs []*core.Transaction) (*core.Block, error) {
+	for {
+		block := core.NewBlock(p.cfg.Genesis.ChainID, height, prevHash, p.pubKey.Hex(), txs)
+		block.Header.Timestamp = ts
+		snapID, err := p.state.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		err = p.exec.ExecuteProposal(block)
+		if err == nil {
+			return block, nil
+		}
+		if revErr := p.state.RevertToSnapshot(snapID); revErr != nil {
+			log.Fatalf("[consensus] FATAL: block %d revert failed after exec error: %v (exec: %v)", height, revErr, err)
+		}
+		var txErr *vm.TxError
+		if !errors.As(err, &txErr) {
+			return nil, fmt.Errorf("execute block: %w", err)
+		}
+		bad := txErr.Tx
+		log.Printf("[consensus] evicting tx %s: %v", bad.ID, txErr.Err)
+		p.mempool.Remove([]string{bad.ID})
+		p.emitter.Emit(events.Event{
+			Type:        events.EventTxRejected,
+			TxID:        bad.ID,
+			BlockHeight: height,
+			Data:        map[string]any{"from": bad.From, "type": string(bad.Type), "reason": txErr.Err.Error()},
+		})
+		kept := make([]*core.Transaction, 0, len(txs)-1)
+		for _, tx := range txs {
+			if tx != bad {
+				kept = append(kept, tx)
+			}
+		}
+		txs = kept
+	}
+}
 
 // ValidateBlock checks that block was proposed by the expected validator.
 func (p *PoA) ValidateBlock(block *core.Block) error {
-	if len(p.cfg.Validators) == 0 {
+	if len(p.schedule) == 0 {
 		return errors.New("no validators configured")
 	}
 
@@ -134,8 +347,7 @@ func (p *PoA) ValidateBlock(block *core.Block) error {
 		return fmt.Errorf("chain ID mismatch: got %q want %q", block.Header.ChainID, p.cfg.Genesis.ChainID)
 	}
 
-	idx := int(block.Header.Height % int64(len(p.cfg.Validators)))
-	expected := p.cfg.Validators[idx]
+	expected := p.ProposerFor(block.Header.Height, block.Header.PrevHash)
 	if block.Header.Proposer != expected {
 		return fmt.Errorf("wrong proposer: got %s want %s", block.Header.Proposer, expected)
 	}
@@ -149,16 +361,37 @@ func (p *PoA) ValidateBlock(block *core.Block) error {
 	if err := block.Verify(pub); err != nil {
 		return fmt.Errorf("block signature invalid: %w", err)
 	}
+	if block.Header.Height >= p.legacyTo {
+		if err := core.RequireChainBound(block.Header.Version); err != nil {
+			return fmt.Errorf("block: %w", err)
+		}
+		for _, tx := range block.Transactions {
+			if err := core.RequireChainBound(tx.Version); err != nil {
+				return fmt.Errorf("tx %s: %w", tx.ID, err)
+			}
+			if err := tx.RequireNamedCosigners(); err != nil {
+				return fmt.Errorf("tx %s: %w", tx.ID, err)
+			}
+		}
+	}
 	// Independently verify TxRoot matches the actual transaction list.
 	if txRoot := core.ComputeTxRoot(block.Transactions); block.Header.TxRoot != txRoot {
 		return fmt.Errorf("tx_root mismatch: got %s want %s", block.Header.TxRoot, txRoot)
 	}
-
-	// (C) Timestamp validation: must not be too far in the future
-	// and must be >= the previous block's timestamp.
-	now := time.Now().UnixNano()
-	if block.Header.Timestamp > now+maxBlockTimeDrift {
-		return fmt.Errorf("block timestamp too far in future: %d (now %d)", block.Header.Timestamp, now)
+	// Reject duplicate transactions up front rather than letting the second
+	// copy fail on its nonce during execution.
+	seen := make(map[string]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if seen[tx.ID] {
+			return fmt.Errorf("duplicate transaction %s in block", tx.ID)
+		}
+		seen[tx.ID] = true
+	}
+	// A sender's transactions must appear in nonce order. Execution would
+	// fail on an out-of-order nonce anyway; rejecting here makes the rule
+	// explicit and independent of how the proposer's own node executed it.
+	if err := core.CheckTxOrder(block.Transactions); err != nil {
+		return err
 	}
 
 	// Validate previous hash linkage
@@ -174,26 +407,52 @@ func (p *PoA) ValidateBlock(block *core.Block) error {
 		if block.Header.Height != tip.Header.Height+1 {
 			return fmt.Errorf("height mismatch: got %d want %d", block.Header.Height, tip.Header.Height+1)
 		}
-		// Timestamp must not go backwards.
+		// Timestamp must not go backwards. Equal timestamps are allowed;
+		// rival blocks for one height that arrive together are ordered by
+		// core.CompareBlocks before either reaches here.
 		if block.Header.Timestamp < tip.Header.Timestamp {
 			return fmt.Errorf("block timestamp %d < previous block %d", block.Header.Timestamp, tip.Header.Timestamp)
 		}
+		if err := p.checkSpacing(tip, block.Header.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	// (C) Timestamp must not be too far in the future. It is checked last so
+	// that a block only slightly ahead of our clock is otherwise valid when
+	// it is reported as a *core.FutureBlockError.
+	now := time.Now().UnixNano()
+	if ahead := time.Duration(block.Header.Timestamp - now); ahead > p.maxDrift {
+		if ahead > p.maxDrift+p.quarantine {
+			return fmt.Errorf("block timestamp too far in future: %d (now %d)", block.Header.Timestamp, now)
+		}
+		return &core.FutureBlockError{Height: block.Header.Height, Wait: ahead - p.maxDrift}
 	}
 	return nil
 }
 
 // Run starts the block-production loop with the given interval. It blocks
-// until done is closed.
+// until done is closed. While the sync status reports the node as behind,
+// no blocks are produced.
 func (p *PoA) Run(interval time.Duration, done <-chan struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	paused := false
 	for {
 		select {
 		case <-done:
 			return
 		case <-ticker.C:
-			if p.IsProposer() {
-				if _, err := p.ProduceBlock(); err != nil {
+			if syncing := p.sync != nil && p.sync.Syncing(); syncing != paused {
+				paused = syncing
+				if paused {
+					log.Printf("[consensus] behind peers at height %d, pausing block production", p.bc.Height())
+				} else {
+					log.Printf("[consensus] caught up at height %d, resuming block production", p.bc.Height())
+				}
+			}
+			if !paused && p.IsProposer() {
+				if _, err := p.ProduceBlock(); err != nil && !errors.Is(err, ErrTooSoon) {
 					log.Printf("[consensus] produce block error: %v", err)
 				}
 			}
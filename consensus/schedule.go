@@ -0,0 +1,48 @@
+package consensus
+
+import (
+	"encoding/binary"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/crypto"
+)
+
+// ProposerSchedule expands vals into a rotation in which each validator
+// appears as many times as its weight. Turns are interleaved with smooth
+// weighted round-robin so a heavy validator's slots are spread across the
+// rotation rather than bunched together. The result depends only on vals
+// and its order, so every node with the same config computes the same
+// schedule; with all weights 1 it is the plain round-robin order.
+func ProposerSchedule(vals []config.Validator) []string {
+	total := 0
+	for _, v := range vals {
+		total += v.Weighted()
+	}
+	schedule := make([]string, 0, total)
+	current := make([]int, len(vals))
+	for len(schedule) < total {
+		best := 0
+		for i, v := range vals {
+			current[i] += v.Weighted()
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		schedule = append(schedule, vals[best].PubKey)
+	}
+	return schedule
+}
+
+// SeededIndex picks a slot in a schedule of n slots for the block at height
+// following prevHash: seed = SHA-256(prevHash || height), index = seed mod
+// n, with the seed's first 8 bytes read big-endian and height encoded as 8
+// big-endian bytes. The result cannot be known before the previous block
+// exists, but any node can recompute it afterwards. n must be positive.
+func SeededIndex(prevHash string, height int64, n int) int {
+	buf := make([]byte, len(prevHash)+8)
+	copy(buf, prevHash)
+	binary.BigEndian.PutUint64(buf[len(prevHash):], uint64(height))
+	seed := binary.BigEndian.Uint64(crypto.HashBytes(buf))
+	return int(seed % uint64(n))
+}
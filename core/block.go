@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/tolelom/tolchain/crypto"
@@ -20,6 +22,39 @@ type BlockHeader struct {
 	TxRoot    string `json:"tx_root"`    // hash of all transaction IDs
 	Timestamp int64  `json:"timestamp"`
 	Proposer  string `json:"proposer"` // proposer's pubkey hex
+	// StateRootVersion is set on the genesis block only: the state root
+	// algorithm the chain uses. 0 → DefaultStateRootVersion.
+	StateRootVersion int `json:"state_root_version,omitempty"`
+	// ParamsHash is set on the genesis block only: the hash of the
+	// consensus parameters the chain was created with.
+	ParamsHash string `json:"params_hash,omitempty"`
+	// Version is the serialization format of the block. 0 is the format
+	// from before versioning, equivalent to version 1.
+	Version int `json:"version,omitempty"`
+}
+
+// BlockVersion is the block serialization format this node produces.
+// Verify and VerifyIntegrity accept it and every earlier version, and
+// reject later ones. Since version 2 the proposer signature is bound to the
+// chain (see SigningMessage).
+const BlockVersion = 2
+
+// State root algorithms. Every node of a chain must compute roots the same
+// way, so a chain fixes its algorithm at genesis and never changes it.
+const (
+	StateRootFlat   = 1 // hash of the length-prefixed, sorted key-value pairs
+	StateRootMerkle = 2 // binary Merkle tree over the sorted key-value pairs
+
+	DefaultStateRootVersion = StateRootMerkle
+)
+
+// StateRootVersionOrDefault maps the unset version 0 to
+// DefaultStateRootVersion.
+func StateRootVersionOrDefault(v int) int {
+	if v == 0 {
+		return DefaultStateRootVersion
+	}
+	return v
 }
 
 // Block is a collection of transactions with a signed header.
@@ -43,22 +78,29 @@ func (b *Block) ComputeHash() string {
 // Sign sets Hash and signs the block with the proposer's private key.
 func (b *Block) Sign(priv crypto.PrivateKey) {
 	b.Hash = b.ComputeHash()
-	b.Signature = crypto.Sign(priv, []byte(b.Hash))
+	b.Signature = crypto.Sign(priv, SigningMessage(b.Header.Version, b.Header.ChainID, b.Hash))
 }
 
-// Verify checks that b.Hash matches the recomputed header hash and that the
-// signature is valid. This prevents accepting blocks whose header was tampered
+// Verify checks the version, that b.Hash matches the recomputed header hash
+// and that the signature is valid. This prevents accepting blocks whose header was tampered
 // with after signing.
 func (b *Block) Verify(pub crypto.PublicKey) error {
+	if err := checkVersion(b.Header.Version, BlockVersion); err != nil {
+		return err
+	}
 	if computed := b.ComputeHash(); b.Hash != computed {
 		return fmt.Errorf("block hash mismatch: stored %s computed %s", b.Hash, computed)
 	}
-	return crypto.Verify(pub, []byte(b.Hash), b.Signature)
+	return crypto.Verify(pub, SigningMessage(b.Header.Version, b.Header.ChainID, b.Hash), b.Signature)
 }
 
 // VerifyIntegrity checks the structural integrity of a block independently of
-// the proposer signature: hash consistency and TxRoot correctness.
+// the proposer signature: a known version, hash consistency and TxRoot
+// correctness.
 func (b *Block) VerifyIntegrity() error {
+	if err := checkVersion(b.Header.Version, BlockVersion); err != nil {
+		return err
+	}
 	if computed := b.ComputeHash(); b.Hash != computed {
 		return fmt.Errorf("block hash mismatch: stored %s computed %s", b.Hash, computed)
 	}
@@ -86,6 +128,67 @@ func ComputeTxRoot(txs []*Transaction) string {
 	return crypto.Hash(buf.Bytes())
 }
 
+// ErrTxOrder is returned by CheckTxOrder for a block in which a sender's
+// transactions are not in ascending nonce order.
+var ErrTxOrder = errors.New("transactions out of nonce order")
+
+// CheckTxOrder verifies that txs are in canonical order: the transactions
+// of each sender appear with strictly ascending nonces. Transactions of
+// different senders may interleave freely.
+func CheckTxOrder(txs []*Transaction) error {
+	last := make(map[string]uint64)
+	for _, tx := range txs {
+		if prev, ok := last[tx.From]; ok && tx.Nonce <= prev {
+			return fmt.Errorf("%w: sender %s nonce %d after %d", ErrTxOrder, tx.From, tx.Nonce, prev)
+		}
+		last[tx.From] = tx.Nonce
+	}
+	return nil
+}
+
+// SortTxsByNonce puts txs in place into the order CheckTxOrder expects.
+// Each sender's transactions are sorted by nonce within the positions they
+// already occupy, so the interleaving of senders is kept.
+func SortTxsByNonce(txs []*Transaction) {
+	slots := make(map[string][]int)
+	for i, tx := range txs {
+		slots[tx.From] = append(slots[tx.From], i)
+	}
+	for _, idx := range slots {
+		if len(idx) < 2 {
+			continue
+		}
+		own := make([]*Transaction, len(idx))
+		for k, i := range idx {
+			own[k] = txs[i]
+		}
+		sort.SliceStable(own, func(a, b int) bool { return own[a].Nonce < own[b].Nonce })
+		for k, i := range idx {
+			txs[i] = own[k]
+		}
+	}
+}
+
+// CompareBlocks orders two candidate blocks for the same height: the earlier
+// timestamp wins, and for equal timestamps the lexicographically smaller
+// hash wins. It returns a negative number when a is preferred, positive when
+// b is preferred, and 0 only for the same block. It only decides between
+// candidates a node holds at once, before committing either, such as the
+// blocks of one sync response; nodes given the same set then pick the same
+// block whatever its order. It is not a chain-wide fork-choice rule: a
+// committed block is final, so a rival arriving later is never adopted even
+// when preferred (see AddBlock), and nodes that committed different rivals
+// stay split. Rivals need the height's proposer to sign two blocks.
+func CompareBlocks(a, b *Block) int {
+	if a.Header.Timestamp != b.Header.Timestamp {
+		if a.Header.Timestamp < b.Header.Timestamp {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Hash, b.Hash)
+}
+
 // NewBlock creates an unsigned block with the given parameters.
 func NewBlock(chainID string, height int64, prevHash, proposer string, txs []*Transaction) *Block {
 	return &Block{
@@ -96,6 +199,7 @@ func NewBlock(chainID string, height int64, prevHash, proposer string, txs []*Tr
 			TxRoot:    ComputeTxRoot(txs),
 			Timestamp: time.Now().UnixNano(),
 			Proposer:  proposer,
+			Version:   BlockVersion,
 		},
 		Transactions: txs,
 	}
@@ -4,11 +4,36 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
 // ErrNotFound is returned when a requested object does not exist in storage.
 var ErrNotFound = errors.New("not found")
 
+// ErrChainIDMismatch is returned by VerifyChainID when the stored chain was
+// created for a different network.
+var ErrChainIDMismatch = errors.New("chain ID mismatch")
+
+// ErrStateRootVersionMismatch is returned by VerifyStateRootVersion when the
+// stored chain uses a different state root algorithm.
+var ErrStateRootVersionMismatch = errors.New("state root version mismatch")
+
+// ErrParamsMismatch is returned by VerifyParamsHash when the stored chain
+// was created with different consensus parameters.
+var ErrParamsMismatch = errors.New("consensus params mismatch")
+
+// FutureBlockError is returned by block validation when a block's timestamp
+// is ahead of the local clock by more than the allowed drift but close
+// enough that the block may become valid once Wait has elapsed.
+type FutureBlockError struct {
+	Height int64
+	Wait   time.Duration
+}
+
+func (e *FutureBlockError) Error() string {
+	return fmt.Sprintf("block %d timestamp is in the future; valid in %s", e.Height, e.Wait)
+}
+
 // BlockStore is the persistence interface used by Blockchain.
 // Implementations live in the storage package.
 type BlockStore interface {
@@ -59,6 +84,64 @@ func (bc *Blockchain) Init() error {
 	return nil
 }
 
+// VerifyChainID checks that the stored genesis block was created for
+// chainID. A fresh chain trivially matches. Call it after Init so a node
+// pointed at another network's data refuses to start instead of failing
+// later on every peer block and transaction.
+func (bc *Blockchain) VerifyChainID(chainID string) error {
+	if bc.Tip() == nil {
+		return nil
+	}
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return fmt.Errorf("load genesis block: %w", err)
+	}
+	if genesis.Header.ChainID != chainID {
+		return fmt.Errorf("%w: stored chain is %q, configured chain_id is %q",
+			ErrChainIDMismatch, genesis.Header.ChainID, chainID)
+	}
+	return nil
+}
+
+// VerifyStateRootVersion checks that the stored genesis block records the
+// state root algorithm version; 0 on either side means
+// DefaultStateRootVersion. A fresh chain trivially matches. A node computing
+// roots differently from its chain would reject every block it syncs.
+func (bc *Blockchain) VerifyStateRootVersion(version int) error {
+	if bc.Tip() == nil {
+		return nil
+	}
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return fmt.Errorf("load genesis block: %w", err)
+	}
+	stored := StateRootVersionOrDefault(genesis.Header.StateRootVersion)
+	if want := StateRootVersionOrDefault(version); stored != want {
+		return fmt.Errorf("%w: stored chain uses version %d, configured state_root_version is %d",
+			ErrStateRootVersionMismatch, stored, want)
+	}
+	return nil
+}
+
+// VerifyParamsHash checks that the stored genesis block records the given
+// consensus parameters hash. A fresh chain trivially matches, as does a
+// genesis block from before the hash was recorded. A node executing with
+// other parameters would compute other state roots than its chain.
+func (bc *Blockchain) VerifyParamsHash(hash string) error {
+	if bc.Tip() == nil {
+		return nil
+	}
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return fmt.Errorf("load genesis block: %w", err)
+	}
+	if stored := genesis.Header.ParamsHash; stored != "" && stored != hash {
+		return fmt.Errorf("%w: stored chain has params hash %s, configured params hash is %s",
+			ErrParamsMismatch, stored, hash)
+	}
+	return nil
+}
+
 // AddBlock validates height continuity and PrevHash linkage, then persists the
 // block and advances the tip. Only the next sequential block is accepted;
 // blocks at the current or lower height are rejected to prevent forks.
@@ -101,6 +184,38 @@ func (bc *Blockchain) GetBlockByHeight(height int64) (*Block, error) {
 	return bc.store.GetBlockByHeight(height)
 }
 
+// ErrStopIteration may be returned by an IterateBlocks callback to stop
+// early without IterateBlocks reporting an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// IterateBlocks calls fn with each block from height from to height to,
+// inclusive, in order. to is capped at the tip height read when iteration
+// starts; a negative to means the tip. Iteration stops at the first error
+// from loading a block or from fn, which is returned, except that
+// ErrStopIteration ends it with a nil error. fn may call other Blockchain
+// methods.
+func (bc *Blockchain) IterateBlocks(from, to int64, fn func(*Block) error) error {
+	if tip := bc.Height(); to < 0 || to > tip {
+		to = tip
+	}
+	if bc.Tip() == nil {
+		return nil
+	}
+	for h := max(from, 0); h <= to; h++ {
+		block, err := bc.GetBlockByHeight(h)
+		if err != nil {
+			return fmt.Errorf("load block %d: %w", h, err)
+		}
+		if err := fn(block); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
 // Tip returns the current chain tip, or nil for a fresh chain.
 func (bc *Blockchain) Tip() *Block {
 	bc.mu.RLock()
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"errors"
+	"sync"
+)
+
+// Errors returned by Intake.Submit.
+var (
+	ErrIntakeFull   = errors.New("mempool intake queue full")
+	ErrIntakeClosed = errors.New("mempool intake closed")
+)
+
+// Intake is a bounded queue in front of a Mempool. Submit enqueues a
+// transaction without verifying it, and a fixed pool of workers drains the
+// queue through Mempool.Add, so signature checks run in parallel and a
+// burst waits in the queue instead of being verified on the caller's
+// goroutine. The queue is held in memory only.
+type Intake struct {
+	pool  *Mempool
+	queue chan intakeItem
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type intakeItem struct {
+	tx   *Transaction
+	done func(error)
+}
+
+// NewIntake creates an intake of the given queue depth feeding pool and
+// starts its workers. Non-positive depth or workers are treated as 1.
+func NewIntake(pool *Mempool, depth, workers int) *Intake {
+	in := &Intake{pool: pool, queue: make(chan intakeItem, max(depth, 1))}
+	for range max(workers, 1) {
+		in.wg.Add(1)
+		go in.work()
+	}
+	return in
+}
+
+func (in *Intake) work() {
+	defer in.wg.Done()
+	for item := range in.queue {
+		err := in.pool.Add(item.tx)
+		if item.done != nil {
+			item.done(err)
+		}
+	}
+}
+
+// Submit queues tx for admission to the mempool without blocking. done, if
+// non-nil, is called from a worker with Mempool.Add's result. Submit
+// returns ErrIntakeFull when the queue is at capacity and ErrIntakeClosed
+// after Close; done is not called in either case. Every transaction Submit
+// accepts is eventually passed to Mempool.Add.
+func (in *Intake) Submit(tx *Transaction, done func(error)) error {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.closed {
+		return ErrIntakeClosed
+	}
+	select {
+	case in.queue <- intakeItem{tx: tx, done: done}:
+		return nil
+	default:
+		return ErrIntakeFull
+	}
+}
+
+// Len returns the number of transactions waiting in the queue.
+func (in *Intake) Len() int {
+	return len(in.queue)
+}
+
+// Close stops accepting transactions and waits for the workers to drain
+// the queue. It is safe to call more than once.
+func (in *Intake) Close() {
+	in.mu.Lock()
+	if !in.closed {
+		in.closed = true
+		close(in.queue)
+	}
+	in.mu.Unlock()
+	in.wg.Wait()
+}
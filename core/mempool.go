@@ -3,10 +3,40 @@ package core
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
 
+// DefaultMaxTxsPerAccount is the default cap on pending transactions from
+// one sender.
+const DefaultMaxTxsPerAccount = 64
+
+// DefaultMaxValidFromAhead is the default bound on how many blocks past the
+// next one a transaction's ValidFrom may lie for the pool to accept it.
+const DefaultMaxValidFromAhead = 1000
+
+// ErrAccountTxLimit is returned by Add when the sender already has the
+// maximum number of pending transactions.
+var ErrAccountTxLimit = errors.New("too many pending transactions for account")
+
+// Admission failures returned by Add besides signature errors and
+// ErrAccountTxLimit, so callers can classify them with errors.Is. Besides
+// these, a transaction signed in a version before DomainSeparatedVersion is
+// refused with ErrLegacySignature, and one carrying cosignatures without
+// naming its cosigners with ErrUnnamedCosigners. A transaction refused by
+// the validator installed with SetValidator is reported as ErrTxRejected
+// wrapping the validator's error.
+var (
+	ErrTxExpired   = errors.New("transaction expired")
+	ErrTxFuture    = errors.New("transaction timestamp too far in the future")
+	ErrTxRejected  = errors.New("transaction rejected")
+	ErrMempoolFull = errors.New("mempool full")
+	ErrTxKnown     = errors.New("tx already in pool")
+	ErrTxTooEarly  = errors.New("transaction valid_from too far ahead of the chain")
+)
+
 const (
 	maxMempoolSize = 10_000
 	maxTxAge       = int64(time.Hour)          // reject txs older than 1 hour
@@ -16,38 +46,134 @@ const (
 // Mempool is a thread-safe pending-transaction pool.
 type Mempool struct {
 	mu  sync.RWMutex
-	txs map[string]*Transaction
-	ord []string // insertion-ordered IDs for deterministic pending iteration
+	txs   map[string]*Transaction
+	ord   []string             // insertion-ordered IDs for deterministic pending iteration
+	added map[string]time.Time // ID → wall-clock admission time
+
+	byFrom        map[string]int // sender → number of pending txs
+	maxPerAccount int
+	maxAhead      int64 // blocks past the next one a ValidFrom may lie
+
+	validate func(*Transaction) error // optional admission policy; nil → none
+	height   func() int64             // chain tip height; nil → nothing is held
 }
 
 // NewMempool creates an empty mempool.
 func NewMempool() *Mempool {
-	return &Mempool{txs: make(map[string]*Transaction)}
+	return &Mempool{
+		txs:           make(map[string]*Transaction),
+		added:         make(map[string]time.Time),
+		byFrom:        make(map[string]int),
+		maxPerAccount: DefaultMaxTxsPerAccount,
+		maxAhead:      DefaultMaxValidFromAhead,
+	}
+}
+
+// SetMaxPerAccount caps how many pending transactions a single sender may
+// have in the pool, so one account cannot crowd out the rest. n <= 0 keeps
+// the current limit.
+func (m *Mempool) SetMaxPerAccount(n int) {
+	if n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxPerAccount = n
+}
+
+// SetValidator installs an admission check run by Add after the signature
+// check, so transactions the node would refuse to execute (e.g. of a
+// disabled type) are rejected before entering the pool.
+func (m *Mempool) SetValidator(fn func(*Transaction) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validate = fn
+}
+
+// SetChainHeight tells the pool how to read the chain's tip height, so
+// that Pending holds back time-locked transactions (Transaction.ValidFrom)
+// until the next block may include them.
+func (m *Mempool) SetChainHeight(fn func() int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.height = fn
+}
+
+// SetMaxValidFromAhead bounds how many blocks past the next one a
+// transaction's ValidFrom may lie, so that the pool does not fill with
+// transactions that will not be includable for a long time. It has no
+// effect without SetChainHeight. n <= 0 keeps the current bound.
+func (m *Mempool) SetMaxValidFromAhead(n int64) {
+	if n <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxAhead = n
+}
+
+// nextHeight returns the height of the next block, or math.MaxInt64 when
+// the chain height is unknown so that nothing is held.
+func (m *Mempool) nextHeight() int64 {
+	if m.height == nil {
+		return math.MaxInt64
+	}
+	return m.height() + 1
 }
 
 // Add validates and inserts a transaction. Returns an error if the pool is
-// full, the tx is already present, the signature is invalid, or the timestamp
-// is out of the acceptable window (±1 h / +5 min).
+// full (ErrMempoolFull), the tx is already present (ErrTxKnown), the sender
+// is at its pending limit (ErrAccountTxLimit), the signature is invalid,
+// the signature is not bound to the chain (ErrLegacySignature), the
+// cosigners are not named (ErrUnnamedCosigners),
+// the validator refuses it (ErrTxRejected), the timestamp is out of the
+// acceptable window of 1 h back (ErrTxExpired) and 5 min ahead (ErrTxFuture),
+// or ValidFrom lies too far past the next block (ErrTxTooEarly). When the
+// pool or the sender is full, held transactions (see Held) whose timestamp
+// has aged past the 1 h window are evicted first to make room.
 func (m *Mempool) Add(tx *Transaction) error {
 	if err := tx.Verify(); err != nil {
 		return fmt.Errorf("invalid tx signature: %w", err)
 	}
+	if err := RequireChainBound(tx.Version); err != nil {
+		return err
+	}
+	if err := tx.RequireNamedCosigners(); err != nil {
+		return err
+	}
 	now := time.Now().UnixNano()
 	if now > tx.Timestamp && now-tx.Timestamp > maxTxAge {
-		return errors.New("transaction expired")
+		return ErrTxExpired
 	}
 	if tx.Timestamp > now && tx.Timestamp-now > maxTxFuture {
-		return errors.New("transaction timestamp too far in the future")
+		return ErrTxFuture
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.validate != nil {
+		if err := m.validate(tx); err != nil {
+			return fmt.Errorf("%w: %w", ErrTxRejected, err)
+		}
+	}
+	next := m.nextHeight()
+	if m.height != nil && tx.ValidFrom > next+m.maxAhead {
+		return fmt.Errorf("%w: %d, next block %d, limit %d ahead", ErrTxTooEarly, tx.ValidFrom, next, m.maxAhead)
+	}
+	if len(m.txs) >= maxMempoolSize || m.byFrom[tx.From] >= m.maxPerAccount {
+		m.evictStaleHeld(now, next)
+	}
 	if len(m.txs) >= maxMempoolSize {
-		return errors.New("mempool full")
+		return ErrMempoolFull
 	}
 	if _, exists := m.txs[tx.ID]; exists {
-		return errors.New("tx already in pool")
+		return ErrTxKnown
+	}
+	if m.byFrom[tx.From] >= m.maxPerAccount {
+		return fmt.Errorf("%w: %s has %d", ErrAccountTxLimit, tx.From, m.maxPerAccount)
 	}
 	m.txs[tx.ID] = tx
+	m.added[tx.ID] = time.Now()
+	m.byFrom[tx.From]++
 	m.ord = append(m.ord, tx.ID)
 	return nil
 }
@@ -60,29 +186,166 @@ func (m *Mempool) Get(id string) (*Transaction, bool) {
 	return tx, ok
 }
 
-// Pending returns up to n pending transactions in insertion order.
+// PendingTx is a pending transaction with the time the mempool admitted it.
+type PendingTx struct {
+	Tx    *Transaction
+	Since time.Time
+}
+
+// PendingSince returns the time the transaction with the given ID was
+// admitted, and false if it is not pending.
+func (m *Mempool) PendingSince(id string) (time.Time, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.added[id]
+	return t, ok
+}
+
+// Entries returns pending transactions with their admission times, oldest
+// first, skipping the first offset and returning at most limit
+// (limit <= 0 → all).
+func (m *Mempool) Entries(offset, limit int) []PendingTx {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []PendingTx
+	for _, id := range m.ord {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		result = append(result, PendingTx{Tx: m.txs[id], Since: m.added[id]})
+	}
+	return result
+}
+
+// Stuck returns the transactions that have been pending for at least
+// threshold, oldest first. They are still within maxTxAge but not being
+// included, e.g. because of a nonce gap or a fee too low to be picked.
+func (m *Mempool) Stuck(threshold time.Duration) []PendingTx {
+	cutoff := time.Now().Add(-threshold)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var result []PendingTx
+	for _, id := range m.ord {
+		since := m.added[id]
+		if since.After(cutoff) {
+			break // ord is in admission order
+		}
+		result = append(result, PendingTx{Tx: m.txs[id], Since: since})
+	}
+	return result
+}
+
+// Pending returns up to n transactions eligible for the next block, in
+// insertion order. A transaction held for its ValidFrom height is left
+// out, and so are its sender's transactions of a later nonce, which could
+// not execute before it.
 func (m *Mempool) Pending(n int) []*Transaction {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	next := m.nextHeight()
+	blocked := make(map[string]uint64) // sender → lowest held nonce
+	for _, tx := range m.txs {
+		if !tx.EligibleAt(next) {
+			if low, ok := blocked[tx.From]; !ok || tx.Nonce < low {
+				blocked[tx.From] = tx.Nonce
+			}
+		}
+	}
 	result := make([]*Transaction, 0, n)
 	for _, id := range m.ord {
-		if tx, ok := m.txs[id]; ok {
-			result = append(result, tx)
-			if len(result) >= n {
-				break
-			}
+		tx, ok := m.txs[id]
+		if !ok {
+			continue
+		}
+		if low, held := blocked[tx.From]; held && tx.Nonce >= low {
+			continue
+		}
+		result = append(result, tx)
+		if len(result) >= n {
+			break
 		}
 	}
 	return result
 }
 
-// Remove deletes transactions by ID (called after block commit).
+// Held returns the transactions that are not yet eligible for the next
+// block because of their ValidFrom height, in insertion order. They stay
+// in the pool, counted by Size, until the chain reaches them.
+func (m *Mempool) Held() []PendingTx {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	next := m.nextHeight()
+	var result []PendingTx
+	for _, id := range m.ord {
+		if tx := m.txs[id]; !tx.EligibleAt(next) {
+			result = append(result, PendingTx{Tx: tx, Since: m.added[id]})
+		}
+	}
+	return result
+}
+
+// evictStaleHeld removes the transactions held for a ValidFrom past next
+// whose timestamp is older than maxTxAge: they would no longer be admitted,
+// and may otherwise occupy the pool indefinitely. Callers must hold mu.
+func (m *Mempool) evictStaleHeld(now, next int64) {
+	var stale []string
+	for _, id := range m.ord {
+		tx := m.txs[id]
+		if !tx.EligibleAt(next) && now-tx.Timestamp > maxTxAge {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		m.remove(stale)
+	}
+}
+
+// Remove deletes transactions by ID, e.g. one that failed execution.
 func (m *Mempool) Remove(ids []string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.remove(ids)
+}
+
+// RemoveMined deletes the transactions of a committed block, and every
+// pending transaction of their senders at a nonce the block used up, which
+// could no longer execute (e.g. a replacement of a mined transaction).
+func (m *Mempool) RemoveMined(txs []*Transaction) {
+	next := make(map[string]uint64, len(txs)) // sender → first unused nonce
+	ids := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+		if tx.Nonce >= next[tx.From] {
+			next[tx.From] = tx.Nonce + 1
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, tx := range m.txs {
+		if n, ok := next[tx.From]; ok && tx.Nonce < n {
+			ids = append(ids, id)
+		}
+	}
+	m.remove(ids)
+}
+
+// remove deletes transactions by ID. Callers must hold mu.
+func (m *Mempool) remove(ids []string) {
 	removed := make(map[string]bool, len(ids))
 	for _, id := range ids {
+		tx, ok := m.txs[id]
+		if !ok {
+			continue
+		}
 		delete(m.txs, id)
+		delete(m.added, id)
+		if m.byFrom[tx.From]--; m.byFrom[tx.From] <= 0 {
+			delete(m.byFrom, tx.From)
+		}
 		removed[id] = true
 	}
 	filtered := m.ord[:0]
@@ -94,6 +357,48 @@ func (m *Mempool) Remove(ids []string) {
 	m.ord = filtered
 }
 
+// Fees returns the fees of all pending transactions in ascending order.
+func (m *Mempool) Fees() []uint64 {
+	m.mu.RLock()
+	fees := make([]uint64, 0, len(m.txs))
+	for _, tx := range m.txs {
+		fees = append(fees, tx.Fee)
+	}
+	m.mu.RUnlock()
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+	return fees
+}
+
+// PendingFrom returns the number of pending transactions sent by from.
+func (m *Mempool) PendingFrom(from string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.byFrom[from]
+}
+
+// NextNonce returns the nonce from should use for its next transaction:
+// committed (the account's nonce in committed state) advanced past every
+// consecutive pending nonce. Counting stops at the first gap, since a
+// transaction after a gap cannot execute until the gap is filled.
+func (m *Mempool) NextNonce(from string, committed uint64) uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.byFrom[from] == 0 {
+		return committed
+	}
+	nonces := make(map[uint64]bool, m.byFrom[from])
+	for _, tx := range m.txs {
+		if tx.From == from {
+			nonces[tx.Nonce] = true
+		}
+	}
+	next := committed
+	for nonces[next] {
+		next++
+	}
+	return next
+}
+
 // Size returns the current number of pending transactions.
 func (m *Mempool) Size() int {
 	m.mu.RLock()
@@ -1,11 +1,35 @@
 package core
 
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
 // Account holds a participant's token balance and replay-protection nonce.
 // Address is the hex-encoded ed25519 public key.
 type Account struct {
 	Address string `json:"address"` // pubkey hex
 	Balance uint64 `json:"balance"`
 	Nonce   uint64 `json:"nonce"`
+
+	// IdempotencyKeys holds the idempotency keys of the account's most
+	// recent keyed transactions, oldest first, up to the chain's limit.
+	IdempotencyKeys []string `json:"idempotency_keys,omitempty"`
+}
+
+// HasIdempotencyKey reports whether key is among the account's recent
+// idempotency keys.
+func (a *Account) HasIdempotencyKey(key string) bool {
+	return slices.Contains(a.IdempotencyKeys, key)
+}
+
+// AddIdempotencyKey records key, dropping the oldest keys beyond limit.
+func (a *Account) AddIdempotencyKey(key string, limit int) {
+	a.IdempotencyKeys = append(a.IdempotencyKeys, key)
+	if over := len(a.IdempotencyKeys) - limit; over > 0 {
+		a.IdempotencyKeys = slices.Clone(a.IdempotencyKeys[over:])
+	}
 }
 
 // Asset is a universal game asset: item, card, character, etc.
@@ -18,6 +42,48 @@ type Asset struct {
 	Tradeable       bool           `json:"tradeable"`
 	MintedAt        int64          `json:"minted_at"`
 	ActiveListingID string         `json:"active_listing_id,omitempty"` // non-empty while listed
+	LockedBy        string         `json:"locked_by,omitempty"`         // lock holder pubkey hex; empty → unlocked
+	LockExpiry      int64          `json:"lock_expiry,omitempty"`       // block timestamp (unix nano) the lock lapses at
+	Burned          bool           `json:"burned,omitempty"`            // tombstone of a burned asset; Owner is empty
+	BurnedAt        int64          `json:"burned_at,omitempty"`         // block timestamp of the burn
+	// LastTransferHeight is the height of the block that last changed the
+	// owner; 0 → never transferred.
+	LastTransferHeight int64 `json:"last_transfer_height,omitempty"`
+}
+
+// IsLocked reports whether the asset is held under an unexpired lock at
+// block time now. Locks lapse automatically once now reaches LockExpiry.
+func (a *Asset) IsLocked(now int64) bool {
+	return a.LockedBy != "" && now < a.LockExpiry
+}
+
+// CheckMovable returns an error if the asset is encumbered at block time
+// now — listed on the market or locked — or burned, and so may not be
+// transferred, listed, locked or burned.
+func (a *Asset) CheckMovable(now int64) error {
+	if a.Burned {
+		return fmt.Errorf("asset %q was burned", a.ID)
+	}
+	if a.ActiveListingID != "" {
+		return fmt.Errorf("asset %q has an active listing (%s)", a.ID, a.ActiveListingID)
+	}
+	if a.IsLocked(now) {
+		return fmt.Errorf("asset %q is locked by %s until %d", a.ID, a.LockedBy, a.LockExpiry)
+	}
+	return nil
+}
+
+// CheckCooldown returns an error if the asset, of template t, was
+// transferred fewer than t.TransferCooldownBlocks blocks before height and
+// so may not be transferred or listed yet.
+func (a *Asset) CheckCooldown(t *AssetTemplate, height int64) error {
+	if t.TransferCooldownBlocks <= 0 || a.LastTransferHeight == 0 {
+		return nil
+	}
+	if until := a.LastTransferHeight + t.TransferCooldownBlocks; height < until {
+		return fmt.Errorf("asset %q is in its transfer cooldown until block %d", a.ID, until)
+	}
+	return nil
 }
 
 // AssetTemplate defines the schema and rules for a class of assets.
@@ -27,6 +93,9 @@ type AssetTemplate struct {
 	Schema    map[string]any `json:"schema"` // property key → type hint
 	Tradeable bool           `json:"tradeable"`
 	Creator   string         `json:"creator"` // pubkey hex of registrant
+	// TransferCooldownBlocks is how many blocks after a transfer an asset
+	// of this template may not be transferred or listed again; 0 → none.
+	TransferCooldownBlocks int64 `json:"transfer_cooldown_blocks,omitempty"`
 }
 
 // Session represents an active or completed game match.
@@ -52,36 +121,116 @@ type MarketListing struct {
 	CreatedAt int64  `json:"created_at"`
 }
 
-// State is the full blockchain state interface. Implementations must be
-// snapshot-able so the executor can roll back failed transactions.
-type State interface {
+// VestingTranche is one installment of a vesting schedule. It matures once
+// the block height reaches Height and the block timestamp reaches
+// Timestamp; a zero field places no constraint.
+type VestingTranche struct {
+	Height    int64  `json:"height,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"` // block timestamp (unix nano)
+	Amount    uint64 `json:"amount"`
+}
+
+// Matured reports whether the tranche is releasable in a block at height
+// with timestamp now.
+func (t VestingTranche) Matured(height, now int64) bool {
+	return height >= t.Height && now >= t.Timestamp
+}
+
+// Vesting holds tokens locked by a scheduled transfer until its tranches
+// mature and are claimed by the recipient.
+type Vesting struct {
+	ID        string           `json:"id"`
+	From      string           `json:"from"` // pubkey hex of the funder
+	To        string           `json:"to"`   // pubkey hex of the recipient
+	Tranches  []VestingTranche `json:"tranches"`
+	Claimed   uint64           `json:"claimed"` // total already released
+	CreatedAt int64            `json:"created_at"`
+}
+
+// Total returns the sum of all tranche amounts.
+func (v *Vesting) Total() uint64 {
+	var total uint64
+	for _, t := range v.Tranches {
+		total += t.Amount
+	}
+	return total
+}
+
+// Claimable returns the matured amount not yet claimed in a block at
+// height with timestamp now.
+func (v *Vesting) Claimable(height, now int64) uint64 {
+	var matured uint64
+	for _, t := range v.Tranches {
+		if t.Matured(height, now) {
+			matured += t.Amount
+		}
+	}
+	return matured - v.Claimed
+}
+
+// CustomRecord is the data of a custom transaction, stored under the ID of
+// the transaction that carried it once it passed its schema.
+type CustomRecord struct {
+	ID        string          `json:"id"` // transaction ID
+	Schema    string          `json:"schema"`
+	From      string          `json:"from"` // pubkey hex of the sender
+	Data      json.RawMessage `json:"data"`
+	CreatedAt int64           `json:"created_at"`
+}
+
+// ValidatorBond holds the tokens a validator locked at genesis. They are
+// taken out of its balance and stay locked; a later slashing rule can
+// reduce them.
+type ValidatorBond struct {
+	Validator string `json:"validator"` // pubkey hex
+	Amount    uint64 `json:"amount"`
+}
+
+// StateReader is the read-only subset of State.
+type StateReader interface {
 	// Accounts
+	// GetAccount returns a zero-value account for unknown addresses;
+	// use HasAccount to tell whether one was ever stored.
 	GetAccount(address string) (*Account, error)
-	SetAccount(account *Account) error
+	HasAccount(address string) (bool, error)
 
-	// Assets
 	GetAsset(id string) (*Asset, error)
+	GetTemplate(id string) (*AssetTemplate, error)
+	GetSession(id string) (*Session, error)
+	GetListing(id string) (*MarketListing, error)
+	GetVesting(id string) (*Vesting, error)
+	GetCustomRecord(id string) (*CustomRecord, error)
+	GetValidatorBond(validator string) (*ValidatorBond, error)
+
+	// GetTotalSupply returns the number of tokens in existence: the genesis
+	// allocation plus block rewards minus burns. 0 if never set.
+	GetTotalSupply() (uint64, error)
+}
+
+// State is the full blockchain state interface. Implementations must be
+// snapshot-able so the executor can roll back failed transactions.
+type State interface {
+	StateReader
+
+	// Writes
+	SetAccount(account *Account) error
 	SetAsset(asset *Asset) error
 	DeleteAsset(id string) error
-
-	// Templates
-	GetTemplate(id string) (*AssetTemplate, error)
 	SetTemplate(t *AssetTemplate) error
-
-	// Sessions
-	GetSession(id string) (*Session, error)
 	SetSession(s *Session) error
-
-	// Market
-	GetListing(id string) (*MarketListing, error)
 	SetListing(l *MarketListing) error
+	SetVesting(v *Vesting) error
+	SetCustomRecord(r *CustomRecord) error
+	SetValidatorBond(b *ValidatorBond) error
+	SetTotalSupply(supply uint64) error
 
 	// Snapshot / rollback / commit
 	Snapshot() (int, error)
 	RevertToSnapshot(id int) error
 	// ComputeRoot returns the deterministic state root from the current write
-	// buffer without flushing. Call this before signing a block.
-	ComputeRoot() string
+	// buffer without flushing. Call this before signing a block. It fails if
+	// the persisted state cannot be read in full.
+	ComputeRoot() (string, error)
 	// Commit flushes the write buffer to the underlying DB and clears it.
 	// Always call ComputeRoot() first to obtain the root for the block header.
 	Commit() error
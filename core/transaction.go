@@ -13,21 +13,31 @@ import (
 type TxType string
 
 const (
-	TxTransfer         TxType = "transfer"
-	TxMintAsset        TxType = "mint_asset"
-	TxBurnAsset        TxType = "burn_asset"
-	TxTransferAsset    TxType = "transfer_asset"
-	TxRegisterTemplate TxType = "register_template"
-	TxSessionOpen      TxType = "session_open"
-	TxSessionResult    TxType = "session_result"
-	TxListMarket       TxType = "list_market"
-	TxBuyMarket        TxType = "buy_market"
+	TxTransfer           TxType = "transfer"
+	TxMintAsset          TxType = "mint_asset"
+	TxBurnAsset          TxType = "burn_asset"
+	TxTransferAsset      TxType = "transfer_asset"
+	TxRegisterTemplate   TxType = "register_template"
+	TxSessionOpen        TxType = "session_open"
+	TxSessionResult      TxType = "session_result"
+	TxListMarket         TxType = "list_market"
+	TxBuyMarket          TxType = "buy_market"
+	TxLockAsset          TxType = "lock_asset"
+	TxUnlockAsset        TxType = "unlock_asset"
+	TxBatchTransferAsset TxType = "batch_transfer_asset"
+	TxScheduleTransfer   TxType = "schedule_transfer"
+	TxClaimVested        TxType = "claim_vested"
+	TxDirectPurchase     TxType = "direct_purchase"
+	TxCustom             TxType = "custom"
+	TxBatch              TxType = "batch"
 )
 
 // Transaction is the atomic unit of work on the chain.
 // From holds the sender's full hex-encoded ed25519 public key (64 chars).
 // ChainID prevents replay of this transaction on a different network.
-// Signature covers all fields except Signature itself.
+// Signature covers all fields except Signature, FeePayerSignature and
+// Cosignatures. Those are bound to the ID all the same: FeePayer and
+// Cosigners, which are covered, name whose signatures must be present.
 type Transaction struct {
 	ID        string          `json:"id"`
 	ChainID   string          `json:"chain_id"` // must match the receiving node's chain ID
@@ -38,30 +48,133 @@ type Transaction struct {
 	Timestamp int64           `json:"timestamp"`
 	Payload   json.RawMessage `json:"payload"`
 	Signature string          `json:"signature"`
+
+	// Version is the serialization format of the transaction, covered by
+	// the signature. 0 is the format from before versioning, equivalent
+	// to version 1.
+	Version int `json:"version,omitempty"`
+
+	// IdempotencyKey optionally names the logical operation the sender
+	// means to perform once, and is covered by the signature. Execution
+	// rejects a transaction whose key the sender used in one of its recent
+	// transactions, whatever the nonce (see Account.IdempotencyKeys).
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	// ValidFrom optionally time-locks the transaction: it may only be
+	// included in a block at this height or later. It is covered by the
+	// signature; 0 means no lock. The mempool holds an early transaction
+	// (see Mempool.Held) rather than offering it for inclusion.
+	ValidFrom int64 `json:"valid_from,omitempty"`
+
+	// Fee delegation: when FeePayer is set, that account pays the fee
+	// instead of From and co-signs the transaction hash.
+	FeePayer          string `json:"fee_payer,omitempty"` // hex-encoded ed25519 public key
+	FeePayerSignature string `json:"fee_payer_signature,omitempty"`
+
+	// Cosignatures holds additional approvals of the transaction hash,
+	// keyed by signer pubkey hex, for operations that need the consent of
+	// parties other than From (e.g. the seller of a direct_purchase).
+	// Cosigners names the signers, and is covered by the signature, so
+	// that a cosignature cannot be stripped or added in transit without
+	// the transaction failing Verify. Transactions from before Cosigners
+	// carry cosignatures without naming them (see RequireNamedCosigners).
+	Cosignatures map[string]string `json:"cosignatures,omitempty"`
+	Cosigners    []string          `json:"cosigners,omitempty"`
 }
 
 // signingBody holds the fields that are covered by the signature.
 type signingBody struct {
-	ChainID   string          `json:"chain_id"`
-	Type      TxType          `json:"type"`
-	From      string          `json:"from"`
-	Nonce     uint64          `json:"nonce"`
-	Fee       uint64          `json:"fee"`
-	Timestamp int64           `json:"timestamp"`
-	Payload   json.RawMessage `json:"payload"`
+	ChainID        string          `json:"chain_id"`
+	Type           TxType          `json:"type"`
+	From           string          `json:"from"`
+	Nonce          uint64          `json:"nonce"`
+	Fee            uint64          `json:"fee"`
+	Timestamp      int64           `json:"timestamp"`
+	Payload        json.RawMessage `json:"payload"`
+	FeePayer       string          `json:"fee_payer,omitempty"`
+	Version        int             `json:"version,omitempty"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	ValidFrom      int64           `json:"valid_from,omitempty"`
+	Cosigners      []string        `json:"cosigners,omitempty"`
+}
+
+// TxVersion is the transaction serialization format this node produces.
+// Verify accepts it and every earlier version, and rejects later ones.
+// Since version 2 signatures are bound to the chain (see SigningMessage).
+const TxVersion = 2
+
+// DomainSeparatedVersion is the first transaction and block version whose
+// signatures cover the chain ID as well as the hash.
+const DomainSeparatedVersion = 2
+
+// ErrLegacySignature is returned for a transaction or block whose version
+// predates DomainSeparatedVersion where only signatures bound to the chain
+// are accepted: by the mempool, and for blocks past the legacy history.
+var ErrLegacySignature = errors.New("signature not bound to the chain ID")
+
+// RequireChainBound returns ErrLegacySignature if a transaction or block of
+// the given version is signed over the bare hash.
+func RequireChainBound(version int) error {
+	if version < DomainSeparatedVersion {
+		return fmt.Errorf("%w: version %d (want at least %d)", ErrLegacySignature, version, DomainSeparatedVersion)
+	}
+	return nil
+}
+
+// ErrUnnamedCosigners is returned for a transaction that carries
+// cosignatures without naming its cosigners, where only named cosigners are
+// accepted: by the mempool, and for blocks past the legacy history. Such
+// cosignatures could be stripped in transit without changing the ID.
+var ErrUnnamedCosigners = errors.New("cosignatures without named cosigners")
+
+// RequireNamedCosigners returns ErrUnnamedCosigners if tx carries
+// cosignatures but leaves Cosigners empty.
+func (tx *Transaction) RequireNamedCosigners() error {
+	if len(tx.Cosignatures) > 0 && len(tx.Cosigners) == 0 {
+		return ErrUnnamedCosigners
+	}
+	return nil
+}
+
+// ErrUnknownVersion is returned for a transaction or block whose Version
+// this node does not know.
+var ErrUnknownVersion = errors.New("unknown serialization version")
+
+// checkVersion accepts v if it is 0 (unversioned) up to current.
+func checkVersion(v, current int) error {
+	if v < 0 || v > current {
+		return fmt.Errorf("%w: %d (want at most %d)", ErrUnknownVersion, v, current)
+	}
+	return nil
+}
+
+// SigningMessage returns the bytes a signature of a transaction or block in
+// the given version covers: "<chainID>:<hash>" from DomainSeparatedVersion
+// on, so that a signature only verifies for the chain it was made for, and
+// the bare hash before.
+func SigningMessage(version int, chainID, hash string) []byte {
+	if version >= DomainSeparatedVersion {
+		return []byte(chainID + ":" + hash)
+	}
+	return []byte(hash)
 }
 
 // Hash returns a deterministic hash of the transaction (sans Signature).
 // Returns an empty string if marshalling fails (which cannot happen in practice).
 func (tx *Transaction) Hash() string {
 	body := signingBody{
-		ChainID:   tx.ChainID,
-		Type:      tx.Type,
-		From:      tx.From,
-		Nonce:     tx.Nonce,
-		Fee:       tx.Fee,
-		Timestamp: tx.Timestamp,
-		Payload:   tx.Payload,
+		ChainID:        tx.ChainID,
+		Type:           tx.Type,
+		From:           tx.From,
+		Nonce:          tx.Nonce,
+		Fee:            tx.Fee,
+		Timestamp:      tx.Timestamp,
+		Payload:        tx.Payload,
+		FeePayer:       tx.FeePayer,
+		Version:        tx.Version,
+		IdempotencyKey: tx.IdempotencyKey,
+		ValidFrom:      tx.ValidFrom,
+		Cosigners:      tx.Cosigners,
 	}
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -70,29 +183,167 @@ func (tx *Transaction) Hash() string {
 	return crypto.Hash(data)
 }
 
+// SigningHash returns the message the sender's ed25519 signature covers:
+// the transaction hash prefixed with the chain ID (see SigningMessage).
+// Signing it on another machine and passing the result to AttachSignature
+// is equivalent to Sign. Cosigners and the fee payer sign the same message.
+func (tx *Transaction) SigningHash() []byte {
+	return SigningMessage(tx.Version, tx.ChainID, tx.Hash())
+}
+
 // Sign computes the signature and sets ID.
 func (tx *Transaction) Sign(priv crypto.PrivateKey) {
-	hash := tx.Hash()
-	tx.Signature = crypto.Sign(priv, []byte(hash))
-	tx.ID = hash
+	tx.Signature = crypto.Sign(priv, tx.SigningHash())
+	tx.ID = tx.Hash()
+}
+
+// AttachSignature sets a sender signature produced elsewhere, e.g. by
+// wallet.SignDetached on an offline machine, and sets ID. It returns the
+// Verify error if the signature does not match the transaction.
+func (tx *Transaction) AttachSignature(sig string) error {
+	tx.Signature = sig
+	tx.ID = tx.Hash()
+	return tx.Verify()
+}
+
+// Cosign adds priv's approval of the signing hash to Cosignatures.
+func (tx *Transaction) Cosign(priv crypto.PrivateKey) {
+	if tx.Cosignatures == nil {
+		tx.Cosignatures = make(map[string]string)
+	}
+	tx.Cosignatures[priv.Public().Hex()] = crypto.Sign(priv, tx.SigningHash())
+}
+
+// SignedBy reports whether pubkey signed tx, as sender or cosigner. It
+// trusts the signatures, so call it only on a transaction that passed
+// Verify.
+func (tx *Transaction) SignedBy(pubkey string) bool {
+	if pubkey == tx.From {
+		return true
+	}
+	_, ok := tx.Cosignatures[pubkey]
+	return ok
+}
+
+// SignFeePayer adds the fee payer's co-signature over the signing hash.
+// The sender must have signed with FeePayer already set.
+func (tx *Transaction) SignFeePayer(priv crypto.PrivateKey) {
+	tx.FeePayerSignature = crypto.Sign(priv, tx.SigningHash())
+}
+
+// MaxIdempotencyKeyLength bounds Transaction.IdempotencyKey in bytes.
+const MaxIdempotencyKeyLength = 64
+
+// ErrDuplicateIdempotencyKey is returned when executing a transaction
+// whose idempotency key its sender has recently used.
+var ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+// ErrTxNotYetValid is returned when executing a transaction in a block
+// below its ValidFrom height.
+var ErrTxNotYetValid = errors.New("transaction not yet valid")
+
+// EligibleAt reports whether tx may be included in a block at height.
+func (tx *Transaction) EligibleAt(height int64) bool {
+	return tx.ValidFrom <= height
 }
 
-// Verify checks the signature, that From is a valid public key, and that
-// tx.ID matches the recomputed hash. This prevents a transaction whose ID
+// Transaction verification failures. Verify wraps one of these so callers
+// can classify the failure with errors.Is.
+var (
+	ErrMissingFrom  = errors.New("missing from field")
+	ErrBadPubkey    = errors.New("invalid from (must be ed25519 pubkey hex)")
+	ErrTxIDMismatch = errors.New("tx ID mismatch")
+	ErrBadSignature = errors.New("invalid signature")
+
+	ErrBadFeePayer          = errors.New("invalid fee_payer (must be ed25519 pubkey hex)")
+	ErrBadFeePayerSignature = errors.New("invalid fee payer signature")
+	ErrBadCosignature       = errors.New("invalid cosignature")
+)
+
+// Verify checks the version, the signature, that From is a valid public
+// key, and that tx.ID matches the recomputed hash. This prevents a transaction whose ID
 // was tampered with from being accepted into the mempool or a block.
+// A sponsored transaction must also carry a valid fee payer co-signature,
+// and every entry in Cosignatures must be a valid signature of its key.
+// If Cosigners is set, Cosignatures must hold exactly one entry for each
+// key it names. Signatures are checked for the transaction's own chain ID.
 func (tx *Transaction) Verify() error {
+	return tx.VerifyChain(tx.ChainID)
+}
+
+// VerifyChain is Verify with the signatures checked for chainID, the chain
+// the caller expects, instead of the transaction's own chain ID. A
+// domain-separated signature made for another chain fails with
+// ErrBadSignature even before the chain IDs are compared.
+func (tx *Transaction) VerifyChain(chainID string) error {
+	if err := checkVersion(tx.Version, TxVersion); err != nil {
+		return err
+	}
 	if tx.From == "" {
-		return errors.New("missing from field")
+		return ErrMissingFrom
 	}
 	pub, err := crypto.PubKeyFromHex(tx.From)
 	if err != nil {
-		return fmt.Errorf("invalid from (must be ed25519 pubkey hex): %w", err)
+		return fmt.Errorf("%w: %v", ErrBadPubkey, err)
 	}
 	hash := tx.Hash()
 	if tx.ID != hash {
-		return fmt.Errorf("tx ID mismatch: declared %s computed %s", tx.ID, hash)
+		return fmt.Errorf("%w: declared %s computed %s", ErrTxIDMismatch, tx.ID, hash)
+	}
+	msg := SigningMessage(tx.Version, chainID, hash)
+	if err := crypto.Verify(pub, msg, tx.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if err := tx.checkCosigners(); err != nil {
+		return err
+	}
+	for signer, sig := range tx.Cosignatures {
+		signerPub, err := crypto.PubKeyFromHex(signer)
+		if err != nil {
+			return fmt.Errorf("%w: signer %q: %v", ErrBadCosignature, signer, err)
+		}
+		if err := crypto.Verify(signerPub, msg, sig); err != nil {
+			return fmt.Errorf("%w: signer %s: %v", ErrBadCosignature, signer, err)
+		}
+	}
+	if tx.FeePayer == "" {
+		if tx.FeePayerSignature != "" {
+			return fmt.Errorf("%w: fee payer signature without fee_payer", ErrBadFeePayer)
+		}
+		return nil
+	}
+	payer, err := crypto.PubKeyFromHex(tx.FeePayer)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadFeePayer, err)
+	}
+	if err := crypto.Verify(payer, msg, tx.FeePayerSignature); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadFeePayerSignature, err)
 	}
-	return crypto.Verify(pub, []byte(hash), tx.Signature)
+	return nil
+}
+
+// checkCosigners verifies that the cosignatures are exactly those of the
+// keys named in Cosigners, if it is set.
+func (tx *Transaction) checkCosigners() error {
+	if len(tx.Cosigners) == 0 {
+		return nil
+	}
+	named := make(map[string]bool, len(tx.Cosigners))
+	for _, signer := range tx.Cosigners {
+		if named[signer] {
+			return fmt.Errorf("%w: cosigner %s named twice", ErrBadCosignature, signer)
+		}
+		if _, ok := tx.Cosignatures[signer]; !ok {
+			return fmt.Errorf("%w: missing cosignature of %s", ErrBadCosignature, signer)
+		}
+		named[signer] = true
+	}
+	for signer := range tx.Cosignatures {
+		if !named[signer] {
+			return fmt.Errorf("%w: signer %s is not a named cosigner", ErrBadCosignature, signer)
+		}
+	}
+	return nil
 }
 
 // NewTransaction creates an unsigned transaction with the current timestamp.
@@ -111,6 +362,7 @@ func NewTransaction(chainID string, typ TxType, from string, nonce, fee uint64,
 		Fee:       fee,
 		Timestamp: time.Now().UnixNano(),
 		Payload:   raw,
+		Version:   TxVersion,
 	}, nil
 }
 
@@ -122,6 +374,21 @@ type TransferPayload struct {
 	Amount uint64 `json:"amount"`
 }
 
+// MaxVestingTranches caps the number of tranches in one schedule_transfer.
+const MaxVestingTranches = 100
+
+// ScheduleTransferPayload locks tokens from the sender into a vesting record
+// released to To in tranches.
+type ScheduleTransferPayload struct {
+	To       string           `json:"to"` // recipient pubkey hex
+	Tranches []VestingTranche `json:"tranches"`
+}
+
+// ClaimVestedPayload releases the matured, unclaimed part of a vesting record.
+type ClaimVestedPayload struct {
+	VestingID string `json:"vesting_id"`
+}
+
 // MintAssetPayload mints a new asset from a registered template.
 type MintAssetPayload struct {
 	TemplateID string         `json:"template_id"`
@@ -140,12 +407,54 @@ type TransferAssetPayload struct {
 	To      string `json:"to"` // recipient pubkey hex
 }
 
+// MaxBatchTransferAssets caps the number of assets one
+// batch_transfer_asset transaction may move.
+const MaxBatchTransferAssets = 100
+
+// BatchTransferAssetPayload moves several assets to one new owner
+// atomically: either every asset is transferred or none is.
+type BatchTransferAssetPayload struct {
+	AssetIDs []string `json:"asset_ids"`
+	To       string   `json:"to"` // recipient pubkey hex
+}
+
+// MaxBatchOps caps the number of operations in one batch transaction.
+const MaxBatchOps = 32
+
+// BatchPayload carries operations of other transaction types that are
+// applied in order and atomically, under the batch's single nonce and fee:
+// either every operation succeeds or the whole batch is reverted.
+type BatchPayload struct {
+	Ops []BatchOp `json:"ops"`
+}
+
+// BatchOp is one operation of a batch: a transaction type other than batch
+// and the payload its handler expects.
+type BatchOp struct {
+	Type    TxType          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// LockAssetPayload places an asset in escrow under Holder until Expiry.
+type LockAssetPayload struct {
+	AssetID string `json:"asset_id"`
+	Holder  string `json:"holder"` // lock holder pubkey hex; empty → sender
+	Expiry  int64  `json:"expiry"` // block timestamp (unix nano) the lock lapses at
+}
+
+// UnlockAssetPayload releases a lock early (holder) or after expiry (owner).
+type UnlockAssetPayload struct {
+	AssetID string `json:"asset_id"`
+}
+
 // RegisterTemplatePayload defines a new class of game assets.
 type RegisterTemplatePayload struct {
 	ID        string         `json:"id"`
 	Name      string         `json:"name"`
 	Schema    map[string]any `json:"schema"`    // allowed property keys → type hints
 	Tradeable bool           `json:"tradeable"`
+
+	TransferCooldownBlocks int64 `json:"transfer_cooldown_blocks,omitempty"` // blocks between transfers of one asset; 0 → none
 }
 
 // SessionOpenPayload opens a new game session and locks stakes.
@@ -172,3 +481,18 @@ type ListMarketPayload struct {
 type BuyMarketPayload struct {
 	ListingID string `json:"listing_id"`
 }
+
+// DirectPurchasePayload buys an asset straight from its owner at an agreed
+// price. The transaction is sent by the buyer and must be cosigned by Seller.
+type DirectPurchasePayload struct {
+	AssetID string `json:"asset_id"`
+	Seller  string `json:"seller"` // current owner pubkey hex
+	Price   uint64 `json:"price"`
+}
+
+// CustomPayload carries game-defined data validated against the custom
+// schema named by Schema, which the node operator registers at startup.
+type CustomPayload struct {
+	Schema string          `json:"schema"`
+	Data   json.RawMessage `json:"data"` // JSON object matching the schema
+}
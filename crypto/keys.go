@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
@@ -56,7 +57,9 @@ func PubKeyFromHex(s string) (PublicKey, error) {
 	return PublicKey(b), nil
 }
 
-// PrivKeyFromHex decodes a hex-encoded private key.
+// PrivKeyFromHex decodes a hex-encoded 64-byte ed25519 private key (seed
+// followed by public key), rejecting one whose public half does not match
+// its seed.
 func PrivKeyFromHex(s string) (PrivateKey, error) {
 	b, err := hex.DecodeString(s)
 	if err != nil {
@@ -65,5 +68,8 @@ func PrivKeyFromHex(s string) (PrivateKey, error) {
 	if len(b) != ed25519.PrivateKeySize {
 		return nil, fmt.Errorf("privkey must be %d bytes, got %d", ed25519.PrivateKeySize, len(b))
 	}
+	if !bytes.Equal(ed25519.NewKeyFromSeed(b[:ed25519.SeedSize]), b) {
+		return nil, fmt.Errorf("privkey public half does not match its seed")
+	}
 	return PrivateKey(b), nil
 }
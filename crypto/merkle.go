@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Domain-separation prefixes keep a leaf hash from ever colliding with an
+// interior node hash.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleStep is one sibling on the path from a leaf to the root.
+type MerkleStep struct {
+	Hash string `json:"hash"` // sibling hash, hex
+	Left bool   `json:"left"` // true if the sibling is the left child
+}
+
+// MerkleLeaf hashes a key-value pair into a leaf using length-prefix
+// encoding so that distinct pairs never share an encoding.
+func MerkleLeaf(key, value []byte) []byte {
+	var buf bytes.Buffer
+	var lenBuf [4]byte
+	buf.WriteByte(merkleLeafPrefix)
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(key)))
+	buf.Write(lenBuf[:])
+	buf.Write(key)
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(value)))
+	buf.Write(lenBuf[:])
+	buf.Write(value)
+	return HashBytes(buf.Bytes())
+}
+
+// MerkleNode hashes two child hashes into their parent.
+func MerkleNode(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	return HashBytes(buf)
+}
+
+// MerkleRoot returns the hex root of a binary Merkle tree over leaves, in
+// order. A node without a sibling is promoted unchanged to the next level.
+// The root of an empty tree is the hash of no data.
+func MerkleRoot(leaves [][]byte) string {
+	if len(leaves) == 0 {
+		return Hash(nil)
+	}
+	level := leaves
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// MerkleProof returns the sibling path proving leaves[index] is in the tree
+// whose root is MerkleRoot(leaves). It returns nil if index is out of range.
+func MerkleProof(leaves [][]byte, index int) []MerkleStep {
+	if index < 0 || index >= len(leaves) {
+		return nil
+	}
+	var proof []MerkleStep
+	level := leaves
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, MerkleStep{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		level = merkleLevel(level)
+		index /= 2
+	}
+	return proof
+}
+
+// VerifyMerkleProof reports whether leaf combined with proof yields root.
+func VerifyMerkleProof(root string, leaf []byte, proof []MerkleStep) bool {
+	h := leaf
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		if step.Left {
+			h = MerkleNode(sibling, h)
+		} else {
+			h = MerkleNode(h, sibling)
+		}
+	}
+	return hex.EncodeToString(h) == root
+}
+
+func merkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+		next = append(next, MerkleNode(level[i], level[i+1]))
+	}
+	return next
+}
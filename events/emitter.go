@@ -9,17 +9,24 @@ import (
 type EventType string
 
 const (
-	EventBlockCommit   EventType = "block_commit"
-	EventTxExecuted    EventType = "tx_executed"
-	EventTokenTransfer EventType = "token_transfer"
-	EventAssetMinted   EventType = "asset_minted"
-	EventAssetBurned   EventType = "asset_burned"
-	EventAssetTransfer EventType = "asset_transfer"
-	EventTemplateReg   EventType = "template_registered"
-	EventSessionOpen   EventType = "session_open"
-	EventSessionClose  EventType = "session_close"
-	EventMarketList    EventType = "market_list"
-	EventMarketBuy     EventType = "market_buy"
+	EventBlockCommit      EventType = "block_commit"
+	EventTxExecuted       EventType = "tx_executed"
+	EventTxRejected       EventType = "tx_rejected"
+	EventTokenTransfer    EventType = "token_transfer"
+	EventAssetMinted      EventType = "asset_minted"
+	EventAssetBurned      EventType = "asset_burned"
+	EventAssetTransfer    EventType = "asset_transfer"
+	EventAssetLocked      EventType = "asset_locked"
+	EventAssetUnlocked    EventType = "asset_unlocked"
+	EventTemplateReg      EventType = "template_registered"
+	EventSessionOpen      EventType = "session_open"
+	EventSessionClose     EventType = "session_close"
+	EventMarketList       EventType = "market_list"
+	EventMarketBuy        EventType = "market_buy"
+	EventDirectPurchase   EventType = "direct_purchase"
+	EventBlockReward      EventType = "block_reward"
+	EventVestingScheduled EventType = "vesting_scheduled"
+	EventVestingClaimed   EventType = "vesting_claimed"
 )
 
 // Event carries a typed payload emitted after a state change.
@@ -37,6 +44,10 @@ type Handler func(Event)
 type Emitter struct {
 	mu       sync.RWMutex
 	handlers map[EventType][]Handler
+	all      []Handler // receive every event regardless of type
+
+	parent  *Emitter // set on a buffer (see Buffer)
+	pending []Event  // events queued on a buffer until Flush
 }
 
 // NewEmitter creates an Emitter with no subscribers.
@@ -51,12 +62,56 @@ func (e *Emitter) Subscribe(typ EventType, h Handler) {
 	e.handlers[typ] = append(e.handlers[typ], h)
 }
 
-// Emit delivers ev to all subscribers for ev.Type synchronously.
-// Each handler is guarded by panic recovery so a misbehaving subscriber
-// cannot crash the node or halt block production.
+// SubscribeAll registers h to be called for every emitted event.
+func (e *Emitter) SubscribeAll(h Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.all = append(e.all, h)
+}
+
+// Buffer returns an Emitter that queues the events emitted on it instead of
+// delivering them, so that events of work that may still be undone are only
+// published once it sticks. Flush passes them on to e in emission order; a
+// buffer that is never flushed drops them. Subscribers belong on e, not on
+// the buffer. Buffer on a nil Emitter returns nil.
+func (e *Emitter) Buffer() *Emitter {
+	if e == nil {
+		return nil
+	}
+	return &Emitter{parent: e}
+}
+
+// Flush passes the events queued on buffer e to the Emitter it was created
+// from, which delivers them or, if it is a buffer too, queues them in turn,
+// and empties e. It does nothing on a nil Emitter or one that is not a
+// buffer.
+func (e *Emitter) Flush() {
+	if e == nil || e.parent == nil {
+		return
+	}
+	e.mu.Lock()
+	pending := e.pending
+	e.pending = nil
+	e.mu.Unlock()
+	for _, ev := range pending {
+		e.parent.Emit(ev)
+	}
+}
+
+// Emit delivers ev to all subscribers for ev.Type synchronously, or queues
+// it if e is a buffer. Each handler is guarded by panic recovery so a
+// misbehaving subscriber cannot crash the node or halt block production.
 func (e *Emitter) Emit(ev Event) {
+	if e.parent != nil {
+		e.mu.Lock()
+		e.pending = append(e.pending, ev)
+		e.mu.Unlock()
+		return
+	}
 	e.mu.RLock()
-	handlers := e.handlers[ev.Type]
+	handlers := make([]Handler, 0, len(e.handlers[ev.Type])+len(e.all))
+	handlers = append(handlers, e.handlers[ev.Type]...)
+	handlers = append(handlers, e.all...)
 	e.mu.RUnlock()
 	for _, h := range handlers {
 		func() {
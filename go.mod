@@ -5,11 +5,11 @@ go 1.24.0
 require (
 	github.com/syndtr/goleveldb v1.0.0
 	golang.org/x/crypto v0.47.0
+	golang.org/x/net v0.49.0
 )
 
 require (
 	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db // indirect
-	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/text v0.34.0 // indirect
 )
@@ -0,0 +1,146 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/storage"
+)
+
+const prefixEventLog = "evlog:"
+
+// EventFilter selects events from the log. Zero fields match everything;
+// ToHeight is inclusive.
+type EventFilter struct {
+	Type       events.EventType
+	FromHeight int64
+	ToHeight   int64
+}
+
+func (f EventFilter) match(ev events.Event) bool {
+	return f.Type == "" || f.Type == ev.Type
+}
+
+// EventLog records the events of committed blocks in the DB under a key
+// ordered by block height and emission sequence, so events can be replayed
+// to rebuild secondary indexes or exported for analysis.
+//
+// Events are held in memory until the EventBlockCommit of their height and
+// then written together with it in one batch that replaces whatever was
+// logged at that height, so a block logged again, e.g. after a restart,
+// is not duplicated. Held events of any other height belong to a block that
+// was never committed and are dropped.
+type EventLog struct {
+	db        storage.DB
+	retention int64 // number of most recent heights kept; 0 → keep all
+
+	mu      sync.Mutex
+	pending []events.Event // events awaiting their block's EventBlockCommit
+}
+
+// NewEventLog creates an EventLog backed by db and subscribes it to every
+// event on emitter. If retention is positive, events older than the last
+// retention heights are pruned on each block commit.
+func NewEventLog(db storage.DB, emitter *events.Emitter, retention int64) *EventLog {
+	l := &EventLog{db: db, retention: retention}
+	emitter.SubscribeAll(l.append)
+	return l
+}
+
+// eventKey encodes height and sequence big-endian so that keys iterate in
+// emission order.
+func eventKey(height int64, seq uint32) []byte {
+	key := make([]byte, len(prefixEventLog)+12)
+	n := copy(key, prefixEventLog)
+	binary.BigEndian.PutUint64(key[n:], uint64(height))
+	binary.BigEndian.PutUint32(key[n+8:], seq)
+	return key
+}
+
+func heightFromKey(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key[len(prefixEventLog):]))
+}
+
+func (l *EventLog) append(ev events.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ev.Type != events.EventBlockCommit {
+		l.pending = append(l.pending, ev)
+		return
+	}
+	pending := append(l.pending, ev)
+	l.pending = nil
+	if err := l.write(ev.BlockHeight, pending); err != nil {
+		log.Printf("[eventlog] write events at height %d: %v", ev.BlockHeight, err)
+	}
+}
+
+// write replaces the events logged at height with those of evs at that
+// height, in order, and prunes heights beyond the retention, in one batch.
+func (l *EventLog) write(height int64, evs []events.Event) error {
+	batch := l.db.NewBatch()
+	batch.DeleteRange(eventKey(height, 0), eventKey(height+1, 0))
+	var seq uint32
+	for _, ev := range evs {
+		if ev.BlockHeight != height {
+			continue
+		}
+		data, err := json.Marshal(ev)
+		if err != nil {
+			log.Printf("[eventlog] marshal %s event: %v", ev.Type, err)
+			continue
+		}
+		batch.Set(eventKey(height, seq), data)
+		seq++
+	}
+	if cutoff := height - l.retention; l.retention > 0 && cutoff >= 0 {
+		batch.DeleteRange(eventKey(0, 0), eventKey(cutoff+1, 0))
+	}
+	return batch.Write()
+}
+
+// Replay calls h for every logged event matching f, in emission order.
+func (l *EventLog) Replay(f EventFilter, h events.Handler) error {
+	return l.scan(f, func(ev events.Event) bool {
+		h(ev)
+		return true
+	})
+}
+
+// Query returns up to limit logged events matching f, in emission order.
+// A non-positive limit returns every match.
+func (l *EventLog) Query(f EventFilter, limit int) ([]events.Event, error) {
+	var out []events.Event
+	err := l.scan(f, func(ev events.Event) bool {
+		out = append(out, ev)
+		return limit <= 0 || len(out) < limit
+	})
+	return out, err
+}
+
+// scan calls fn for each matching event until fn returns false.
+func (l *EventLog) scan(f EventFilter, fn func(events.Event) bool) error {
+	it := l.db.NewIterator([]byte(prefixEventLog))
+	defer it.Release()
+	for it.Next() {
+		height := heightFromKey(it.Key())
+		if height < f.FromHeight {
+			continue
+		}
+		if f.ToHeight > 0 && height > f.ToHeight {
+			break
+		}
+		var ev events.Event
+		if err := json.Unmarshal(it.Value(), &ev); err != nil {
+			return fmt.Errorf("eventlog unmarshal: %w", err)
+		}
+		if f.match(ev) && !fn(ev) {
+			break
+		}
+	}
+	return it.Error()
+}
@@ -3,10 +3,12 @@
 package indexer
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/events"
@@ -14,8 +16,10 @@ import (
 )
 
 const (
-	prefixOwnerAssets   = "idx:owner:asset:"
+	prefixOwnerAssets   = "idx:owner:asset:" // + owner + ":" + assetID → empty
 	prefixPlayerSession = "idx:player:session:"
+	prefixOpenSession   = "idx:session:open:"   // + sessionID → empty
+	prefixTemplateAsset = "idx:template:asset:" // + hex(templateID) + ":" + assetID → empty
 )
 
 // Indexer subscribes to chain events and updates secondary lookup tables.
@@ -30,13 +34,26 @@ func New(db storage.DB, emitter *events.Emitter) *Indexer {
 	emitter.Subscribe(events.EventAssetMinted, idx.onAssetMinted)
 	emitter.Subscribe(events.EventAssetTransfer, idx.onAssetTransferred)
 	emitter.Subscribe(events.EventAssetBurned, idx.onAssetBurned)
+	emitter.Subscribe(events.EventDirectPurchase, idx.onDirectPurchase)
 	emitter.Subscribe(events.EventSessionOpen, idx.onSessionOpen)
+	emitter.Subscribe(events.EventSessionClose, idx.onSessionClose)
+	if err := idx.migrateOwnerLists(); err != nil {
+		log.Printf("[indexer] owner index migration failed: %v", err)
+	}
 	return idx
 }
 
-// GetAssetsByOwner returns all asset IDs owned by the given pubkey.
+// GetAssetsByOwner returns all asset IDs owned by the given pubkey, in
+// ascending ID order.
 func (idx *Indexer) GetAssetsByOwner(owner string) ([]string, error) {
-	return idx.getList(prefixOwnerAssets + owner)
+	prefix := ownerAssetPrefix(owner)
+	it := idx.db.NewIterator(prefix)
+	defer it.Release()
+	var ids []string
+	for it.Next() {
+		ids = append(ids, string(it.Key()[len(prefix):]))
+	}
+	return ids, it.Error()
 }
 
 // GetSessionsByPlayer returns all session IDs a player participated in.
@@ -44,6 +61,62 @@ func (idx *Indexer) GetSessionsByPlayer(player string) ([]string, error) {
 	return idx.getList(prefixPlayerSession + player)
 }
 
+// GetOpenSessions returns the IDs of sessions opened and not yet closed, in
+// ascending ID order, skipping the first offset and returning at most
+// limit (limit <= 0 → all). It never returns nil.
+func (idx *Indexer) GetOpenSessions(offset, limit int) ([]string, error) {
+	return idx.page([]byte(prefixOpenSession), offset, limit)
+}
+
+// GetAssetsByTemplate returns the IDs of existing assets minted from
+// templateID, paged like GetOpenSessions. It never returns nil.
+func (idx *Indexer) GetAssetsByTemplate(templateID string, offset, limit int) ([]string, error) {
+	return idx.page(templateAssetPrefix(templateID), offset, limit)
+}
+
+// page returns the key suffixes after prefix in ascending order, skipping
+// the first offset and returning at most limit (limit <= 0 → all).
+func (idx *Indexer) page(prefix []byte, offset, limit int) ([]string, error) {
+	it := idx.db.NewIterator(prefix)
+	defer it.Release()
+	ids := []string{}
+	for it.Next() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+		ids = append(ids, string(it.Key()[len(prefix):]))
+	}
+	return ids, it.Error()
+}
+
+// IndexAssets adds the assets with the given IDs to the owner and template
+// indexes as they are in state. It is for assets minted without an event,
+// such as the genesis assets, and is safe to repeat on every start: an
+// asset since transferred is indexed under its current owner, and one
+// since burned is skipped.
+func (idx *Indexer) IndexAssets(state core.StateReader, ids []string) error {
+	b := idx.db.NewBatch()
+	for _, id := range ids {
+		asset, err := state.GetAsset(id)
+		if errors.Is(err, core.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("asset %s: %w", id, err)
+		}
+		if asset.Burned || asset.Owner == "" {
+			continue
+		}
+		b.Set(ownerAssetKey(asset.Owner, id), []byte{})
+		b.Set(templateAssetKey(asset.TemplateID, id), []byte{})
+	}
+	return b.Write()
+}
+
 // ---- event handlers ----
 
 func (idx *Indexer) onAssetMinted(ev events.Event) {
@@ -52,7 +125,12 @@ func (idx *Indexer) onAssetMinted(ev events.Event) {
 	if owner == "" || assetID == "" {
 		return
 	}
-	if err := idx.addToList(prefixOwnerAssets+owner, assetID); err != nil {
+	b := idx.db.NewBatch()
+	b.Set(ownerAssetKey(owner, assetID), []byte{})
+	if templateID, _ := ev.Data["template_id"].(string); templateID != "" {
+		b.Set(templateAssetKey(templateID, assetID), []byte{})
+	}
+	if err := b.Write(); err != nil {
 		log.Printf("[indexer] mint index write failed (owner=%s asset=%s): %v", owner, assetID, err)
 	}
 }
@@ -64,21 +142,32 @@ func (idx *Indexer) onAssetTransferred(ev events.Event) {
 	if assetID == "" || from == "" || to == "" {
 		return
 	}
-	if err := idx.removeFromList(prefixOwnerAssets+from, assetID); err != nil {
-		log.Printf("[indexer] transfer remove failed (from=%s asset=%s): %v", from, assetID, err)
-	}
-	if err := idx.addToList(prefixOwnerAssets+to, assetID); err != nil {
-		log.Printf("[indexer] transfer add failed (to=%s asset=%s): %v", to, assetID, err)
+	b := idx.db.NewBatch()
+	b.Delete(ownerAssetKey(from, assetID))
+	b.Set(ownerAssetKey(to, assetID), []byte{})
+	if err := b.Write(); err != nil {
+		log.Printf("[indexer] transfer index write failed (from=%s to=%s asset=%s): %v", from, to, assetID, err)
 	}
 }
 
+func (idx *Indexer) onDirectPurchase(ev events.Event) {
+	seller, _ := ev.Data["seller"].(string)
+	buyer, _ := ev.Data["buyer"].(string)
+	idx.onAssetTransferred(events.Event{Data: map[string]any{"from": seller, "to": buyer, "asset_id": ev.Data["asset_id"]}})
+}
+
 func (idx *Indexer) onAssetBurned(ev events.Event) {
 	owner, _ := ev.Data["owner"].(string)
 	assetID, _ := ev.Data["asset_id"].(string)
 	if owner == "" || assetID == "" {
 		return
 	}
-	if err := idx.removeFromList(prefixOwnerAssets+owner, assetID); err != nil {
+	b := idx.db.NewBatch()
+	b.Delete(ownerAssetKey(owner, assetID))
+	if templateID, _ := ev.Data["template_id"].(string); templateID != "" {
+		b.Delete(templateAssetKey(templateID, assetID))
+	}
+	if err := b.Write(); err != nil {
 		log.Printf("[indexer] burn remove failed (owner=%s asset=%s): %v", owner, assetID, err)
 	}
 }
@@ -89,6 +178,9 @@ func (idx *Indexer) onSessionOpen(ev events.Event) {
 	if sessionID == "" {
 		return
 	}
+	if err := idx.db.Set([]byte(prefixOpenSession+sessionID), []byte{}); err != nil {
+		log.Printf("[indexer] open session index write failed (session=%s): %v", sessionID, err)
+	}
 	for _, p := range players {
 		player, _ := p.(string)
 		if player != "" {
@@ -99,6 +191,73 @@ func (idx *Indexer) onSessionOpen(ev events.Event) {
 	}
 }
 
+func (idx *Indexer) onSessionClose(ev events.Event) {
+	sessionID, _ := ev.Data["session_id"].(string)
+	if sessionID == "" {
+		return
+	}
+	if err := idx.db.Delete([]byte(prefixOpenSession + sessionID)); err != nil {
+		log.Printf("[indexer] open session index remove failed (session=%s): %v", sessionID, err)
+	}
+}
+
+// ---- owner index ----
+
+// Each owned asset is its own key, so adding or removing one is O(1)
+// however many assets the owner holds. Owners are pubkey hex and never
+// contain ':', so one owner's prefix cannot match another's keys.
+
+func ownerAssetPrefix(owner string) []byte {
+	return []byte(prefixOwnerAssets + owner + ":")
+}
+
+func ownerAssetKey(owner, assetID string) []byte {
+	return []byte(prefixOwnerAssets + owner + ":" + assetID)
+}
+
+// ---- template index ----
+
+// Template IDs are free-form and may contain ':', so they are hex-encoded
+// in keys; otherwise template "a" would match the keys of template "a:b".
+
+func templateAssetPrefix(templateID string) []byte {
+	return []byte(prefixTemplateAsset + hex.EncodeToString([]byte(templateID)) + ":")
+}
+
+func templateAssetKey(templateID, assetID string) []byte {
+	return append(templateAssetPrefix(templateID), assetID...)
+}
+
+// migrateOwnerLists converts owner indexes written as one JSON list per
+// owner (idx:owner:asset:<owner>) into per-asset keys.
+func (idx *Indexer) migrateOwnerLists() error {
+	legacy := make(map[string][]string)
+	it := idx.db.NewIterator([]byte(prefixOwnerAssets))
+	defer it.Release()
+	for it.Next() {
+		owner := string(it.Key()[len(prefixOwnerAssets):])
+		if strings.Contains(owner, ":") {
+			continue // already a per-asset key
+		}
+		var ids []string
+		if err := json.Unmarshal(it.Value(), &ids); err != nil {
+			return fmt.Errorf("owner list %s: %w", owner, err)
+		}
+		legacy[owner] = ids
+	}
+	if err := it.Error(); err != nil || len(legacy) == 0 {
+		return err
+	}
+	b := idx.db.NewBatch()
+	for owner, ids := range legacy {
+		for _, id := range ids {
+			b.Set(ownerAssetKey(owner, id), []byte{})
+		}
+		b.Delete([]byte(prefixOwnerAssets + owner))
+	}
+	return b.Write()
+}
+
 // ---- list helpers ----
 
 func (idx *Indexer) getList(key string) ([]string, error) {
@@ -133,24 +292,3 @@ func (idx *Indexer) addToList(key, value string) error {
 	}
 	return idx.db.Set([]byte(key), data)
 }
-
-func (idx *Indexer) removeFromList(key, value string) error {
-	ids, err := idx.getList(key)
-	if err != nil {
-		return fmt.Errorf("read list: %w", err)
-	}
-	if ids == nil {
-		return nil
-	}
-	filtered := ids[:0]
-	for _, id := range ids {
-		if id != value {
-			filtered = append(filtered, id)
-		}
-	}
-	data, err := json.Marshal(filtered)
-	if err != nil {
-		return err
-	}
-	return idx.db.Set([]byte(key), data)
-}
@@ -0,0 +1,169 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/storage"
+)
+
+const (
+	prefixMarketRecord = "idx:market:rec:"    // + pos → MarketRecord JSON
+	prefixMarketAsset  = "idx:market:asset:"  // + assetID + ":" + pos → empty
+	prefixMarketSeller = "idx:market:seller:" // + seller + ":" + pos → empty
+)
+
+// Market record kinds.
+const (
+	MarketListed = "listing"
+	MarketSold   = "sale"
+)
+
+// MarketRecord is an archived listing or completed sale. Records are never
+// changed or removed, unlike the listings in state.
+type MarketRecord struct {
+	Kind      string `json:"kind"` // MarketListed or MarketSold
+	ListingID string `json:"listing_id"`
+	AssetID   string `json:"asset_id"`
+	Seller    string `json:"seller"`
+	Buyer     string `json:"buyer,omitempty"` // sales only
+	Price     uint64 `json:"price"`
+	Height    int64  `json:"height"`
+	Timestamp int64  `json:"timestamp"` // block timestamp, Unix nanoseconds
+	TxID      string `json:"tx_id"`
+}
+
+// MarketQuery selects records from the market history. Zero fields match
+// everything; ToTime is inclusive.
+type MarketQuery struct {
+	AssetID  string
+	Seller   string
+	FromTime int64
+	ToTime   int64
+}
+
+func (q MarketQuery) match(r MarketRecord) bool {
+	return (q.AssetID == "" || r.AssetID == q.AssetID) &&
+		(q.Seller == "" || r.Seller == q.Seller) &&
+		r.Timestamp >= q.FromTime &&
+		(q.ToTime == 0 || r.Timestamp <= q.ToTime)
+}
+
+// MarketHistory archives every listing and market sale from EventMarketList
+// and EventMarketBuy, indexed by asset and by seller. It is a read model of
+// the events and does not depend on the listings kept in state.
+type MarketHistory struct {
+	db storage.DB
+}
+
+// NewMarketHistory creates a MarketHistory backed by db and subscribes it
+// to the market events on emitter.
+func NewMarketHistory(db storage.DB, emitter *events.Emitter) *MarketHistory {
+	m := &MarketHistory{db: db}
+	emitter.Subscribe(events.EventMarketList, m.onList)
+	emitter.Subscribe(events.EventMarketBuy, m.onBuy)
+	return m
+}
+
+// marketPos orders records by block height, then transaction ID. A
+// transaction emits at most one market event.
+func marketPos(height int64, txID string) string {
+	return fmt.Sprintf("%016x:%s", height, txID)
+}
+
+func (m *MarketHistory) onList(ev events.Event) {
+	m.record(ev, MarketListed)
+}
+
+func (m *MarketHistory) onBuy(ev events.Event) {
+	m.record(ev, MarketSold)
+}
+
+func (m *MarketHistory) record(ev events.Event, kind string) {
+	r := MarketRecord{Kind: kind, Height: ev.BlockHeight, TxID: ev.TxID}
+	r.ListingID, _ = ev.Data["listing_id"].(string)
+	r.AssetID, _ = ev.Data["asset_id"].(string)
+	r.Seller, _ = ev.Data["seller"].(string)
+	r.Buyer, _ = ev.Data["buyer"].(string)
+	r.Price = uint64(number(ev.Data["price"]))
+	r.Timestamp = number(ev.Data["timestamp"])
+	if ev.TxID == "" || r.AssetID == "" || r.Seller == "" {
+		return
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("[indexer] marshal market record (tx=%s): %v", ev.TxID, err)
+		return
+	}
+	pos := marketPos(r.Height, r.TxID)
+	b := m.db.NewBatch()
+	b.Set([]byte(prefixMarketRecord+pos), data)
+	b.Set([]byte(prefixMarketAsset+r.AssetID+":"+pos), []byte{})
+	b.Set([]byte(prefixMarketSeller+r.Seller+":"+pos), []byte{})
+	if err := b.Write(); err != nil {
+		log.Printf("[indexer] market history write failed (tx=%s): %v", ev.TxID, err)
+	}
+}
+
+// number returns v as an int64, accepting the integer types handlers emit
+// and the float64 of an event decoded from JSON.
+func number(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case uint64:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+// Query returns the records matching q, oldest first, skipping the first
+// offset and returning at most limit (limit <= 0 → all). It scans the asset
+// or seller index when q names one. It never returns nil.
+func (m *MarketHistory) Query(q MarketQuery, offset, limit int) ([]MarketRecord, error) {
+	prefix, indexed := prefixMarketRecord, false
+	switch {
+	case q.AssetID != "":
+		prefix, indexed = prefixMarketAsset+q.AssetID+":", true
+	case q.Seller != "":
+		prefix, indexed = prefixMarketSeller+q.Seller+":", true
+	}
+	it := m.db.NewIterator([]byte(prefix))
+	defer it.Release()
+	records := []MarketRecord{}
+	for it.Next() {
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		data := it.Value()
+		if indexed {
+			pos := string(it.Key()[len(prefix):])
+			var err error
+			if data, err = m.db.Get([]byte(prefixMarketRecord + pos)); err != nil {
+				return nil, fmt.Errorf("market record %s: %w", pos, err)
+			}
+		}
+		var r MarketRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("decode market record: %w", err)
+		}
+		if q.ToTime != 0 && r.Timestamp > q.ToTime {
+			break // records are in block order, so timestamps only grow
+		}
+		if !q.match(r) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, it.Error()
+}
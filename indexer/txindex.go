@@ -0,0 +1,243 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/storage"
+)
+
+const (
+	prefixSenderTxs = "idx:sender:tx:" // + sender + ":" + height + position → TxRef
+	prefixTypeTxs   = "idx:type:tx:"   // + type + ":" + height + position → TxRef
+
+	prefixTxCount = "idx:txcount:" // + list prefix → number of entries in the list
+)
+
+// DefaultTxIndexLimit is the number of most recent transactions kept per
+// sender and per type unless overridden in NewTxIndex.
+const DefaultTxIndexLimit = 1000
+
+// TxRef identifies an executed transaction in the sender and type indexes.
+type TxRef struct {
+	TxID   string `json:"tx_id"`
+	Height int64  `json:"height"`
+	Type   string `json:"type"`
+	From   string `json:"from"`
+}
+
+// TxIndex records executed transactions by sender address and by tx type.
+// Each list keeps at most limit entries in execution order; older entries
+// are dropped as new ones arrive. Every entry is its own key, so indexing a
+// transaction costs the same however long its lists are.
+type TxIndex struct {
+	db    storage.DB
+	limit int
+
+	mu     sync.Mutex
+	height int64  // height of the last indexed transaction
+	pos    uint32 // position of the next transaction within height
+}
+
+// NewTxIndex creates a TxIndex backed by db and subscribes it to
+// EventTxExecuted and EventBlockCommit on emitter. A non-positive limit selects
+// DefaultTxIndexLimit.
+func NewTxIndex(db storage.DB, emitter *events.Emitter, limit int) *TxIndex {
+	if limit <= 0 {
+		limit = DefaultTxIndexLimit
+	}
+	ti := &TxIndex{db: db, limit: limit, height: -1}
+	emitter.Subscribe(events.EventTxExecuted, ti.onTxExecuted)
+	emitter.Subscribe(events.EventBlockCommit, ti.onBlockCommit)
+	if err := ti.migrateLists(); err != nil {
+		log.Printf("[indexer] tx index migration failed: %v", err)
+	}
+	return ti
+}
+
+// GetBySender returns up to limit indexed transactions sent by from,
+// oldest first, skipping the first offset. A non-positive limit returns all.
+func (ti *TxIndex) GetBySender(from string, offset, limit int) ([]TxRef, error) {
+	return ti.page(listPrefix(prefixSenderTxs, from), offset, limit)
+}
+
+// GetByType returns up to limit indexed transactions of type typ, oldest
+// first, skipping the first offset. A non-positive limit returns all.
+func (ti *TxIndex) GetByType(typ core.TxType, offset, limit int) ([]TxRef, error) {
+	return ti.page(listPrefix(prefixTypeTxs, string(typ)), offset, limit)
+}
+
+func (ti *TxIndex) onTxExecuted(ev events.Event) {
+	typ, _ := ev.Data["type"].(string)
+	from, _ := ev.Data["from"].(string)
+	if ev.TxID == "" || typ == "" || from == "" {
+		return
+	}
+	ref := TxRef{TxID: ev.TxID, Height: ev.BlockHeight, Type: typ, From: from}
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	// A block's transactions are published together and in order, ending
+	// with its EventBlockCommit, so the position restarts with each block.
+	// A block published again indexes its transactions under the same keys.
+	if ev.BlockHeight != ti.height {
+		ti.height, ti.pos = ev.BlockHeight, 0
+	}
+	pos := ti.pos
+	ti.pos++
+	if err := ti.add(listPrefix(prefixSenderTxs, from), ref, pos); err != nil {
+		log.Printf("[indexer] sender tx index write failed (from=%s tx=%s): %v", from, ev.TxID, err)
+	}
+	if err := ti.add(listPrefix(prefixTypeTxs, typ), ref, pos); err != nil {
+		log.Printf("[indexer] type tx index write failed (type=%s tx=%s): %v", typ, ev.TxID, err)
+	}
+}
+
+func (ti *TxIndex) onBlockCommit(events.Event) {
+	ti.mu.Lock()
+	ti.height = -1
+	ti.mu.Unlock()
+}
+
+// page returns the refs of the list at prefix, oldest first, skipping the
+// first offset and returning at most limit (limit <= 0 → all).
+func (ti *TxIndex) page(prefix []byte, offset, limit int) ([]TxRef, error) {
+	it := ti.db.NewIterator(prefix)
+	defer it.Release()
+	refs := []TxRef{}
+	for it.Next() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if limit > 0 && len(refs) == limit {
+			break
+		}
+		var ref TxRef
+		if err := json.Unmarshal(it.Value(), &ref); err != nil {
+			return nil, fmt.Errorf("indexer unmarshal: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, it.Error()
+}
+
+// add stores ref at pos within its height in the list at prefix and drops
+// the oldest entries beyond the limit, in one batch. An entry already
+// stored is left alone. Callers must hold ti.mu.
+func (ti *TxIndex) add(prefix []byte, ref TxRef, pos uint32) error {
+	key := txKey(prefix, ref.Height, pos)
+	if _, err := ti.db.Get(key); err == nil {
+		return nil // already indexed
+	} else if !errors.Is(err, core.ErrNotFound) {
+		return err
+	}
+	n, err := ti.count(prefix)
+	if err != nil {
+		return fmt.Errorf("read count: %w", err)
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	b := ti.db.NewBatch()
+	b.Set(key, data)
+	n++
+	if excess := n - ti.limit; excess > 0 {
+		it := ti.db.NewIterator(prefix)
+		for excess > 0 && it.Next() {
+			b.Delete(append([]byte(nil), it.Key()...))
+			excess--
+			n--
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	b.Set(countKey(prefix), []byte(strconv.Itoa(n)))
+	return b.Write()
+}
+
+// count returns the number of entries in the list at prefix.
+func (ti *TxIndex) count(prefix []byte) (int, error) {
+	data, err := ti.db.Get(countKey(prefix))
+	if errors.Is(err, core.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// migrateLists converts tx indexes written as one JSON list per sender or
+// type (idx:sender:tx:<from>, idx:type:tx:<type>) into per-entry keys,
+// keeping their order.
+func (ti *TxIndex) migrateLists() error {
+	b := ti.db.NewBatch()
+	migrated := false
+	for _, base := range []string{prefixSenderTxs, prefixTypeTxs} {
+		it := ti.db.NewIterator([]byte(base))
+		for it.Next() {
+			name := string(it.Key()[len(base):])
+			if strings.Contains(name, ":") {
+				continue // already a per-entry key
+			}
+			var refs []TxRef
+			if err := json.Unmarshal(it.Value(), &refs); err != nil {
+				it.Release()
+				return fmt.Errorf("tx list %s%s: %w", base, name, err)
+			}
+			prefix := listPrefix(base, name)
+			for i, ref := range refs {
+				data, err := json.Marshal(ref)
+				if err != nil {
+					it.Release()
+					return err
+				}
+				b.Set(txKey(prefix, ref.Height, uint32(i)), data)
+			}
+			b.Set(countKey(prefix), []byte(strconv.Itoa(len(refs))))
+			b.Delete(append([]byte(nil), it.Key()...))
+			migrated = true
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	if !migrated {
+		return nil
+	}
+	return b.Write()
+}
+
+// ---- keys ----
+
+// Senders are pubkey hex and types are fixed names, neither containing
+// ':', so one list's prefix cannot match another list's keys. Heights and
+// positions are big-endian so that a list iterates in execution order.
+
+func listPrefix(base, name string) []byte {
+	return []byte(base + name + ":")
+}
+
+func txKey(prefix []byte, height int64, pos uint32) []byte {
+	key := make([]byte, len(prefix)+12)
+	n := copy(key, prefix)
+	binary.BigEndian.PutUint64(key[n:], uint64(height))
+	binary.BigEndian.PutUint32(key[n+8:], pos)
+	return key
+}
+
+func countKey(prefix []byte) []byte {
+	return []byte(prefixTxCount + string(prefix))
+}
@@ -0,0 +1,195 @@
+// Package cli implements the tol command-line tool: balance and asset
+// queries plus signed transaction submission against a running node.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tolelom/tolchain/client"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+const usage = `usage: tol [global flags] <command> [flags] [args]
+
+commands:
+  height                                   current block height
+  balance <address>                        balance and nonce of an address
+  asset <id>                               asset details
+  send --key FILE --to ADDR --amount N     transfer tokens
+  mint --key FILE --template ID --owner ADDR [--props JSON]
+                                           mint an asset from a template
+
+global flags:
+`
+
+// Run executes the tol command line args (without the program name),
+// writing results to stdout. The keystore password is read from the
+// TOL_PASSWORD environment variable and the RPC token from TOL_RPC_TOKEN.
+func Run(ctx context.Context, args []string, stdout io.Writer) error {
+	global := flag.NewFlagSet("tol", flag.ContinueOnError)
+	global.SetOutput(stdout)
+	rpcURL := global.String("rpc", "http://127.0.0.1:8545", "node RPC endpoint")
+	chainID := global.String("chain-id", "tolchain-dev", "chain ID transactions are signed for")
+	global.Usage = func() {
+		fmt.Fprint(stdout, usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return errors.New("no command given")
+	}
+
+	c := client.New(*rpcURL)
+	if token := os.Getenv("TOL_RPC_TOKEN"); token != "" {
+		c.SetAuthToken(token)
+	}
+	cmd := &command{ctx: ctx, client: c, chainID: *chainID, out: stdout}
+	name, rest := global.Arg(0), global.Args()[1:]
+	switch name {
+	case "height":
+		return cmd.height()
+	case "balance":
+		return cmd.balance(rest)
+	case "asset":
+		return cmd.asset(rest)
+	case "send":
+		return cmd.send(rest)
+	case "mint":
+		return cmd.mint(rest)
+	default:
+		global.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+type command struct {
+	ctx     context.Context
+	client  *client.Client
+	chainID string
+	out     io.Writer
+}
+
+func (c *command) print(v any) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (c *command) height() error {
+	h, err := c.client.Height(c.ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, h)
+	return nil
+}
+
+func (c *command) balance(args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ContinueOnError)
+	pending := fs.Bool("pending", false, "include the block being produced")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: tol balance [--pending] <address>")
+	}
+	b, err := c.client.Balance(c.ctx, fs.Arg(0), *pending)
+	if err != nil {
+		return err
+	}
+	return c.print(b)
+}
+
+func (c *command) asset(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: tol asset <id>")
+	}
+	a, err := c.client.Asset(c.ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.print(a)
+}
+
+// txFlags registers the flags shared by every transaction-sending command.
+func txFlags(fs *flag.FlagSet) (key *string, fee *uint64) {
+	key = fs.String("key", "", "keystore file of the sender (password from TOL_PASSWORD)")
+	fee = fs.Uint64("fee", 0, "transaction fee")
+	return key, fee
+}
+
+func (c *command) send(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	key, fee := txFlags(fs)
+	to := fs.String("to", "", "recipient address")
+	amount := fs.Uint64("amount", 0, "tokens to transfer")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *amount == 0 {
+		return errors.New("send requires --to and a positive --amount")
+	}
+	return c.submit(*key, core.TxTransfer, *fee, core.TransferPayload{To: *to, Amount: *amount})
+}
+
+func (c *command) mint(args []string) error {
+	fs := flag.NewFlagSet("mint", flag.ContinueOnError)
+	key, fee := txFlags(fs)
+	template := fs.String("template", "", "asset template ID")
+	owner := fs.String("owner", "", "owner address; empty → sender")
+	props := fs.String("props", "", "asset properties as a JSON object")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *template == "" {
+		return errors.New("mint requires --template")
+	}
+	p := core.MintAssetPayload{TemplateID: *template, Owner: *owner}
+	if *props != "" {
+		if err := json.Unmarshal([]byte(*props), &p.Properties); err != nil {
+			return fmt.Errorf("--props: %w", err)
+		}
+	}
+	return c.submit(*key, core.TxMintAsset, *fee, p)
+}
+
+// submit signs a transaction with the keystore at keyPath, using the
+// sender's next nonce after its mempool transactions, and submits it to
+// the node.
+func (c *command) submit(keyPath string, typ core.TxType, fee uint64, payload any) error {
+	if keyPath == "" {
+		return errors.New("--key is required")
+	}
+	priv, err := wallet.LoadKey(keyPath, os.Getenv("TOL_PASSWORD"))
+	if err != nil {
+		return fmt.Errorf("load key: %w", err)
+	}
+	w := wallet.New(priv)
+	if mp, ok := payload.(core.MintAssetPayload); ok && mp.Owner == "" {
+		mp.Owner = w.PubKey()
+		payload = mp
+	}
+	nonce, err := c.client.PendingNonce(c.ctx, w.PubKey())
+	if err != nil {
+		return fmt.Errorf("fetch nonce: %w", err)
+	}
+	tx, err := w.NewTx(c.chainID, typ, nonce, fee, payload)
+	if err != nil {
+		return err
+	}
+	id, err := c.client.SendTx(c.ctx, tx)
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]string{"tx_id": id})
+}
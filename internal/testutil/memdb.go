@@ -3,6 +3,7 @@
 package testutil
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -57,6 +58,8 @@ func (m *MemDB) NewIterator(prefix []byte) storage.Iterator {
 			pairs = append(pairs, kv{k: []byte(k), v: cp})
 		}
 	}
+	// Match LevelDB, which iterates in ascending key order.
+	sort.Slice(pairs, func(i, j int) bool { return string(pairs[i].k) < string(pairs[j].k) })
 	return &memIter{pairs: pairs, idx: -1}
 }
 
@@ -75,16 +78,23 @@ type memBatch struct {
 type memBatchOp struct {
 	key   string
 	value []byte // nil means delete
+
+	rangeEnd *string // non-nil → delete keys in [key, *rangeEnd); "" → no upper bound
 }
 
 func (b *memBatch) Set(key, value []byte) {
 	cp := make([]byte, len(value))
 	copy(cp, value)
-	b.ops = append(b.ops, memBatchOp{string(key), cp})
+	b.ops = append(b.ops, memBatchOp{key: string(key), value: cp})
 }
 
 func (b *memBatch) Delete(key []byte) {
-	b.ops = append(b.ops, memBatchOp{string(key), nil})
+	b.ops = append(b.ops, memBatchOp{key: string(key)})
+}
+
+func (b *memBatch) DeleteRange(start, end []byte) {
+	e := string(end)
+	b.ops = append(b.ops, memBatchOp{key: string(start), rangeEnd: &e})
 }
 
 func (b *memBatch) Reset() { b.ops = nil }
@@ -93,7 +103,13 @@ func (b *memBatch) Write() error {
 	b.db.mu.Lock()
 	defer b.db.mu.Unlock()
 	for _, op := range b.ops {
-		if op.value == nil {
+		if op.rangeEnd != nil {
+			for k := range b.db.data {
+				if k >= op.key && (*op.rangeEnd == "" || k < *op.rangeEnd) {
+					delete(b.db.data, k)
+				}
+			}
+		} else if op.value == nil {
 			delete(b.db.data, op.key)
 		} else {
 			b.db.data[op.key] = op.value
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SetAllowedPeers restricts the node to the peers whose node IDs are
+// listed, for a permissioned network. An inbound peer must send a hello
+// naming a listed ID before any other message, and is disconnected
+// otherwise; AddPeer refuses to dial an unlisted ID. Under mTLS the ID is
+// the CommonName of the peer's verified certificate, which must be listed
+// and match the hello or the dialed ID. Without TLS the hello's ID is taken
+// on trust. An empty list allows every peer. Must be called before Start.
+func (n *Node) SetAllowedPeers(ids []string) {
+	if len(ids) == 0 {
+		n.allowed = nil
+		return
+	}
+	n.allowed = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		n.allowed[id] = true
+	}
+}
+
+// admitted reports whether peer may exchange messages with this node.
+func (n *Node) admitted(peer *Peer) bool {
+	return n.allowed == nil || peer.admitted.Load()
+}
+
+// certID returns the CommonName of the certificate the remote end of a TLS
+// connection presented, completing the handshake if needed, or "" for a
+// plain connection.
+func certID(p *Peer) (string, error) {
+	conn, ok := p.conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+	if err := conn.SetDeadline(time.Now().Add(DefaultReadTimeout)); err != nil {
+		return "", err
+	}
+	if err := conn.Handshake(); err != nil {
+		return "", fmt.Errorf("tls handshake: %w", err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return "", err
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no peer certificate")
+	}
+	return certs[0].Subject.CommonName, nil
+}
+
+// admitOutbound checks a peer this node dialed as id against the allow
+// list.
+func (n *Node) admitOutbound(peer *Peer, id string) error {
+	if n.allowed == nil {
+		return nil
+	}
+	cn, err := certID(peer)
+	if err != nil {
+		return err
+	}
+	if cn != "" && cn != id {
+		return fmt.Errorf("peer %s presented a certificate for %q", id, cn)
+	}
+	peer.admitted.Store(true)
+	return nil
+}
+
+// admitInboundCert checks the certificate of an inbound TLS peer against
+// the allow list before any message is read.
+func (n *Node) admitInboundCert(peer *Peer) bool {
+	cn, err := certID(peer)
+	switch {
+	case err != nil:
+		log.Printf("[network] rejecting %s: %v", peer.Addr, err)
+		return false
+	case cn != "" && !n.allowed[cn]:
+		log.Printf("[network] rejecting %s: node %q is not in the allowed peer list", peer.Addr, cn)
+		return false
+	}
+	peer.certID = cn
+	return true
+}
+
+// admitHello admits an inbound peer whose first message is a hello naming
+// a listed node ID, the ID on its certificate if it presented one.
+func (n *Node) admitHello(peer *Peer, msg Message) bool {
+	if msg.Type != MsgHello {
+		log.Printf("[network] rejecting %s: sent %s before hello", peer.Addr, msg.Type)
+		return false
+	}
+	var hello Hello
+	if err := json.Unmarshal(msg.Payload, &hello); err != nil {
+		log.Printf("[network] rejecting %s: malformed hello: %v", peer.Addr, err)
+		return false
+	}
+	if peer.certID != "" && hello.NodeID != peer.certID {
+		log.Printf("[network] rejecting %s: hello names %q but its certificate is for %q", peer.Addr, hello.NodeID, peer.certID)
+		return false
+	}
+	if !n.allowed[hello.NodeID] {
+		log.Printf("[network] rejecting %s: node %q is not in the allowed peer list", peer.Addr, hello.NodeID)
+		return false
+	}
+	peer.admitted.Store(true)
+	return true
+}
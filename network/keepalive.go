@@ -0,0 +1,79 @@
+package network
+
+import (
+	"log"
+	"time"
+)
+
+// Defaults for SetKeepAlive.
+const (
+	DefaultReadTimeout   = 30 * time.Second // silence after which a peer is dropped
+	DefaultPingInterval  = 10 * time.Second
+	DefaultPingMaxMissed = 3 // unanswered pings after which a peer is dropped
+)
+
+// SetKeepAlive sets how often connected peers are pinged, how many
+// consecutive unanswered pings close a peer, and how long a peer may stay
+// silent before its connection is closed. The read timeout should exceed
+// the ping interval so that pongs keep idle peers connected. Non-positive
+// values keep the current setting.
+func (n *Node) SetKeepAlive(pingInterval time.Duration, maxMissed int, readTimeout time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if pingInterval > 0 {
+		n.pingInterval = pingInterval
+	}
+	if maxMissed > 0 {
+		n.pingMaxMissed = maxMissed
+	}
+	if readTimeout > 0 {
+		n.readTimeout = readTimeout
+		for _, p := range n.peers {
+			p.readTimeout.Store(int64(readTimeout))
+		}
+	}
+}
+
+// pingLoop pings every peer once per ping interval until the node stops.
+func (n *Node) pingLoop() {
+	for {
+		n.mu.RLock()
+		interval := n.pingInterval
+		n.mu.RUnlock()
+		select {
+		case <-n.stopCh:
+			return
+		case <-time.After(interval):
+			n.pingPeers()
+		}
+	}
+}
+
+// pingPeers closes peers that left too many pings unanswered and pings the
+// rest.
+func (n *Node) pingPeers() {
+	n.mu.RLock()
+	maxMissed := n.pingMaxMissed
+	n.mu.RUnlock()
+	for _, p := range n.Peers() {
+		if missed := p.pingsMissed.Load(); missed >= int32(maxMissed) {
+			log.Printf("[network] peer %s missed %d pings, disconnecting", p.ID, missed)
+			p.Close()
+			continue
+		}
+		p.pingsMissed.Add(1)
+		if err := p.Send(Message{Type: MsgPing}); err != nil {
+			log.Printf("[network] ping %s: %v", p.ID, err)
+		}
+	}
+}
+
+func (n *Node) handlePing(peer *Peer, _ Message) {
+	if err := peer.Send(Message{Type: MsgPong}); err != nil {
+		log.Printf("[network] pong %s: %v", peer.ID, err)
+	}
+}
+
+func (n *Node) handlePong(peer *Peer, _ Message) {
+	peer.pingsMissed.Store(0)
+}
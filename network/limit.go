@@ -0,0 +1,115 @@
+package network
+
+import (
+	"errors"
+	"time"
+)
+
+// Defaults for SetInboundLimits.
+const (
+	DefaultMaxPeersPerIP   = 8  // simultaneous peers from one host
+	DefaultAcceptRate      = 50 // inbound connections per second, all hosts
+	DefaultAcceptRatePerIP = 10 // inbound connections per second, one host
+)
+
+var (
+	errAcceptRate     = errors.New("inbound connection rate exceeded")
+	errHostAcceptRate = errors.New("per-host connection rate exceeded")
+	errHostPeerCap    = errors.New("per-host peer limit reached")
+)
+
+// maxTrackedHosts bounds the per-host rate limiter table; idle entries are
+// dropped once it is exceeded.
+const maxTrackedHosts = 1024
+
+// tokenBucket is a rate limiter allowing bursts of up to rate events and a
+// sustained rate events per second.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: now}
+}
+
+// allow refills the bucket for the time elapsed since the last call and
+// takes one token if available.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket has refilled completely, i.e. the host
+// has been idle long enough that forgetting it changes nothing.
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.rate
+}
+
+// SetInboundLimits sets how many peers one host may hold and how many
+// inbound connections per second are accepted overall and per host.
+// Non-positive values keep the current setting.
+func (n *Node) SetInboundLimits(maxPerIP, rate, ratePerIP int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if maxPerIP > 0 {
+		n.maxPeersPerIP = maxPerIP
+	}
+	if rate > 0 {
+		n.acceptRate = rate
+		n.acceptBucket = nil
+	}
+	if ratePerIP > 0 {
+		n.acceptRatePerIP = ratePerIP
+		n.hostBuckets = make(map[string]*tokenBucket)
+	}
+}
+
+// admitInbound decides whether an inbound connection from host may become
+// a peer: it must fit the global and per-host accept rates and the host
+// must hold fewer than the per-host peer cap.
+func (n *Node) admitInbound(host string) error {
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.acceptBucket == nil {
+		n.acceptBucket = newTokenBucket(n.acceptRate, now)
+	}
+	if !n.acceptBucket.allow(now) {
+		return errAcceptRate
+	}
+	b, ok := n.hostBuckets[host]
+	if !ok {
+		if len(n.hostBuckets) >= maxTrackedHosts {
+			for h, hb := range n.hostBuckets {
+				if hb.full(now) {
+					delete(n.hostBuckets, h)
+				}
+			}
+		}
+		b = newTokenBucket(n.acceptRatePerIP, now)
+		n.hostBuckets[host] = b
+	}
+	if !b.allow(now) {
+		return errHostAcceptRate
+	}
+	count := 0
+	for _, p := range n.peers {
+		if peerHost(p.Addr) == host {
+			count++
+		}
+	}
+	if count >= n.maxPeersPerIP {
+		return errHostPeerCap
+	}
+	return nil
+}
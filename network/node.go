@@ -3,6 +3,7 @@ package network
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/tolelom/tolchain/core"
+	"golang.org/x/net/proxy"
 )
 
 // MessageHandler is called for each received message.
@@ -25,13 +27,34 @@ type Node struct {
 	mempool    *core.Mempool
 	tlsConfig  *tls.Config // nil → plain TCP
 	maxPeers   int
+	dialer     proxy.Dialer    // nil → dial peers directly
+	chainID    string          // if set, gossiped transactions must carry it
+	seen       *seenCache      // recently gossiped transactions
+	intake     *core.Intake    // nil → gossiped transactions are added to the mempool directly
+	height     func() int64    // local chain height announced in hello; nil → 0
+	allowed    map[string]bool // peer node IDs allowed to connect; nil → any
 
 	mu       sync.RWMutex
 	peers    map[string]*Peer
 	handlers map[MsgType]MessageHandler
 
+	banThreshold int
+	banDuration  time.Duration
+	bans         map[string]time.Time // peer ID or host → ban expiry
+
+	maxPeersPerIP   int
+	acceptRate      int
+	acceptRatePerIP int
+	acceptBucket    *tokenBucket            // nil → created on first accept
+	hostBuckets     map[string]*tokenBucket // host → its accept rate limiter
+
+	pingInterval  time.Duration
+	pingMaxMissed int
+	readTimeout   time.Duration
+
 	listener net.Listener
 	stopCh   chan struct{}
+	wg       sync.WaitGroup // running readLoops
 }
 
 // NewNode creates a Node that will listen on listenAddr.
@@ -43,12 +66,28 @@ func NewNode(nodeID, listenAddr string, mempool *core.Mempool, tlsCfg *tls.Confi
 		mempool:    mempool,
 		tlsConfig:  tlsCfg,
 		maxPeers:   DefaultMaxPeers,
+		seen:       newSeenCache(DefaultSeenTxCacheSize, DefaultSeenTxTTL),
 		peers:      make(map[string]*Peer),
 		handlers:   make(map[MsgType]MessageHandler),
 		stopCh:     make(chan struct{}),
+
+		banThreshold: DefaultBanThreshold,
+		banDuration:  DefaultBanDuration,
+		bans:         make(map[string]time.Time),
+
+		maxPeersPerIP:   DefaultMaxPeersPerIP,
+		acceptRate:      DefaultAcceptRate,
+		acceptRatePerIP: DefaultAcceptRatePerIP,
+		hostBuckets:     make(map[string]*tokenBucket),
+
+		pingInterval:  DefaultPingInterval,
+		pingMaxMissed: DefaultPingMaxMissed,
+		readTimeout:   DefaultReadTimeout,
 	}
 	// Register default handlers
 	n.Handle(MsgTx, n.handleTx)
+	n.Handle(MsgPing, n.handlePing)
+	n.Handle(MsgPong, n.handlePong)
 	return n
 }
 
@@ -59,6 +98,35 @@ func (n *Node) Handle(typ MsgType, h MessageHandler) {
 	n.handlers[typ] = h
 }
 
+// SetIntake makes the node admit gossiped transactions through in rather
+// than verifying them on the peer's read loop. A transaction is relayed
+// once the intake has added it to the mempool. Must be called before Start.
+func (n *Node) SetIntake(in *core.Intake) {
+	n.intake = in
+}
+
+// SetChainID makes the node drop gossiped transactions signed for a
+// different chain instead of adding them to the mempool.
+func (n *Node) SetChainID(chainID string) {
+	n.chainID = chainID
+}
+
+// SetProxy routes outgoing peer connections through the SOCKS5 proxy at
+// socksAddr (e.g. a local Tor daemon on 127.0.0.1:9050). Inbound
+// connections are unaffected. An empty address restores direct dialing.
+func (n *Node) SetProxy(socksAddr string) error {
+	if socksAddr == "" {
+		n.dialer = nil
+		return nil
+	}
+	d, err := proxy.SOCKS5("tcp", socksAddr, nil, proxy.Direct)
+	if err != nil {
+		return fmt.Errorf("socks5 proxy %s: %w", socksAddr, err)
+	}
+	n.dialer = d
+	return nil
+}
+
 // Start begins accepting connections.
 func (n *Node) Start() error {
 	var ln net.Listener
@@ -73,35 +141,62 @@ func (n *Node) Start() error {
 	}
 	n.listener = ln
 	go n.acceptLoop()
+	go n.pingLoop()
+	return nil
+}
+
+// Addr returns the listener's address. Useful when started on ":0".
+func (n *Node) Addr() net.Addr {
+	if n.listener != nil {
+		return n.listener.Addr()
+	}
 	return nil
 }
 
-// Stop shuts down the node.
+// Stop shuts down the node and waits for in-flight message handlers to
+// return, so callers may safely release shared resources afterwards.
 func (n *Node) Stop() {
 	close(n.stopCh)
 	if n.listener != nil {
 		n.listener.Close()
 	}
 	n.mu.Lock()
-	defer n.mu.Unlock()
 	for _, p := range n.peers {
 		p.Close()
 	}
+	n.mu.Unlock()
+	n.wg.Wait()
 }
 
 // AddPeer dials addr and registers the peer.
 func (n *Node) AddPeer(id, addr string) error {
-	peer, err := Connect(id, addr, n.tlsConfig)
+	if n.IsBanned(id) || n.IsBanned(addr) {
+		return fmt.Errorf("peer %s (%s) is banned", id, addr)
+	}
+	if n.allowed != nil && !n.allowed[id] {
+		return fmt.Errorf("peer %s is not in the allowed peer list", id)
+	}
+	peer, err := ConnectVia(id, addr, n.tlsConfig, n.dialer)
 	if err != nil {
 		return err
 	}
+	if err := n.admitOutbound(peer, id); err != nil {
+		peer.Close()
+		return err
+	}
 	n.mu.Lock()
+	peer.readTimeout.Store(int64(n.readTimeout))
 	n.peers[id] = peer
 	n.mu.Unlock()
+	n.wg.Add(1)
 	go n.readLoop(peer)
 
 	// Send hello
-	hello, err := json.Marshal(map[string]string{"node_id": n.nodeID})
+	h := Hello{NodeID: n.nodeID}
+	if n.height != nil {
+		h.Height = n.height()
+	}
+	hello, err := json.Marshal(h)
 	if err != nil {
 		log.Printf("[network] marshal hello: %v", err)
 		return nil
@@ -112,6 +207,13 @@ func (n *Node) AddPeer(id, addr string) error {
 	return nil
 }
 
+// PeerCount returns the number of connected peers.
+func (n *Node) PeerCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.peers)
+}
+
 // Peer returns the connected peer with the given id, or nil if not found.
 func (n *Node) Peer(id string) *Peer {
 	n.mu.RLock()
@@ -119,28 +221,39 @@ func (n *Node) Peer(id string) *Peer {
 	return n.peers[id]
 }
 
-// Broadcast sends msg to all connected peers.
-func (n *Node) Broadcast(msg Message) {
+// Peers returns the currently connected peers in no particular order.
+func (n *Node) Peers() []*Peer {
 	n.mu.RLock()
+	defer n.mu.RUnlock()
 	peers := make([]*Peer, 0, len(n.peers))
 	for _, p := range n.peers {
 		peers = append(peers, p)
 	}
-	n.mu.RUnlock()
-	for _, p := range peers {
+	return peers
+}
+
+// Broadcast sends msg to all connected peers. With an allowed peer list,
+// inbound peers that have not yet identified themselves are skipped.
+func (n *Node) Broadcast(msg Message) {
+	for _, p := range n.Peers() {
+		if !n.admitted(p) {
+			continue
+		}
 		if err := p.Send(msg); err != nil {
 			log.Printf("[network] broadcast to %s: %v", p.ID, err)
 		}
 	}
 }
 
-// BroadcastTx serialises tx and sends it to all peers.
+// BroadcastTx serialises tx and sends it to all peers. The transaction is
+// marked as seen, so copies relayed back by peers are dropped.
 func (n *Node) BroadcastTx(tx *core.Transaction) {
 	data, err := json.Marshal(tx)
 	if err != nil {
 		log.Printf("[network] marshal tx: %v", err)
 		return
 	}
+	n.seen.add(data, time.Now())
 	n.Broadcast(Message{Type: MsgTx, Payload: data})
 }
 
@@ -167,6 +280,16 @@ func (n *Node) acceptLoop() {
 				continue
 			}
 		}
+		if n.IsBanned(conn.RemoteAddr().String()) {
+			log.Printf("[network] rejecting banned peer %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		if err := n.admitInbound(peerHost(conn.RemoteAddr().String())); err != nil {
+			log.Printf("[network] rejecting %s: %v", conn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
 		n.mu.RLock()
 		peerCount := len(n.peers)
 		n.mu.RUnlock()
@@ -177,13 +300,16 @@ func (n *Node) acceptLoop() {
 		}
 		peer := NewPeer(conn.RemoteAddr().String(), conn.RemoteAddr().String(), conn)
 		n.mu.Lock()
+		peer.readTimeout.Store(int64(n.readTimeout))
 		n.peers[peer.ID] = peer
 		n.mu.Unlock()
+		n.wg.Add(1)
 		go n.readLoop(peer)
 	}
 }
 
 func (n *Node) readLoop(peer *Peer) {
+	defer n.wg.Done()
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("[network] readLoop panic from %s: %v", peer.ID, r)
@@ -193,27 +319,90 @@ func (n *Node) readLoop(peer *Peer) {
 		delete(n.peers, peer.ID)
 		n.mu.Unlock()
 	}()
+	if !n.admitted(peer) && !n.admitInboundCert(peer) {
+		return
+	}
 	for {
 		msg, err := peer.Receive()
 		if err != nil {
+			var syntaxErr *json.SyntaxError
+			switch {
+			case errors.Is(err, ErrMessageTooLarge):
+				n.Penalize(peer, PenaltyOversizedMessage, err.Error())
+			case errors.As(err, &syntaxErr):
+				n.Penalize(peer, PenaltyProtocol, "malformed message: "+err.Error())
+			}
+			return
+		}
+		if !n.admitted(peer) && !n.admitHello(peer, msg) {
 			return
 		}
 		n.mu.RLock()
 		h, ok := n.handlers[msg.Type]
 		n.mu.RUnlock()
 		if ok {
-			h(peer, msg)
+			n.dispatch(h, peer, msg)
 		}
 	}
 }
 
-func (n *Node) handleTx(_ *Peer, msg Message) {
+// dispatch runs a message handler, turning a panic into a protocol penalty
+// so that one malformed message cannot tear down the peer's read loop.
+func (n *Node) dispatch(h MessageHandler, peer *Peer, msg Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[network] %s handler panic from %s: %v", msg.Type, peer.ID, r)
+			n.Penalize(peer, PenaltyProtocol, fmt.Sprintf("%s message crashed its handler", msg.Type))
+		}
+	}()
+	h(peer, msg)
+}
+
+// handleTx adds a gossiped transaction to the mempool and relays it to the
+// other peers. A transaction already seen is dropped before it is decoded
+// and verified again.
+func (n *Node) handleTx(peer *Peer, msg Message) {
+	if !n.seen.add(msg.Payload, time.Now()) {
+		return
+	}
 	var tx core.Transaction
 	if err := json.Unmarshal(msg.Payload, &tx); err != nil {
-		log.Printf("[network] unmarshal tx: %v", err)
+		n.Penalize(peer, PenaltyProtocol, "unmarshal tx: "+err.Error())
+		return
+	}
+	if n.chainID != "" && tx.ChainID != n.chainID {
+		n.Penalize(peer, PenaltyProtocol, fmt.Sprintf("tx %s for foreign chain %q", tx.ID, tx.ChainID))
+		return
+	}
+	if n.intake != nil {
+		err := n.intake.Submit(&tx, func(err error) {
+			if err != nil {
+				log.Printf("[network] mempool add: %v", err)
+				return
+			}
+			n.relay(peer, msg)
+		})
+		if err != nil {
+			log.Printf("[network] tx %s from %s: %v", tx.ID, peer.ID, err)
+		}
 		return
 	}
 	if err := n.mempool.Add(&tx); err != nil {
 		log.Printf("[network] mempool add: %v", err)
+		return
+	}
+	n.relay(peer, msg)
+}
+
+// relay forwards a gossiped message to every admitted peer except the one
+// it came from.
+func (n *Node) relay(from *Peer, msg Message) {
+	for _, p := range n.Peers() {
+		if p == from || !n.admitted(p) {
+			continue
+		}
+		if err := p.Send(msg); err != nil {
+			log.Printf("[network] relay tx to %s: %v", p.ID, err)
+		}
 	}
 }
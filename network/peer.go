@@ -6,11 +6,15 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // MsgType labels a network message.
@@ -22,8 +26,24 @@ const (
 	MsgBlock     MsgType = "block"
 	MsgGetBlocks MsgType = "get_blocks"
 	MsgBlocks    MsgType = "blocks"
+	MsgPing      MsgType = "ping"
+	MsgPong      MsgType = "pong"
 )
 
+// MaxMessageSize is the largest message a peer may send.
+const MaxMessageSize = 10 * 1024 * 1024
+
+// ErrMessageTooLarge is returned by Receive when a peer announces a message
+// larger than MaxMessageSize.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// Hello is the payload of MsgHello, sent by the dialing side of a
+// connection.
+type Hello struct {
+	NodeID string `json:"node_id"`
+	Height int64  `json:"height"` // sender's chain height
+}
+
 // Message is the envelope for all P2P communication.
 type Message struct {
 	Type    MsgType         `json:"type"`
@@ -38,6 +58,15 @@ type Peer struct {
 	conn   net.Conn
 	mu     sync.Mutex
 	closed bool
+	score  int // accumulated misbehaviour penalties
+
+	readTimeout atomic.Int64 // time.Duration; 0 → DefaultReadTimeout
+	pingsMissed atomic.Int32 // consecutive pings sent without a pong
+	height      atomic.Int64 // highest chain height the peer has claimed and not failed to serve
+	greeted     atomic.Bool  // the height in the peer's hello has been recorded
+
+	certID   string      // CommonName of an inbound peer's TLS certificate; "" without TLS
+	admitted atomic.Bool // passed the node's allowed peer list
 }
 
 // NewPeer wraps an established TCP connection as a Peer.
@@ -48,16 +77,38 @@ func NewPeer(id, addr string, conn net.Conn) *Peer {
 // Connect dials the remote address and returns a connected Peer.
 // If tlsCfg is non-nil the connection is established over TLS.
 func Connect(id, addr string, tlsCfg *tls.Config) (*Peer, error) {
-	var conn net.Conn
-	var err error
-	if tlsCfg != nil {
-		conn, err = tls.Dial("tcp", addr, tlsCfg)
-	} else {
-		conn, err = net.Dial("tcp", addr)
+	return ConnectVia(id, addr, tlsCfg, nil)
+}
+
+// ConnectVia is like Connect but opens the TCP connection through d
+// (e.g. a SOCKS5 proxy). A nil d dials directly.
+func ConnectVia(id, addr string, tlsCfg *tls.Config, d proxy.Dialer) (*Peer, error) {
+	if d == nil {
+		d = proxy.Direct
 	}
+	conn, err := d.Dial("tcp", addr)
 	if err != nil {
 		return nil, fmt.Errorf("connect to %s: %w", addr, err)
 	}
+	if tlsCfg != nil {
+		cfg := tlsCfg
+		if cfg.ServerName == "" {
+			// Mirror tls.Dial, which derives ServerName from addr.
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("connect to %s: %w", addr, err)
+			}
+			cfg = tlsCfg.Clone()
+			cfg.ServerName = host
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("connect to %s: tls handshake: %w", addr, err)
+		}
+		conn = tlsConn
+	}
 	return NewPeer(id, addr, conn), nil
 }
 
@@ -86,9 +137,14 @@ func (p *Peer) Send(msg Message) error {
 }
 
 // Receive reads the next length-prefixed JSON message.
-// A 30-second read deadline prevents a stalled peer from blocking indefinitely.
+// A read deadline (DefaultReadTimeout unless the node's keep-alive settings
+// say otherwise) prevents a stalled peer from blocking indefinitely.
 func (p *Peer) Receive() (Message, error) {
-	if err := p.conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+	timeout := time.Duration(p.readTimeout.Load())
+	if timeout <= 0 {
+		timeout = DefaultReadTimeout
+	}
+	if err := p.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
 		return Message{}, fmt.Errorf("set read deadline: %w", err)
 	}
 	var header [4]byte
@@ -96,8 +152,8 @@ func (p *Peer) Receive() (Message, error) {
 		return Message{}, err
 	}
 	length := binary.BigEndian.Uint32(header[:])
-	if length > 10*1024*1024 { // 10 MB safety limit
-		return Message{}, fmt.Errorf("message too large: %d bytes", length)
+	if length > MaxMessageSize {
+		return Message{}, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, length)
 	}
 	buf := make([]byte, length)
 	if _, err := io.ReadFull(p.conn, buf); err != nil {
@@ -110,6 +166,47 @@ func (p *Peer) Receive() (Message, error) {
 	return msg, nil
 }
 
+// Height returns the highest chain height the peer has claimed, or 0 if it
+// has claimed none or failed to serve the blocks its claim implies. Peers
+// report heights about themselves unchecked, so the syncer withdraws a
+// claim the peer does not back with blocks.
+func (p *Peer) Height() int64 {
+	return p.height.Load()
+}
+
+// noteHello records the height in the peer's hello. Only the first hello of
+// a connection counts, so that a peer cannot renew a claim it failed to
+// serve by greeting again.
+func (p *Peer) noteHello(h int64) {
+	if p.greeted.CompareAndSwap(false, true) {
+		p.noteHeight(h)
+	}
+}
+
+// dropHeight withdraws the peer's height claim.
+func (p *Peer) dropHeight() {
+	p.height.Store(0)
+}
+
+// noteHeight records a chain height reported by the peer, keeping the
+// highest.
+func (p *Peer) noteHeight(h int64) {
+	for {
+		cur := p.height.Load()
+		if h <= cur || p.height.CompareAndSwap(cur, h) {
+			return
+		}
+	}
+}
+
+// addScore adds points to the peer's misbehaviour score and returns the total.
+func (p *Peer) addScore(points int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.score += points
+	return p.score
+}
+
 // Close terminates the peer connection.
 func (p *Peer) Close() {
 	p.mu.Lock()
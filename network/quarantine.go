@@ -0,0 +1,59 @@
+package network
+
+import (
+	"log"
+	"time"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// MaxQuarantinedBlocks bounds how many blocks the syncer holds back at once
+// because their timestamps are slightly ahead of the local clock.
+const MaxQuarantinedBlocks = MaxSyncBlocks
+
+// quarantine holds blocks, the first of which is ahead of the local clock,
+// and applies them again after wait, when the clock has caught up. This
+// keeps a peer with a slightly fast clock from stalling sync without
+// accepting its blocks early. It reports whether the blocks were held; they
+// are dropped instead when the same blocks are already held or the
+// quarantine is full. Callers must hold applyMu.
+func (s *Syncer) quarantine(peer *Peer, blocks []*core.Block, wait time.Duration) bool {
+	first := blocks[0]
+	s.mu.Lock()
+	if _, ok := s.quarantined[first.Hash]; ok {
+		s.mu.Unlock()
+		return true
+	}
+	total := 0
+	for _, n := range s.quarantined {
+		total += n
+	}
+	if total+len(blocks) > MaxQuarantinedBlocks {
+		s.mu.Unlock()
+		log.Printf("[sync] quarantine full, dropping %d future blocks from %s", len(blocks), peer.ID)
+		return false
+	}
+	s.quarantined[first.Hash] = len(blocks)
+	s.mu.Unlock()
+
+	log.Printf("[sync] block %d from %s is ahead of our clock, retrying in %s", first.Header.Height, peer.ID, wait)
+	time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		delete(s.quarantined, first.Hash)
+		s.mu.Unlock()
+		select {
+		case <-s.node.stopCh:
+			return
+		default:
+		}
+
+		s.applyMu.Lock()
+		held := s.applyBlocks(peer, blocks)
+		s.applyMu.Unlock()
+		last := blocks[len(blocks)-1]
+		if !held && s.bc.Height() >= last.Header.Height {
+			s.SyncWithPeer(peer) // resume where the held blocks left off
+		}
+	})
+	return true
+}
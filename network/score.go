@@ -0,0 +1,87 @@
+package network
+
+import (
+	"log"
+	"net"
+	"time"
+)
+
+// Misbehaviour penalties. A peer whose accumulated score reaches the node's
+// ban threshold is disconnected and banned.
+const (
+	PenaltyInvalidBlock     = 25 // block failed validation, checkpoint or state root checks
+	PenaltyOversizedMessage = 100
+	PenaltyProtocol         = 10 // malformed message or payload
+)
+
+// Defaults for SetBanPolicy.
+const (
+	DefaultBanThreshold = 100
+	DefaultBanDuration  = 10 * time.Minute
+)
+
+// SetBanPolicy sets the score at which a peer is banned and how long the
+// ban lasts. Non-positive values keep the current setting.
+func (n *Node) SetBanPolicy(threshold int, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if threshold > 0 {
+		n.banThreshold = threshold
+	}
+	if d > 0 {
+		n.banDuration = d
+	}
+}
+
+// Penalize adds points to peer's misbehaviour score. Once the score reaches
+// the ban threshold the peer is disconnected and its ID and host are banned
+// for the ban duration.
+func (n *Node) Penalize(peer *Peer, points int, reason string) {
+	score := peer.addScore(points)
+	n.mu.Lock()
+	threshold, d := n.banThreshold, n.banDuration
+	if score < threshold {
+		n.mu.Unlock()
+		log.Printf("[network] peer %s penalized %d (%s), score %d/%d", peer.ID, points, reason, score, threshold)
+		return
+	}
+	until := time.Now().Add(d)
+	n.bans[peer.ID] = until
+	if host := peerHost(peer.Addr); host != "" {
+		n.bans[host] = until
+	}
+	n.mu.Unlock()
+	log.Printf("[network] banning peer %s (%s) for %s: score %d (%s)", peer.ID, peer.Addr, d, score, reason)
+	peer.Close()
+}
+
+// IsBanned reports whether a peer ID or address (host or host:port) is
+// currently banned.
+func (n *Node) IsBanned(idOrAddr string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.bannedLocked(idOrAddr) || n.bannedLocked(peerHost(idOrAddr))
+}
+
+// bannedLocked checks a single ban key, dropping it once expired.
+// Callers must hold n.mu.
+func (n *Node) bannedLocked(key string) bool {
+	until, ok := n.bans[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(n.bans, key)
+		return false
+	}
+	return true
+}
+
+// peerHost returns the host part of addr, or "" if addr has no port.
+func peerHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// Defaults for SetSeenTxCache.
+const (
+	DefaultSeenTxCacheSize = 20000            // gossiped transactions remembered
+	DefaultSeenTxTTL       = 10 * time.Minute // how long one is remembered
+)
+
+// SetSeenTxCache bounds the cache of recently gossiped transactions by
+// entry count and age. Non-positive values keep the current setting.
+func (n *Node) SetSeenTxCache(size int, ttl time.Duration) {
+	n.seen.mu.Lock()
+	defer n.seen.mu.Unlock()
+	if size > 0 {
+		n.seen.size = size
+	}
+	if ttl > 0 {
+		n.seen.ttl = ttl
+	}
+}
+
+// seenCache remembers the encoded transactions a node has recently received
+// or sent, so that a transaction pushed by several peers is verified and
+// relayed only once. Entries are keyed by a hash of the message payload
+// rather than the claimed tx ID, so a forged copy carrying a valid ID cannot
+// shadow the real transaction.
+type seenCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	at    map[[sha256.Size]byte]time.Time // key → time first seen
+	queue []seenEntry                     // oldest first
+}
+
+type seenEntry struct {
+	key [sha256.Size]byte
+	at  time.Time
+}
+
+func newSeenCache(size int, ttl time.Duration) *seenCache {
+	return &seenCache{size: size, ttl: ttl, at: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// add records payload as seen and reports whether it was new, i.e. not
+// seen within the TTL.
+func (c *seenCache) add(payload []byte, now time.Time) bool {
+	key := sha256.Sum256(payload)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(now)
+	if _, ok := c.at[key]; ok {
+		return false
+	}
+	c.at[key] = now
+	c.queue = append(c.queue, seenEntry{key: key, at: now})
+	return true
+}
+
+// prune drops entries older than the TTL and, oldest first, any beyond the
+// size bound. Callers must hold mu.
+func (c *seenCache) prune(now time.Time) {
+	drop := 0
+	for drop < len(c.queue) {
+		e := c.queue[drop]
+		if now.Sub(e.at) < c.ttl && len(c.queue)-drop < c.size {
+			break
+		}
+		delete(c.at, e.key)
+		drop++
+	}
+	c.queue = c.queue[drop:]
+}
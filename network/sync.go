@@ -1,8 +1,15 @@
 package network
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/tolelom/tolchain/core"
 )
@@ -13,19 +20,49 @@ type GetBlocksRequest struct {
 	Limit      int   `json:"limit"`
 }
 
-// BlocksResponse carries a batch of blocks.
+// BlocksResponse carries a batch of blocks. Truncated is set when the
+// sender stopped early to stay within its byte budget; the requester should
+// ask again from its new height.
 type BlocksResponse struct {
-	Blocks []*core.Block `json:"blocks"`
+	Blocks    []*core.Block `json:"blocks"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Height    int64         `json:"height,omitempty"` // sender's chain height
 }
 
+// blocksPayload has the wire shape of BlocksResponse but carries blocks that
+// are already serialised, so their size can be budgeted as they are added.
+type blocksPayload struct {
+	Blocks    []json.RawMessage `json:"blocks"`
+	Truncated bool              `json:"truncated,omitempty"`
+	Height    int64             `json:"height,omitempty"`
+}
+
+// Structural limits on a blocks response, enforced while it is decoded so
+// that a peer cannot pack millions of tiny blocks or transactions into one
+// message and make us decode them all. A peer exceeding them is dropped.
+const (
+	MaxSyncBlocks   = 200   // blocks per response; the largest get_blocks limit served
+	MaxSyncBlockTxs = 10000 // transactions per synced block
+)
+
+// errSyncLimit marks a blocks response that exceeds a structural limit.
+var errSyncLimit = errors.New("sync limit exceeded")
+
+// DefaultMaxBatchBytes bounds the serialised size of a blocks response,
+// keeping it well below MaxMessageSize.
+const DefaultMaxBatchBytes = 8 * 1024 * 1024
+
 // BlockValidator validates a block before it is accepted into the chain.
 type BlockValidator interface {
 	ValidateBlock(block *core.Block) error
 }
 
 // BlockExecutor applies all transactions in a block against the state.
+// PublishEvents delivers the events of the executed block once it has been
+// committed.
 type BlockExecutor interface {
 	ExecuteBlock(block *core.Block) error
+	PublishEvents(block *core.Block)
 }
 
 // Syncer handles block synchronisation between nodes.
@@ -35,21 +72,82 @@ type Syncer struct {
 	validator BlockValidator
 	exec      BlockExecutor // may be nil; if set, state is also required
 	state     core.State    // may be nil; used with exec to commit after each block
+
+	checkpoints   map[int64]string // height → required block hash
+	maxBatchBytes int              // byte budget for a blocks response
+
+	applyMu sync.Mutex // serialises applying blocks received from different peers
+
+	mu          sync.Mutex
+	pending     map[string]*blockRequest // peer ID → outstanding request
+	timeout     time.Duration
+	backoff     time.Duration
+	maxRetries  int
+	quarantined map[string]int // first block hash → blocks held for a future timestamp
 }
 
 // NewSyncer creates a Syncer that requests missing blocks from peers.
 // Pass non-nil exec and state so that synced blocks are fully applied to the
 // local state; without them the node will have blocks but no account/asset state.
 func NewSyncer(node *Node, bc *core.Blockchain, validator BlockValidator, exec BlockExecutor, state core.State) *Syncer {
-	s := &Syncer{node: node, bc: bc, validator: validator, exec: exec, state: state}
+	s := &Syncer{
+		node: node, bc: bc, validator: validator, exec: exec, state: state,
+		maxBatchBytes: DefaultMaxBatchBytes,
+		pending:       make(map[string]*blockRequest),
+		timeout:       DefaultSyncTimeout,
+		backoff:       DefaultSyncBackoff,
+		maxRetries:    DefaultSyncMaxRetries,
+		quarantined:   make(map[string]int),
+	}
+	node.height = bc.Height
 	node.Handle(MsgHello, s.handleHello)
 	node.Handle(MsgGetBlocks, s.handleGetBlocks)
 	node.Handle(MsgBlocks, s.handleBlocks)
+	node.Handle(MsgBlock, s.handleBlock)
 	return s
 }
 
-// handleHello triggers an initial block sync when a peer announces itself.
-func (s *Syncer) handleHello(peer *Peer, _ Message) {
+// SetCheckpoints installs trusted height → block hash pairs. A synced block
+// at a checkpoint height must carry exactly that hash; otherwise the batch
+// is abandoned so the node never follows a chain that diverges from it.
+func (s *Syncer) SetCheckpoints(checkpoints map[int64]string) {
+	s.checkpoints = checkpoints
+}
+
+// SetMaxBatchBytes caps the cumulative serialised size of the blocks sent
+// in reply to one get_blocks request. A batch always holds at least one
+// block so that sync can progress. Non-positive n keeps the default.
+func (s *Syncer) SetMaxBatchBytes(n int) {
+	if n > 0 {
+		s.maxBatchBytes = n
+	}
+}
+
+// Syncing reports whether the node is catching up: some connected peer
+// claims a chain taller than ours (see Peer.Height). A peer's first hello
+// makes a claim that holds while the blocks requested from it are in
+// flight; a later blocks response raises it only if its blocks were
+// applied. The claim is withdrawn when a request to the peer fails or times
+// out, or when it answers without a block we could use, so a peer that
+// announces a height it cannot serve stalls block production for at most
+// one request timeout.
+func (s *Syncer) Syncing() bool {
+	height := s.bc.Height()
+	for _, p := range s.node.Peers() {
+		if p.Height() > height {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHello records the height a peer announces and triggers an initial
+// block sync from it.
+func (s *Syncer) handleHello(peer *Peer, msg Message) {
+	var hello Hello
+	if err := json.Unmarshal(msg.Payload, &hello); err == nil {
+		peer.noteHello(hello.Height)
+	}
 	fromHeight := s.bc.Height() + 1
 	if err := s.RequestBlocks(peer, fromHeight); err != nil {
 		log.Printf("[sync] failed to request blocks from %s: %v", peer.ID, err)
@@ -65,32 +163,44 @@ func (s *Syncer) SyncWithPeer(peer *Peer) {
 	}
 }
 
-// RequestBlocks asks peer for blocks starting at fromHeight.
+// RequestBlocks asks peer for blocks starting at fromHeight. If the peer
+// fails to answer in time the request is retried with exponential backoff,
+// preferring other connected peers (see SetRetryPolicy).
 func (s *Syncer) RequestBlocks(peer *Peer, fromHeight int64) error {
-	req, err := json.Marshal(GetBlocksRequest{FromHeight: fromHeight, Limit: 50})
-	if err != nil {
-		return err
-	}
-	return peer.Send(Message{Type: MsgGetBlocks, Payload: req})
+	return s.request(peer, fromHeight, 0, nil)
 }
 
 func (s *Syncer) handleGetBlocks(peer *Peer, msg Message) {
 	var req GetBlocksRequest
 	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		s.node.Penalize(peer, PenaltyProtocol, "unmarshal get_blocks: "+err.Error())
 		return
 	}
-	if req.Limit <= 0 || req.Limit > 200 {
+	if req.Limit <= 0 || req.Limit > MaxSyncBlocks {
 		req.Limit = 50
 	}
-	blocks := make([]*core.Block, 0, req.Limit)
+	// Blocks are serialised one at a time so that a peer cannot make us
+	// hold an unbounded batch in memory; stop once the budget is spent.
+	resp := blocksPayload{Blocks: make([]json.RawMessage, 0, req.Limit), Height: s.bc.Height()}
+	size := 0
 	for h := req.FromHeight; h < req.FromHeight+int64(req.Limit); h++ {
 		b, err := s.bc.GetBlockByHeight(h)
 		if err != nil {
 			break
 		}
-		blocks = append(blocks, b)
+		raw, err := json.Marshal(b)
+		if err != nil {
+			log.Printf("[sync] marshal block %d: %v", h, err)
+			break
+		}
+		if len(resp.Blocks) > 0 && size+len(raw) > s.maxBatchBytes {
+			resp.Truncated = true
+			break
+		}
+		resp.Blocks = append(resp.Blocks, raw)
+		size += len(raw)
 	}
-	data, err := json.Marshal(BlocksResponse{Blocks: blocks})
+	data, err := json.Marshal(resp)
 	if err != nil {
 		log.Printf("[sync] marshal blocks response: %v", err)
 		return
@@ -101,15 +211,107 @@ func (s *Syncer) handleGetBlocks(peer *Peer, msg Message) {
 }
 
 func (s *Syncer) handleBlocks(peer *Peer, msg Message) {
-	var resp BlocksResponse
-	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+	resp, err := decodeBlocksResponse(msg.Payload)
+	if errors.Is(err, errSyncLimit) {
+		s.node.Penalize(peer, PenaltyOversizedMessage, "blocks response: "+err.Error())
+		return
+	}
+	if err != nil {
+		s.node.Penalize(peer, PenaltyProtocol, "unmarshal blocks: "+err.Error())
+		return
+	}
+	// A response to a request that already timed out and was handed to
+	// another peer is unsolicited: its blocks may still be applied, but it
+	// does not drive further requests.
+	solicited := s.complete(peer.ID)
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	before := s.bc.Height()
+	held := s.applyBlocks(peer, resp.Blocks)
+
+	// The height the peer claims is believed only as far as it serves: a
+	// solicited response that extended our chain backs the claim (and the
+	// follow-up request below puts the rest of it to the test), one that
+	// served nothing usable withdraws it.
+	switch {
+	case held:
+	case solicited && s.bc.Height() > before:
+		peer.noteHeight(resp.Height)
+	case solicited:
+		peer.dropHeight()
+	}
+
+	// If we received a full or truncated batch, or the peer claims more
+	// blocks, keep requesting. Held-back blocks resume sync once they are
+	// applied.
+	more := len(resp.Blocks) >= 50 || (resp.Truncated && len(resp.Blocks) > 0) || peer.Height() > s.bc.Height()
+	if solicited && !held && more {
+		nextHeight := s.bc.Height() + 1
+		if err := s.RequestBlocks(peer, nextHeight); err != nil {
+			log.Printf("[sync] follow-up request to %s failed: %v", peer.ID, err)
+		}
+	}
+}
+
+// handleBlock applies a single block pushed by a peer. It goes through the
+// same checks as a synced block; one that does not extend the tip is
+// dropped.
+func (s *Syncer) handleBlock(peer *Peer, msg Message) {
+	b, err := decodeBlock(msg.Payload)
+	if errors.Is(err, errSyncLimit) {
+		s.node.Penalize(peer, PenaltyOversizedMessage, "block: "+err.Error())
+		return
+	}
+	if err != nil {
+		s.node.Penalize(peer, PenaltyProtocol, "unmarshal block: "+err.Error())
 		return
 	}
-	for _, b := range resp.Blocks {
+	s.applyMu.Lock()
+	defer s.applyMu.Unlock()
+	s.applyBlocks(peer, []*core.Block{b})
+}
+
+// applyBlocks validates, executes and appends blocks received from peer in
+// canonical order, stopping at the first one that does not fit, and removes
+// the transactions of each appended block from the mempool. A block
+// whose timestamp is only slightly ahead of our clock is quarantined along
+// with the blocks after it, and held is reported. Callers must hold applyMu.
+func (s *Syncer) applyBlocks(peer *Peer, blocks []*core.Block) (held bool) {
+	for _, b := range blocks {
+		if err := checkBlockShape(b); err != nil {
+			log.Printf("[sync] malformed block from %s: %v", peer.ID, err)
+			s.node.Penalize(peer, PenaltyInvalidBlock, "malformed block: "+err.Error())
+			return false
+		}
+	}
+	canonical := canonicalBlocks(blocks)
+	for i, b := range canonical {
+		if want, ok := s.checkpoints[b.Header.Height]; ok && b.Hash != want {
+			log.Printf("[sync] block %d from %s conflicts with checkpoint: got %s want %s", b.Header.Height, peer.ID, b.Hash, want)
+			s.node.Penalize(peer, PenaltyInvalidBlock, "checkpoint mismatch")
+			return false // stop processing blocks from this peer
+		}
+		// A block that does not extend our tip is stale or on a competing
+		// fork; honest peers send those too, so it is not penalized. A rival
+		// of the tip itself is not adopted even if core.CompareBlocks
+		// prefers it (see canonicalBlocks).
+		if tip := s.bc.Tip(); tip != nil && b.Header.Height == tip.Header.Height && b.Hash != tip.Hash && b.Header.PrevHash == tip.Header.PrevHash {
+			log.Printf("[sync] block %d from %s competes with the committed tip %s (preferred: %t); keeping the tip, proposer %s signed both", b.Header.Height, peer.ID, tip.Hash, core.CompareBlocks(b, tip) < 0, b.Header.Proposer)
+			return false
+		}
+		if tip := s.bc.Tip(); tip != nil && (b.Header.Height != tip.Header.Height+1 || b.Header.PrevHash != tip.Hash) {
+			log.Printf("[sync] block %d from %s does not extend tip %d", b.Header.Height, peer.ID, tip.Header.Height)
+			return false // stop processing blocks from this peer
+		}
 		if s.validator != nil {
 			if err := s.validator.ValidateBlock(b); err != nil {
+				var future *core.FutureBlockError
+				if errors.As(err, &future) {
+					return s.quarantine(peer, canonical[i:], future.Wait)
+				}
 				log.Printf("[sync] block %d validation failed: %v", b.Header.Height, err)
-				return // stop processing blocks from this peer
+				s.node.Penalize(peer, PenaltyInvalidBlock, "invalid block: "+err.Error())
+				return false // stop processing blocks from this peer
 			}
 		}
 
@@ -133,13 +335,21 @@ func (s *Syncer) handleBlocks(peer *Peer, msg Message) {
 
 		// (A) Verify state root matches after execution.
 		if s.exec != nil && s.state != nil {
-			computedRoot := s.state.ComputeRoot()
+			computedRoot, err := s.state.ComputeRoot()
+			if err != nil {
+				if revErr := s.state.RevertToSnapshot(snapID); revErr != nil {
+					log.Fatalf("[sync] FATAL: block %d revert failed after state root error: %v", b.Header.Height, revErr)
+				}
+				log.Printf("[sync] block %d: compute state root: %v", b.Header.Height, err)
+				return false // a local read failure, not the peer's fault
+			}
 			if b.Header.StateRoot != "" && computedRoot != b.Header.StateRoot {
 				if revErr := s.state.RevertToSnapshot(snapID); revErr != nil {
 					log.Fatalf("[sync] FATAL: block %d revert failed after state root mismatch: %v", b.Header.Height, revErr)
 				}
 				log.Printf("[sync] block %d state root mismatch: computed %s want %s", b.Header.Height, computedRoot, b.Header.StateRoot)
-				return
+				s.node.Penalize(peer, PenaltyInvalidBlock, "state root mismatch")
+				return false
 			}
 		}
 
@@ -157,14 +367,164 @@ func (s *Syncer) handleBlocks(peer *Peer, msg Message) {
 			if err := s.state.Commit(); err != nil {
 				log.Fatalf("[sync] FATAL: block %d state commit failed: %v", b.Header.Height, err)
 			}
+			s.exec.PublishEvents(b)
 		}
+		// The block's transactions reached us by gossip too; drop them
+		// so the pool does not fill with mined transactions.
+		s.node.mempool.RemoveMined(b.Transactions)
 	}
+	return false
+}
 
-	// If we received a full batch, there may be more blocks — keep requesting.
-	if len(resp.Blocks) >= 50 {
-		nextHeight := s.bc.Height() + 1
-		if err := s.RequestBlocks(peer, nextHeight); err != nil {
-			log.Printf("[sync] follow-up request to %s failed: %v", peer.ID, err)
+// checkBlockShape rejects blocks that are structurally unusable before any
+// of their fields are relied on: a null block or transaction, a missing
+// chain ID or signature, a non-positive height, malformed hashes or
+// proposer key, or a block naming itself as its parent.
+func checkBlockShape(b *core.Block) error {
+	if b == nil {
+		return errors.New("null block")
+	}
+	h := b.Header
+	switch {
+	case h.ChainID == "":
+		return errors.New("missing chain_id")
+	case h.Height <= 0:
+		return fmt.Errorf("invalid height %d", h.Height)
+	case !isHexHash(b.Hash):
+		return fmt.Errorf("invalid hash %q", b.Hash)
+	case !isHexHash(h.PrevHash):
+		return fmt.Errorf("invalid prev_hash %q", h.PrevHash)
+	case h.PrevHash == b.Hash:
+		return errors.New("block is its own parent")
+	case !isHexHash(h.Proposer): // ed25519 pubkeys are 32 bytes too
+		return fmt.Errorf("invalid proposer %q", h.Proposer)
+	case b.Signature == "":
+		return errors.New("missing signature")
+	case len(b.Transactions) > MaxSyncBlockTxs:
+		return fmt.Errorf("%d transactions exceed %d", len(b.Transactions), MaxSyncBlockTxs)
+	}
+	for i, tx := range b.Transactions {
+		if tx == nil {
+			return fmt.Errorf("null transaction %d", i)
+		}
+	}
+	return nil
+}
+
+// isHexHash reports whether s is a hex-encoded 32-byte value.
+func isHexHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// canonicalBlocks orders blocks by height and, where several candidates share
+// a height, keeps only the one preferred by core.CompareBlocks. This is the
+// only place the rule applies: it makes the resulting tip independent of the
+// order of candidates within one delivery. Candidates arriving in separate
+// deliveries are not reconciled; the first to be committed stays, since
+// there is no rollback of committed blocks and state. Only the scheduled
+// proposer can sign a valid block for a height, so such a split needs that
+// proposer to equivocate, and is logged by applyBlocks.
+func canonicalBlocks(blocks []*core.Block) []*core.Block {
+	sorted := make([]*core.Block, len(blocks))
+	copy(sorted, blocks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Header.Height != b.Header.Height {
+			return a.Header.Height < b.Header.Height
+		}
+		return core.CompareBlocks(a, b) < 0
+	})
+	out := make([]*core.Block, 0, len(sorted))
+	for _, b := range sorted {
+		if n := len(out); n > 0 && out[n-1].Header.Height == b.Header.Height {
+			continue // a preferred candidate for this height is already kept
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// decodeBlocksResponse decodes a blocks response, failing with errSyncLimit
+// as soon as it holds more than MaxSyncBlocks blocks or a block holds more
+// than MaxSyncBlockTxs transactions, before the excess is decoded.
+func decodeBlocksResponse(data []byte) (*BlocksResponse, error) {
+	var wire struct {
+		Blocks    json.RawMessage `json:"blocks"`
+		Truncated bool            `json:"truncated,omitempty"`
+		Height    int64           `json:"height,omitempty"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, err
+	}
+	raws, err := decodeBounded[json.RawMessage](wire.Blocks, MaxSyncBlocks, "blocks")
+	if err != nil {
+		return nil, err
+	}
+	resp := &BlocksResponse{Blocks: make([]*core.Block, 0, len(raws)), Truncated: wire.Truncated, Height: wire.Height}
+	for i, raw := range raws {
+		b, err := decodeBlock(raw)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		resp.Blocks = append(resp.Blocks, b)
+	}
+	return resp, nil
+}
+
+// decodeBlock decodes a block, failing with errSyncLimit once it holds more
+// than MaxSyncBlockTxs transactions. JSON null decodes to a nil block.
+func decodeBlock(data []byte) (*core.Block, error) {
+	var b *struct {
+		Header       core.BlockHeader `json:"header"`
+		Transactions json.RawMessage  `json:"transactions"`
+		Hash         string           `json:"hash"`
+		Signature    string           `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, nil
+	}
+	txs, err := decodeBounded[*core.Transaction](b.Transactions, MaxSyncBlockTxs, "transactions")
+	if err != nil {
+		return nil, err
+	}
+	return &core.Block{Header: b.Header, Transactions: txs, Hash: b.Hash, Signature: b.Signature}, nil
+}
+
+// decodeBounded decodes the JSON array data element by element, failing
+// with errSyncLimit once it would exceed max elements. A missing or null
+// array decodes to nil.
+func decodeBounded[T any](data json.RawMessage, max int, what string) ([]T, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("%s: want array", what)
+	}
+	var out []T
+	for dec.More() {
+		if len(out) == max {
+			return nil, fmt.Errorf("%w: more than %d %s", errSyncLimit, max, what)
+		}
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %w", what, err)
 		}
+		out = append(out, v)
 	}
+	return out, nil
 }
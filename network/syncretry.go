@@ -0,0 +1,144 @@
+package network
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Defaults for SetRetryPolicy.
+const (
+	DefaultSyncTimeout    = 10 * time.Second // wait for a blocks response
+	DefaultSyncBackoff    = 500 * time.Millisecond
+	DefaultSyncMaxRetries = 5
+)
+
+// maxSyncBackoff caps the delay between two attempts of one request.
+const maxSyncBackoff = 30 * time.Second
+
+// blockRequest is an outstanding get_blocks request.
+type blockRequest struct {
+	peerID     string
+	fromHeight int64
+	attempt    int             // 0 for the first try
+	tried      map[string]bool // peers already asked for this range
+	timer      *time.Timer
+}
+
+// SetRetryPolicy sets how long the syncer waits for a blocks response, the
+// base of the exponential backoff before a retry and how many retries are
+// made before giving up. Non-positive values keep the current setting.
+func (s *Syncer) SetRetryPolicy(timeout, backoff time.Duration, maxRetries int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timeout > 0 {
+		s.timeout = timeout
+	}
+	if backoff > 0 {
+		s.backoff = backoff
+	}
+	if maxRetries > 0 {
+		s.maxRetries = maxRetries
+	}
+}
+
+// request sends a get_blocks request to peer and arms its timeout. A peer
+// has at most one outstanding request; a new one replaces it.
+func (s *Syncer) request(peer *Peer, fromHeight int64, attempt int, tried map[string]bool) error {
+	data, err := json.Marshal(GetBlocksRequest{FromHeight: fromHeight, Limit: 50})
+	if err != nil {
+		return err
+	}
+	if tried == nil {
+		tried = make(map[string]bool)
+	}
+	tried[peer.ID] = true
+	req := &blockRequest{peerID: peer.ID, fromHeight: fromHeight, attempt: attempt, tried: tried}
+
+	s.mu.Lock()
+	if old := s.pending[peer.ID]; old != nil {
+		old.timer.Stop()
+	}
+	s.pending[peer.ID] = req
+	req.timer = time.AfterFunc(s.timeout, func() { s.retry(req, "timed out") })
+	s.mu.Unlock()
+
+	if err := peer.Send(Message{Type: MsgGetBlocks, Payload: data}); err != nil {
+		go s.retry(req, err.Error())
+		return err
+	}
+	return nil
+}
+
+// complete clears the outstanding request to peer and reports whether
+// there was one.
+func (s *Syncer) complete(peerID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := s.pending[peerID]
+	if req == nil {
+		return false
+	}
+	req.timer.Stop()
+	delete(s.pending, peerID)
+	return true
+}
+
+// retry abandons req and, after an exponential backoff, asks another peer —
+// or the same one when no other is connected — for the blocks still missing.
+func (s *Syncer) retry(req *blockRequest, reason string) {
+	s.mu.Lock()
+	if s.pending[req.peerID] != req {
+		s.mu.Unlock()
+		return // answered or superseded meanwhile
+	}
+	delete(s.pending, req.peerID)
+	attempt := req.attempt + 1
+	maxRetries, delay := s.maxRetries, s.backoff<<req.attempt
+	s.mu.Unlock()
+
+	// A peer that does not answer no longer counts as ahead of us.
+	if peer := s.node.Peer(req.peerID); peer != nil {
+		peer.dropHeight()
+	}
+
+	log.Printf("[sync] request for blocks from %d to %s %s", req.fromHeight, req.peerID, reason)
+	if attempt > maxRetries {
+		log.Printf("[sync] giving up on blocks from %d after %d retries", req.fromHeight, maxRetries)
+		return
+	}
+	if delay <= 0 || delay > maxSyncBackoff {
+		delay = maxSyncBackoff
+	}
+	time.AfterFunc(delay, func() {
+		peer := s.nextPeer(req.tried)
+		if peer == nil {
+			log.Printf("[sync] no peer to retry blocks from %d", req.fromHeight)
+			return
+		}
+		if err := s.request(peer, s.bc.Height()+1, attempt, req.tried); err != nil {
+			log.Printf("[sync] retry request to %s failed: %v", peer.ID, err)
+		}
+	})
+}
+
+// nextPeer picks an admitted peer not yet in tried; once every peer has
+// been tried, tried is cleared and any admitted peer may be picked again.
+func (s *Syncer) nextPeer(tried map[string]bool) *Peer {
+	var peers []*Peer
+	for _, p := range s.node.Peers() {
+		if s.node.admitted(p) {
+			peers = append(peers, p)
+		}
+	}
+	for _, p := range peers {
+		if !tried[p.ID] {
+			return p
+		}
+	}
+	if len(peers) == 0 {
+		return nil
+	}
+	clear(tried)
+	return peers[0]
+}
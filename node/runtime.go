@@ -0,0 +1,441 @@
+// Package node assembles the chain subsystems into a running node and owns
+// their startup and shutdown order.
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/consensus"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/indexer"
+	"github.com/tolelom/tolchain/network"
+	"github.com/tolelom/tolchain/rpc"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/vm"
+)
+
+// DefaultBlockInterval is the block production interval when the config
+// leaves block_interval_ms unset.
+const DefaultBlockInterval = 2 * time.Second
+
+// DefaultStuckTxThreshold is how long a transaction may wait in the mempool
+// before the runtime logs it as stuck, when the config leaves
+// stuck_tx_threshold_ms unset.
+const DefaultStuckTxThreshold = 10 * time.Minute
+
+// DefaultShutdownTimeout bounds Stop when the config leaves
+// shutdown_timeout_ms unset.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Runtime owns every subsystem of a node. Start brings them up in
+// dependency order; Stop tears them down in reverse, guaranteeing the
+// consensus loop has drained before the database is closed.
+type Runtime struct {
+	cfg       *config.Config
+	privKey   crypto.PrivateKey
+	faucetKey crypto.PrivateKey // nil → faucet unavailable
+	db        storage.DB
+	blocks    core.BlockStore
+
+	state   *storage.StateDB
+	bc      *core.Blockchain
+	mempool *core.Mempool
+	intake  *core.Intake // nil unless mempool_intake_depth is set
+	emitter *events.Emitter
+	exec    *vm.Executor
+	poa     *consensus.PoA
+	p2p     *network.Node
+	syncer  *network.Syncer
+	rpc     *rpc.Server
+	rpcInt  *rpc.Server // internal listener; nil unless rpc_internal_port is set
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a Runtime over db and blocks. The Runtime takes ownership of
+// db and closes it on Stop.
+func New(cfg *config.Config, privKey crypto.PrivateKey, db storage.DB, blocks core.BlockStore) *Runtime {
+	return &Runtime{cfg: cfg, privKey: privKey, db: db, blocks: blocks}
+}
+
+// SetFaucetKey provides the key of the funded account the faucet RPC pays
+// from. It must be called before Start when the config enables the faucet.
+func (r *Runtime) SetFaucetKey(key crypto.PrivateKey) {
+	r.faucetKey = key
+}
+
+// Start initialises the chain (committing genesis on a fresh database),
+// starts P2P and RPC listeners, connects to seed peers and launches the
+// consensus loop. On error, anything already started is stopped.
+func (r *Runtime) Start() (err error) {
+	cfg := r.cfg
+	defer func() {
+		if err != nil {
+			r.shutdown(context.Background())
+		}
+	}()
+
+	// ---- state & blockchain ----
+	if cfg.SyncWrites {
+		s, ok := r.db.(storage.SyncSetter)
+		if !ok {
+			return fmt.Errorf("sync_writes: %T does not support synchronous writes", r.db)
+		}
+		s.SetSync(true)
+	}
+	r.state = storage.NewStateDB(r.db)
+	if err := r.state.SetRootVersion(cfg.Genesis.StateRootVersion); err != nil {
+		return fmt.Errorf("state_root_version: %w", err)
+	}
+	r.bc = core.NewBlockchain(r.blocks)
+	if err := r.bc.Init(); err != nil {
+		return fmt.Errorf("blockchain init: %w", err)
+	}
+	if err := r.bc.VerifyChainID(cfg.Genesis.ChainID); err != nil {
+		return fmt.Errorf("%w (is data_dir %q the right chain's data?)", err, cfg.DataDir)
+	}
+	if err := r.bc.VerifyStateRootVersion(cfg.Genesis.StateRootVersion); err != nil {
+		return err
+	}
+	if err := r.bc.VerifyParamsHash(cfg.ParamsHash()); err != nil {
+		return fmt.Errorf("%w (execution settings such as block_reward and min_fees are fixed for the chain's life)", err)
+	}
+	if r.bc.Tip() == nil {
+		genesisBlock, err := config.CreateGenesisBlock(cfg, r.state, r.privKey)
+		if err != nil {
+			return fmt.Errorf("genesis: %w", err)
+		}
+		if err := r.bc.AddBlock(genesisBlock); err != nil {
+			return fmt.Errorf("add genesis: %w", err)
+		}
+		log.Printf("Genesis block committed: %s", genesisBlock.Hash)
+	}
+
+	// ---- execution & consensus ----
+	r.emitter = events.NewEmitter()
+	idx := indexer.New(r.db, r.emitter)
+	if err := idx.IndexAssets(r.state.Committed(), cfg.Genesis.AssetIDs()); err != nil {
+		return fmt.Errorf("index genesis assets: %w", err)
+	}
+	var evlog *indexer.EventLog
+	if cfg.EventLog {
+		evlog = indexer.NewEventLog(r.db, r.emitter, cfg.EventLogRetention)
+	}
+	var txidx *indexer.TxIndex
+	if cfg.TxIndex {
+		txidx = indexer.NewTxIndex(r.db, r.emitter, cfg.TxIndexLimit)
+	}
+	var market *indexer.MarketHistory
+	if cfg.MarketHistory {
+		market = indexer.NewMarketHistory(r.db, r.emitter)
+	}
+	r.mempool = core.NewMempool()
+	r.mempool.SetMaxPerAccount(cfg.MempoolMaxPerAccount)
+	r.mempool.SetChainHeight(r.bc.Height)
+	r.mempool.SetMaxValidFromAhead(int64(cfg.MaxValidFromAhead))
+	r.exec = vm.NewExecutor(r.state, r.emitter)
+	r.exec.SetTxTimeout(time.Duration(cfg.TxTimeoutMs) * time.Millisecond)
+	r.exec.SetParams(cfg.VMParams())
+	for typ := range cfg.MinFees {
+		if !vm.IsRegistered(core.TxType(typ)) {
+			return fmt.Errorf("min_fees: unknown tx type %q", typ)
+		}
+	}
+	if err := r.exec.SetEnabledTxTypes(cfg.TxTypes()); err != nil {
+		return fmt.Errorf("enabled_tx_types: %w", err)
+	}
+	r.mempool.SetValidator(r.exec.CheckTx)
+	if cfg.MempoolIntakeDepth > 0 {
+		workers := cfg.MempoolIntakeWorkers
+		if workers == 0 {
+			workers = runtime.NumCPU()
+		}
+		r.intake = core.NewIntake(r.mempool, cfg.MempoolIntakeDepth, workers)
+	}
+	r.poa = consensus.New(cfg, r.bc, r.state, r.mempool, r.exec, r.emitter, r.privKey)
+	r.poa.SetClockDrift(time.Duration(cfg.MaxBlockDriftMs)*time.Millisecond,
+		time.Duration(cfg.BlockQuarantineMs)*time.Millisecond)
+	r.poa.SetBlockSpacing(time.Duration(cfg.MinBlockIntervalMs)*time.Millisecond,
+		time.Duration(cfg.MaxBlockIntervalMs)*time.Millisecond)
+	r.poa.SetLegacySignaturesUntil(cfg.LegacySignaturesUntil)
+
+	// ---- network ----
+	tlsCfg, err := config.LoadTLSConfig(cfg.TLS)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if tlsCfg != nil {
+		log.Println("mTLS enabled for P2P")
+	}
+	r.p2p = network.NewNode(cfg.NodeID, fmt.Sprintf(":%d", cfg.P2PPort), r.mempool, tlsCfg)
+	r.p2p.SetChainID(cfg.Genesis.ChainID)
+	r.p2p.SetBanPolicy(cfg.PeerBanThreshold, time.Duration(cfg.PeerBanDurationMs)*time.Millisecond)
+	r.p2p.SetInboundLimits(cfg.MaxPeersPerIP, cfg.AcceptRate, cfg.AcceptRatePerIP)
+	r.p2p.SetKeepAlive(time.Duration(cfg.PingIntervalMs)*time.Millisecond, cfg.PingMaxMissed,
+		time.Duration(cfg.PeerReadTimeoutMs)*time.Millisecond)
+	r.p2p.SetSeenTxCache(cfg.SeenTxCacheSize, time.Duration(cfg.SeenTxTTLMs)*time.Millisecond)
+	r.p2p.SetIntake(r.intake)
+	if len(cfg.AllowedPeerIDs) > 0 {
+		r.p2p.SetAllowedPeers(cfg.AllowedPeerIDs)
+		if tlsCfg == nil {
+			log.Println("WARNING: allowed_peer_ids without tls — peer IDs are not authenticated")
+		}
+	}
+	if cfg.P2PProxy != "" {
+		if err := r.p2p.SetProxy(cfg.P2PProxy); err != nil {
+			return fmt.Errorf("p2p proxy: %w", err)
+		}
+		log.Printf("Outbound P2P connections via SOCKS5 proxy %s", cfg.P2PProxy)
+	}
+	r.syncer = network.NewSyncer(r.p2p, r.bc, r.poa, r.exec, r.state)
+	r.syncer.SetCheckpoints(cfg.Checkpoints)
+	r.syncer.SetMaxBatchBytes(cfg.SyncBatchMaxBytes)
+	r.poa.SetSyncStatus(r.syncer)
+	if err := r.p2p.Start(); err != nil {
+		return fmt.Errorf("p2p start: %w", err)
+	}
+	log.Printf("P2P listening on %s", r.p2p.Addr())
+	r.connectSeeds()
+
+	// ---- RPC ----
+	handler := rpc.NewHandler(r.bc, r.mempool, r.state, idx, cfg.Genesis.ChainID)
+	handler.SetFeePolicy(cfg.FeeEstimateFloor, cfg.FeeEstimatePercentile)
+	handler.SetBroadcaster(r.p2p)
+	handler.SetIntake(r.intake)
+	handler.SetSyncStatus(r.syncer)
+	handler.SetPauser(r.poa)
+	validators := make([]string, len(cfg.Validators))
+	for i, v := range cfg.Validators {
+		validators[i] = v.PubKey
+	}
+	handler.SetValidators(validators)
+	handler.SetProposerSchedule(r.poa)
+	if evlog != nil {
+		handler.SetEventLog(evlog)
+	}
+	if txidx != nil {
+		handler.SetTxIndex(txidx)
+	}
+	if market != nil {
+		handler.SetMarketHistory(market)
+	}
+	if cfg.Faucet {
+		if r.faucetKey == nil {
+			return errors.New("faucet enabled but no faucet key loaded")
+		}
+		faucet := rpc.NewFaucet(r.faucetKey, cfg.FaucetAmount, cfg.FaucetIntervalBlocks)
+		faucet.SetFee(cfg.MinFees[string(core.TxTransfer)])
+		handler.SetFaucet(faucet)
+		log.Printf("Faucet enabled: %d tokens per claim from %s", cfg.FaucetAmount, r.faucetKey.Public().Hex())
+	}
+	rpcAddr := fmt.Sprintf(":%d", cfg.RPCPort)
+	if cfg.RPCPort == 0 && cfg.RPCUnixSocket != "" {
+		rpcAddr = "" // Unix socket only
+	}
+	r.rpc = rpc.NewServer(rpcAddr, handler, cfg.RPCAuthToken)
+	r.rpc.SetAdminToken(cfg.RPCAdminToken)
+	r.rpc.SetRequestTimeout(time.Duration(cfg.RPCRequestTimeoutMs)*time.Millisecond,
+		time.Duration(cfg.RPCSlowLogMs)*time.Millisecond)
+	r.rpc.SetAllowedMethods(cfg.RPCPublicMethods)
+	r.rpc.SetMaxConnections(cfg.RPCMaxConnections)
+	r.rpc.EnableFeed(rpc.NewFeed(r.emitter))
+	if cfg.RPCUnixSocket != "" {
+		r.rpc.EnableUnixSocket(cfg.RPCUnixSocket, cfg.RPCUnixSocketNoAuth)
+	}
+	if err := r.rpc.Start(); err != nil {
+		r.rpc = nil
+		return fmt.Errorf("rpc start: %w", err)
+	}
+	if addr := r.rpc.Addr(); addr != nil {
+		log.Printf("RPC listening on %s", addr)
+	}
+	if cfg.RPCUnixSocket != "" {
+		log.Printf("RPC listening on unix socket %s", cfg.RPCUnixSocket)
+	}
+	if cfg.RPCInternalPort != 0 {
+		r.rpcInt = rpc.NewServer(fmt.Sprintf(":%d", cfg.RPCInternalPort), handler, cfg.RPCAuthToken)
+		r.rpcInt.SetAdminToken(cfg.RPCAdminToken)
+		r.rpcInt.SetRequestTimeout(time.Duration(cfg.RPCRequestTimeoutMs)*time.Millisecond,
+			time.Duration(cfg.RPCSlowLogMs)*time.Millisecond)
+		r.rpcInt.SetAllowedMethods(cfg.RPCInternalMethods)
+		r.rpcInt.SetMaxConnections(cfg.RPCMaxConnections)
+		if err := r.rpcInt.Start(); err != nil {
+			r.rpcInt = nil
+			return fmt.Errorf("internal rpc start: %w", err)
+		}
+		log.Printf("Internal RPC listening on %s", r.rpcInt.Addr())
+	}
+	if cfg.RPCAuthToken != "" {
+		log.Println("RPC Bearer token authentication enabled")
+	}
+
+	// ---- consensus loop ----
+	interval := DefaultBlockInterval
+	if cfg.BlockIntervalMs > 0 {
+		interval = time.Duration(cfg.BlockIntervalMs) * time.Millisecond
+	}
+	done := make(chan struct{})
+	r.done = done
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.poa.Run(interval, done)
+	}()
+	stuck := DefaultStuckTxThreshold
+	if cfg.StuckTxThresholdMs > 0 {
+		stuck = time.Duration(cfg.StuckTxThresholdMs) * time.Millisecond
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.watchStuckTxs(stuck, done)
+	}()
+	log.Printf("Consensus running (validator: %s)", r.privKey.Public().Hex())
+	return nil
+}
+
+// watchStuckTxs logs, every half threshold until done is closed, the
+// mempool transactions that have been pending for at least threshold.
+func (r *Runtime) watchStuckTxs(threshold time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(threshold / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		stuck := r.mempool.Stuck(threshold)
+		if len(stuck) == 0 {
+			continue
+		}
+		oldest := stuck[0]
+		log.Printf("[mempool] %d transactions pending longer than %s; oldest %s from %s (nonce %d) pending %s",
+			len(stuck), threshold, oldest.Tx.ID, oldest.Tx.From, oldest.Tx.Nonce, time.Since(oldest.Since).Round(time.Second))
+	}
+}
+
+func (r *Runtime) connectSeeds() {
+	connected := 0
+	for _, sp := range r.cfg.SeedPeers {
+		if err := r.p2p.AddPeer(sp.ID, sp.Addr); err != nil {
+			log.Printf("seed peer %s (%s): %v", sp.ID, sp.Addr, err)
+			continue
+		}
+		// Trigger initial block sync with the newly connected peer.
+		if peer := r.p2p.Peer(sp.ID); peer != nil {
+			r.syncer.SyncWithPeer(peer)
+		}
+		connected++
+		log.Printf("Connected to seed peer %s (%s)", sp.ID, sp.Addr)
+	}
+	if len(r.cfg.SeedPeers) > 0 && connected == 0 {
+		log.Println("WARNING: failed to connect to any seed peer — node is isolated")
+	}
+}
+
+// ShutdownTimeout returns the configured bound for Stop.
+func (r *Runtime) ShutdownTimeout() time.Duration {
+	if r.cfg.ShutdownTimeoutMs > 0 {
+		return time.Duration(r.cfg.ShutdownTimeoutMs) * time.Millisecond
+	}
+	return DefaultShutdownTimeout
+}
+
+// Stop shuts the node down in order: consensus (no new blocks are written),
+// RPC (in-flight requests finish until ctx expires), P2P, the mempool intake
+// queue, then the database.
+// The database is only closed once consensus has fully drained; if ctx
+// expires first, Stop returns ctx's error and leaves the database open.
+func (r *Runtime) Stop(ctx context.Context) error {
+	return r.shutdown(ctx)
+}
+
+func (r *Runtime) shutdown(ctx context.Context) error {
+	// 1. Consensus: stop producing and wait for an in-progress block.
+	if r.done != nil {
+		close(r.done)
+		r.done = nil
+		drained := make(chan struct{})
+		go func() {
+			r.wg.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for consensus to stop: %w", ctx.Err())
+		}
+	}
+
+	var errs []error
+	// 2. RPC: stop accepting requests, let in-flight ones finish.
+	if r.rpc != nil {
+		if err := r.rpc.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("rpc shutdown: %w", err))
+		}
+		r.rpc = nil
+	}
+	if r.rpcInt != nil {
+		if err := r.rpcInt.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("internal rpc shutdown: %w", err))
+		}
+		r.rpcInt = nil
+	}
+	// 3. P2P: close listener and peers so no synced blocks arrive.
+	if r.p2p != nil {
+		r.p2p.Stop()
+		r.p2p = nil
+	}
+	if r.intake != nil {
+		r.intake.Close()
+		r.intake = nil
+	}
+	// 4. Database last.
+	if r.db != nil {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close db: %w", err))
+		}
+		r.db = nil
+	}
+	return errors.Join(errs...)
+}
+
+// Blockchain returns the node's chain. Valid after Start.
+func (r *Runtime) Blockchain() *core.Blockchain { return r.bc }
+
+// RPCAddr returns the RPC listener's address, or nil if not running.
+func (r *Runtime) RPCAddr() net.Addr {
+	if r.rpc == nil {
+		return nil
+	}
+	return r.rpc.Addr()
+}
+
+// InternalRPCAddr returns the internal RPC listener's address, or nil if
+// rpc_internal_port is unset or the node is not running.
+func (r *Runtime) InternalRPCAddr() net.Addr {
+	if r.rpcInt == nil {
+		return nil
+	}
+	return r.rpcInt.Addr()
+}
+
+// P2PAddr returns the P2P listener's address, or nil if not running.
+func (r *Runtime) P2PAddr() net.Addr {
+	if r.p2p == nil {
+		return nil
+	}
+	return r.p2p.Addr()
+}
@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// adminKey marks request contexts authorized for admin methods.
+type adminKey struct{}
+
+// WithAdmin returns a context under which Dispatch serves admin methods
+// such as dropTx. The server sets it for requests carrying the admin token
+// (see Server.SetAdminToken).
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// isAdmin reports whether ctx was marked by WithAdmin.
+func isAdmin(ctx context.Context) bool {
+	return ctx.Value(adminKey{}) != nil
+}
+
+// dropTx removes a transaction from the mempool and reports whether it was
+// pending. Operators use it to evict a stuck or abusive transaction without
+// restarting the node; the sender may resubmit it.
+func (h *Handler) dropTx(ctx context.Context, req Request) Response {
+	if !isAdmin(ctx) {
+		return errResponse(req.ID, CodeUnauthorized, "dropTx requires admin authorization")
+	}
+	var params struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.ID == "" {
+		return errResponse(req.ID, CodeInvalidParams, "id is required")
+	}
+	_, ok := h.mempool.Get(params.ID)
+	if ok {
+		h.mempool.Remove([]string{params.ID})
+		log.Printf("[rpc] admin dropped tx %s from mempool", params.ID)
+	}
+	return okResponse(req.ID, map[string]any{"id": params.ID, "dropped": ok})
+}
+
+// setPaused pauses or resumes block production and transaction intake
+// for a coordinated upgrade, and reports the resulting state.
+func (h *Handler) setPaused(ctx context.Context, req Request, pause bool) Response {
+	if !isAdmin(ctx) {
+		return errResponse(req.ID, CodeUnauthorized, req.Method+" requires admin authorization")
+	}
+	if h.pauser == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "pausing is not supported by this node")
+	}
+	if pause {
+		h.pauser.Pause()
+	} else {
+		h.pauser.Resume()
+	}
+	log.Printf("[rpc] admin %s", req.Method)
+	return okResponse(req.ID, map[string]bool{"paused": h.pauser.Paused()})
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxConnections bounds the simultaneous TCP connections a Server
+// keeps open unless overridden by SetMaxConnections.
+const DefaultMaxConnections = 1000
+
+// overLimitKey marks request contexts whose connection was accepted beyond
+// the connection limit.
+type overLimitKey struct{}
+
+// SetMaxConnections bounds the simultaneous TCP connections, idle
+// keep-alive and WebSocket connections included. A connection beyond the
+// limit gets 503 Service Unavailable to its first request and is closed.
+// Unix socket connections are local and are not counted. Non-positive
+// values keep the current setting. Must be called before Start.
+func (s *Server) SetMaxConnections(n int) {
+	if n > 0 {
+		s.maxConns = n
+	}
+}
+
+// limitConns wraps next to refuse requests on connections accepted beyond
+// the limit.
+func limitConns(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(overLimitKey{}) != nil {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many connections", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// connContext marks the context of a connection over the limit.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	if lc, ok := c.(*limitedConn); ok && lc.over {
+		return context.WithValue(ctx, overLimitKey{}, true)
+	}
+	return ctx
+}
+
+// limitListener counts the open connections it has accepted. Connections
+// beyond max are still accepted, so the client gets an HTTP error rather
+// than a hanging dial, but are marked over the limit.
+type limitListener struct {
+	net.Listener
+	max    int64
+	active atomic.Int64
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.active.Add(1) > l.max {
+		l.active.Add(-1)
+		return &limitedConn{Conn: c, over: true}, nil
+	}
+	return &limitedConn{Conn: c, l: l}, nil
+}
+
+// limitedConn releases its slot in the listener when first closed.
+type limitedConn struct {
+	net.Conn
+	l    *limitListener // nil for a connection over the limit
+	over bool
+	once sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	if c.l != nil {
+		c.once.Do(func() { c.l.active.Add(-1) })
+	}
+	return c.Conn.Close()
+}
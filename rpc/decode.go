@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/vm"
+)
+
+// decodedTx is a transaction with its payload decoded into the typed struct
+// registered for its TxType.
+type decodedTx struct {
+	*core.Transaction
+	DecodedPayload any    `json:"decoded_payload,omitempty"`
+	DecodeError    string `json:"decode_error,omitempty"`
+}
+
+// decodedBlock mirrors core.Block with decoded transactions.
+type decodedBlock struct {
+	Header       core.BlockHeader `json:"header"`
+	Transactions []decodedTx      `json:"transactions"`
+	Hash         string           `json:"hash"`
+	Signature    string           `json:"signature"`
+}
+
+func decodeTx(tx *core.Transaction) decodedTx {
+	out := decodedTx{Transaction: tx}
+	p, err := vm.DecodePayload(tx.Type, tx.Payload)
+	if err != nil {
+		out.DecodeError = err.Error()
+	} else {
+		out.DecodedPayload = p
+	}
+	return out
+}
+
+func decodeBlock(b *core.Block) decodedBlock {
+	txs := make([]decodedTx, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		txs[i] = decodeTx(tx)
+	}
+	return decodedBlock{Header: b.Header, Transactions: txs, Hash: b.Hash, Signature: b.Signature}
+}
+
+// blockSummary is a compact projection of a block for explorers.
+type blockSummary struct {
+	Height    int64  `json:"height"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	Proposer  string `json:"proposer"`
+	TxCount   int    `json:"tx_count"`
+	TotalFees uint64 `json:"total_fees"`
+}
+
+func summarizeBlock(b *core.Block) blockSummary {
+	s := blockSummary{
+		Height:    b.Header.Height,
+		Hash:      b.Hash,
+		Timestamp: b.Header.Timestamp,
+		Proposer:  b.Header.Proposer,
+		TxCount:   len(b.Transactions),
+	}
+	for _, tx := range b.Transactions {
+		s.TotalFees += tx.Fee
+	}
+	return s
+}
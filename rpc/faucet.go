@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// DefaultFaucetInterval is the number of blocks an address must wait
+// between faucet claims unless overridden in NewFaucet.
+const DefaultFaucetInterval = 100
+
+// Faucet hands out a fixed amount of tokens from a funded testnet account.
+// Each claim is a real transfer signed by the faucet key and submitted to
+// the mempool; an address may claim once per interval blocks.
+type Faucet struct {
+	w        *wallet.Wallet
+	amount   uint64
+	fee      uint64
+	interval int64
+
+	mu        sync.Mutex
+	lastClaim map[string]int64 // address → chain height of its last claim
+}
+
+// NewFaucet creates a Faucet paying amount per claim from the account of
+// key. A non-positive interval selects DefaultFaucetInterval.
+func NewFaucet(key crypto.PrivateKey, amount uint64, interval int64) *Faucet {
+	if interval <= 0 {
+		interval = DefaultFaucetInterval
+	}
+	return &Faucet{w: wallet.New(key), amount: amount, interval: interval, lastClaim: make(map[string]int64)}
+}
+
+// SetFee sets the fee each claim pays. It must be at least the chain's
+// minimum transfer fee, or the mempool rejects every claim. Default 0.
+func (f *Faucet) SetFee(fee uint64) {
+	f.fee = fee
+}
+
+// SetFaucet enables the faucet method, served from f.
+func (h *Handler) SetFaucet(f *Faucet) {
+	h.faucet = f
+}
+
+func (h *Handler) faucetClaim(req Request) Response {
+	f := h.faucet
+	if f == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "faucet is disabled")
+	}
+	if h.paused() {
+		return errResponse(req.ID, CodeNodePaused, "node paused; not accepting transactions")
+	}
+	var params struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if _, err := crypto.PubKeyFromHex(params.Address); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, fmt.Sprintf("invalid address: %v", err))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	height := h.bc.Height()
+	if last, ok := f.lastClaim[params.Address]; ok && height < last+f.interval {
+		return errResponse(req.ID, CodeRateLimited,
+			fmt.Sprintf("address claimed at height %d; next claim allowed at height %d", last, last+f.interval))
+	}
+
+	// Continue after the faucet's pending txs; a dropped tx leaves a gap
+	// that the next claim fills.
+	acc, err := h.reader(false).GetAccount(f.w.PubKey())
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	nonce := h.mempool.NextNonce(f.w.PubKey(), acc.Nonce)
+	tx, err := f.w.Transfer(h.chainID, params.Address, f.amount, nonce, f.fee)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	if err := h.mempool.Add(tx); err != nil {
+		return errResponse(req.ID, CodeInternalError, fmt.Sprintf("submit faucet tx: %v", err))
+	}
+	f.lastClaim[params.Address] = height
+	h.broadcast(tx)
+	return okResponse(req.ID, map[string]any{"tx_id": tx.ID, "amount": f.amount})
+}
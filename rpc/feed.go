@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tolelom/tolchain/events"
+	"golang.org/x/net/websocket"
+)
+
+// feedBufferSize is the number of undelivered events queued per subscriber.
+// A subscriber that falls further behind has events dropped rather than
+// stalling the (synchronous) emitter.
+const feedBufferSize = 256
+
+// feedWriteTimeout bounds a single frame write to a slow client.
+const feedWriteTimeout = 10 * time.Second
+
+// WildcardAddress subscribes to every event regardless of the addresses involved.
+const WildcardAddress = "*"
+
+// addressKeys lists the event Data fields that carry participant addresses.
+var addressKeys = []string{"from", "to", "owner", "player", "players", "buyer", "seller", "holder"}
+
+// SubscribeRequest is sent by a WebSocket client to set its address filter.
+// It may be sent again at any time to replace the current filter.
+type SubscribeRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// FeedFrame is the envelope for every frame the server writes to a client.
+type FeedFrame struct {
+	Subscribed []string      `json:"subscribed,omitempty"` // ack of the active filter
+	Event      *events.Event `json:"event,omitempty"`
+}
+
+// Feed streams chain events to WebSocket subscribers. Filtering happens
+// server-side so clients only receive events touching their addresses.
+type Feed struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+type subscriber struct {
+	mu     sync.RWMutex
+	filter map[string]bool // nil → nothing subscribed yet
+	ch     chan FeedFrame
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewFeed creates a Feed that receives every event published on emitter.
+func NewFeed(emitter *events.Emitter) *Feed {
+	f := &Feed{subs: make(map[*subscriber]struct{})}
+	emitter.SubscribeAll(f.publish)
+	return f
+}
+
+// Close disconnects all subscribers. Further connections are refused.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for sub := range f.subs {
+		sub.close()
+	}
+	f.subs = make(map[*subscriber]struct{})
+}
+
+func (f *Feed) publish(ev events.Event) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for sub := range f.subs {
+		if !sub.matches(ev) {
+			continue
+		}
+		ev := ev
+		select {
+		case sub.ch <- FeedFrame{Event: &ev}:
+		default:
+			log.Printf("[rpc] feed subscriber lagging, dropped %s event", ev.Type)
+		}
+	}
+}
+
+// serveWS handles a single WebSocket connection for its lifetime.
+func (f *Feed) serveWS(ws *websocket.Conn) {
+	defer ws.Close()
+	// The HTTP server's read/write deadlines still apply to the hijacked
+	// connection; clear them so an idle subscription is not torn down.
+	if err := ws.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	sub := &subscriber{ch: make(chan FeedFrame, feedBufferSize), done: make(chan struct{})}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.subs, sub)
+		f.mu.Unlock()
+		sub.close()
+	}()
+
+	go func() {
+		defer sub.close()
+		for {
+			var req SubscribeRequest
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			sub.setFilter(req.Addresses)
+			select {
+			case sub.ch <- FeedFrame{Subscribed: req.Addresses}:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-sub.done:
+			return
+		case frame := <-sub.ch:
+			if err := ws.SetWriteDeadline(time.Now().Add(feedWriteTimeout)); err != nil {
+				return
+			}
+			if err := websocket.JSON.Send(ws, frame); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *subscriber) setFilter(addrs []string) {
+	filter := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		filter[a] = true
+	}
+	s.mu.Lock()
+	s.filter = filter
+	s.mu.Unlock()
+}
+
+// matches reports whether ev involves one of the subscribed addresses.
+func (s *subscriber) matches(ev events.Event) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.filter) == 0 {
+		return false
+	}
+	if s.filter[WildcardAddress] {
+		return true
+	}
+	for _, key := range addressKeys {
+		switch v := ev.Data[key].(type) {
+		case string:
+			if s.filter[v] {
+				return true
+			}
+		case []string:
+			for _, a := range v {
+				if s.filter[a] {
+					return true
+				}
+			}
+		case []any:
+			for _, a := range v {
+				if str, ok := a.(string); ok && s.filter[str] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
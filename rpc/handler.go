@@ -1,11 +1,17 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/events"
 	"github.com/tolelom/tolchain/indexer"
+	"github.com/tolelom/tolchain/version"
 )
 
 // Handler holds all dependencies needed to serve RPC methods.
@@ -14,25 +20,189 @@ type Handler struct {
 	mempool *core.Mempool
 	state   core.State
 	indexer *indexer.Indexer
-	chainID string // expected chain_id; used to reject cross-chain replay transactions
+	evlog   *indexer.EventLog      // nil → getEvents disabled
+	txidx   *indexer.TxIndex       // nil → getTransactionsBy* disabled
+	market  *indexer.MarketHistory // nil → getMarketHistory disabled
+	faucet  *Faucet                // nil → faucet disabled
+	gossip  TxBroadcaster          // nil → accepted transactions stay in the local mempool
+	intake  *core.Intake           // nil → sendTx adds to the mempool directly
+	sync    SyncStatus             // nil → getChainInfo omits syncing
+	pauser  Pauser                 // nil → pauseNode and resumeNode disabled
+	turns   ProposerSchedule       // nil → getProposerSchedule disabled
+	chainID string                 // expected chain_id; used to reject cross-chain replay transactions
+
+	validators []string // pubkeys whose bonds getValidatorBonds reports
+
+	feeFloor      uint64 // minimum fee estimateFee suggests
+	feePercentile int    // mempool fee percentile estimateFee suggests
+
+	mu     sync.RWMutex
+	custom map[string]MethodFunc // methods added via RegisterMethod
+}
+
+// TxBroadcaster relays transactions to peers; *network.Node implements it.
+type TxBroadcaster interface {
+	BroadcastTx(tx *core.Transaction)
+}
+
+// SyncStatus reports whether the node is catching up with its peers;
+// *network.Syncer implements it.
+type SyncStatus interface {
+	Syncing() bool
+}
+
+// Pauser pauses and resumes block production; *consensus.PoA implements
+// it.
+type Pauser interface {
+	Pause()
+	Resume()
+	Paused() bool
 }
 
+// ProposerSchedule reports the validators' proposer rotation and whose turn
+// the next blocks are; *consensus.PoA implements it.
+type ProposerSchedule interface {
+	Schedule() []string
+	UpcomingProposers(n int) (int64, []string)
+}
+
+// DefaultFeePercentile is the mempool fee percentile estimateFee reports
+// unless overridden by SetFeePolicy.
+const DefaultFeePercentile = 50
+
+// MethodFunc implements an RPC method registered with RegisterMethod.
+// Long-running methods should watch ctx and return once it is cancelled
+// (e.g. because the client disconnected).
+type MethodFunc func(ctx context.Context, req Request) Response
+
 // NewHandler creates an RPC Handler.
 func NewHandler(bc *core.Blockchain, mempool *core.Mempool, state core.State, idx *indexer.Indexer, chainID string) *Handler {
-	return &Handler{bc: bc, mempool: mempool, state: state, indexer: idx, chainID: chainID}
+	return &Handler{bc: bc, mempool: mempool, state: state, indexer: idx, chainID: chainID, custom: make(map[string]MethodFunc), feePercentile: DefaultFeePercentile}
+}
+
+// SetFeePolicy configures estimateFee: the suggestion is the given
+// percentile (1-100) of pending fees, never below floor.
+func (h *Handler) SetFeePolicy(floor uint64, percentile int) {
+	h.feeFloor = floor
+	if percentile > 0 && percentile <= 100 {
+		h.feePercentile = percentile
+	}
+}
+
+// SetBroadcaster makes sendTx and faucet gossip every transaction they
+// admit to the mempool through b, so that a transaction submitted to a node
+// that does not propose blocks still reaches a proposer.
+func (h *Handler) SetBroadcaster(b TxBroadcaster) {
+	h.gossip = b
 }
 
-// Dispatch routes an RPC request to the correct method.
-func (h *Handler) Dispatch(req Request) Response {
+// broadcast relays tx to peers if a broadcaster is set.
+func (h *Handler) broadcast(tx *core.Transaction) {
+	if h.gossip != nil {
+		h.gossip.BroadcastTx(tx)
+	}
+}
+
+// SetIntake makes sendTx admit transactions through in, so their
+// signatures are verified by its worker pool. sendTx still waits for the
+// result and reports it to the client.
+func (h *Handler) SetIntake(in *core.Intake) {
+	h.intake = in
+}
+
+// admit adds tx to the mempool, through the intake queue if one is set.
+func (h *Handler) admit(tx *core.Transaction) error {
+	if h.intake == nil {
+		return h.mempool.Add(tx)
+	}
+	result := make(chan error, 1)
+	if err := h.intake.Submit(tx, func(err error) { result <- err }); err != nil {
+		return err
+	}
+	return <-result
+}
+
+// SetSyncStatus makes getChainInfo report whether the node is syncing.
+func (h *Handler) SetSyncStatus(s SyncStatus) {
+	h.sync = s
+}
+
+// SetPauser enables the pauseNode and resumeNode admin methods, which
+// drive p. While p is paused sendTx and faucet refuse new transactions
+// with CodeNodePaused; reads keep working.
+func (h *Handler) SetPauser(p Pauser) {
+	h.pauser = p
+}
+
+// paused reports whether the node is paused by pauseNode.
+func (h *Handler) paused() bool {
+	return h.pauser != nil && h.pauser.Paused()
+}
+
+// SetValidators sets the validator pubkeys whose bonds getValidatorBonds
+// reports, in order.
+func (h *Handler) SetValidators(pubKeys []string) {
+	h.validators = pubKeys
+}
+
+// SetProposerSchedule enables getProposerSchedule and the weights reported
+// by getValidators, served from s.
+func (h *Handler) SetProposerSchedule(s ProposerSchedule) {
+	h.turns = s
+}
+
+// SetEventLog enables the getEvents method, served from l.
+func (h *Handler) SetEventLog(l *indexer.EventLog) {
+	h.evlog = l
+}
+
+// SetTxIndex enables the getTransactionsBySender and getTransactionsByType
+// methods, served from ti.
+func (h *Handler) SetTxIndex(ti *indexer.TxIndex) {
+	h.txidx = ti
+}
+
+// SetMarketHistory enables the getMarketHistory method, served from m.
+func (h *Handler) SetMarketHistory(m *indexer.MarketHistory) {
+	h.market = m
+}
+
+// RegisterMethod adds an RPC method. Built-in methods take precedence over
+// a registered method of the same name.
+func (h *Handler) RegisterMethod(name string, fn MethodFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.custom[name] = fn
+}
+
+// Dispatch routes an RPC request to the correct method. ctx is the request's
+// context; it is cancelled when the client goes away.
+func (h *Handler) Dispatch(ctx context.Context, req Request) Response {
+	if err := ctx.Err(); err != nil {
+		return errResponse(req.ID, CodeRequestCancelled, "request cancelled: "+err.Error())
+	}
 	switch req.Method {
 	case "getBlockHeight":
 		return okResponse(req.ID, h.bc.Height())
 
+	case "getChainInfo":
+		return h.getChainInfo(req)
+
 	case "getBlock":
 		return h.getBlock(req)
+	case "getBlockSummaries":
+		return h.getBlockSummaries(req)
 
 	case "getBalance":
 		return h.getBalance(req)
+	case "getBalances":
+		return h.getBalances(req)
+
+	case "getPendingNonce":
+		return h.getPendingNonce(req)
+
+	case "getStateRoot":
+		return h.getStateRoot(req)
 
 	case "getAsset":
 		return h.getAsset(req)
@@ -42,17 +212,63 @@ func (h *Handler) Dispatch(req Request) Response {
 
 	case "getListing":
 		return h.getListing(req)
+	case "getVesting":
+		return h.getVesting(req)
+	case "getCustomRecord":
+		return h.getCustomRecord(req)
+	case "getValidatorBonds":
+		return h.getValidatorBonds(req)
+	case "getValidators":
+		return h.getValidators(req)
+	case "getProposerSchedule":
+		return h.getProposerSchedule(req)
 
 	case "getAssetsByOwner":
 		return h.getAssetsByOwner(req)
+	case "getOpenSessions":
+		return h.getOpenSessions(req)
+	case "getAssetsByTemplate":
+		return h.getAssetsByTemplate(req)
+
+	case "getEvents":
+		return h.getEvents(req)
+	case "getTransactionsBySender":
+		return h.getTransactionsBySender(req)
+	case "getTransactionsByType":
+		return h.getTransactionsByType(req)
+	case "getMarketHistory":
+		return h.getMarketHistory(req)
 
 	case "sendTx":
 		return h.sendTx(req)
 
+	case "faucet":
+		return h.faucetClaim(req)
 	case "getMempoolSize":
 		return okResponse(req.ID, h.mempool.Size())
+	case "getMempoolTxs":
+		return h.getMempoolTxs(req)
+	case "getHeldTxs":
+		return h.getHeldTxs(req)
+	case "getTxStatus":
+		return h.getTxStatus(req)
+	case "dropTx":
+		return h.dropTx(ctx, req)
+	case "pauseNode":
+		return h.setPaused(ctx, req, true)
+	case "resumeNode":
+		return h.setPaused(ctx, req, false)
+
+	case "estimateFee":
+		return h.estimateFee(req)
 
 	default:
+		h.mu.RLock()
+		fn, ok := h.custom[req.Method]
+		h.mu.RUnlock()
+		if ok {
+			return fn(ctx, req)
+		}
 		return errResponse(req.ID, CodeMethodNotFound, fmt.Sprintf("method %q not found", req.Method))
 	}
 }
@@ -61,6 +277,7 @@ func (h *Handler) getBlock(req Request) Response {
 	var params struct {
 		Hash   string `json:"hash"`
 		Height *int64 `json:"height"`
+		Decode bool   `json:"decode"` // include typed decoded_payload per transaction
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, "params: "+err.Error())
@@ -81,12 +298,182 @@ func (h *Handler) getBlock(req Request) Response {
 	if block == nil {
 		return okResponse(req.ID, nil)
 	}
+	if params.Decode {
+		return okResponse(req.ID, decodeBlock(block))
+	}
 	return okResponse(req.ID, block)
 }
 
+// maxBlockSummaries caps the number of blocks one getBlockSummaries call
+// returns.
+const maxBlockSummaries = 100
+
+// getBlockSummaries returns compact summaries of up to limit consecutive
+// blocks starting at from_height, stopping at the tip.
+func (h *Handler) getBlockSummaries(req Request) Response {
+	var params struct {
+		FromHeight int64 `json:"from_height"`
+		Limit      int   `json:"limit"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.FromHeight < 0 {
+		return errResponse(req.ID, CodeInvalidParams, "from_height must not be negative")
+	}
+	if params.Limit <= 0 || params.Limit > maxBlockSummaries {
+		params.Limit = maxBlockSummaries
+	}
+	summaries := make([]blockSummary, 0)
+	err := h.bc.IterateBlocks(params.FromHeight, params.FromHeight+int64(params.Limit)-1, func(b *core.Block) error {
+		summaries = append(summaries, summarizeBlock(b))
+		return nil
+	})
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, summaries)
+}
+
+// getChainInfo identifies the chain and the build of the node serving it,
+// along with the committed total token supply.
+func (h *Handler) getChainInfo(req Request) Response {
+	info := map[string]any{
+		"chain_id":   h.chainID,
+		"height":     h.bc.Height(),
+		"version":    version.Version,
+		"git_commit": version.GitCommit,
+		"build_time": version.BuildTime,
+	}
+	if tip := h.bc.Tip(); tip != nil {
+		info["tip_hash"] = tip.Hash
+	}
+	if h.sync != nil {
+		info["syncing"] = h.sync.Syncing()
+	}
+	if h.pauser != nil {
+		info["paused"] = h.pauser.Paused()
+	}
+	supply, err := h.reader(false).GetTotalSupply()
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	info["total_supply"] = supply
+	return okResponse(req.ID, info)
+}
+
+// getStateRoot returns the state root committed in the tip block header,
+// i.e. the root of the Merkle tree over all state entries after that block.
+func (h *Handler) getStateRoot(req Request) Response {
+	tip := h.bc.Tip()
+	if tip == nil {
+		return okResponse(req.ID, nil)
+	}
+	return okResponse(req.ID, map[string]any{
+		"height":     tip.Header.Height,
+		"block_hash": tip.Hash,
+		"state_root": tip.Header.StateRoot,
+	})
+}
+
+// estimateFee suggests a fee from the current mempool fee distribution,
+// falling back to the configured floor when the mempool is empty.
+func (h *Handler) estimateFee(req Request) Response {
+	fees := h.mempool.Fees()
+	fee := h.feeFloor
+	if n := len(fees); n > 0 {
+		// Nearest-rank percentile.
+		rank := (h.feePercentile*n + 99) / 100
+		if p := fees[rank-1]; p > fee {
+			fee = p
+		}
+	}
+	return okResponse(req.ID, map[string]any{
+		"fee":          fee,
+		"floor":        h.feeFloor,
+		"percentile":   h.feePercentile,
+		"mempool_size": len(fees),
+	})
+}
+
+// MempoolTx is a pending transaction as reported by getMempoolTxs.
+type MempoolTx struct {
+	Tx           *core.Transaction `json:"tx"`
+	PendingSince int64             `json:"pending_since"` // admission time, Unix nanoseconds
+}
+
+// getMempoolTxs pages through the pending transactions, oldest first, with
+// the time each was admitted.
+func (h *Handler) getMempoolTxs(req Request) Response {
+	var params txPage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	params.normalize()
+	txs := []MempoolTx{}
+	for _, e := range h.mempool.Entries(params.Offset, params.Limit) {
+		txs = append(txs, MempoolTx{Tx: e.Tx, PendingSince: e.Since.UnixNano()})
+	}
+	return okResponse(req.ID, txs)
+}
+
+// getHeldTxs lists the mempool transactions held back until the chain
+// reaches their ValidFrom height, oldest first.
+func (h *Handler) getHeldTxs(req Request) Response {
+	txs := []MempoolTx{}
+	for _, e := range h.mempool.Held() {
+		txs = append(txs, MempoolTx{Tx: e.Tx, PendingSince: e.Since.UnixNano()})
+	}
+	return okResponse(req.ID, txs)
+}
+
+// getTxStatus reports whether a transaction is waiting in the mempool and
+// since when: "pending", or "held" while the chain is below its ValidFrom
+// height. Any other transaction — included, dropped or never seen — is
+// reported as "unknown".
+func (h *Handler) getTxStatus(req Request) Response {
+	var params struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.ID == "" {
+		return errResponse(req.ID, CodeInvalidParams, "id is required")
+	}
+	since, ok := h.mempool.PendingSince(params.ID)
+	if !ok {
+		return okResponse(req.ID, map[string]any{"id": params.ID, "status": "unknown"})
+	}
+	status := map[string]any{
+		"id":            params.ID,
+		"status":        "pending",
+		"pending_since": since.UnixNano(),
+		"pending_ms":    time.Since(since).Milliseconds(),
+	}
+	if tx, ok := h.mempool.Get(params.ID); ok && !tx.EligibleAt(h.bc.Height()+1) {
+		status["status"] = "held"
+		status["valid_from"] = tx.ValidFrom
+	}
+	return okResponse(req.ID, status)
+}
+
+// reader returns the state view RPC reads are served from: by default the
+// last committed state, or with pending the speculative state including the
+// write buffer of a block still being produced.
+func (h *Handler) reader(pending bool) core.StateReader {
+	if c, ok := h.state.(interface{ Committed() core.StateReader }); ok && !pending {
+		return c.Committed()
+	}
+	return h.state
+}
+
 func (h *Handler) getBalance(req Request) Response {
 	var params struct {
 		Address string `json:"address"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, err.Error())
@@ -94,16 +481,79 @@ func (h *Handler) getBalance(req Request) Response {
 	if params.Address == "" {
 		return errResponse(req.ID, CodeInvalidParams, "address is required")
 	}
-	acc, err := h.state.GetAccount(params.Address)
+	acc, err := h.reader(params.Pending).GetAccount(params.Address)
 	if err != nil {
 		return errResponse(req.ID, CodeInternalError, err.Error())
 	}
 	return okResponse(req.ID, map[string]any{"address": params.Address, "balance": acc.Balance, "nonce": acc.Nonce})
 }
 
+// maxBalanceAddresses caps the number of addresses one getBalances call
+// reads.
+const maxBalanceAddresses = 500
+
+// Balance is one account's entry in a getBalances result.
+type Balance struct {
+	Balance uint64 `json:"balance"`
+	Nonce   uint64 `json:"nonce"`
+}
+
+// getBalances returns the balance and nonce of each address, keyed by
+// address. Unknown addresses have zero entries.
+func (h *Handler) getBalances(req Request) Response {
+	var params struct {
+		Addresses []string `json:"addresses"`
+		Pending   bool     `json:"pending"` // read the in-progress block's state
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if len(params.Addresses) == 0 {
+		return errResponse(req.ID, CodeInvalidParams, "addresses is required")
+	}
+	if len(params.Addresses) > maxBalanceAddresses {
+		return errResponse(req.ID, CodeInvalidParams,
+			fmt.Sprintf("too many addresses: %d (max %d)", len(params.Addresses), maxBalanceAddresses))
+	}
+	reader := h.reader(params.Pending)
+	balances := make(map[string]Balance, len(params.Addresses))
+	for _, addr := range params.Addresses {
+		if addr == "" {
+			return errResponse(req.ID, CodeInvalidParams, "empty address")
+		}
+		acc, err := reader.GetAccount(addr)
+		if err != nil {
+			return errResponse(req.ID, CodeInternalError, err.Error())
+		}
+		balances[addr] = Balance{Balance: acc.Balance, Nonce: acc.Nonce}
+	}
+	return okResponse(req.ID, balances)
+}
+
+// getPendingNonce returns the nonce a client should sign its next
+// transaction with: the committed nonce advanced past the account's
+// consecutive pending mempool transactions.
+func (h *Handler) getPendingNonce(req Request) Response {
+	var params struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.Address == "" {
+		return errResponse(req.ID, CodeInvalidParams, "address is required")
+	}
+	acc, err := h.reader(false).GetAccount(params.Address)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, map[string]any{"address": params.Address, "nonce": h.mempool.NextNonce(params.Address, acc.Nonce)})
+}
+
 func (h *Handler) getAsset(req Request) Response {
 	var params struct {
-		ID string `json:"id"`
+		ID      string `json:"id"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, err.Error())
@@ -111,7 +561,7 @@ func (h *Handler) getAsset(req Request) Response {
 	if params.ID == "" {
 		return errResponse(req.ID, CodeInvalidParams, "id is required")
 	}
-	asset, err := h.state.GetAsset(params.ID)
+	asset, err := h.reader(params.Pending).GetAsset(params.ID)
 	if err != nil {
 		return errResponse(req.ID, CodeInternalError, err.Error())
 	}
@@ -120,7 +570,8 @@ func (h *Handler) getAsset(req Request) Response {
 
 func (h *Handler) getSession(req Request) Response {
 	var params struct {
-		ID string `json:"id"`
+		ID      string `json:"id"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, err.Error())
@@ -128,7 +579,7 @@ func (h *Handler) getSession(req Request) Response {
 	if params.ID == "" {
 		return errResponse(req.ID, CodeInvalidParams, "id is required")
 	}
-	sess, err := h.state.GetSession(params.ID)
+	sess, err := h.reader(params.Pending).GetSession(params.ID)
 	if err != nil {
 		return errResponse(req.ID, CodeInternalError, err.Error())
 	}
@@ -137,7 +588,8 @@ func (h *Handler) getSession(req Request) Response {
 
 func (h *Handler) getListing(req Request) Response {
 	var params struct {
-		ID string `json:"id"`
+		ID      string `json:"id"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, err.Error())
@@ -145,13 +597,147 @@ func (h *Handler) getListing(req Request) Response {
 	if params.ID == "" {
 		return errResponse(req.ID, CodeInvalidParams, "id is required")
 	}
-	listing, err := h.state.GetListing(params.ID)
+	listing, err := h.reader(params.Pending).GetListing(params.ID)
 	if err != nil {
 		return errResponse(req.ID, CodeInternalError, err.Error())
 	}
 	return okResponse(req.ID, listing)
 }
 
+func (h *Handler) getVesting(req Request) Response {
+	var params struct {
+		ID      string `json:"id"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.ID == "" {
+		return errResponse(req.ID, CodeInvalidParams, "id is required")
+	}
+	v, err := h.reader(params.Pending).GetVesting(params.ID)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, v)
+}
+
+func (h *Handler) getCustomRecord(req Request) Response {
+	var params struct {
+		ID      string `json:"id"`
+		Pending bool   `json:"pending"` // read the in-progress block's state
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.ID == "" {
+		return errResponse(req.ID, CodeInvalidParams, "id is required")
+	}
+	r, err := h.reader(params.Pending).GetCustomRecord(params.ID)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, r)
+}
+
+// getValidatorBonds lists the bonds of the configured validators, skipping
+// validators without one. It never returns nil.
+func (h *Handler) getValidatorBonds(req Request) Response {
+	var params struct {
+		Pending bool `json:"pending"` // read the in-progress block's state
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	r := h.reader(params.Pending)
+	bonds := []*core.ValidatorBond{}
+	for _, v := range h.validators {
+		b, err := r.GetValidatorBond(v)
+		if errors.Is(err, core.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return errResponse(req.ID, CodeInternalError, err.Error())
+		}
+		bonds = append(bonds, b)
+	}
+	return okResponse(req.ID, bonds)
+}
+
+// validatorInfo is one entry of the getValidators result.
+type validatorInfo struct {
+	PubKey string `json:"pubkey"`
+	Weight int    `json:"weight,omitempty"` // proposer turns per rotation
+	Bond   uint64 `json:"bond"`             // genesis bond still locked
+}
+
+// getValidators lists the configured validators in order with their
+// proposer weight and bond.
+func (h *Handler) getValidators(req Request) Response {
+	turns := map[string]int{}
+	if h.turns != nil {
+		for _, pub := range h.turns.Schedule() {
+			turns[pub]++
+		}
+	}
+	r := h.reader(false)
+	vals := make([]validatorInfo, len(h.validators))
+	for i, pub := range h.validators {
+		vals[i] = validatorInfo{PubKey: pub, Weight: turns[pub]}
+		b, err := r.GetValidatorBond(pub)
+		if errors.Is(err, core.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return errResponse(req.ID, CodeInternalError, err.Error())
+		}
+		vals[i].Bond = b.Amount
+	}
+	return okResponse(req.ID, vals)
+}
+
+// Limits on the count parameter of getProposerSchedule.
+const (
+	defaultScheduleCount = 10
+	maxScheduleCount     = 1000
+)
+
+// proposerTurn is one entry of the getProposerSchedule result.
+type proposerTurn struct {
+	Height   int64  `json:"height"`
+	Proposer string `json:"proposer,omitempty"` // empty → not yet known (random selection)
+}
+
+// getProposerSchedule reports the expected proposers of the next count
+// blocks.
+func (h *Handler) getProposerSchedule(req Request) Response {
+	if h.turns == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "proposer schedule is not available on this node")
+	}
+	var params struct {
+		Count int `json:"count"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	if params.Count <= 0 {
+		params.Count = defaultScheduleCount
+	}
+	if params.Count > maxScheduleCount {
+		return errResponse(req.ID, CodeInvalidParams, fmt.Sprintf("count must be at most %d", maxScheduleCount))
+	}
+	start, proposers := h.turns.UpcomingProposers(params.Count)
+	turns := make([]proposerTurn, len(proposers))
+	for i, pub := range proposers {
+		turns[i] = proposerTurn{Height: start + int64(i), Proposer: pub}
+	}
+	return okResponse(req.ID, turns)
+}
+
 func (h *Handler) getAssetsByOwner(req Request) Response {
 	var params struct {
 		Owner string `json:"owner"`
@@ -169,7 +755,150 @@ func (h *Handler) getAssetsByOwner(req Request) Response {
 	return okResponse(req.ID, ids)
 }
 
+// getOpenSessions pages through the IDs of sessions that are still open.
+func (h *Handler) getOpenSessions(req Request) Response {
+	var params txPage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	params.normalize()
+	ids, err := h.indexer.GetOpenSessions(params.Offset, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, ids)
+}
+
+// getAssetsByTemplate pages through the IDs of the existing assets minted
+// from a template.
+func (h *Handler) getAssetsByTemplate(req Request) Response {
+	var params struct {
+		TemplateID string `json:"template_id"`
+		txPage
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.TemplateID == "" {
+		return errResponse(req.ID, CodeInvalidParams, "template_id is required")
+	}
+	params.normalize()
+	ids, err := h.indexer.GetAssetsByTemplate(params.TemplateID, params.Offset, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, ids)
+}
+
+// maxEventsPerQuery caps the number of events a single getEvents returns.
+const maxEventsPerQuery = 1000
+
+func (h *Handler) getEvents(req Request) Response {
+	if h.evlog == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "event log is disabled")
+	}
+	var params struct {
+		Type       string `json:"type"`
+		FromHeight int64  `json:"from_height"`
+		ToHeight   int64  `json:"to_height"` // inclusive; 0 → no upper bound
+		Limit      int    `json:"limit"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	if params.FromHeight < 0 || params.ToHeight < 0 {
+		return errResponse(req.ID, CodeInvalidParams, "heights must not be negative")
+	}
+	if params.Limit <= 0 || params.Limit > maxEventsPerQuery {
+		params.Limit = maxEventsPerQuery
+	}
+	evs, err := h.evlog.Query(indexer.EventFilter{
+		Type:       events.EventType(params.Type),
+		FromHeight: params.FromHeight,
+		ToHeight:   params.ToHeight,
+	}, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	if evs == nil {
+		evs = []events.Event{}
+	}
+	return okResponse(req.ID, evs)
+}
+
+// maxTxRefsPerQuery caps the number of entries a single
+// getTransactionsBy*, getOpenSessions, getAssetsByTemplate, getMempoolTxs
+// or getMarketHistory call returns.
+const maxTxRefsPerQuery = 1000
+
+// txPage holds the pagination parameters shared by getTransactionsBy*,
+// getOpenSessions, getAssetsByTemplate, getMempoolTxs and getMarketHistory.
+type txPage struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+func (p *txPage) normalize() {
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	if p.Limit <= 0 || p.Limit > maxTxRefsPerQuery {
+		p.Limit = maxTxRefsPerQuery
+	}
+}
+
+func (h *Handler) getTransactionsBySender(req Request) Response {
+	if h.txidx == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "transaction index is disabled")
+	}
+	var params struct {
+		Sender string `json:"sender"`
+		txPage
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.Sender == "" {
+		return errResponse(req.ID, CodeInvalidParams, "sender is required")
+	}
+	params.normalize()
+	refs, err := h.txidx.GetBySender(params.Sender, params.Offset, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, refs)
+}
+
+func (h *Handler) getTransactionsByType(req Request) Response {
+	if h.txidx == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "transaction index is disabled")
+	}
+	var params struct {
+		Type string `json:"type"`
+		txPage
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return errResponse(req.ID, CodeInvalidParams, err.Error())
+	}
+	if params.Type == "" {
+		return errResponse(req.ID, CodeInvalidParams, "type is required")
+	}
+	params.normalize()
+	refs, err := h.txidx.GetByType(core.TxType(params.Type), params.Offset, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, refs)
+}
+
 func (h *Handler) sendTx(req Request) Response {
+	if h.paused() {
+		return errResponse(req.ID, CodeNodePaused, "node paused; not accepting transactions")
+	}
 	var tx core.Transaction
 	if err := json.Unmarshal(req.Params, &tx); err != nil {
 		return errResponse(req.ID, CodeInvalidParams, err.Error())
@@ -182,8 +911,70 @@ func (h *Handler) sendTx(req Request) Response {
 	}
 	// Recompute the ID server-side; do not trust the client-provided value.
 	tx.ID = tx.Hash()
-	if err := h.mempool.Add(&tx); err != nil {
-		return errResponse(req.ID, CodeInternalError, err.Error())
+	if err := h.admit(&tx); err != nil {
+		return errResponse(req.ID, txErrorCode(err), err.Error())
 	}
+	h.broadcast(&tx)
 	return okResponse(req.ID, map[string]string{"tx_id": tx.ID})
 }
+
+// txErrorCode maps a mempool admission error to a JSON-RPC error code so
+// clients can tell verification failures apart. Anything wrong with the
+// transaction itself is a client error; only failures of the node, such as
+// a closed intake, are CodeInternalError.
+func txErrorCode(err error) int {
+	switch {
+	case errors.Is(err, core.ErrMissingFrom):
+		return CodeTxMissingFrom
+	case errors.Is(err, core.ErrBadPubkey), errors.Is(err, core.ErrBadFeePayer):
+		return CodeTxBadPubkey
+	case errors.Is(err, core.ErrBadSignature), errors.Is(err, core.ErrBadFeePayerSignature),
+		errors.Is(err, core.ErrBadCosignature):
+		return CodeTxBadSignature
+	case errors.Is(err, core.ErrUnknownVersion), errors.Is(err, core.ErrTxIDMismatch),
+		errors.Is(err, core.ErrTxExpired), errors.Is(err, core.ErrTxFuture),
+		errors.Is(err, core.ErrTxRejected), errors.Is(err, core.ErrTxKnown),
+		errors.Is(err, core.ErrTxTooEarly), errors.Is(err, core.ErrLegacySignature),
+		errors.Is(err, core.ErrUnnamedCosigners):
+		return CodeInvalidParams
+	case errors.Is(err, core.ErrIntakeFull), errors.Is(err, core.ErrMempoolFull),
+		errors.Is(err, core.ErrAccountTxLimit):
+		return CodeRateLimited
+	default:
+		return CodeInternalError
+	}
+}
+
+// getMarketHistory pages through archived listings and sales, optionally
+// of one asset or seller and within a block time range.
+func (h *Handler) getMarketHistory(req Request) Response {
+	if h.market == nil {
+		return errResponse(req.ID, CodeMethodNotFound, "market history is disabled")
+	}
+	var params struct {
+		AssetID  string `json:"asset_id"`
+		Seller   string `json:"seller"`
+		FromTime int64  `json:"from_time"` // Unix nanoseconds
+		ToTime   int64  `json:"to_time"`   // inclusive; 0 → no upper bound
+		txPage
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return errResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+	}
+	if params.FromTime < 0 || params.ToTime < 0 {
+		return errResponse(req.ID, CodeInvalidParams, "times must not be negative")
+	}
+	params.normalize()
+	records, err := h.market.Query(indexer.MarketQuery{
+		AssetID:  params.AssetID,
+		Seller:   params.Seller,
+		FromTime: params.FromTime,
+		ToTime:   params.ToTime,
+	}, params.Offset, params.Limit)
+	if err != nil {
+		return errResponse(req.ID, CodeInternalError, err.Error())
+	}
+	return okResponse(req.ID, records)
+}
@@ -1,56 +1,193 @@
 package rpc
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"time"
+
+	"golang.org/x/net/websocket"
 )
 
+// MaxBatchSize bounds the members of one JSON-RPC batch request. Each
+// member is dispatched with its own request timeout, so a larger batch is
+// refused as a whole rather than served.
+const MaxBatchSize = 100
+
 // Server is a JSON-RPC 2.0 HTTP server.
 type Server struct {
-	handler   *Handler
-	addr      string
-	authToken string // empty → no auth required
-	srv       *http.Server
-	ln        net.Listener
+	handler    *Handler
+	addr       string
+	authToken  string // empty → no auth required
+	adminToken string // empty → admin methods only over a no-auth Unix socket
+	srv        *http.Server
+	ln         net.Listener
+	mux        *http.ServeMux
+	feed       *Feed // nil → WebSocket feed disabled
+
+	unixPath   string // empty → no Unix socket listener
+	unixNoAuth bool   // skip bearer auth for Unix socket clients
+	unixLn     net.Listener
+
+	requestTimeout time.Duration // per-request processing bound; 0 → none
+	slowThreshold  time.Duration // requests taking this long are logged; 0 → none
+
+	allowed map[string]bool // methods served over TCP; nil → all
+
+	maxConns int // simultaneous TCP connections
 }
 
+// DefaultSlowRequestThreshold is the processing time above which a request
+// is logged unless overridden by SetRequestTimeout.
+const DefaultSlowRequestThreshold = time.Second
+
+// unixConnKey marks request contexts whose connection arrived on the Unix socket.
+type unixConnKey struct{}
+
 // NewServer creates a Server on addr. If authToken is non-empty, every
 // request must carry a matching "Authorization: Bearer <token>" header.
+// An empty addr disables the TCP listener (see EnableUnixSocket).
 func NewServer(addr string, handler *Handler, authToken string) *Server {
-	s := &Server{handler: handler, addr: addr, authToken: authToken}
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.serveHTTP)
+	s := &Server{handler: handler, addr: addr, authToken: authToken, mux: http.NewServeMux(), slowThreshold: DefaultSlowRequestThreshold,
+		maxConns: DefaultMaxConnections}
+	s.mux.HandleFunc("/", s.serveHTTP)
 	s.srv = &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           limitConns(s.mux),
 		ReadHeaderTimeout: 10 * time.Second,
 		ReadTimeout:       30 * time.Second,
 		WriteTimeout:      30 * time.Second,
 		IdleTimeout:       60 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if _, ok := c.(*net.UnixConn); ok {
+				return context.WithValue(ctx, unixConnKey{}, true)
+			}
+			return connContext(ctx, c)
+		},
 	}
 	return s
 }
 
+// SetAdminToken enables admin methods such as dropTx for requests carrying
+// "Authorization: Bearer <token>". The admin token also satisfies the
+// regular auth token. Clients on a Unix socket without authentication (see
+// EnableUnixSocket) are admins too. Must be called before Start.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// SetRequestTimeout bounds how long one request — each member of a batch
+// separately — may be processed. On expiry its context is cancelled and the
+// client gets a CodeRequestTimeout error even if the method keeps running.
+// Requests taking at least slowThreshold are logged with their method and
+// duration. Non-positive values keep the current setting. Must be called
+// before Start.
+func (s *Server) SetRequestTimeout(timeout, slowThreshold time.Duration) {
+	if timeout > 0 {
+		s.requestTimeout = timeout
+	}
+	if slowThreshold > 0 {
+		s.slowThreshold = slowThreshold
+	}
+}
+
+// SetAllowedMethods restricts the methods served to TCP clients to the
+// given ones; others get CodeMethodNotAllowed, even with the admin token.
+// This lets a public listener expose a read-only subset while sendTx and
+// admin methods stay on an internal one. Unix socket clients are local and
+// are not restricted. An empty list allows all methods. Must be called
+// before Start.
+func (s *Server) SetAllowedMethods(methods []string) {
+	if len(methods) == 0 {
+		s.allowed = nil
+		return
+	}
+	s.allowed = make(map[string]bool, len(methods))
+	for _, m := range methods {
+		s.allowed[m] = true
+	}
+}
+
+// EnableUnixSocket additionally serves the same endpoints on a Unix domain
+// socket at path, created with mode 0600. If noAuth is true, clients on the
+// socket skip bearer authentication; filesystem permissions guard them
+// instead. Must be called before Start.
+func (s *Server) EnableUnixSocket(path string, noAuth bool) {
+	s.unixPath = path
+	s.unixNoAuth = noAuth
+}
+
+// EnableFeed serves feed as a WebSocket endpoint at /ws. Must be called
+// before Start. The same bearer-token authentication applies.
+func (s *Server) EnableFeed(feed *Feed) {
+	s.feed = feed
+	ws := websocket.Server{Handler: feed.serveWS} // no Origin check: clients are servers, not browsers
+	s.mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ws.ServeHTTP(w, r)
+	})
+}
+
 // Start binds the port synchronously (so callers know immediately if binding
 // fails) then serves requests in a background goroutine.
 func (s *Server) Start() error {
-	ln, err := net.Listen("tcp", s.addr)
-	if err != nil {
-		return err
+	if s.addr != "" {
+		ln, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return err
+		}
+		s.ln = &limitListener{Listener: ln, max: int64(s.maxConns)}
 	}
-	s.ln = ln
-	go func() {
-		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
-			log.Printf("[rpc] server error: %v", err)
+	if s.unixPath != "" {
+		// A socket file left by an unclean exit would make Listen fail.
+		if err := os.Remove(s.unixPath); err != nil && !os.IsNotExist(err) {
+			s.closeListeners()
+			return err
 		}
-	}()
+		ln, err := net.Listen("unix", s.unixPath)
+		if err != nil {
+			s.closeListeners()
+			return err
+		}
+		if err := os.Chmod(s.unixPath, 0600); err != nil {
+			ln.Close()
+			s.closeListeners()
+			return err
+		}
+		s.unixLn = ln
+	}
+	for _, ln := range []net.Listener{s.ln, s.unixLn} {
+		if ln == nil {
+			continue
+		}
+		go func(ln net.Listener) {
+			if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Printf("[rpc] server error: %v", err)
+			}
+		}(ln)
+	}
 	return nil
 }
 
+func (s *Server) closeListeners() {
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	if s.unixLn != nil {
+		s.unixLn.Close()
+	}
+}
+
 // Addr returns the listener's address. Useful when started on ":0".
 func (s *Server) Addr() net.Addr {
 	if s.ln != nil {
@@ -64,7 +201,21 @@ func (s *Server) Addr() net.Addr {
 func (s *Server) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	return s.srv.Shutdown(ctx)
+	return s.Shutdown(ctx)
+}
+
+// Shutdown is like Stop but waits for in-flight requests until ctx expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	// http.Server.Shutdown does not track hijacked WebSocket connections;
+	// close them here.
+	if s.feed != nil {
+		s.feed.Close()
+	}
+	err := s.srv.Shutdown(ctx)
+	if s.unixLn != nil {
+		os.Remove(s.unixPath)
+	}
+	return err
 }
 
 func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
@@ -73,31 +224,144 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if s.authToken != "" {
-		if r.Header.Get("Authorization") != "Bearer "+s.authToken {
-			w.WriteHeader(http.StatusUnauthorized)
-			writeJSON(w, errResponse(nil, CodeUnauthorized, "unauthorized"))
-			return
-		}
+	if !s.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, errResponse(nil, CodeUnauthorized, "unauthorized"))
+		return
 	}
 
 	// Limit request body to 1 MB to prevent memory exhaustion.
 	r.Body = http.MaxBytesReader(w, r.Body, 1*1024*1024)
 
-	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
 		writeJSON(w, errResponse(nil, CodeParseError, err.Error()))
 		return
 	}
-	if req.JSONRPC != "2.0" {
-		writeJSON(w, errResponse(req.ID, CodeInvalidRequest, "jsonrpc must be '2.0'"))
+	ctx := r.Context()
+	if s.admin(r) {
+		ctx = WithAdmin(ctx)
+	}
+
+	// Batch: an array of requests, answered by an array of the responses
+	// to its non-notification members.
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			writeJSON(w, errResponse(nil, CodeParseError, err.Error()))
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, errResponse(nil, CodeInvalidRequest, "empty batch"))
+			return
+		}
+		if len(batch) > MaxBatchSize {
+			writeJSON(w, errResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch of %d requests exceeds the limit of %d", len(batch), MaxBatchSize)))
+			return
+		}
+		resps := make([]Response, 0, len(batch))
+		for _, raw := range batch {
+			if resp, ok := s.handle(ctx, raw); ok {
+				resps = append(resps, resp)
+			}
+		}
+		if len(resps) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, resps)
 		return
 	}
 
-	resp := s.handler.Dispatch(req)
+	resp, ok := s.handle(ctx, body)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	writeJSON(w, resp)
 }
 
+// handle decodes and dispatches a single request. It returns false when the
+// request is a notification (no "id" member), whose response is suppressed.
+func (s *Server) handle(ctx context.Context, raw []byte) (Response, bool) {
+	var req Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return errResponse(nil, CodeParseError, err.Error()), true
+	}
+	var members map[string]json.RawMessage
+	_ = json.Unmarshal(raw, &members) // cannot fail: raw already decoded as an object
+	_, hasID := members["id"]
+
+	if req.JSONRPC != "2.0" {
+		// Invalid requests are reported even without an id, per the spec.
+		return errResponse(req.ID, CodeInvalidRequest, "jsonrpc must be '2.0'"), true
+	}
+	if s.allowed != nil && !s.allowed[req.Method] && ctx.Value(unixConnKey{}) == nil {
+		return errResponse(req.ID, CodeMethodNotAllowed, fmt.Sprintf("method %q not allowed on this listener", req.Method)), hasID
+	}
+	start := time.Now()
+	resp := s.dispatch(ctx, req)
+	if d := time.Since(start); s.slowThreshold > 0 && d >= s.slowThreshold {
+		log.Printf("[rpc] slow request: %s took %s", req.Method, d)
+	}
+	return resp, hasID
+}
+
+// dispatch runs req under the request timeout, if one is set. The method
+// runs in its own goroutine so that one ignoring its context cannot hold the
+// response past the deadline.
+func (s *Server) dispatch(ctx context.Context, req Request) Response {
+	if s.requestTimeout <= 0 {
+		return s.handler.Dispatch(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	done := make(chan Response, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[rpc] %s panicked: %v", req.Method, r)
+				done <- errResponse(req.ID, CodeInternalError, "internal error")
+			}
+		}()
+		done <- s.handler.Dispatch(ctx, req)
+	}()
+	select {
+	case resp := <-done:
+		if resp.Error != nil && resp.Error.Code == CodeRequestCancelled && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return s.timeoutResponse(req)
+		}
+		return resp
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return s.timeoutResponse(req)
+		}
+		return errResponse(req.ID, CodeRequestCancelled, "request cancelled: "+ctx.Err().Error())
+	}
+}
+
+func (s *Server) timeoutResponse(req Request) Response {
+	return errResponse(req.ID, CodeRequestTimeout, fmt.Sprintf("request timed out after %s", s.requestTimeout))
+}
+
+// authorized reports whether r carries the configured bearer token, or
+// arrived on a Unix socket configured to skip authentication.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.admin(r) {
+		return true
+	}
+	return s.authToken == "" || r.Header.Get("Authorization") == "Bearer "+s.authToken
+}
+
+// admin reports whether r carries the admin token, or arrived on a Unix
+// socket configured to skip authentication.
+func (s *Server) admin(r *http.Request) bool {
+	if s.unixNoAuth && r.Context().Value(unixConnKey{}) != nil {
+		return true
+	}
+	return s.adminToken != "" && r.Header.Get("Authorization") == "Bearer "+s.adminToken
+}
+
 func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(v); err != nil {
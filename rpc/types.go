@@ -27,12 +27,24 @@ type Error struct {
 
 // Standard JSON-RPC error codes.
 const (
-	CodeParseError     = -32700
-	CodeInvalidRequest = -32600
-	CodeMethodNotFound = -32601
-	CodeInvalidParams  = -32602
-	CodeInternalError  = -32603
-	CodeUnauthorized   = -32000
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeUnauthorized     = -32000
+	CodeRequestCancelled = -32001
+	CodeRateLimited      = -32002
+	CodeRequestTimeout   = -32003
+	CodeMethodNotAllowed = -32004
+	CodeNodePaused       = -32005
+)
+
+// Transaction verification error codes returned by sendTx.
+const (
+	CodeTxMissingFrom  = -32010
+	CodeTxBadPubkey    = -32011
+	CodeTxBadSignature = -32012
 )
 
 func errResponse(id any, code int, msg string) Response {
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Names of the built-in storage engines.
+const (
+	DefaultBackend = "leveldb" // used when none is configured
+	PebbleBackend  = "pebble"  // see pebble_stub.go
+)
+
+// Opener opens (or creates) a database of one storage engine at path.
+type Opener func(path string) (DB, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Opener)
+)
+
+func init() {
+	RegisterBackend(DefaultBackend, func(path string) (DB, error) { return NewLevelDB(path) })
+}
+
+// RegisterBackend makes a storage engine available to Open under name.
+// Engine packages call it from init(). Panics on an empty name or a
+// duplicate registration.
+func RegisterBackend(name string, open Opener) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if name == "" {
+		panic("storage: backend name must not be empty")
+	}
+	if _, exists := backends[name]; exists {
+		panic(fmt.Sprintf("storage: backend %q already registered", name))
+	}
+	backends[name] = open
+}
+
+// HasBackend reports whether a storage engine is registered under name.
+func HasBackend(name string) bool {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	_, ok := backends[name]
+	return ok
+}
+
+// Backends returns the names of the registered storage engines, sorted.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the database at path with the storage engine registered as
+// backend. An empty backend means DefaultBackend.
+func Open(backend, path string) (DB, error) {
+	if backend == "" {
+		backend = DefaultBackend
+	}
+	backendsMu.RLock()
+	open, ok := backends[backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage backend %q (registered: %v)", backend, Backends())
+	}
+	return open(path)
+}
@@ -1,14 +1,32 @@
 package storage
 
+import "github.com/syndtr/goleveldb/leveldb/util"
+
 // Batch is an atomic write buffer. All operations are applied together
 // via Write() or discarded together on error, preventing partial commits.
 type Batch interface {
 	Set(key, value []byte)
 	Delete(key []byte)
+	// DeleteRange deletes every key k with start <= k < end, including keys
+	// set earlier in the same batch. A nil end means no upper bound.
+	DeleteRange(start, end []byte)
 	Write() error
 	Reset()
 }
 
+// SyncSetter is implemented by DBs whose batch writes can be made durable
+// (fsynced) before Write returns.
+type SyncSetter interface {
+	SetSync(sync bool)
+}
+
+// PrefixRange returns the [start, end) key range covering every key with
+// the given prefix, for use with Batch.DeleteRange.
+func PrefixRange(prefix []byte) (start, end []byte) {
+	r := util.BytesPrefix(prefix)
+	return r.Start, r.Limit
+}
+
 // DB is the generic key-value store interface.
 type DB interface {
 	Get(key []byte) ([]byte, error)
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -12,7 +13,8 @@ import (
 
 // LevelDB implements DB using LevelDB.
 type LevelDB struct {
-	db *leveldb.DB
+	db   *leveldb.DB
+	sync bool // fsync batch writes before Write returns
 }
 
 // NewLevelDB opens (or creates) a LevelDB database at path.
@@ -44,8 +46,15 @@ func (l *LevelDB) NewIterator(prefix []byte) Iterator {
 	return l.db.NewIterator(util.BytesPrefix(prefix), nil)
 }
 
+// SetSync selects whether batch writes — block commits and state commits —
+// are fsynced before Write returns. Synchronous writes survive power loss
+// at the cost of throughput; single-key Set and Delete stay asynchronous.
+func (l *LevelDB) SetSync(sync bool) {
+	l.sync = sync
+}
+
 func (l *LevelDB) NewBatch() Batch {
-	return &levelBatch{db: l.db, b: new(leveldb.Batch)}
+	return &levelBatch{db: l.db, b: new(leveldb.Batch), sync: l.sync}
 }
 
 func (l *LevelDB) Close() error {
@@ -54,26 +63,70 @@ func (l *LevelDB) Close() error {
 
 // levelBatch wraps leveldb.Batch for atomic multi-key writes.
 type levelBatch struct {
-	db *leveldb.DB
-	b  *leveldb.Batch
+	db   *leveldb.DB
+	b    *leveldb.Batch
+	sync bool
+	err  error // first DeleteRange scan failure, reported by Write
 }
 
 func (lb *levelBatch) Set(key, value []byte) { lb.b.Put(key, value) }
 func (lb *levelBatch) Delete(key []byte)      { lb.b.Delete(key) }
-func (lb *levelBatch) Reset()                 { lb.b.Reset() }
+func (lb *levelBatch) Reset()                 { lb.b.Reset(); lb.err = nil }
 func (lb *levelBatch) Write() error {
-	return lb.db.Write(lb.b, &opt.WriteOptions{Sync: true})
+	if lb.err != nil {
+		return lb.err
+	}
+	return lb.db.Write(lb.b, &opt.WriteOptions{Sync: lb.sync})
+}
+
+// DeleteRange queues a delete for every key in [start, end) currently in
+// the database or already set in this batch. Keys written to the database
+// by others between DeleteRange and Write are not covered.
+func (lb *levelBatch) DeleteRange(start, end []byte) {
+	it := lb.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	defer it.Release()
+	for it.Next() {
+		lb.b.Delete(append([]byte(nil), it.Key()...))
+	}
+	if err := it.Error(); err != nil && lb.err == nil {
+		lb.err = fmt.Errorf("delete range scan: %w", err)
+	}
+	var pending [][]byte
+	_ = lb.b.Replay(rangeCollector{start: start, end: end, keys: &pending})
+	for _, k := range pending {
+		lb.b.Delete(k)
+	}
+}
+
+// rangeCollector gathers the keys of batched puts that fall in a range.
+type rangeCollector struct {
+	start, end []byte
+	keys       *[][]byte
+}
+
+func (c rangeCollector) Put(key, _ []byte) {
+	if inRange(key, c.start, c.end) {
+		*c.keys = append(*c.keys, append([]byte(nil), key...))
+	}
+}
+
+func (c rangeCollector) Delete([]byte) {}
+
+func inRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (end == nil || bytes.Compare(key, end) < 0)
 }
 
 // ---- BlockStore implementation ----
 
-// LevelBlockStore implements core.BlockStore on top of LevelDB.
+// LevelBlockStore implements core.BlockStore on top of a DB, normally
+// LevelDB. CommitBlock relies only on the DB's atomic Batch, so any DB
+// whose batches are all-or-nothing gives the same crash consistency.
 type LevelBlockStore struct {
-	db *LevelDB
+	db DB
 }
 
-// NewLevelBlockStore wraps a LevelDB instance as a BlockStore.
-func NewLevelBlockStore(db *LevelDB) *LevelBlockStore {
+// NewLevelBlockStore wraps a DB instance as a BlockStore.
+func NewLevelBlockStore(db DB) *LevelBlockStore {
 	return &LevelBlockStore{db: db}
 }
 
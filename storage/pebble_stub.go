@@ -0,0 +1,15 @@
+//go:build !pebble
+
+package storage
+
+import "fmt"
+
+// Without the pebble build tag the engine is not compiled in; the name is
+// still registered so that selecting it fails with an explanation rather
+// than as an unknown backend. The Pebble implementation belongs in a file
+// built with the pebble tag that registers it under PebbleBackend.
+func init() {
+	RegisterBackend(PebbleBackend, func(string) (DB, error) {
+		return nil, fmt.Errorf("storage backend %q is not compiled into this binary", PebbleBackend)
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/tolelom/tolchain/core"
@@ -31,8 +33,15 @@ var (
 	prefixTemplate = registerPrefix("tmpl:")
 	prefixSession  = registerPrefix("sess:")
 	prefixListing  = registerPrefix("list:")
+	prefixVesting  = registerPrefix("vest:")
+	prefixCustom   = registerPrefix("custom:")
+	prefixBond     = registerPrefix("bond:")
+	prefixSupply   = registerPrefix("supply:")
 )
 
+// keyTotalSupply holds the total token supply as a JSON number.
+var keyTotalSupply = prefixSupply + "total"
+
 type stateSnapshot struct {
 	dirty   map[string][]byte
 	deleted map[string]bool
@@ -42,20 +51,38 @@ type stateSnapshot struct {
 // snapshot/rollback, and deterministic state-root computation.
 // All methods are protected by a mutex for future-proof concurrency safety.
 type StateDB struct {
-	mu        sync.Mutex
-	db        DB
-	dirty     map[string][]byte
-	deleted   map[string]bool
-	snapshots []stateSnapshot
+	mu          sync.Mutex
+	db          DB
+	dirty       map[string][]byte
+	deleted     map[string]bool
+	snapshots   []stateSnapshot
+	rootVersion int // core.StateRoot*; see SetRootVersion
 }
 
 // NewStateDB creates a StateDB backed by db.
 func NewStateDB(db DB) *StateDB {
 	return &StateDB{
-		db:      db,
-		dirty:   make(map[string][]byte),
-		deleted: make(map[string]bool),
+		db:          db,
+		dirty:       make(map[string][]byte),
+		deleted:     make(map[string]bool),
+		rootVersion: core.DefaultStateRootVersion,
+	}
+}
+
+// SetRootVersion selects the algorithm ComputeRoot uses: core.StateRootFlat
+// or core.StateRootMerkle, with 0 meaning core.DefaultStateRootVersion. It
+// must match the version recorded in the chain's genesis block.
+func (s *StateDB) SetRootVersion(version int) error {
+	version = core.StateRootVersionOrDefault(version)
+	switch version {
+	case core.StateRootFlat, core.StateRootMerkle:
+	default:
+		return fmt.Errorf("unknown state root version %d", version)
 	}
+	s.mu.Lock()
+	s.rootVersion = version
+	s.mu.Unlock()
+	return nil
 }
 
 // ---- internal helpers ----
@@ -80,23 +107,27 @@ func (s *StateDB) del(key string) {
 	s.deleted[key] = true
 }
 
+// buffered returns a reader over the write buffer layered on the DB.
+// Callers must hold s.mu.
+func (s *StateDB) buffered() stateReader {
+	return stateReader{get: s.get}
+}
+
+// Committed returns a read-only view of the last committed state. It reads
+// straight from the DB, ignoring the write buffer of a block in progress,
+// so it never exposes state that may still be reverted.
+func (s *StateDB) Committed() core.StateReader {
+	return stateReader{get: func(key string) ([]byte, error) {
+		return s.db.Get([]byte(key))
+	}}
+}
+
 // ---- Account ----
 
 func (s *StateDB) GetAccount(address string) (*core.Account, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.get(prefixAccount + address)
-	if errors.Is(err, core.ErrNotFound) {
-		return &core.Account{Address: address}, nil // zero-value account
-	}
-	if err != nil {
-		return nil, err
-	}
-	var acc core.Account
-	if err := json.Unmarshal(data, &acc); err != nil {
-		return nil, err
-	}
-	return &acc, nil
+	return s.buffered().GetAccount(address)
 }
 
 func (s *StateDB) SetAccount(acc *core.Account) error {
@@ -110,20 +141,19 @@ func (s *StateDB) SetAccount(acc *core.Account) error {
 	return nil
 }
 
+// HasAccount reports whether an account entry exists for address.
+func (s *StateDB) HasAccount(address string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered().HasAccount(address)
+}
+
 // ---- Asset ----
 
 func (s *StateDB) GetAsset(id string) (*core.Asset, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.get(prefixAsset + id)
-	if err != nil {
-		return nil, err
-	}
-	var asset core.Asset
-	if err := json.Unmarshal(data, &asset); err != nil {
-		return nil, err
-	}
-	return &asset, nil
+	return s.buffered().GetAsset(id)
 }
 
 func (s *StateDB) SetAsset(asset *core.Asset) error {
@@ -149,15 +179,7 @@ func (s *StateDB) DeleteAsset(id string) error {
 func (s *StateDB) GetTemplate(id string) (*core.AssetTemplate, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.get(prefixTemplate + id)
-	if err != nil {
-		return nil, err
-	}
-	var t core.AssetTemplate
-	if err := json.Unmarshal(data, &t); err != nil {
-		return nil, err
-	}
-	return &t, nil
+	return s.buffered().GetTemplate(id)
 }
 
 func (s *StateDB) SetTemplate(t *core.AssetTemplate) error {
@@ -176,15 +198,7 @@ func (s *StateDB) SetTemplate(t *core.AssetTemplate) error {
 func (s *StateDB) GetSession(id string) (*core.Session, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.get(prefixSession + id)
-	if err != nil {
-		return nil, err
-	}
-	var sess core.Session
-	if err := json.Unmarshal(data, &sess); err != nil {
-		return nil, err
-	}
-	return &sess, nil
+	return s.buffered().GetSession(id)
 }
 
 func (s *StateDB) SetSession(sess *core.Session) error {
@@ -203,15 +217,7 @@ func (s *StateDB) SetSession(sess *core.Session) error {
 func (s *StateDB) GetListing(id string) (*core.MarketListing, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.get(prefixListing + id)
-	if err != nil {
-		return nil, err
-	}
-	var l core.MarketListing
-	if err := json.Unmarshal(data, &l); err != nil {
-		return nil, err
-	}
-	return &l, nil
+	return s.buffered().GetListing(id)
 }
 
 func (s *StateDB) SetListing(l *core.MarketListing) error {
@@ -225,6 +231,146 @@ func (s *StateDB) SetListing(l *core.MarketListing) error {
 	return nil
 }
 
+// ---- Vesting ----
+
+func (s *StateDB) GetVesting(id string) (*core.Vesting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered().GetVesting(id)
+}
+
+func (s *StateDB) SetVesting(v *core.Vesting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.set(prefixVesting+v.ID, data)
+	return nil
+}
+
+// ---- Custom records ----
+
+func (s *StateDB) GetCustomRecord(id string) (*core.CustomRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered().GetCustomRecord(id)
+}
+
+func (s *StateDB) SetCustomRecord(r *core.CustomRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.set(prefixCustom+r.ID, data)
+	return nil
+}
+
+// ---- Validator bonds ----
+
+func (s *StateDB) GetValidatorBond(validator string) (*core.ValidatorBond, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered().GetValidatorBond(validator)
+}
+
+func (s *StateDB) SetValidatorBond(b *core.ValidatorBond) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	s.set(prefixBond+b.Validator, data)
+	return nil
+}
+
+// ---- Supply ----
+
+func (s *StateDB) GetTotalSupply() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered().GetTotalSupply()
+}
+
+func (s *StateDB) SetTotalSupply(supply uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(supply)
+	if err != nil {
+		return err
+	}
+	s.set(keyTotalSupply, data)
+	return nil
+}
+
+// VerifySupply checks the supply invariant: the total supply equals the sum
+// of all account balances plus the stakes locked in open sessions, the
+// unclaimed tokens of vesting schedules and the validator bonds. A mismatch means some handler
+// minted or destroyed tokens without accounting for it. It scans the whole
+// state, so it is meant for tests and debugging, not for every block.
+func (s *StateDB) VerifySupply() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, merged, err := s.entries()
+	if err != nil {
+		return err
+	}
+	var held uint64
+	add := func(n uint64) error {
+		if n > math.MaxUint64-held {
+			return errors.New("supply invariant: holdings overflow")
+		}
+		held += n
+		return nil
+	}
+	for _, k := range keys {
+		var n uint64
+		switch {
+		case strings.HasPrefix(k, prefixAccount):
+			var acc core.Account
+			if err := json.Unmarshal(merged[k], &acc); err != nil {
+				return fmt.Errorf("decode %s: %w", k, err)
+			}
+			n = acc.Balance
+		case strings.HasPrefix(k, prefixSession):
+			var sess core.Session
+			if err := json.Unmarshal(merged[k], &sess); err != nil {
+				return fmt.Errorf("decode %s: %w", k, err)
+			}
+			if sess.Status == "open" {
+				n = sess.Stakes * uint64(len(sess.Players))
+			}
+		case strings.HasPrefix(k, prefixVesting):
+			var v core.Vesting
+			if err := json.Unmarshal(merged[k], &v); err != nil {
+				return fmt.Errorf("decode %s: %w", k, err)
+			}
+			n = v.Total() - v.Claimed
+		case strings.HasPrefix(k, prefixBond):
+			var b core.ValidatorBond
+			if err := json.Unmarshal(merged[k], &b); err != nil {
+				return fmt.Errorf("decode %s: %w", k, err)
+			}
+			n = b.Amount
+		}
+		if err := add(n); err != nil {
+			return err
+		}
+	}
+	supply, err := s.buffered().GetTotalSupply()
+	if err != nil {
+		return err
+	}
+	if held != supply {
+		return fmt.Errorf("supply invariant: total supply %d, held %d", supply, held)
+	}
+	return nil
+}
+
 // ---- Snapshot / Rollback / Commit ----
 
 // Snapshot saves the current write buffer and returns a snapshot ID.
@@ -274,25 +420,59 @@ func (s *StateDB) RevertToSnapshot(id int) error {
 	return nil
 }
 
-// ComputeRoot returns the deterministic hash of the complete world state.
+// ComputeRoot returns the deterministic root of the complete world state.
 // It merges all persisted state entries (scanned from DB by the known state
-// prefixes) with the current write buffer, then hashes the sorted key-value
-// pairs using length-prefix encoding.  It does NOT flush or modify state,
-// so it is safe to call before signing a block.
-func (s *StateDB) ComputeRoot() string {
+// prefixes) with the current write buffer and, under the default
+// core.StateRootMerkle, builds a binary Merkle tree whose leaves are the
+// key-value pairs in sorted key order (see crypto.MerkleLeaf), so inclusion
+// of any entry can be proven against the root. Under core.StateRootFlat it
+// hashes the length-prefixed pairs instead. It does NOT flush or modify
+// state, so it is safe to call before signing a block. A failed DB scan is
+// returned as an error rather than yielding the root of a partial state.
+func (s *StateDB) ComputeRoot() (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	keys, merged, err := s.entries()
+	if err != nil {
+		return "", err
+	}
+	if s.rootVersion == core.StateRootFlat {
+		return flatRoot(keys, merged), nil
+	}
+	leaves := make([][]byte, len(keys))
+	for i, k := range keys {
+		leaves[i] = crypto.MerkleLeaf([]byte(k), merged[k])
+	}
+	return crypto.MerkleRoot(leaves), nil
+}
+
+// flatRoot hashes the key-value pairs in keys order, each key and value
+// prefixed by its 4-byte big-endian length.
+func flatRoot(keys []string, merged map[string][]byte) string {
+	var buf bytes.Buffer
+	var lenBuf [4]byte
+	for _, k := range keys {
+		v := merged[k]
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(k)))
+		buf.Write(lenBuf[:])
+		buf.WriteString(k)
+		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(v)))
+		buf.Write(lenBuf[:])
+		buf.Write(v)
+	}
+	return crypto.Hash(buf.Bytes())
+}
+
+// entries returns every live state entry — persisted entries overlaid with
+// the write buffer, minus deletions — along with its keys in sorted order.
+// Callers must hold s.mu.
+func (s *StateDB) entries() ([]string, map[string][]byte, error) {
 	// Step 1: collect all persisted state entries from DB.
 	merged := make(map[string][]byte)
 	for _, prefix := range statePrefixes {
-		it := s.db.NewIterator([]byte(prefix))
-		for it.Next() {
-			k := string(it.Key())
-			v := make([]byte, len(it.Value()))
-			copy(v, it.Value())
-			merged[k] = v
+		if err := s.scanPrefix(prefix, merged); err != nil {
+			return nil, nil, err
 		}
-		it.Release()
 	}
 
 	// Step 2: apply in-memory write buffer (uncommitted changes this block).
@@ -311,21 +491,22 @@ func (s *StateDB) ComputeRoot() string {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	return keys, merged, nil
+}
 
-	// Step 5: length-prefix encode each key-value pair and hash.
-	var buf bytes.Buffer
-	var lenBuf [4]byte
-	for _, k := range keys {
-		v := merged[k]
-		kb := []byte(k)
-		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(kb)))
-		buf.Write(lenBuf[:])
-		buf.Write(kb)
-		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(v)))
-		buf.Write(lenBuf[:])
-		buf.Write(v)
+// scanPrefix copies every persisted entry under prefix into dst. The
+// iterator is released even if the scan panics, and an iterator error is
+// returned so that a truncated scan is never mistaken for the full state.
+func (s *StateDB) scanPrefix(prefix string, dst map[string][]byte) error {
+	it := s.db.NewIterator([]byte(prefix))
+	defer it.Release()
+	for it.Next() {
+		dst[string(it.Key())] = bytes.Clone(it.Value())
 	}
-	return crypto.Hash(buf.Bytes())
+	if err := it.Error(); err != nil {
+		return fmt.Errorf("scan %s: %w", prefix, err)
+	}
+	return nil
 }
 
 // Commit atomically flushes the write buffer to the underlying DB via a
@@ -334,12 +515,24 @@ func (s *StateDB) ComputeRoot() string {
 func (s *StateDB) Commit() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	batch := s.db.NewBatch()
-	for k, v := range s.dirty {
-		batch.Set([]byte(k), v)
+	// Apply writes and deletes in sorted key order so the batch contents are
+	// reproducible regardless of map iteration order. The two maps are
+	// disjoint, so each key yields exactly one operation.
+	keys := make([]string, 0, len(s.dirty)+len(s.deleted))
+	for k := range s.dirty {
+		keys = append(keys, k)
 	}
 	for k := range s.deleted {
-		batch.Delete([]byte(k))
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	batch := s.db.NewBatch()
+	for _, k := range keys {
+		if v, ok := s.dirty[k]; ok {
+			batch.Set([]byte(k), v)
+		} else {
+			batch.Delete([]byte(k))
+		}
 	}
 	if err := batch.Write(); err != nil {
 		return err
@@ -349,3 +542,106 @@ func (s *StateDB) Commit() error {
 	s.snapshots = nil
 	return nil
 }
+
+// stateReader decodes state entries fetched through get.
+type stateReader struct {
+	get func(key string) ([]byte, error)
+}
+
+func (r stateReader) GetAccount(address string) (*core.Account, error) {
+	data, err := r.get(prefixAccount + address)
+	if errors.Is(err, core.ErrNotFound) {
+		return &core.Account{Address: address}, nil // zero-value account
+	}
+	if err != nil {
+		return nil, err
+	}
+	var acc core.Account
+	if err := json.Unmarshal(data, &acc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func (r stateReader) HasAccount(address string) (bool, error) {
+	_, err := r.get(prefixAccount + address)
+	if errors.Is(err, core.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r stateReader) GetAsset(id string) (*core.Asset, error) {
+	var asset core.Asset
+	if err := r.decode(prefixAsset+id, &asset); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r stateReader) GetTemplate(id string) (*core.AssetTemplate, error) {
+	var t core.AssetTemplate
+	if err := r.decode(prefixTemplate+id, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r stateReader) GetSession(id string) (*core.Session, error) {
+	var sess core.Session
+	if err := r.decode(prefixSession+id, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (r stateReader) GetListing(id string) (*core.MarketListing, error) {
+	var l core.MarketListing
+	if err := r.decode(prefixListing+id, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r stateReader) GetVesting(id string) (*core.Vesting, error) {
+	var v core.Vesting
+	if err := r.decode(prefixVesting+id, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r stateReader) GetCustomRecord(id string) (*core.CustomRecord, error) {
+	var c core.CustomRecord
+	if err := r.decode(prefixCustom+id, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r stateReader) GetValidatorBond(validator string) (*core.ValidatorBond, error) {
+	var b core.ValidatorBond
+	if err := r.decode(prefixBond+validator, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r stateReader) GetTotalSupply() (uint64, error) {
+	var supply uint64
+	if err := r.decode(keyTotalSupply, &supply); err != nil && !errors.Is(err, core.ErrNotFound) {
+		return 0, err
+	}
+	return supply, nil
+}
+
+func (r stateReader) decode(key string, v any) error {
+	data, err := r.get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tolelom/tolchain/internal/cli"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// TestCLISend verifies that the tol send command loads a keystore, signs a
+// transfer with the sender's nonce and submits it to a running node, and
+// that the balance command reads the result back.
+func TestCLISend(t *testing.T) {
+	sender, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	url, cleanup := startTestNode(t, sender)
+	defer cleanup()
+
+	keyPath := filepath.Join(t.TempDir(), "sender.key")
+	if err := wallet.SaveKey(keyPath, "pw", sender.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TOL_PASSWORD", "pw")
+
+	tol := func(args ...string) string {
+		var out bytes.Buffer
+		args = append([]string{"--rpc", url, "--chain-id", testChainID}, args...)
+		if err := cli.Run(context.Background(), args, &out); err != nil {
+			t.Fatalf("tol %s: %v", strings.Join(args[4:], " "), err)
+		}
+		return out.String()
+	}
+
+	var sent struct {
+		TxID string `json:"tx_id"`
+	}
+	if err := json.Unmarshal([]byte(tol("send", "--key", keyPath, "--to", recipient.PubKey(), "--amount", "500")), &sent); err != nil || sent.TxID == "" {
+		t.Fatalf("send output: %v %+v", err, sent)
+	}
+
+	var h int64
+	_ = json.Unmarshal([]byte(tol("height")), &h)
+	waitBlock(t, url, h+2)
+
+	var bal struct {
+		Balance uint64 `json:"balance"`
+	}
+	if err := json.Unmarshal([]byte(tol("balance", recipient.PubKey())), &bal); err != nil {
+		t.Fatal(err)
+	}
+	if bal.Balance != 500 {
+		t.Errorf("recipient balance: got %d want 500", bal.Balance)
+	}
+
+	if err := cli.Run(context.Background(), []string{"--rpc", url, "send", "--to", recipient.PubKey(), "--amount", "1"}, &bytes.Buffer{}); err == nil {
+		t.Error("send without --key should fail")
+	}
+}
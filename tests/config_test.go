@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// TestConfigEnvOverrides verifies that TOL_* environment variables take
+// precedence over the config file and that the result still validates.
+func TestConfigEnvOverrides(t *testing.T) {
+	fileValidator, _ := wallet.Generate()
+	envValidator, _ := wallet.Generate()
+	cfg := newTestConfig(fileValidator)
+	cfg.RPCPort, cfg.P2PPort = 8545, 30303
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := config.Save(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TOL_NODE_ID", "container-7")
+	t.Setenv("TOL_RPC_PORT", "9000")
+	t.Setenv("TOL_P2P_PORT", "9001")
+	t.Setenv("TOL_DATA_DIR", "/var/lib/tol")
+	t.Setenv("TOL_CHAIN_ID", "tolchain-staging")
+	t.Setenv("TOL_VALIDATORS", envValidator.PubKey()+":3")
+	t.Setenv("TOL_SEED_PEERS", "node1@10.0.0.1:30303")
+	loaded, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.NodeID != "container-7" || loaded.RPCPort != 9000 || loaded.P2PPort != 9001 ||
+		loaded.DataDir != "/var/lib/tol" || loaded.Genesis.ChainID != "tolchain-staging" {
+		t.Errorf("env overrides not applied: %+v", loaded)
+	}
+	if len(loaded.Validators) != 1 || loaded.Validators[0] != (config.Validator{PubKey: envValidator.PubKey(), Weight: 3}) {
+		t.Errorf("validators: got %+v", loaded.Validators)
+	}
+	if len(loaded.SeedPeers) != 1 || loaded.SeedPeers[0] != (config.SeedPeer{ID: "node1", Addr: "10.0.0.1:30303"}) {
+		t.Errorf("seed peers: got %+v", loaded.SeedPeers)
+	}
+	if loaded.MaxBlockTxs != cfg.MaxBlockTxs {
+		t.Errorf("file value lost: max_block_txs %d want %d", loaded.MaxBlockTxs, cfg.MaxBlockTxs)
+	}
+
+	t.Setenv("TOL_RPC_PORT", "eighty")
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "TOL_RPC_PORT") {
+		t.Errorf("unparsable port: got %v", err)
+	}
+	t.Setenv("TOL_RPC_PORT", "9001") // same as p2p port
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "validation") {
+		t.Errorf("invalid override: got %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/consensus"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// TestValidateBlockDuplicateTx verifies that a block carrying the same
+// transaction twice is rejected by validation.
+func TestValidateBlockDuplicateTx(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	block := core.NewBlock(testChainID, 1, genesis.Hash, validator.PubKey(), []*core.Transaction{tx, tx})
+	block.Header.Timestamp = time.Now().UnixNano()
+	block.Sign(validator.PrivKey())
+
+	err := chain.poa.ValidateBlock(block)
+	if err == nil || !strings.Contains(err.Error(), "duplicate transaction") {
+		t.Fatalf("expected duplicate transaction error, got %v", err)
+	}
+}
+
+// TestValidateBlockForeignChainID verifies that a block signed for another
+// network is rejected, and that rewriting its chain_id breaks the signature.
+func TestValidateBlockForeignChainID(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+
+	foreign := core.NewBlock("other-chain", 1, genesis.Hash, validator.PubKey(), nil)
+	foreign.Sign(validator.PrivKey())
+	err := chain.poa.ValidateBlock(foreign)
+	if err == nil || !strings.Contains(err.Error(), "chain ID mismatch") {
+		t.Fatalf("expected chain ID mismatch, got %v", err)
+	}
+
+	// Relabelling the block for this chain must invalidate the signature.
+	foreign.Header.ChainID = testChainID
+	err = chain.poa.ValidateBlock(foreign)
+	if err == nil || !strings.Contains(err.Error(), "signature invalid") {
+		t.Fatalf("expected signature error after chain_id rewrite, got %v", err)
+	}
+}
+
+// TestRandomProposerSelection verifies that under random proposer
+// selection a producer and a validator derive the same proposer from a
+// previous hash and height, that the pick follows SeededIndex, and that the
+// block the chosen proposer produces is accepted by the other validator.
+func TestRandomProposerSelection(t *testing.T) {
+	a, _ := wallet.Generate()
+	b, _ := wallet.Generate()
+	cfg := newTestConfig(a)
+	cfg.Validators = config.ValidatorsOf(a.PubKey(), b.PubKey())
+	cfg.ProposerSelection = config.ProposerRandom
+	chainA, genesis := newTestChain(t, cfg, a, nil)
+	chainB, _ := newTestChain(t, cfg, b, genesis)
+
+	seen := map[string]bool{}
+	for h := int64(1); h <= 32; h++ {
+		prev := crypto.Hash([]byte{byte(h)})
+		pa, pb := chainA.poa.ProposerFor(h, prev), chainB.poa.ProposerFor(h, prev)
+		if pa != pb {
+			t.Fatalf("height %d: producer and validator disagree: %s vs %s", h, pa, pb)
+		}
+		if want := cfg.Validators[consensus.SeededIndex(prev, h, 2)].PubKey; pa != want {
+			t.Fatalf("height %d: got %s want %s", h, pa, want)
+		}
+		seen[pa] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("32 seeds picked %d distinct proposers, want 2", len(seen))
+	}
+
+	producer, validator := chainA, chainB
+	if chainA.poa.ProposerFor(1, genesis.Hash) != a.PubKey() {
+		producer, validator = chainB, chainA
+	}
+	if !producer.poa.IsProposer() || validator.poa.IsProposer() {
+		t.Fatal("IsProposer does not follow ProposerFor")
+	}
+	block, err := producer.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validator.poa.ValidateBlock(block); err != nil {
+		t.Errorf("validator rejected the seeded proposer's block: %v", err)
+	}
+}
+
+// TestWeightedProposerSchedule verifies that two independently constructed
+// engines agree on the weighted proposer for every height, that each
+// validator's share of turns matches its weight, and that a block from a
+// validator out of turn is rejected.
+func TestWeightedProposerSchedule(t *testing.T) {
+	a, _ := wallet.Generate()
+	b, _ := wallet.Generate()
+	c, _ := wallet.Generate()
+	// Mixed plain-string and weighted entries, as read from a config file.
+	raw := `[{"pubkey":"` + a.PubKey() + `","weight":3},"` + b.PubKey() + `",{"pubkey":"` + c.PubKey() + `","weight":2}]`
+	newEngine := func(w *wallet.Wallet) *testChain {
+		cfg := newTestConfig(w)
+		if err := json.Unmarshal([]byte(raw), &cfg.Validators); err != nil {
+			t.Fatal(err)
+		}
+		chain, _ := newTestChain(t, cfg, w, nil)
+		return chain
+	}
+	one, two := newEngine(a), newEngine(c)
+
+	counts := map[string]int{}
+	for h := int64(0); h < 60; h++ {
+		p1, p2 := one.poa.ProposerFor(h, ""), two.poa.ProposerFor(h, "")
+		if p1 != p2 {
+			t.Fatalf("height %d: engines disagree: %s vs %s", h, p1, p2)
+		}
+		counts[p1]++
+	}
+	if counts[a.PubKey()] != 30 || counts[b.PubKey()] != 10 || counts[c.PubKey()] != 20 {
+		t.Errorf("turns per validator: a=%d b=%d c=%d want 30/10/20", counts[a.PubKey()], counts[b.PubKey()], counts[c.PubKey()])
+	}
+
+	// Unweighted validators keep the plain round-robin order.
+	plain := consensus.ProposerSchedule(config.ValidatorsOf(a.PubKey(), b.PubKey(), c.PubKey()))
+	if strings.Join(plain, ",") != strings.Join([]string{a.PubKey(), b.PubKey(), c.PubKey()}, ",") {
+		t.Errorf("unweighted schedule is not round-robin: %v", plain)
+	}
+
+	var outOfTurn *wallet.Wallet
+	for _, w := range []*wallet.Wallet{a, b, c} {
+		if w.PubKey() != one.poa.ProposerFor(1, one.bc.Tip().Hash) {
+			outOfTurn = w
+			break
+		}
+	}
+	tip := one.bc.Tip()
+	block := core.NewBlock(testChainID, 1, tip.Hash, outOfTurn.PubKey(), nil)
+	block.Sign(outOfTurn.PrivKey())
+	if err := one.poa.ValidateBlock(block); err == nil || !strings.Contains(err.Error(), "wrong proposer") {
+		t.Fatalf("expected wrong proposer error, got %v", err)
+	}
+}
+
+// TestProduceBlockEvictsFailingTx verifies that a transaction failing
+// execution is evicted from the mempool and reported, that the block is
+// produced with the remaining transactions, and that their events are
+// published once even though the block was executed twice.
+func TestProduceBlockEvictsFailingTx(t *testing.T) {
+	validator, _ := wallet.Generate()
+	broke, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, _ := newTestChain(t, cfg, validator, nil)
+
+	var rejected []events.Event
+	chain.emitter.Subscribe(events.EventTxRejected, func(ev events.Event) { rejected = append(rejected, ev) })
+	published := make(map[events.EventType]int)
+	chain.emitter.SubscribeAll(func(ev events.Event) { published[ev.Type]++ })
+
+	good0, _ := validator.Transfer(testChainID, recipient.PubKey(), 10, 0, 0)
+	bad, _ := broke.Transfer(testChainID, recipient.PubKey(), 10, 0, 0) // no balance
+	good1, _ := validator.Transfer(testChainID, recipient.PubKey(), 20, 1, 0)
+	for _, tx := range []*core.Transaction{good0, bad, good1} {
+		if err := chain.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	block, err := chain.poa.ProduceBlock()
+	if err != nil {
+		t.Fatalf("ProduceBlock: %v", err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[0].ID != good0.ID || block.Transactions[1].ID != good1.ID {
+		t.Errorf("block transactions: got %d, want the two good transfers", len(block.Transactions))
+	}
+	if chain.mempool.Size() != 0 {
+		t.Errorf("mempool size: got %d want 0", chain.mempool.Size())
+	}
+	if len(rejected) != 1 || rejected[0].TxID != bad.ID || rejected[0].Data["reason"] == "" {
+		t.Errorf("tx_rejected events: %+v", rejected)
+	}
+	if published[events.EventTxExecuted] != 2 || published[events.EventTokenTransfer] != 2 || published[events.EventBlockCommit] != 1 {
+		t.Errorf("published events: %v, want 2 tx_executed, 2 token_transfer and 1 block_commit", published)
+	}
+	if acc, _ := chain.state.GetAccount(recipient.PubKey()); acc.Balance != 30 {
+		t.Errorf("recipient balance: got %d want 30", acc.Balance)
+	}
+}
+
+// TestValidateBlockTxOrder verifies that a block holding one sender's
+// transactions in descending nonce order is rejected, and that the proposer
+// puts transactions that reached its mempool out of order into nonce order.
+func TestValidateBlockTxOrder(t *testing.T) {
+	validator, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+
+	tx0, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	tx1, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 1, 0)
+	foreign, _ := other.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	descending := core.NewBlock(testChainID, 1, genesis.Hash, validator.PubKey(), []*core.Transaction{tx1, foreign, tx0})
+	descending.Header.Timestamp = time.Now().UnixNano()
+	descending.Sign(validator.PrivKey())
+	if err := chain.poa.ValidateBlock(descending); !errors.Is(err, core.ErrTxOrder) {
+		t.Fatalf("descending nonces: got %v want %v", err, core.ErrTxOrder)
+	}
+
+	for _, tx := range []*core.Transaction{tx1, tx0} {
+		if err := chain.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	block, err := chain.poa.ProduceBlock()
+	if err != nil {
+		t.Fatalf("ProduceBlock: %v", err)
+	}
+	if len(block.Transactions) != 2 || block.Transactions[0].ID != tx0.ID || block.Transactions[1].ID != tx1.ID {
+		t.Errorf("produced block: got %d transactions, want nonce 0 then nonce 1", len(block.Transactions))
+	}
+}
+
+// TestValidateBlockLegacySignatures verifies that a block carrying a
+// transaction signed over the bare hash or cosigned without naming its
+// cosigners, or itself signed over the bare hash, is rejected unless it
+// lies below the legacy_signatures_until height.
+func TestValidateBlockLegacySignatures(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+
+	legacy, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	legacy.Version = 0
+	legacy.Sign(validator.PrivKey())
+	withLegacyTx := core.NewBlock(testChainID, 1, genesis.Hash, validator.PubKey(), []*core.Transaction{legacy})
+	withLegacyTx.Sign(validator.PrivKey())
+	legacyBlock := core.NewBlock(testChainID, 1, genesis.Hash, validator.PubKey(), nil)
+	legacyBlock.Header.Version = 0
+	legacyBlock.Sign(validator.PrivKey())
+	unnamed, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	recipient.Countersign(unnamed)
+	withUnnamed := core.NewBlock(testChainID, 1, genesis.Hash, validator.PubKey(), []*core.Transaction{unnamed})
+	withUnnamed.Sign(validator.PrivKey())
+
+	for name, b := range map[string]*core.Block{"legacy tx": withLegacyTx, "legacy block": legacyBlock} {
+		if err := chain.poa.ValidateBlock(b); !errors.Is(err, core.ErrLegacySignature) {
+			t.Errorf("%s: got %v want ErrLegacySignature", name, err)
+		}
+	}
+	if err := chain.poa.ValidateBlock(withUnnamed); !errors.Is(err, core.ErrUnnamedCosigners) {
+		t.Errorf("unnamed cosigners: got %v want ErrUnnamedCosigners", err)
+	}
+	chain.poa.SetLegacySignaturesUntil(2)
+	for name, b := range map[string]*core.Block{"legacy tx": withLegacyTx, "legacy block": legacyBlock, "unnamed cosigners": withUnnamed} {
+		if err := chain.poa.ValidateBlock(b); err != nil {
+			t.Errorf("%s below the legacy height: %v", name, err)
+		}
+	}
+}
+
+// TestBlockSpacingResumesAfterGap verifies that a proposer halted for longer
+// than the maximum spacing stamps its next block within that bound, so both
+// it and its peers accept the block and production resumes.
+func TestBlockSpacingResumesAfterGap(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	producer, genesis := newTestChain(t, cfg, validator, nil)
+	follower, _ := newTestChain(t, cfg, validator, genesis)
+	const maxGap = 200 * time.Millisecond
+	producer.poa.SetBlockSpacing(0, maxGap)
+	follower.poa.SetBlockSpacing(0, maxGap)
+
+	first, err := producer.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * maxGap)
+	var blocks []*core.Block
+	parent := first
+	for i := 0; i < 2; i++ {
+		block, err := producer.poa.ProduceBlock()
+		if err != nil {
+			t.Fatalf("block %d after a %s halt: %v", i+2, 3*maxGap, err)
+		}
+		if gap := time.Duration(block.Header.Timestamp - parent.Header.Timestamp); gap != maxGap {
+			t.Errorf("block %d: %s after its parent, want %s", i+2, gap, maxGap)
+		}
+		blocks, parent = append(blocks, block), block
+	}
+
+	sendBlocks(t, follower, append([]*core.Block{first}, blocks...)...)
+	if !waitHeight(t, follower, 3, 2*time.Second) {
+		t.Fatalf("follower at height %d, want 3", follower.bc.Height())
+	}
+}
+
+// TestBlockSpacing verifies that a block too soon after its parent or too
+// long after it is rejected, that one at a normal cadence is accepted, and
+// that the proposer waits out the minimum spacing.
+func TestBlockSpacing(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, _ := newTestChain(t, cfg, validator, nil)
+	chain.poa.SetBlockSpacing(time.Second, 5*time.Second)
+
+	parent, err := chain.poa.ProduceBlock()
+	if err != nil {
+		t.Fatalf("first block after genesis: %v", err)
+	}
+	if _, err := chain.poa.ProduceBlock(); !errors.Is(err, consensus.ErrTooSoon) {
+		t.Fatalf("ProduceBlock right after the tip: got %v want ErrTooSoon", err)
+	}
+
+	next := func(gap time.Duration) *core.Block {
+		block := core.NewBlock(testChainID, 2, parent.Hash, validator.PubKey(), nil)
+		block.Header.Timestamp = parent.Header.Timestamp + int64(gap)
+		block.Sign(validator.PrivKey())
+		return block
+	}
+	if err := chain.poa.ValidateBlock(next(100 * time.Millisecond)); !errors.Is(err, consensus.ErrTooSoon) {
+		t.Errorf("block 100ms after its parent: got %v want ErrTooSoon", err)
+	}
+	if err := chain.poa.ValidateBlock(next(10 * time.Second)); err == nil || !strings.Contains(err.Error(), "maximum") {
+		t.Errorf("block 10s after its parent: got %v want a maximum spacing error", err)
+	}
+	if err := chain.poa.ValidateBlock(next(2 * time.Second)); err != nil {
+		t.Errorf("block 2s after its parent: %v", err)
+	}
+}
@@ -1,10 +1,19 @@
 package tests
 
 import (
+	"errors"
+	"reflect"
+	"runtime"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/indexer"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/rpc"
 	"github.com/tolelom/tolchain/wallet"
 )
 
@@ -72,6 +81,132 @@ func TestTransactionSignVerify(t *testing.T) {
 	}
 }
 
+// TestTransactionVerifyErrors checks that each verification failure mode is
+// reported as its own sentinel error.
+func TestTransactionVerifyErrors(t *testing.T) {
+	w, _ := wallet.Generate()
+	signed := func() *core.Transaction {
+		tx, _ := w.Transfer("test-chain", w.PubKey(), 1, 0, 0)
+		return tx
+	}
+	cases := []struct {
+		name   string
+		mutate func(tx *core.Transaction)
+		want   error
+	}{
+		{"missing from", func(tx *core.Transaction) { tx.From = "" }, core.ErrMissingFrom},
+		{"bad pubkey hex", func(tx *core.Transaction) { tx.From = "zz" }, core.ErrBadPubkey},
+		{"wrong pubkey length", func(tx *core.Transaction) { tx.From = "abcd" }, core.ErrBadPubkey},
+		{"id mismatch", func(tx *core.Transaction) { tx.Fee = 7 }, core.ErrTxIDMismatch},
+		{"bad signature", func(tx *core.Transaction) { tx.Fee = 7; tx.ID = tx.Hash() }, core.ErrBadSignature},
+		{"malformed signature", func(tx *core.Transaction) { tx.Signature = "xyz" }, core.ErrBadSignature},
+		{"stray fee payer signature", func(tx *core.Transaction) { tx.FeePayerSignature = "ab" }, core.ErrBadFeePayer},
+	}
+	for _, c := range cases {
+		tx := signed()
+		c.mutate(tx)
+		if err := tx.Verify(); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v want %v", c.name, err, c.want)
+		}
+	}
+}
+
+// TestSigningDomain verifies that signatures are bound to their chain: a
+// transaction or block signed on chain A fails verification for chain B,
+// while an unversioned transaction still signs the bare hash.
+func TestSigningDomain(t *testing.T) {
+	w, _ := wallet.Generate()
+	sponsor, _ := wallet.Generate()
+	tx, _ := w.NewSponsoredTx("chain-a", core.TxTransfer, sponsor.PubKey(), 0, 1, core.TransferPayload{To: w.PubKey(), Amount: 1})
+	if err := sponsor.CoSign(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.VerifyChain("chain-a"); err != nil {
+		t.Fatalf("chain A: %v", err)
+	}
+	if err := tx.VerifyChain("chain-b"); !errors.Is(err, core.ErrBadSignature) {
+		t.Errorf("chain B: got %v want ErrBadSignature", err)
+	}
+	if got, want := string(tx.SigningHash()), "chain-a:"+tx.ID; got != want {
+		t.Errorf("signing hash: got %q want %q", got, want)
+	}
+
+	// Relabelling the transaction for chain B changes its hash and
+	// invalidates the signature made for chain A.
+	forged := *tx
+	forged.ChainID = "chain-b"
+	forged.ID = forged.Hash()
+	if err := forged.Verify(); !errors.Is(err, core.ErrBadSignature) {
+		t.Errorf("relabelled tx: got %v want ErrBadSignature", err)
+	}
+
+	legacy, _ := core.NewTransaction("chain-a", core.TxTransfer, w.PubKey(), 0, 0, core.TransferPayload{To: w.PubKey(), Amount: 1})
+	legacy.Version = 0
+	legacy.Sign(w.PrivKey())
+	if string(legacy.SigningHash()) != legacy.ID {
+		t.Errorf("unversioned signing hash: got %q want the bare hash", legacy.SigningHash())
+	}
+	if err := legacy.Verify(); err != nil {
+		t.Errorf("unversioned tx: %v", err)
+	}
+
+	priv, pub, _ := crypto.GenerateKeyPair()
+	block := core.NewBlock("chain-a", 1, "0000", pub.Hex(), nil)
+	block.Sign(priv)
+	if err := block.Verify(pub); err != nil {
+		t.Fatalf("block on chain A: %v", err)
+	}
+	if err := crypto.Verify(pub, core.SigningMessage(block.Header.Version, "chain-b", block.Hash), block.Signature); err == nil {
+		t.Error("block signature verified for chain B")
+	}
+}
+
+// TestCosignersBoundToID verifies that the cosignatures of a transaction
+// naming its cosigners cannot be stripped or added without it failing
+// Verify, so a stripped copy cannot take its ID in the mempool, and that
+// the mempool refuses cosignatures whose signers are not named.
+func TestCosignersBoundToID(t *testing.T) {
+	buyer, _ := wallet.Generate()
+	seller, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	payload := core.DirectPurchasePayload{AssetID: "sword-1", Seller: seller.PubKey(), Price: 300}
+
+	tx, _ := buyer.NewCosignedTx(testChainID, core.TxDirectPurchase, []string{seller.PubKey()}, 0, 0, payload)
+	seller.Countersign(tx)
+	if err := tx.Verify(); err != nil {
+		t.Fatalf("cosigned tx: %v", err)
+	}
+
+	stripped := *tx
+	stripped.Cosignatures = nil
+	if err := stripped.Verify(); !errors.Is(err, core.ErrBadCosignature) {
+		t.Errorf("stripped cosignature: got %v want ErrBadCosignature", err)
+	}
+	mp := core.NewMempool()
+	if err := mp.Add(&stripped); err == nil {
+		t.Error("mempool accepted the stripped copy")
+	}
+	if err := mp.Add(tx); err != nil {
+		t.Errorf("mempool after the stripped copy: %v", err)
+	}
+
+	extra := *tx
+	extra.Cosignatures = map[string]string{seller.PubKey(): tx.Cosignatures[seller.PubKey()]}
+	other.Countersign(&extra)
+	if err := extra.Verify(); !errors.Is(err, core.ErrBadCosignature) {
+		t.Errorf("unnamed extra cosignature: got %v want ErrBadCosignature", err)
+	}
+
+	unnamed, _ := buyer.NewTx(testChainID, core.TxDirectPurchase, 1, 0, payload)
+	seller.Countersign(unnamed)
+	if err := unnamed.Verify(); err != nil {
+		t.Fatalf("cosignatures without cosigners must still verify for old blocks: %v", err)
+	}
+	if err := mp.Add(unnamed); !errors.Is(err, core.ErrUnnamedCosigners) {
+		t.Errorf("mempool: got %v want ErrUnnamedCosigners", err)
+	}
+}
+
 // TestBlockHash ensures that hashing a block is deterministic.
 func TestBlockHash(t *testing.T) {
 	priv, pub, err := crypto.GenerateKeyPair()
@@ -90,6 +225,58 @@ func TestBlockHash(t *testing.T) {
 	}
 }
 
+// TestIterateBlocks verifies that IterateBlocks visits every block of a
+// range in order, caps the range at the tip, and stops on a callback error.
+func TestIterateBlocks(t *testing.T) {
+	priv, pub, _ := crypto.GenerateKeyPair()
+	bc := core.NewBlockchain(testutil.NewMemBlockStore())
+	if err := bc.IterateBlocks(0, -1, func(*core.Block) error { t.Error("callback on empty chain"); return nil }); err != nil {
+		t.Errorf("empty chain: %v", err)
+	}
+	prev := "0000"
+	for h := int64(0); h <= 5; h++ {
+		b := core.NewBlock(testChainID, h, prev, pub.Hex(), nil)
+		b.Sign(priv)
+		if err := bc.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		prev = b.Hash
+	}
+
+	collect := func(from, to int64, stopAt int64) ([]int64, error) {
+		var seen []int64
+		err := bc.IterateBlocks(from, to, func(b *core.Block) error {
+			seen = append(seen, b.Header.Height)
+			if b.Header.Height == stopAt {
+				return errors.New("stop here")
+			}
+			return nil
+		})
+		return seen, err
+	}
+	if seen, err := collect(0, -1, -1); err != nil || !reflect.DeepEqual(seen, []int64{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("whole chain: got %v, %v", seen, err)
+	}
+	if seen, err := collect(2, 100, -1); err != nil || !reflect.DeepEqual(seen, []int64{2, 3, 4, 5}) {
+		t.Errorf("range past tip: got %v, %v", seen, err)
+	}
+	if seen, err := collect(1, -1, 3); err == nil || err.Error() != "stop here" || !reflect.DeepEqual(seen, []int64{1, 2, 3}) {
+		t.Errorf("callback error: got %v, %v", seen, err)
+	}
+
+	var seen []int64
+	err := bc.IterateBlocks(0, -1, func(b *core.Block) error {
+		seen = append(seen, b.Header.Height)
+		if b.Header.Height == 1 {
+			return core.ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(seen, []int64{0, 1}) {
+		t.Errorf("ErrStopIteration: got %v, %v", seen, err)
+	}
+}
+
 // TestMempool verifies add/remove/pending operations.
 func TestMempool(t *testing.T) {
 	mp := core.NewMempool()
@@ -117,3 +304,283 @@ func TestMempool(t *testing.T) {
 		t.Error("pool should be empty after remove")
 	}
 }
+
+// signedTransfers returns n transfers from one sender with nonces 0..n-1.
+func signedTransfers(tb testing.TB, n int) []*core.Transaction {
+	tb.Helper()
+	sender, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	txs := make([]*core.Transaction, n)
+	for i := range txs {
+		tx, err := sender.Transfer("test-chain", recipient.PubKey(), 1, uint64(i), 0)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
+
+// TestMempoolIntake verifies that every transaction the intake queue
+// accepts reaches the mempool, that a full queue is reported rather than
+// dropped silently, and that Submit fails after Close.
+func TestMempoolIntake(t *testing.T) {
+	const n = 300
+	mp := core.NewMempool()
+	mp.SetMaxPerAccount(n)
+	in := core.NewIntake(mp, n, 4)
+	var added, failed atomic.Int64
+	for _, tx := range signedTransfers(t, n) {
+		err := in.Submit(tx, func(err error) {
+			if err != nil {
+				failed.Add(1)
+				return
+			}
+			added.Add(1)
+		})
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	in.Close()
+	if added.Load() != n || failed.Load() != 0 || mp.Size() != n {
+		t.Errorf("added %d, failed %d, pool size %d; want %d, 0, %d", added.Load(), failed.Load(), mp.Size(), n, n)
+	}
+	if err := in.Submit(signedTransfers(t, 1)[0], nil); !errors.Is(err, core.ErrIntakeClosed) {
+		t.Errorf("submit after close: got %v want ErrIntakeClosed", err)
+	}
+
+	// One worker blocked in its callback and a queue of two: the fourth
+	// submission does not fit.
+	in = core.NewIntake(core.NewMempool(), 2, 1)
+	busy, release := make(chan struct{}), make(chan struct{})
+	txs := signedTransfers(t, 4)
+	in.Submit(txs[0], func(error) {
+		close(busy)
+		<-release
+	})
+	<-busy
+	for _, tx := range txs[1:3] {
+		if err := in.Submit(tx, nil); err != nil {
+			t.Fatalf("submit within capacity: %v", err)
+		}
+	}
+	if err := in.Submit(txs[3], nil); !errors.Is(err, core.ErrIntakeFull) {
+		t.Errorf("submit over capacity: got %v want ErrIntakeFull", err)
+	}
+	close(release)
+	in.Close()
+}
+
+// BenchmarkMempoolAdmission compares admitting a burst of 1000 signed
+// transactions with sequential Mempool.Add calls and through an intake
+// queue with one worker per CPU.
+func BenchmarkMempoolAdmission(b *testing.B) {
+	const burst = 1000
+	txs := signedTransfers(b, burst)
+	newPool := func() *core.Mempool {
+		mp := core.NewMempool()
+		mp.SetMaxPerAccount(burst)
+		return mp
+	}
+	b.Run("direct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			mp := newPool()
+			for _, tx := range txs {
+				if err := mp.Add(tx); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("intake", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			in := core.NewIntake(newPool(), burst, runtime.NumCPU())
+			for _, tx := range txs {
+				if err := in.Submit(tx, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			in.Close()
+		}
+	})
+}
+
+// TestMempoolPerAccountLimit verifies that one sender cannot exceed its
+// pending-transaction cap, that other senders are unaffected, and that
+// removing a transaction frees a slot.
+func TestMempoolPerAccountLimit(t *testing.T) {
+	mp := core.NewMempool()
+	mp.SetMaxPerAccount(3)
+	spammer, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+
+	var first *core.Transaction
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx, _ := spammer.Transfer("test-chain", other.PubKey(), 1, nonce, 0)
+		if err := mp.Add(tx); err != nil {
+			t.Fatalf("add %d: %v", nonce, err)
+		}
+		if first == nil {
+			first = tx
+		}
+	}
+	over, _ := spammer.Transfer("test-chain", other.PubKey(), 1, 3, 0)
+	if err := mp.Add(over); !errors.Is(err, core.ErrAccountTxLimit) {
+		t.Fatalf("4th tx: got %v want ErrAccountTxLimit", err)
+	}
+	tx, _ := other.Transfer("test-chain", spammer.PubKey(), 1, 0, 0)
+	if err := mp.Add(tx); err != nil {
+		t.Fatalf("other account: %v", err)
+	}
+
+	mp.Remove([]string{first.ID})
+	if err := mp.Add(over); err != nil {
+		t.Fatalf("after remove: %v", err)
+	}
+}
+
+// TestMempoolStuckTxs verifies that a pending transaction's admission time
+// is reported, including over getTxStatus and getMempoolTxs, and that it is
+// flagged as stuck only once it has waited past the threshold.
+func TestMempoolStuckTxs(t *testing.T) {
+	mp := core.NewMempool()
+	w, _ := wallet.Generate()
+	tx, _ := w.Transfer("test-chain", "aa", 1, 5, 0) // nonce gap: never includable
+
+	before := time.Now()
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	since, ok := mp.PendingSince(tx.ID)
+	if !ok || since.Before(before) || since.After(time.Now()) {
+		t.Fatalf("pending since: got %v, %v", since, ok)
+	}
+
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, testutil.NewStateDB(),
+		indexer.New(testutil.NewMemDB(), events.NewEmitter()), "test-chain")
+	resp := dispatch(handler, "getTxStatus", map[string]any{"id": tx.ID})
+	status, _ := resp.Result.(map[string]any)
+	if status["status"] != "pending" || status["pending_since"] != since.UnixNano() {
+		t.Errorf("getTxStatus: got %+v", resp.Result)
+	}
+	resp = dispatch(handler, "getMempoolTxs", nil)
+	if txs, _ := resp.Result.([]rpc.MempoolTx); len(txs) != 1 || txs[0].Tx.ID != tx.ID || txs[0].PendingSince != since.UnixNano() {
+		t.Errorf("getMempoolTxs: got %+v", resp.Result)
+	}
+
+	if stuck := mp.Stuck(time.Hour); len(stuck) != 0 {
+		t.Errorf("stuck under threshold: got %d", len(stuck))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stuck := mp.Stuck(10 * time.Millisecond); len(stuck) != 1 || stuck[0].Tx.ID != tx.ID {
+		t.Errorf("stuck past threshold: got %+v", stuck)
+	}
+
+	mp.Remove([]string{tx.ID})
+	resp = dispatch(handler, "getTxStatus", map[string]any{"id": tx.ID})
+	if status, _ := resp.Result.(map[string]any); status["status"] != "unknown" {
+		t.Errorf("getTxStatus after remove: got %+v", resp.Result)
+	}
+}
+
+// TestMempoolHeldTxs verifies that a time-locked transaction, and its
+// sender's later nonces, stay out of Pending until the next block reaches
+// its ValidFrom height, and are reported as held meanwhile.
+func TestMempoolHeldTxs(t *testing.T) {
+	mp := core.NewMempool()
+	var height atomic.Int64
+	height.Store(2)
+	mp.SetChainHeight(height.Load)
+	w, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+
+	locked, _ := w.Transfer("test-chain", other.PubKey(), 1, 0, 0)
+	locked.ValidFrom = 5
+	locked.Sign(w.PrivKey())
+	after, _ := w.Transfer("test-chain", other.PubKey(), 1, 1, 0)
+	free, _ := other.Transfer("test-chain", w.PubKey(), 1, 0, 0)
+	for _, tx := range []*core.Transaction{locked, after, free} {
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := mp.Pending(10); len(got) != 1 || got[0].ID != free.ID {
+		t.Errorf("pending before valid_from: got %d txs", len(got))
+	}
+	if held := mp.Held(); len(held) != 1 || held[0].Tx.ID != locked.ID {
+		t.Errorf("held before valid_from: got %+v", held)
+	}
+	if mp.Size() != 3 {
+		t.Errorf("size: got %d want 3", mp.Size())
+	}
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, testutil.NewStateDB(),
+		indexer.New(testutil.NewMemDB(), events.NewEmitter()), "test-chain")
+	resp := dispatch(handler, "getTxStatus", map[string]any{"id": locked.ID})
+	if status, _ := resp.Result.(map[string]any); status["status"] != "held" || status["valid_from"] != int64(5) {
+		t.Errorf("getTxStatus: got %+v", resp.Result)
+	}
+	resp = dispatch(handler, "getHeldTxs", nil)
+	if txs, _ := resp.Result.([]rpc.MempoolTx); len(txs) != 1 || txs[0].Tx.ID != locked.ID {
+		t.Errorf("getHeldTxs: got %+v", resp.Result)
+	}
+
+	height.Store(4) // the next block is at valid_from
+	if got := mp.Pending(10); len(got) != 3 {
+		t.Errorf("pending at valid_from: got %d txs want 3", len(got))
+	}
+	if held := mp.Held(); len(held) != 0 {
+		t.Errorf("held at valid_from: got %d", len(held))
+	}
+
+	tampered := *locked
+	tampered.ValidFrom = 0
+	if err := tampered.Verify(); err == nil {
+		t.Error("valid_from should be covered by the signature")
+	}
+}
+
+// TestMempoolHeldTxBounds verifies that a valid_from too far past the next
+// block is refused, and that a held transaction whose timestamp has aged
+// out is evicted to make room for its sender's new transactions.
+func TestMempoolHeldTxBounds(t *testing.T) {
+	mp := core.NewMempool()
+	mp.SetChainHeight(func() int64 { return 10 })
+	mp.SetMaxValidFromAhead(5)
+	mp.SetMaxPerAccount(2)
+	w, _ := wallet.Generate()
+	lockedTx := func(nonce uint64, validFrom int64, ts time.Time) *core.Transaction {
+		tx, _ := w.Transfer("test-chain", "aa", 1, nonce, 0)
+		tx.ValidFrom = validFrom
+		tx.Timestamp = ts.UnixNano()
+		tx.Sign(w.PrivKey())
+		return tx
+	}
+
+	if err := mp.Add(lockedTx(0, 17, time.Now())); !errors.Is(err, core.ErrTxTooEarly) {
+		t.Fatalf("valid_from 17 with next block 11 and limit 5: got %v want ErrTxTooEarly", err)
+	}
+	if err := mp.Add(lockedTx(0, 16, time.Now())); err != nil {
+		t.Fatalf("valid_from at the limit: %v", err)
+	}
+
+	// Admitted just inside the age window, then aged out while held.
+	aging := lockedTx(1, 16, time.Now().Add(-time.Hour+50*time.Millisecond))
+	if err := mp.Add(aging); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(lockedTx(2, 0, time.Now())); !errors.Is(err, core.ErrAccountTxLimit) {
+		t.Fatalf("sender at its limit: got %v want ErrAccountTxLimit", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := mp.Add(lockedTx(2, 0, time.Now())); err != nil {
+		t.Fatalf("after the held tx aged out: %v", err)
+	}
+	if _, ok := mp.Get(aging.ID); ok {
+		t.Error("aged-out held tx still in the pool")
+	}
+	if mp.Size() != 2 {
+		t.Errorf("size: got %d want 2", mp.Size())
+	}
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/rpc"
+	"golang.org/x/net/websocket"
+)
+
+// TestFeedAddressFilter verifies that a subscriber filtering on one address
+// receives events involving it and nothing else.
+func TestFeedAddressFilter(t *testing.T) {
+	emitter := events.NewEmitter()
+	server := rpc.NewServer(":0", newTestRPCHandler(t), "")
+	server.EnableFeed(rpc.NewFeed(emitter))
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	url := fmt.Sprintf("ws://%s/ws", server.Addr().String())
+	ws, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := websocket.JSON.Send(ws, rpc.SubscribeRequest{Addresses: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	var ack rpc.FeedFrame
+	if err := websocket.JSON.Receive(ws, &ack); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if len(ack.Subscribed) != 1 || ack.Subscribed[0] != "alice" {
+		t.Fatalf("ack: got %v want [alice]", ack.Subscribed)
+	}
+
+	// Unrelated events must be filtered out server-side.
+	emitter.Emit(events.Event{Type: events.EventTokenTransfer, TxID: "tx1",
+		Data: map[string]any{"from": "bob", "to": "carol", "amount": 1}})
+	emitter.Emit(events.Event{Type: events.EventBlockCommit, BlockHeight: 7,
+		Data: map[string]any{"hash": "abc"}})
+	emitter.Emit(events.Event{Type: events.EventSessionOpen, TxID: "tx2",
+		Data: map[string]any{"session_id": "s1", "players": []string{"bob", "alice"}}})
+
+	var frame rpc.FeedFrame
+	if err := websocket.JSON.Receive(ws, &frame); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if frame.Event == nil || frame.Event.TxID != "tx2" {
+		t.Fatalf("first delivered event: got %+v want tx2", frame.Event)
+	}
+}
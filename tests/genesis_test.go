@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/indexer"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/node"
+	"github.com/tolelom/tolchain/rpc"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// TestGenesisTemplatesAndAssets verifies that genesis templates and assets
+// are present at height 0, and that the genesis state root does not depend
+// on which validator created the block.
+func TestGenesisTemplatesAndAssets(t *testing.T) {
+	a, _ := wallet.Generate()
+	b, _ := wallet.Generate()
+	player, _ := wallet.Generate()
+	cfg := newTestConfig(a)
+	cfg.Genesis.Templates = []core.RegisterTemplatePayload{
+		{ID: "sword", Name: "Sword", Tradeable: true},
+		{ID: "badge", Name: "Founder badge"},
+	}
+	cfg.Genesis.Assets = []core.MintAssetPayload{
+		{TemplateID: "badge", Owner: player.PubKey(), Properties: map[string]any{"tier": "gold"}},
+	}
+
+	stateA := testutil.NewStateDB()
+	genesisA, err := config.CreateGenesisBlock(cfg, stateA, a.PrivKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisB, err := config.CreateGenesisBlock(cfg, testutil.NewStateDB(), b.PrivKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesisA.Header.Height != 0 || genesisA.Header.StateRoot != genesisB.Header.StateRoot {
+		t.Errorf("genesis state roots differ: %s vs %s", genesisA.Header.StateRoot, genesisB.Header.StateRoot)
+	}
+
+	tmpl, err := stateA.Committed().GetTemplate("sword")
+	if err != nil || tmpl.Name != "Sword" || !tmpl.Tradeable {
+		t.Fatalf("genesis template: %+v, %v", tmpl, err)
+	}
+	asset, err := stateA.Committed().GetAsset(config.GenesisAssetID(0, "badge"))
+	if err != nil || asset.Owner != player.PubKey() || asset.Tradeable || asset.Properties["tier"] != "gold" {
+		t.Fatalf("genesis asset: %+v, %v", asset, err)
+	}
+
+	cfg.Genesis.Assets = []core.MintAssetPayload{{TemplateID: "shield", Owner: player.PubKey()}}
+	if _, err := config.CreateGenesisBlock(cfg, testutil.NewStateDB(), a.PrivKey()); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("asset of unknown template: got %v", err)
+	}
+
+	cfg.Genesis.Assets = []core.MintAssetPayload{
+		{TemplateID: "badge", Owner: player.PubKey(), Properties: map[string]any{"tier": "gold", "season": 1}},
+	}
+	cfg.MaxAssetPropertyKeys = 1
+	if _, err := config.CreateGenesisBlock(cfg, testutil.NewStateDB(), a.PrivKey()); err == nil || !strings.Contains(err.Error(), "too many properties") {
+		t.Errorf("asset over the property key limit: got %v", err)
+	}
+	cfg.RPCPort, cfg.P2PPort = 8545, 30303
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "genesis.assets[0]: too many properties") {
+		t.Errorf("validate asset over the property key limit: got %v", err)
+	}
+}
+
+// TestGenesisAssetsIndexed verifies that a node indexes the genesis assets
+// by owner and template at startup, though their minting emits no events.
+func TestGenesisAssetsIndexed(t *testing.T) {
+	v, _ := wallet.Generate()
+	player, _ := wallet.Generate()
+	cfg := newTestConfig(v)
+	cfg.BlockIntervalMs = 50
+	cfg.Genesis.Templates = []core.RegisterTemplatePayload{{ID: "badge", Name: "Founder badge"}}
+	cfg.Genesis.Assets = []core.MintAssetPayload{{TemplateID: "badge", Owner: player.PubKey()}}
+
+	rt := node.New(cfg, v.PrivKey(), testutil.NewMemDB(), testutil.NewMemBlockStore())
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Stop(context.Background())
+	url := fmt.Sprintf("http://%s", rt.RPCAddr())
+	want := config.GenesisAssetID(0, "badge")
+
+	var ids []string
+	json.Unmarshal(rpcCall(t, url, "getAssetsByOwner", map[string]string{"owner": player.PubKey()}), &ids)
+	if len(ids) != 1 || ids[0] != want {
+		t.Errorf("getAssetsByOwner: got %v want [%s]", ids, want)
+	}
+	ids = nil
+	json.Unmarshal(rpcCall(t, url, "getAssetsByTemplate", map[string]string{"template_id": "badge"}), &ids)
+	if len(ids) != 1 || ids[0] != want {
+		t.Errorf("getAssetsByTemplate: got %v want [%s]", ids, want)
+	}
+}
+
+// TestGenesisValidatorBond verifies that a validator's bond is moved from
+// its genesis balance into a queryable bond, and that a bond larger than
+// the alloc is rejected.
+func TestGenesisValidatorBond(t *testing.T) {
+	v, _ := wallet.Generate()
+	cfg := newTestConfig(v)
+	cfg.RPCPort, cfg.P2PPort = 8545, 30303
+	cfg.Validators[0].Bond = 4_000_000
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	if _, err := config.CreateGenesisBlock(cfg, state, v.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ := state.GetAccount(v.PubKey())
+	if acc.Balance != 6_000_000 {
+		t.Errorf("balance: got %d want 6000000", acc.Balance)
+	}
+	if err := state.VerifySupply(); err != nil {
+		t.Error(err)
+	}
+
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), state,
+		indexer.New(db, events.NewEmitter()), testChainID)
+	handler.SetValidators([]string{v.PubKey()})
+	resp := dispatch(handler, "getValidatorBonds", nil)
+	if resp.Error != nil {
+		t.Fatal(resp.Error.Message)
+	}
+	bonds, _ := resp.Result.([]*core.ValidatorBond)
+	if len(bonds) != 1 || bonds[0].Validator != v.PubKey() || bonds[0].Amount != 4_000_000 {
+		t.Errorf("bonds: got %+v", resp.Result)
+	}
+
+	cfg.Validators[0].Bond = 10_000_001
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "exceeds genesis alloc") {
+		t.Errorf("bond above alloc: got %v", err)
+	}
+}
+
+// TestGenesisValidate verifies that each kind of malformed genesis is
+// rejected by Config.Validate with an error naming the problem.
+func TestGenesisValidate(t *testing.T) {
+	v, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	cases := []struct {
+		name   string
+		mutate func(cfg *config.Config)
+		want   string
+	}{
+		{"empty chain id", func(cfg *config.Config) { cfg.Genesis.ChainID = "" }, "genesis.chain_id must not be empty"},
+		{"chain id with space", func(cfg *config.Config) { cfg.Genesis.ChainID = "tol chain" }, `genesis.chain_id "tol chain" must be at most 64`},
+		{"chain id with trailing newline", func(cfg *config.Config) { cfg.Genesis.ChainID = "tolchain\n" }, "(no spaces)"},
+		{"chain id too long", func(cfg *config.Config) { cfg.Genesis.ChainID = strings.Repeat("a", 65) }, "must be at most 64"},
+		{"bad state root version", func(cfg *config.Config) { cfg.Genesis.StateRootVersion = 3 }, "genesis.state_root_version must be 1 or 2, got 3"},
+		{"alloc key not hex", func(cfg *config.Config) { cfg.Genesis.Alloc["alice"] = 1 }, `genesis.alloc: key "alice" must be a 64-char hex ed25519 pubkey`},
+		{"alloc key wrong length", func(cfg *config.Config) { cfg.Genesis.Alloc["abcd"] = 1 }, `key "abcd" must be a 64-char hex`},
+		{"alloc key uppercase", func(cfg *config.Config) { cfg.Genesis.Alloc[strings.ToUpper(other.PubKey())] = 1 }, "must be lowercase hex"},
+		{"alloc overflow", func(cfg *config.Config) { cfg.Genesis.Alloc[other.PubKey()] = math.MaxUint64 }, "genesis.alloc: balances sum to more than 18446744073709551615"},
+		{"template without id", func(cfg *config.Config) {
+			cfg.Genesis.Templates = []core.RegisterTemplatePayload{{Name: "Sword"}}
+		}, "genesis.templates[0]: template id required"},
+		{"duplicate template", func(cfg *config.Config) {
+			cfg.Genesis.Templates = []core.RegisterTemplatePayload{{ID: "sword"}, {ID: "sword"}}
+		}, `genesis.templates[1]: duplicate template id "sword"`},
+		{"asset of unknown template", func(cfg *config.Config) {
+			cfg.Genesis.Assets = []core.MintAssetPayload{{TemplateID: "shield", Owner: other.PubKey()}}
+		}, `genesis.assets[0]: template "shield" is not in genesis.templates`},
+		{"asset with bad owner", func(cfg *config.Config) {
+			cfg.Genesis.Templates = []core.RegisterTemplatePayload{{ID: "sword"}}
+			cfg.Genesis.Assets = []core.MintAssetPayload{{TemplateID: "sword", Owner: "bob"}}
+		}, "genesis.assets[0]: owner must be a 64-char hex ed25519 pubkey"},
+		{"bonded validator without alloc", func(cfg *config.Config) {
+			cfg.Validators = append(cfg.Validators, config.Validator{PubKey: other.PubKey(), Weight: 1, Bond: 10})
+		}, "validators[1]: bond 10 exceeds genesis alloc 0; add " + other.PubKey() + " to genesis.alloc"},
+	}
+	for _, c := range cases {
+		cfg := newTestConfig(v)
+		cfg.RPCPort, cfg.P2PPort = 8545, 30303
+		c.mutate(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v want error containing %q", c.name, err, c.want)
+		}
+	}
+
+	// Validators need not hold a genesis balance unless they post a bond.
+	cfg := newTestConfig(v)
+	cfg.RPCPort, cfg.P2PPort = 8545, 30303
+	cfg.Validators = append(cfg.Validators, config.Validator{PubKey: other.PubKey(), Weight: 1})
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("unfunded validator without bond: %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/indexer"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/vm"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+func emitMint(e *events.Emitter, owner, assetID string) {
+	e.Emit(events.Event{Type: events.EventAssetMinted, Data: map[string]any{"owner": owner, "asset_id": assetID}})
+}
+
+func emitAssetTransfer(e *events.Emitter, from, to, assetID string) {
+	e.Emit(events.Event{Type: events.EventAssetTransfer, Data: map[string]any{"from": from, "to": to, "asset_id": assetID}})
+}
+
+// TestOwnerIndexManyUpdates verifies the owner index after many mints,
+// transfers and burns against a model of who owns what.
+func TestOwnerIndexManyUpdates(t *testing.T) {
+	emitter := events.NewEmitter()
+	idx := indexer.New(testutil.NewMemDB(), emitter)
+	owners := []string{"aa", "ab", "b"} // "a" would be a prefix of "aa"; owners are hex keys
+	owned := make(map[string]string)    // asset → owner
+
+	for i := 0; i < 300; i++ {
+		id := fmt.Sprintf("asset-%03d", i)
+		owner := owners[i%len(owners)]
+		emitMint(emitter, owner, id)
+		owned[id] = owner
+	}
+	for i := 0; i < 300; i += 2 {
+		id := fmt.Sprintf("asset-%03d", i)
+		to := owners[(i/2)%len(owners)]
+		emitAssetTransfer(emitter, owned[id], to, id)
+		owned[id] = to
+	}
+	for i := 0; i < 300; i += 5 {
+		id := fmt.Sprintf("asset-%03d", i)
+		emitter.Emit(events.Event{Type: events.EventAssetBurned, Data: map[string]any{"owner": owned[id], "asset_id": id}})
+		delete(owned, id)
+	}
+
+	for _, owner := range owners {
+		var want []string
+		for id, o := range owned {
+			if o == owner {
+				want = append(want, id)
+			}
+		}
+		sort.Strings(want)
+		got, err := idx.GetAssetsByOwner(owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("owner %s: got %d assets want %d", owner, len(got), len(want))
+		}
+	}
+	if got, _ := idx.GetAssetsByOwner("a"); len(got) != 0 {
+		t.Errorf("owner a: got %v want none", got)
+	}
+}
+
+// TestOwnerIndexMigratesLegacyLists verifies that an owner index stored as
+// one JSON list per owner is converted when the indexer starts.
+func TestOwnerIndexMigratesLegacyLists(t *testing.T) {
+	db := testutil.NewMemDB()
+	legacy, _ := json.Marshal([]string{"sword", "shield"})
+	_ = db.Set([]byte("idx:owner:asset:aa"), legacy)
+
+	emitter := events.NewEmitter()
+	idx := indexer.New(db, emitter)
+	emitMint(emitter, "aa", "bow")
+	got, err := idx.GetAssetsByOwner("aa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bow", "shield", "sword"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if _, err := db.Get([]byte("idx:owner:asset:aa")); err == nil {
+		t.Error("legacy list key was not removed")
+	}
+}
+
+// TestTxIndexMigratesLegacyLists verifies that sender and type indexes
+// stored as one JSON list each are converted when the tx index starts,
+// keeping their order and limit.
+func TestTxIndexMigratesLegacyLists(t *testing.T) {
+	db := testutil.NewMemDB()
+	legacy, _ := json.Marshal([]indexer.TxRef{
+		{TxID: "t1", Height: 1, Type: "transfer", From: "aa"},
+		{TxID: "t2", Height: 1, Type: "transfer", From: "aa"},
+	})
+	_ = db.Set([]byte("idx:sender:tx:aa"), legacy)
+	_ = db.Set([]byte("idx:type:tx:transfer"), legacy)
+
+	emitter := events.NewEmitter()
+	ti := indexer.NewTxIndex(db, emitter, 2)
+	emitter.Emit(events.Event{Type: events.EventTxExecuted, TxID: "t3", BlockHeight: 2, Data: map[string]any{"type": "transfer", "from": "aa"}})
+	for name, get := range map[string]func() ([]indexer.TxRef, error){
+		"sender": func() ([]indexer.TxRef, error) { return ti.GetBySender("aa", 0, 0) },
+		"type":   func() ([]indexer.TxRef, error) { return ti.GetByType(core.TxTransfer, 0, 0) },
+	} {
+		refs, err := get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, r := range refs {
+			ids = append(ids, r.TxID)
+		}
+		if want := []string{"t2", "t3"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: got %v want %v", name, ids, want)
+		}
+	}
+	if _, err := db.Get([]byte("idx:sender:tx:aa")); err == nil {
+		t.Error("legacy list key was not removed")
+	}
+}
+
+// TestTemplateIndex verifies that getAssetsByTemplate-style lookups return
+// only the live assets minted from the given template.
+func TestTemplateIndex(t *testing.T) {
+	emitter := events.NewEmitter()
+	idx := indexer.New(testutil.NewMemDB(), emitter)
+	mint := func(id, template string) {
+		emitter.Emit(events.Event{Type: events.EventAssetMinted, Data: map[string]any{"owner": "aa", "asset_id": id, "template_id": template}})
+	}
+	mint("s1", "sword")
+	mint("s2", "sword")
+	mint("h1", "shield")
+	mint("s3", "sword")
+	mint("h2", "shield")
+	mint("x1", "sword:gold") // must not match "sword"
+
+	got, err := idx.GetAssetsByTemplate("sword", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"s1", "s2", "s3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sword: got %v want %v", got, want)
+	}
+	if got, _ := idx.GetAssetsByTemplate("sword", 1, 1); !reflect.DeepEqual(got, []string{"s2"}) {
+		t.Errorf("sword page: got %v want [s2]", got)
+	}
+
+	emitter.Emit(events.Event{Type: events.EventAssetBurned, Data: map[string]any{"owner": "aa", "asset_id": "s2", "template_id": "sword"}})
+	if got, _ := idx.GetAssetsByTemplate("sword", 0, 0); !reflect.DeepEqual(got, []string{"s1", "s3"}) {
+		t.Errorf("sword after burn: got %v want [s1 s3]", got)
+	}
+	if got, _ := idx.GetAssetsByTemplate("bow", 0, 0); got == nil || len(got) != 0 {
+		t.Errorf("bow: got %#v want empty slice", got)
+	}
+}
+
+// BenchmarkOwnerIndexTransfer measures moving an asset between two owners
+// who each hold many assets.
+func BenchmarkOwnerIndexTransfer(b *testing.B) {
+	emitter := events.NewEmitter()
+	indexer.New(testutil.NewMemDB(), emitter)
+	for i := 0; i < 10_000; i++ {
+		emitMint(emitter, "aa", fmt.Sprintf("asset-%05d", i))
+		emitMint(emitter, "bb", fmt.Sprintf("other-%05d", i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			emitAssetTransfer(emitter, "aa", "bb", "asset-00000")
+		} else {
+			emitAssetTransfer(emitter, "bb", "aa", "asset-00000")
+		}
+	}
+}
+
+// TestMarketHistory verifies that a listing and its sale are archived with
+// price, parties and block time, and can be queried by asset, by seller
+// and by time range.
+func TestMarketHistory(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	emitter := events.NewEmitter()
+	history := indexer.NewMarketHistory(db, emitter)
+	exec := vm.NewExecutor(state, emitter)
+
+	seller, _ := wallet.Generate()
+	buyer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: buyer.PubKey(), Balance: 1000})
+	_ = state.SetTemplate(&core.AssetTemplate{ID: "sword", Tradeable: true})
+	_ = state.SetAsset(&core.Asset{ID: "a1", TemplateID: "sword", Owner: seller.PubKey(), Tradeable: true})
+
+	listBlock := core.NewBlock(testChainID, 1, "prev", seller.PubKey(), nil)
+	listBlock.Header.Timestamp = 1_000
+	list, _ := seller.NewTx(testChainID, core.TxListMarket, 0, 0, core.ListMarketPayload{AssetID: "a1", Price: 250})
+	if err := exec.ExecuteTx(listBlock, list); err != nil {
+		t.Fatal(err)
+	}
+	listing, err := history.Query(indexer.MarketQuery{AssetID: "a1"}, 0, 0)
+	if err != nil || len(listing) != 1 {
+		t.Fatalf("after listing: %+v, %v", listing, err)
+	}
+
+	buyBlock := core.NewBlock(testChainID, 2, "prev", seller.PubKey(), nil)
+	buyBlock.Header.Timestamp = 2_000
+	buy, _ := buyer.NewTx(testChainID, core.TxBuyMarket, 0, 0, core.BuyMarketPayload{ListingID: listing[0].ListingID})
+	if err := exec.ExecuteTx(buyBlock, buy); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := history.Query(indexer.MarketQuery{Seller: seller.PubKey()}, 0, 0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("by seller: %+v, %v", records, err)
+	}
+	want := indexer.MarketRecord{
+		Kind: indexer.MarketSold, ListingID: listing[0].ListingID, AssetID: "a1",
+		Seller: seller.PubKey(), Buyer: buyer.PubKey(), Price: 250,
+		Height: 2, Timestamp: 2_000, TxID: buy.ID,
+	}
+	if records[0].Kind != indexer.MarketListed || records[1] != want {
+		t.Errorf("by seller: got %+v, want listing then %+v", records, want)
+	}
+	if sales, _ := history.Query(indexer.MarketQuery{AssetID: "a1", FromTime: 1_500}, 0, 0); len(sales) != 1 || sales[0] != want {
+		t.Errorf("from time 1500: got %+v", sales)
+	}
+	if early, _ := history.Query(indexer.MarketQuery{ToTime: 1_500}, 0, 0); len(early) != 1 || early[0].Kind != indexer.MarketListed {
+		t.Errorf("to time 1500: got %+v", early)
+	}
+	if page, _ := history.Query(indexer.MarketQuery{}, 1, 1); len(page) != 1 || page[0] != want {
+		t.Errorf("offset 1: got %+v", page)
+	}
+
+	// The listing was deactivated in state, but its history remains.
+	if l, _ := state.GetListing(listing[0].ListingID); l.Active {
+		t.Error("listing still active after sale")
+	}
+}
+
+// TestRevertedBatchLeavesIndex verifies that a batch failing in a later
+// operation publishes none of the events of the operations before it, so
+// the owner index still matches the reverted state.
+func TestRevertedBatchLeavesIndex(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	emitter := events.NewEmitter()
+	idx := indexer.New(db, emitter)
+	exec := vm.NewExecutor(state, emitter)
+	var published []events.EventType
+	emitter.SubscribeAll(func(ev events.Event) { published = append(published, ev.Type) })
+
+	owner, _ := wallet.Generate()
+	friend, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: owner.PubKey(), Balance: 1000})
+	_ = state.SetTemplate(&core.AssetTemplate{ID: "sword", Tradeable: true})
+	_ = state.SetAsset(&core.Asset{ID: "a1", TemplateID: "sword", Owner: owner.PubKey(), Tradeable: true})
+	emitMint(emitter, owner.PubKey(), "a1")
+	published = nil
+
+	tx, _ := owner.NewTx(testChainID, core.TxBatch, 0, 0, core.BatchPayload{Ops: []core.BatchOp{
+		batchOp(core.TxTransferAsset, core.TransferAssetPayload{AssetID: "a1", To: friend.PubKey()}),
+		batchOp(core.TxTransfer, core.TransferPayload{To: friend.PubKey(), Amount: 5000}),
+	}})
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", owner.PubKey(), nil), tx); err == nil {
+		t.Fatal("overdrawn batch succeeded")
+	}
+	if a, _ := state.GetAsset("a1"); a.Owner != owner.PubKey() {
+		t.Fatalf("asset owner after reverted batch: %s", a.Owner)
+	}
+	if len(published) != 0 {
+		t.Errorf("reverted batch published %v", published)
+	}
+	if got, _ := idx.GetAssetsByOwner(owner.PubKey()); !reflect.DeepEqual(got, []string{"a1"}) {
+		t.Errorf("owner's assets: got %v want [a1]", got)
+	}
+	if got, _ := idx.GetAssetsByOwner(friend.PubKey()); len(got) != 0 {
+		t.Errorf("friend's assets: got %v want none", got)
+	}
+}
+
+// TestEventLogCommittedBlocksOnly verifies that the event log keeps only
+// the events of committed blocks, and that logging a height again, as after
+// a restart, replaces its events instead of adding to them.
+func TestEventLogCommittedBlocksOnly(t *testing.T) {
+	db := testutil.NewMemDB()
+	emitter := events.NewEmitter()
+	evlog := indexer.NewEventLog(db, emitter, 0)
+	emit := func(typ events.EventType, txID string, height int64) {
+		emitter.Emit(events.Event{Type: typ, TxID: txID, BlockHeight: height})
+	}
+	logged := func() []string {
+		evs, err := evlog.Query(indexer.EventFilter{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, ev := range evs {
+			out = append(out, fmt.Sprintf("%d/%s/%s", ev.BlockHeight, ev.Type, ev.TxID))
+		}
+		return out
+	}
+
+	emit(events.EventTokenTransfer, "stale", 3) // of a block never committed
+	emit(events.EventTokenTransfer, "a", 1)
+	emit(events.EventBlockCommit, "", 1)
+	emit(events.EventTokenTransfer, "b", 2) // block 2 not yet committed
+	if want := []string{"1/token_transfer/a", "1/block_commit/"}; !reflect.DeepEqual(logged(), want) {
+		t.Fatalf("before block 2 commits: got %v want %v", logged(), want)
+	}
+
+	// The node restarts and logs block 1 again before block 2.
+	emitter = events.NewEmitter()
+	evlog = indexer.NewEventLog(db, emitter, 0)
+	emit(events.EventTokenTransfer, "a", 1)
+	emit(events.EventBlockCommit, "", 1)
+	emit(events.EventTokenTransfer, "b", 2)
+	emit(events.EventBlockCommit, "", 2)
+	want := []string{"1/token_transfer/a", "1/block_commit/", "2/token_transfer/b", "2/block_commit/"}
+	if got := logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after restart: got %v want %v", got, want)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/tolelom/tolchain/wallet"
 
 	_ "github.com/tolelom/tolchain/vm/modules/asset"
+	_ "github.com/tolelom/tolchain/vm/modules/custom"
 	_ "github.com/tolelom/tolchain/vm/modules/economy"
 	_ "github.com/tolelom/tolchain/vm/modules/market"
 	_ "github.com/tolelom/tolchain/vm/modules/session"
@@ -111,7 +112,7 @@ func startTestNode(t *testing.T, w *wallet.Wallet) (rpcURL string, cleanup func(
 		RPCPort:     0,
 		P2PPort:     0,
 		MaxBlockTxs: 500,
-		Validators:  []string{w.PubKey()},
+		Validators:  config.ValidatorsOf(w.PubKey()),
 		Genesis: config.GenesisConfig{
 			ChainID: testChainID,
 			Alloc:   map[string]uint64{w.PubKey(): 10_000_000},
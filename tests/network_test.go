@@ -0,0 +1,1197 @@
+package tests
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/consensus"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/network"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/vm"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// testChain is an in-memory chain with a running P2P node and syncer.
+type testChain struct {
+	bc      *core.Blockchain
+	state   *storage.StateDB
+	mempool *core.Mempool
+	exec    *vm.Executor
+	poa     *consensus.PoA
+	node    *network.Node
+	syncer  *network.Syncer
+	emitter *events.Emitter
+}
+
+// newTestConfig returns a single-validator config funding the validator.
+func newTestConfig(validator *wallet.Wallet) *config.Config {
+	return &config.Config{
+		NodeID:      "test-node",
+		DataDir:     "./data",
+		MaxBlockTxs: 500,
+		Validators:  config.ValidatorsOf(validator.PubKey()),
+		Genesis: config.GenesisConfig{
+			ChainID: testChainID,
+			Alloc:   map[string]uint64{validator.PubKey(): 10_000_000},
+		},
+	}
+}
+
+// newTestChain builds a chain from cfg and starts its P2P node on a random
+// port. If genesis is non-nil it is used instead of a freshly created block
+// so that several chains can share one genesis hash.
+func newTestChain(t *testing.T, cfg *config.Config, validator *wallet.Wallet, genesis *core.Block) (*testChain, *core.Block) {
+	t.Helper()
+	state := storage.NewStateDB(testutil.NewMemDB())
+	bc := core.NewBlockchain(testutil.NewMemBlockStore())
+	created, err := config.CreateGenesisBlock(cfg, state, validator.PrivKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis == nil {
+		genesis = created
+	}
+	if err := bc.AddBlock(genesis); err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := events.NewEmitter()
+	mempool := core.NewMempool()
+	exec := vm.NewExecutor(state, emitter)
+	exec.SetParams(cfg.VMParams())
+	poa := consensus.New(cfg, bc, state, mempool, exec, emitter, validator.PrivKey())
+	node := network.NewNode(cfg.NodeID, "127.0.0.1:0", mempool, nil)
+	syncer := network.NewSyncer(node, bc, poa, exec, state)
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+	return &testChain{bc: bc, state: state, mempool: mempool, exec: exec, poa: poa, node: node, syncer: syncer, emitter: emitter}, genesis
+}
+
+// sendBlocks delivers blocks to c's node as an unsolicited blocks response
+// from a throwaway peer connection.
+func sendBlocks(t *testing.T, c *testChain, blocks ...*core.Block) *network.Peer {
+	t.Helper()
+	peer, err := network.Connect("feeder", c.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(peer.Close)
+	data, _ := json.Marshal(network.BlocksResponse{Blocks: blocks})
+	if err := peer.Send(network.Message{Type: network.MsgBlocks, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	return peer
+}
+
+// waitHeight polls until c reaches height or the timeout elapses.
+func waitHeight(t *testing.T, c *testChain, height int64, timeout time.Duration) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if c.bc.Height() >= height {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// buildBlock executes txs on a scratch copy of the genesis state and returns
+// a block at height 1 signed by validator with the given timestamp.
+func buildBlock(t *testing.T, cfg *config.Config, validator *wallet.Wallet, prev *core.Block, ts int64, txs []*core.Transaction) *core.Block {
+	t.Helper()
+	scratch := storage.NewStateDB(testutil.NewMemDB())
+	if _, err := config.CreateGenesisBlock(cfg, scratch, validator.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	block := core.NewBlock(cfg.Genesis.ChainID, prev.Header.Height+1, prev.Hash, validator.PubKey(), txs)
+	block.Header.Timestamp = ts
+	exec := vm.NewExecutor(scratch, nil)
+	exec.SetParams(cfg.VMParams())
+	if err := exec.ExecuteBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	root, err := scratch.ComputeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Header.StateRoot = root
+	block.Sign(validator.PrivKey())
+	return block
+}
+
+// TestForkChoiceEqualTimestamps verifies that two nodes receiving the same two
+// equal-timestamp candidates in one delivery, in opposite order, settle on
+// the same tip.
+func TestForkChoiceEqualTimestamps(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+
+	nodeA, genesis := newTestChain(t, cfg, validator, nil)
+	nodeB, _ := newTestChain(t, cfg, validator, genesis)
+
+	ts := time.Now().UnixNano()
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	empty := buildBlock(t, cfg, validator, genesis, ts, nil)
+	withTx := buildBlock(t, cfg, validator, genesis, ts, []*core.Transaction{tx})
+	if empty.Hash == withTx.Hash {
+		t.Fatal("candidates must differ")
+	}
+	want := empty
+	if core.CompareBlocks(withTx, empty) < 0 {
+		want = withTx
+	}
+
+	sendBlocks(t, nodeA, empty, withTx)
+	sendBlocks(t, nodeB, withTx, empty)
+	for name, c := range map[string]*testChain{"A": nodeA, "B": nodeB} {
+		if !waitHeight(t, c, 1, 3*time.Second) {
+			t.Fatalf("node %s did not accept a block", name)
+		}
+		if got := c.bc.Tip().Hash; got != want.Hash {
+			t.Errorf("node %s tip: got %s want %s", name, got, want.Hash)
+		}
+	}
+}
+
+// TestForkChoiceSeparateDeliveries verifies the documented limit of the
+// fork-choice rule: candidates delivered separately are not reconciled, and
+// a node keeps the first one it committed even when the later one is
+// preferred.
+func TestForkChoiceSeparateDeliveries(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	c, genesis := newTestChain(t, cfg, validator, nil)
+
+	ts := time.Now().UnixNano()
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	preferred := buildBlock(t, cfg, validator, genesis, ts, nil)
+	other := buildBlock(t, cfg, validator, genesis, ts, []*core.Transaction{tx})
+	if core.CompareBlocks(other, preferred) < 0 {
+		preferred, other = other, preferred
+	}
+
+	sendBlocks(t, c, other)
+	if !waitHeight(t, c, 1, 3*time.Second) {
+		t.Fatal("first candidate was not accepted")
+	}
+	peer := sendBlocks(t, c, preferred)
+	if err := peer.Send(network.Message{Type: network.MsgPing}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := peer.Receive(); err != nil || msg.Type != network.MsgPong {
+		t.Fatalf("feeder of the rival block: got %v, %v want a pong", msg.Type, err)
+	}
+	if got := c.bc.Tip().Hash; got != other.Hash || c.bc.Height() != 1 {
+		t.Errorf("tip: got %s at height %d, want the first committed %s", got, c.bc.Height(), other.Hash)
+	}
+}
+
+// socks5Stub is a minimal no-auth SOCKS5 server that records CONNECT targets
+// and relays traffic to them.
+type socks5Stub struct {
+	ln      net.Listener
+	targets chan string
+}
+
+func newSOCKS5Stub(t *testing.T) *socks5Stub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Stub{ln: ln, targets: make(chan string, 8)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Stub) serve(conn net.Conn) {
+	defer conn.Close()
+	// Greeting: VER NMETHODS METHODS...
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0}) // no authentication
+
+	// Request: VER CMD RSV ATYP (IPv4 only here) ADDR PORT
+	req := make([]byte, 10)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 1 || req[3] != 1 {
+		return
+	}
+	target := net.JoinHostPort(net.IP(req[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(req[8:]))))
+	s.targets <- target
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+// TestPeerConnectViaSOCKS5 verifies that outbound peer connections are routed
+// through the configured SOCKS5 proxy.
+func TestPeerConnectViaSOCKS5(t *testing.T) {
+	stub := newSOCKS5Stub(t)
+
+	server := network.NewNode("server", "127.0.0.1:0", core.NewMempool(), nil)
+	hello := make(chan string, 1)
+	server.Handle(network.MsgHello, func(_ *network.Peer, msg network.Message) {
+		var h map[string]string
+		json.Unmarshal(msg.Payload, &h)
+		hello <- h["node_id"]
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	client := network.NewNode("client", "127.0.0.1:0", core.NewMempool(), nil)
+	if err := client.SetProxy(stub.ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	if err := client.AddPeer("server", server.Addr().String()); err != nil {
+		t.Fatalf("add peer: %v", err)
+	}
+	select {
+	case target := <-stub.targets:
+		if target != server.Addr().String() {
+			t.Errorf("proxy target: got %s want %s", target, server.Addr())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection did not go through the proxy")
+	}
+	select {
+	case id := <-hello:
+		if id != "client" {
+			t.Errorf("hello node_id: got %q want client", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not receive hello through the proxy")
+	}
+}
+
+// TestSyncRejectsCheckpointMismatch verifies that a synced block at a
+// checkpoint height is only accepted if its hash matches the checkpoint.
+func TestSyncRejectsCheckpointMismatch(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+
+	ts := time.Now().UnixNano()
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	bogus := buildBlock(t, cfg, validator, genesis, ts, nil)
+	trusted := buildBlock(t, cfg, validator, genesis, ts, []*core.Transaction{tx})
+	chain.syncer.SetCheckpoints(map[int64]string{1: trusted.Hash})
+
+	// Messages on one connection are handled in order, so once the trusted
+	// block lands the bogus one has already been considered and refused.
+	peer := sendBlocks(t, chain, bogus)
+	data, _ := json.Marshal(network.BlocksResponse{Blocks: []*core.Block{trusted}})
+	if err := peer.Send(network.Message{Type: network.MsgBlocks, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitHeight(t, chain, 1, 3*time.Second) {
+		t.Fatal("checkpointed block was not accepted")
+	}
+	if got := chain.bc.Tip().Hash; got != trusted.Hash {
+		t.Errorf("tip: got %s want checkpoint %s", got, trusted.Hash)
+	}
+}
+
+// TestSyncQuarantinesFutureBlock verifies that a block slightly ahead of the
+// local clock is held back instead of ending the batch, and applied once the
+// clock catches up, while a block beyond the quarantine window is rejected.
+func TestSyncQuarantinesFutureBlock(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+	chain.poa.SetClockDrift(4*time.Second, 10*time.Second)
+
+	now := time.Now()
+	far := buildBlock(t, cfg, validator, genesis, now.Add(30*time.Second).UnixNano(), nil)
+	var future *core.FutureBlockError
+	if err := chain.poa.ValidateBlock(far); err == nil || errors.As(err, &future) {
+		t.Fatalf("block 30s ahead: got %v, want outright rejection", err)
+	}
+
+	current := buildBlock(t, cfg, validator, genesis, now.UnixNano(), nil)
+	early := buildBlock(t, cfg, validator, current, now.Add(5*time.Second).UnixNano(), nil)
+	sendBlocks(t, chain, current, early)
+	if !waitHeight(t, chain, 1, 3*time.Second) {
+		t.Fatal("the current block was not accepted")
+	}
+	if h := chain.bc.Height(); h != 1 {
+		t.Fatalf("height %d: the early block was accepted before its time", h)
+	}
+	if !waitHeight(t, chain, 2, 5*time.Second) {
+		t.Fatal("the quarantined block was not accepted once the clock caught up")
+	}
+	if got := chain.bc.Tip().Hash; got != early.Hash {
+		t.Errorf("tip: got %s want %s", got, early.Hash)
+	}
+}
+
+// TestSyncBlockRewardRoot verifies that a syncing node applies the same block
+// reward as the producer and so reaches the same state root.
+func TestSyncBlockRewardRoot(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	cfg.BlockReward = 25
+	producer, genesis := newTestChain(t, cfg, validator, nil)
+	follower, _ := newTestChain(t, cfg, validator, genesis)
+
+	block, err := producer.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendBlocks(t, follower, block)
+	if !waitHeight(t, follower, 1, 3*time.Second) {
+		t.Fatal("follower rejected the rewarded block")
+	}
+	if got, _ := follower.state.ComputeRoot(); got != block.Header.StateRoot {
+		t.Errorf("follower root: got %s want %s", got, block.Header.StateRoot)
+	}
+	acc, _ := follower.state.GetAccount(validator.PubKey())
+	if acc.Balance != 10_000_000+25 {
+		t.Errorf("proposer balance on follower: got %d want %d", acc.Balance, 10_000_025)
+	}
+}
+
+// TestPeerBannedForInvalidBlocks verifies that a peer repeatedly sending
+// invalid blocks is disconnected and cannot reconnect until its ban expires.
+func TestPeerBannedForInvalidBlocks(t *testing.T) {
+	validator, _ := wallet.Generate()
+	imposter, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+	const banDuration = 500 * time.Millisecond
+	chain.node.SetBanPolicy(2*network.PenaltyInvalidBlock, banDuration)
+
+	// closed reports whether the node hangs up on peer without a message.
+	closed := func(peer *network.Peer) bool {
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := peer.Receive()
+			errCh <- err
+		}()
+		select {
+		case err := <-errCh:
+			return err != nil
+		case <-time.After(2 * time.Second):
+			return false
+		}
+	}
+
+	ts := time.Now().UnixNano()
+	bad := buildBlock(t, cfg, imposter, genesis, ts, nil) // wrong proposer
+	peer := sendBlocks(t, chain, bad)
+	data, _ := json.Marshal(network.BlocksResponse{Blocks: []*core.Block{bad}})
+	if err := peer.Send(network.Message{Type: network.MsgBlocks, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !closed(peer) {
+		t.Fatal("misbehaving peer was not disconnected")
+	}
+	if !chain.node.IsBanned("127.0.0.1") {
+		t.Fatal("misbehaving peer's host is not banned")
+	}
+
+	// Reconnecting during the cooldown is refused.
+	again, err := network.Connect("again", chain.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if !closed(again) {
+		t.Fatal("banned peer was able to reconnect")
+	}
+
+	// After the cooldown the peer is accepted again.
+	time.Sleep(banDuration)
+	good := buildBlock(t, cfg, validator, genesis, ts, nil)
+	sendBlocks(t, chain, good)
+	if !waitHeight(t, chain, 1, 3*time.Second) {
+		t.Fatal("peer was not accepted after the ban expired")
+	}
+}
+
+// TestSyncRejectsOverCountResponses verifies that a blocks response with
+// more than MaxSyncBlocks blocks, or a block with more than MaxSyncBlockTxs
+// transactions, is rejected without applying anything and that the sending
+// peer is disconnected.
+func TestSyncRejectsOverCountResponses(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	_, genesis := newTestChain(t, cfg, validator, nil)
+	good := buildBlock(t, cfg, validator, genesis, time.Now().UnixNano(), nil)
+
+	tooManyBlocks := make([]*core.Block, network.MaxSyncBlocks+1)
+	for i := range tooManyBlocks {
+		tooManyBlocks[i] = good
+	}
+	tooManyBlocksData, _ := json.Marshal(network.BlocksResponse{Blocks: tooManyBlocks})
+
+	goodData, _ := json.Marshal(good)
+	txs := "[" + strings.Repeat("{},", network.MaxSyncBlockTxs) + "{}]"
+	block := strings.Replace(string(goodData), `"transactions":null`, `"transactions":`+txs, 1)
+	if block == string(goodData) {
+		t.Fatal("failed to build the over-count transactions payload")
+	}
+	tooManyTxsData := []byte(`{"blocks":[` + block + `]}`)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{{"blocks", tooManyBlocksData}, {"transactions", tooManyTxsData}} {
+		chain, _ := newTestChain(t, cfg, validator, genesis)
+		peer, err := network.Connect("feeder", chain.node.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peer.Close()
+		if err := peer.Send(network.Message{Type: network.MsgBlocks, Payload: tc.data}); err != nil {
+			t.Fatal(err)
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := peer.Receive()
+			errCh <- err
+		}()
+		select {
+		case err := <-errCh:
+			if err == nil {
+				t.Errorf("%s: peer got a message instead of being disconnected", tc.name)
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("%s: peer exceeding the limit was not disconnected", tc.name)
+		}
+		if h := chain.bc.Height(); h != 0 {
+			t.Errorf("%s: height after over-count response: got %d want 0", tc.name, h)
+		}
+	}
+}
+
+// TestPushedMalformedBlocks verifies that malformed blocks pushed as block
+// messages, and a message whose handler panics, are rejected without taking
+// down the node or the peer's connection, and that a valid pushed block is
+// still applied afterwards.
+func TestPushedMalformedBlocks(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+	chain.node.SetBanPolicy(1000, time.Minute) // keep the feeder connected
+	chain.node.Handle("boom", func(*network.Peer, network.Message) { panic("boom") })
+	good := buildBlock(t, cfg, validator, genesis, time.Now().UnixNano(), nil)
+
+	mutate := func(fn func(b *core.Block)) []byte {
+		cp := *good
+		fn(&cp)
+		data, _ := json.Marshal(&cp)
+		return data
+	}
+	malformed := map[string][]byte{
+		"null":           []byte("null"),
+		"empty":          []byte("{}"),
+		"self parent":    mutate(func(b *core.Block) { b.Header.PrevHash = b.Hash }),
+		"bad hash":       mutate(func(b *core.Block) { b.Hash = "zz" }),
+		"no chain id":    mutate(func(b *core.Block) { b.Header.ChainID = "" }),
+		"null tx":        []byte(strings.Replace(string(mutate(func(*core.Block) {})), `"transactions":null`, `"transactions":[null]`, 1)),
+		"unsigned":       mutate(func(b *core.Block) { b.Signature = "" }),
+		"not an object":  []byte(`[1,2,3]`),
+		"bad proposer":   mutate(func(b *core.Block) { b.Header.Proposer = "nobody" }),
+		"negative block": mutate(func(b *core.Block) { b.Header.Height = -1 }),
+	}
+
+	peer, err := network.Connect("feeder", chain.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	for name, data := range malformed {
+		if err := peer.Send(network.Message{Type: network.MsgBlock, Payload: data}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if err := peer.Send(network.Message{Type: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if h := chain.bc.Height(); h != 0 {
+		t.Fatalf("height after malformed blocks: got %d want 0", h)
+	}
+
+	data, _ := json.Marshal(good)
+	if err := peer.Send(network.Message{Type: network.MsgBlock, Payload: data}); err != nil {
+		t.Fatalf("connection dropped after malformed blocks: %v", err)
+	}
+	if !waitHeight(t, chain, 1, 3*time.Second) {
+		t.Fatal("valid pushed block was not applied after malformed ones")
+	}
+}
+
+// TestChainIDPropagation verifies that chain_id flows from the wallet through
+// block production and sync, and that gossiped foreign transactions are
+// dropped before reaching the mempool.
+func TestChainIDPropagation(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	producer, genesis := newTestChain(t, cfg, validator, nil)
+	follower, _ := newTestChain(t, cfg, validator, genesis)
+	follower.node.SetChainID(testChainID)
+
+	if genesis.Header.ChainID != testChainID {
+		t.Errorf("genesis chain_id: got %q want %q", genesis.Header.ChainID, testChainID)
+	}
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	if err := producer.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	block, err := producer.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.ChainID != testChainID || block.Transactions[0].ChainID != testChainID {
+		t.Errorf("produced chain_ids: block %q tx %q", block.Header.ChainID, block.Transactions[0].ChainID)
+	}
+	sendBlocks(t, follower, block)
+	if !waitHeight(t, follower, 1, 3*time.Second) {
+		t.Fatal("follower rejected the block")
+	}
+
+	// Gossip one foreign and one local tx; only the local one is pooled.
+	foreign, _ := validator.Transfer("other-chain", recipient.PubKey(), 5, 1, 0)
+	local, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 1, 0)
+	peer, err := network.Connect("gossip", follower.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	for _, tx := range []*core.Transaction{foreign, local} {
+		data, _ := json.Marshal(tx)
+		if err := peer.Send(network.Message{Type: network.MsgTx, Payload: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pooled := func(id string) bool {
+		_, ok := follower.mempool.Get(id)
+		return ok
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !pooled(local.ID) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !pooled(local.ID) {
+		t.Fatal("local-chain tx was not pooled")
+	}
+	if pooled(foreign.ID) {
+		t.Error("foreign-chain tx was pooled")
+	}
+}
+
+// TestGossipTxDedup verifies that a transaction pushed by two peers is
+// verified and admitted once and relayed to the other peers once.
+func TestGossipTxDedup(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, _ := newTestChain(t, cfg, validator, nil)
+	var checks atomic.Int32
+	chain.mempool.SetValidator(func(tx *core.Transaction) error {
+		checks.Add(1)
+		return chain.exec.CheckTx(tx)
+	})
+
+	var peers []*network.Peer
+	for _, id := range []string{"first", "second", "watcher"} {
+		p, err := network.Connect(id, chain.node.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		peers = append(peers, p)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for chain.node.PeerCount() < len(peers) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 5, 0, 0)
+	data, _ := json.Marshal(tx)
+	msg := network.Message{Type: network.MsgTx, Payload: data}
+	if err := peers[0].Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	relayed, err := peers[2].Receive()
+	if err != nil {
+		t.Fatalf("watcher: %v", err)
+	}
+	if relayed.Type != network.MsgTx || string(relayed.Payload) != string(data) {
+		t.Fatalf("watcher got %s %s, want the relayed tx", relayed.Type, relayed.Payload)
+	}
+	if err := peers[1].Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if n := checks.Load(); n != 1 {
+		t.Errorf("tx checked %d times, want 1", n)
+	}
+	if _, ok := chain.mempool.Get(tx.ID); !ok {
+		t.Error("tx was not pooled")
+	}
+}
+
+// TestGetBlocksByteBudget verifies that a get_blocks response for many large
+// blocks stops at the syncer's byte budget and is marked truncated.
+func TestGetBlocksByteBudget(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, genesis := newTestChain(t, cfg, validator, nil)
+	const budget = 256 * 1024
+	chain.syncer.SetMaxBatchBytes(budget)
+
+	// 200 blocks of ~16 KiB each; the chain store does not execute them.
+	filler := strings.Repeat("x", 16*1024)
+	prev := genesis
+	for h := int64(1); h <= 200; h++ {
+		tx, _ := validator.NewTx(testChainID, core.TxTransfer, uint64(h), 0, map[string]string{"memo": filler})
+		b := core.NewBlock(testChainID, h, prev.Hash, validator.PubKey(), []*core.Transaction{tx})
+		b.Sign(validator.PrivKey())
+		if err := chain.bc.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+		prev = b
+	}
+
+	peer, err := network.Connect("requester", chain.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	req, _ := json.Marshal(network.GetBlocksRequest{FromHeight: 1, Limit: 200})
+	if err := peer.Send(network.Message{Type: network.MsgGetBlocks, Payload: req}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := peer.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != network.MsgBlocks {
+		t.Fatalf("got %s message, want blocks", msg.Type)
+	}
+	var resp network.BlocksResponse
+	if err := json.Unmarshal(msg.Payload, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Payload) > budget+1024 {
+		t.Errorf("response is %d bytes, budget %d", len(msg.Payload), budget)
+	}
+	if len(resp.Blocks) == 0 || len(resp.Blocks) >= 200 || !resp.Truncated {
+		t.Errorf("got %d blocks (truncated=%v), want a truncated partial batch", len(resp.Blocks), resp.Truncated)
+	}
+	if resp.Blocks[0].Header.Height != 1 {
+		t.Errorf("first block height: got %d want 1", resp.Blocks[0].Header.Height)
+	}
+}
+
+// floodConnections opens n TCP connections to node and returns them.
+func floodConnections(t *testing.T, node *network.Node, n int) []net.Conn {
+	t.Helper()
+	conns := make([]net.Conn, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := net.Dial("tcp", node.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// closedCount returns how many of conns the remote end has closed.
+func closedCount(conns []net.Conn) int {
+	closed := 0
+	for _, c := range conns {
+		_ = c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := c.Read(make([]byte, 1)); errors.Is(err, io.EOF) {
+			closed++
+		}
+	}
+	return closed
+}
+
+// TestInboundPerIPLimits verifies that a flood of connections from one host
+// is capped by the per-host peer limit and by the per-host accept rate, with
+// the excess connections closed immediately.
+func TestInboundPerIPLimits(t *testing.T) {
+	node := network.NewNode("target", "127.0.0.1:0", core.NewMempool(), nil)
+	node.SetInboundLimits(3, 1000, 1000)
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+
+	conns := floodConnections(t, node, 10)
+	if closed := closedCount(conns); closed != 7 {
+		t.Errorf("per-host peer cap: %d of 10 connections closed, want 7", closed)
+	}
+	if got := node.PeerCount(); got != 3 {
+		t.Errorf("peer count: got %d want 3", got)
+	}
+
+	rated := network.NewNode("rated", "127.0.0.1:0", core.NewMempool(), nil)
+	rated.SetInboundLimits(100, 1000, 2)
+	if err := rated.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(rated.Stop)
+	conns = floodConnections(t, rated, 10)
+	if closed := closedCount(conns); closed < 6 {
+		t.Errorf("per-host accept rate: only %d of 10 connections closed, want at least 6", closed)
+	}
+}
+
+// TestSyncRetriesWithAnotherPeer verifies that a block request the first
+// peer never answers is retried with a second peer, which completes sync.
+func TestSyncRetriesWithAnotherPeer(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	ahead, genesis := newTestChain(t, cfg, validator, nil)
+	behind, _ := newTestChain(t, cfg, validator, genesis)
+	behind.syncer.SetRetryPolicy(200*time.Millisecond, 50*time.Millisecond, 3)
+
+	block := buildBlock(t, cfg, validator, genesis, time.Now().UnixNano(), nil)
+	if err := ahead.bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	// The silent peer accepts the connection and discards everything sent.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	if err := behind.node.AddPeer("silent", ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := behind.node.AddPeer("ahead", ahead.node.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	behind.syncer.SyncWithPeer(behind.node.Peer("silent"))
+
+	if !waitHeight(t, behind, 1, 5*time.Second) {
+		t.Fatal("sync did not complete via the second peer")
+	}
+	if got := behind.bc.Tip().Hash; got != block.Hash {
+		t.Errorf("tip: got %s want %s", got, block.Hash)
+	}
+}
+
+// TestKeepAlive verifies that keep-alive pings hold an idle connection open
+// past the read timeout, and that a peer which never answers pings is
+// disconnected.
+func TestKeepAlive(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	a, genesis := newTestChain(t, cfg, validator, nil)
+	b, _ := newTestChain(t, cfg, validator, genesis)
+	for _, c := range []*testChain{a, b} {
+		c.node.SetKeepAlive(50*time.Millisecond, 3, 200*time.Millisecond)
+	}
+	if err := a.node.AddPeer("b", b.node.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second) // five read timeouts without any chain traffic
+	if a.node.PeerCount() != 1 || b.node.PeerCount() != 1 {
+		t.Fatalf("idle peers disconnected: a has %d, b has %d", a.node.PeerCount(), b.node.PeerCount())
+	}
+
+	// A peer that keeps talking (so the read timeout never fires) but never
+	// answers pings is dropped once it misses three of them.
+	mute, err := network.Connect("mute", a.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mute.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				if mute.Send(network.Message{Type: network.MsgPing}) != nil {
+					return
+				}
+			}
+		}
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for a.node.PeerCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for a.node.PeerCount() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.node.PeerCount() != 1 {
+		t.Errorf("peer ignoring pings still connected: %d peers", a.node.PeerCount())
+	}
+}
+
+// TestSyncingPausesProduction verifies that a node whose peer reports a
+// taller chain does not produce blocks on its stale tip, even on its own
+// proposer turn, and resumes once it has synced.
+func TestSyncingPausesProduction(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	ahead, genesis := newTestChain(t, cfg, validator, nil)
+	var blocks []*core.Block
+	for i := 0; i < 3; i++ {
+		b, err := ahead.poa.ProduceBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	behind, _ := newTestChain(t, cfg, validator, genesis)
+	behind.poa.SetSyncStatus(behind.syncer)
+	peer, err := network.Connect("ahead", behind.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	hello, _ := json.Marshal(network.Hello{NodeID: "ahead", Height: 3})
+	if err := peer.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := peer.Receive(); err != nil || msg.Type != network.MsgGetBlocks {
+		t.Fatalf("expected get_blocks after hello, got %v, %v", msg.Type, err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go behind.poa.Run(10*time.Millisecond, done)
+	time.Sleep(150 * time.Millisecond)
+	if !behind.syncer.Syncing() {
+		t.Error("node behind its peer should report syncing")
+	}
+	if h := behind.bc.Height(); h != 0 {
+		t.Fatalf("node produced up to height %d while syncing", h)
+	}
+
+	data, _ := json.Marshal(network.BlocksResponse{Blocks: blocks, Height: 3})
+	if err := peer.Send(network.Message{Type: network.MsgBlocks, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitHeight(t, behind, 4, 5*time.Second) {
+		t.Fatalf("node did not resume production after syncing, height %d", behind.bc.Height())
+	}
+	if behind.syncer.Syncing() {
+		t.Error("node should not report syncing once caught up")
+	}
+	b3, _ := behind.bc.GetBlockByHeight(3)
+	b4, _ := behind.bc.GetBlockByHeight(4)
+	if b3.Hash != blocks[2].Hash || b4.Header.PrevHash != blocks[2].Hash {
+		t.Error("produced block does not extend the synced chain")
+	}
+}
+
+// TestSlowTxSyncs verifies that the tx timeout does not apply to blocks from
+// peers: a block whose transaction outlasts the follower's timeout still
+// validates and is applied on the sync path.
+func TestSlowTxSyncs(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	ahead, genesis := newTestChain(t, cfg, validator, nil)
+	tx, _ := validator.NewTx(testChainID, txSlow, 0, 0, struct{}{})
+	if err := ahead.mempool.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ahead.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 1 {
+		t.Fatalf("slow tx not included: %d txs", len(block.Transactions))
+	}
+
+	behind, _ := newTestChain(t, cfg, validator, genesis)
+	behind.exec.SetTxTimeout(50 * time.Millisecond)
+	if err := behind.node.AddPeer("ahead", ahead.node.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	behind.syncer.SyncWithPeer(behind.node.Peer("ahead"))
+	if !waitHeight(t, behind, 1, 5*time.Second) {
+		t.Fatal("block with a slow tx was not applied on the sync path")
+	}
+	if got := behind.bc.Tip().Hash; got != block.Hash {
+		t.Errorf("tip: got %s want %s", got, block.Hash)
+	}
+}
+
+// TestSyncedBlockClearsMempool verifies that a follower applying a block
+// from the proposer drops the block's transactions from its mempool, along
+// with pending transactions at the nonces the block used up, and keeps the
+// rest.
+func TestSyncedBlockClearsMempool(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	proposer, genesis := newTestChain(t, cfg, validator, nil)
+	follower, _ := newTestChain(t, cfg, validator, genesis)
+
+	tx0, _ := validator.Transfer(testChainID, recipient.PubKey(), 10, 0, 0)
+	tx1, _ := validator.Transfer(testChainID, recipient.PubKey(), 20, 1, 0)
+	replaced, _ := validator.Transfer(testChainID, recipient.PubKey(), 30, 0, 0) // lost the race for nonce 0
+	later, _ := validator.Transfer(testChainID, recipient.PubKey(), 40, 2, 0)
+	for _, tx := range []*core.Transaction{tx0, tx1} {
+		if err := proposer.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tx := range []*core.Transaction{tx0, tx1, replaced, later} {
+		if err := follower.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	block, err := proposer.poa.ProduceBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 {
+		t.Fatalf("block holds %d txs, want 2", len(block.Transactions))
+	}
+	sendBlocks(t, follower, block)
+	if !waitHeight(t, follower, 1, 2*time.Second) {
+		t.Fatal("follower did not apply the block")
+	}
+	if pending := follower.mempool.Pending(10); len(pending) != 1 || pending[0].ID != later.ID {
+		t.Errorf("follower mempool after the block: %d txs, want only the nonce-2 transfer", len(pending))
+	}
+	if proposer.mempool.Size() != 0 {
+		t.Errorf("proposer mempool size: got %d want 0", proposer.mempool.Size())
+	}
+}
+
+// TestFakePeerHeight verifies that a peer announcing a height it cannot
+// serve stops being counted as ahead — at once when it answers without
+// blocks, after the request timeout when it does not answer — and that a
+// repeated hello does not renew its claim, so the proposer resumes.
+func TestFakePeerHeight(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	c, _ := newTestChain(t, cfg, validator, nil)
+	c.poa.SetSyncStatus(c.syncer)
+	c.syncer.SetRetryPolicy(300*time.Millisecond, 50*time.Millisecond, 1)
+	hello, _ := json.Marshal(network.Hello{NodeID: "liar", Height: 1 << 62})
+	waitSyncing := func(want bool) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for c.syncer.Syncing() != want && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return c.syncer.Syncing() == want
+	}
+
+	empty, err := network.Connect("liar", c.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	if err := empty.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := empty.Receive(); err != nil || msg.Type != network.MsgGetBlocks {
+		t.Fatalf("expected get_blocks after hello, got %v, %v", msg.Type, err)
+	}
+	if !c.syncer.Syncing() {
+		t.Fatal("claimed height should count while its blocks are requested")
+	}
+	data, _ := json.Marshal(network.BlocksResponse{Height: 1 << 62})
+	if err := empty.Send(network.Message{Type: network.MsgBlocks, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitSyncing(false) {
+		t.Fatal("claim still counted after an empty blocks response")
+	}
+	if err := empty.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if c.syncer.Syncing() {
+		t.Error("a repeated hello renewed the claim")
+	}
+
+	silent, err := network.Connect("mute", c.node.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	if err := silent.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitSyncing(true) {
+		t.Fatal("claimed height should count while its blocks are requested")
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go c.poa.Run(10*time.Millisecond, done)
+	if !waitHeight(t, c, 1, 3*time.Second) {
+		t.Fatal("proposer did not resume after the silent peer's request timed out")
+	}
+}
+
+// TestAllowedPeers verifies that with an allowed peer list an inbound peer
+// whose hello names an unlisted ID is disconnected while a listed one is
+// served, and that the node refuses to dial an unlisted ID.
+func TestAllowedPeers(t *testing.T) {
+	node := network.NewNode("validator-a", "127.0.0.1:0", core.NewMempool(), nil)
+	node.SetAllowedPeers([]string{"validator-b"})
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+
+	connect := func(id string) *network.Peer {
+		peer, err := network.Connect(id, node.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(peer.Close)
+		hello, _ := json.Marshal(network.Hello{NodeID: id})
+		if err := peer.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.Send(network.Message{Type: network.MsgPing}); err != nil {
+			t.Fatal(err)
+		}
+		return peer
+	}
+
+	if _, err := connect("intruder").Receive(); err == nil {
+		t.Error("unlisted peer: connection still open")
+	}
+	msg, err := connect("validator-b").Receive()
+	if err != nil || msg.Type != network.MsgPong {
+		t.Errorf("listed peer: got %v, %v want a pong", msg.Type, err)
+	}
+
+	if err := node.AddPeer("intruder", node.Addr().String()); err == nil {
+		t.Error("AddPeer dialed an unlisted peer")
+	}
+}
+
+// TestAllowedPeersRelay verifies that a gossiped transaction is relayed to
+// admitted peers only, not to a connection that has not sent its hello.
+func TestAllowedPeersRelay(t *testing.T) {
+	node := network.NewNode("validator-a", "127.0.0.1:0", core.NewMempool(), nil)
+	node.SetAllowedPeers([]string{"validator-b", "validator-c"})
+	if err := node.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+	dial := func(id string, greet bool) *network.Peer {
+		peer, err := network.Connect(id, node.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(peer.Close)
+		if !greet {
+			return peer
+		}
+		hello, _ := json.Marshal(network.Hello{NodeID: id})
+		if err := peer.Send(network.Message{Type: network.MsgHello, Payload: hello}); err != nil {
+			t.Fatal(err)
+		}
+		if err := peer.Send(network.Message{Type: network.MsgPing}); err != nil {
+			t.Fatal(err)
+		}
+		if msg, err := peer.Receive(); err != nil || msg.Type != network.MsgPong {
+			t.Fatalf("%s: got %v, %v want a pong", id, msg.Type, err)
+		}
+		return peer
+	}
+	lurker := dial("lurker", false)
+	listener := dial("validator-c", true)
+	sender := dial("validator-b", true)
+	deadline := time.Now().Add(2 * time.Second)
+	for node.PeerCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w, _ := wallet.Generate()
+	tx, _ := w.Transfer(testChainID, "aa", 1, 0, 0)
+	data, _ := json.Marshal(tx)
+	if err := sender.Send(network.Message{Type: network.MsgTx, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := listener.Receive(); err != nil || msg.Type != network.MsgTx {
+		t.Fatalf("admitted peer: got %v, %v want the relayed tx", msg.Type, err)
+	}
+	got := make(chan network.MsgType, 1)
+	go func() {
+		if msg, err := lurker.Receive(); err == nil {
+			got <- msg.Type
+		}
+	}()
+	select {
+	case typ := <-got:
+		t.Errorf("unadmitted connection received %s", typ)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
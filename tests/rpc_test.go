@@ -1,15 +1,36 @@
 package tests
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/tolelom/tolchain/config"
 	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
 	"github.com/tolelom/tolchain/events"
 	"github.com/tolelom/tolchain/indexer"
 	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/node"
 	"github.com/tolelom/tolchain/rpc"
 	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/version"
+	"github.com/tolelom/tolchain/vm"
+	"github.com/tolelom/tolchain/wallet"
 )
 
 // newTestRPCHandler builds an RPC handler backed by in-memory state.
@@ -27,7 +48,7 @@ func newTestRPCHandler(t *testing.T) *rpc.Handler {
 
 func dispatch(handler *rpc.Handler, method string, params any) rpc.Response {
 	raw, _ := json.Marshal(params)
-	return handler.Dispatch(rpc.Request{
+	return handler.Dispatch(context.Background(), rpc.Request{
 		JSONRPC: "2.0",
 		ID:      1,
 		Method:  method,
@@ -35,6 +56,32 @@ func dispatch(handler *rpc.Handler, method string, params any) rpc.Response {
 	})
 }
 
+// TestRPCGetChainInfo verifies that getChainInfo reports the chain ID and
+// the build of the node, which defaults to non-empty values without ldflags.
+func TestRPCGetChainInfo(t *testing.T) {
+	for name, v := range map[string]string{"Version": version.Version, "GitCommit": version.GitCommit, "BuildTime": version.BuildTime} {
+		if v == "" {
+			t.Errorf("version.%s is empty", name)
+		}
+	}
+
+	handler := newTestRPCHandler(t)
+	resp := dispatch(handler, "getChainInfo", struct{}{})
+	if resp.Error != nil {
+		t.Fatalf("error: %v", resp.Error.Message)
+	}
+	info, ok := resp.Result.(map[string]any)
+	if !ok {
+		t.Fatalf("unexpected result type %T", resp.Result)
+	}
+	if info["chain_id"] != "test-chain" {
+		t.Errorf("chain_id: got %v", info["chain_id"])
+	}
+	if info["version"] != version.Version || info["git_commit"] != version.GitCommit || info["build_time"] != version.BuildTime {
+		t.Errorf("build info: got %v", info)
+	}
+}
+
 // TestRPCGetBlockHeight verifies that getBlockHeight returns 0 for a fresh chain.
 func TestRPCGetBlockHeight(t *testing.T) {
 	handler := newTestRPCHandler(t)
@@ -74,6 +121,41 @@ func TestRPCGetBalance(t *testing.T) {
 	}
 }
 
+// TestRPCGetBalances verifies that getBalances reads known and unknown
+// addresses in one call and enforces its address cap.
+func TestRPCGetBalances(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	_ = state.SetAccount(&core.Account{Address: "alice", Balance: 500, Nonce: 3})
+	_ = state.SetAccount(&core.Account{Address: "bob", Balance: 20})
+	if err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), state,
+		indexer.New(db, events.NewEmitter()), "test-chain")
+
+	resp := dispatch(handler, "getBalances", map[string]any{"addresses": []string{"alice", "nobody", "bob"}})
+	if resp.Error != nil {
+		t.Fatalf("getBalances: %v", resp.Error.Message)
+	}
+	want := map[string]rpc.Balance{
+		"alice":  {Balance: 500, Nonce: 3},
+		"bob":    {Balance: 20},
+		"nobody": {},
+	}
+	if got := resp.Result.(map[string]rpc.Balance); !reflect.DeepEqual(got, want) {
+		t.Errorf("balances: got %v want %v", got, want)
+	}
+
+	tooMany := make([]string, 501)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("addr%d", i)
+	}
+	if resp := dispatch(handler, "getBalances", map[string]any{"addresses": tooMany}); resp.Error == nil || resp.Error.Code != rpc.CodeInvalidParams {
+		t.Errorf("501 addresses: got %+v want invalid params", resp.Error)
+	}
+}
+
 // TestRPCGetMempoolSize verifies getMempoolSize returns 0 for an empty mempool.
 func TestRPCGetMempoolSize(t *testing.T) {
 	handler := newTestRPCHandler(t)
@@ -98,3 +180,1040 @@ func TestRPCMethodNotFound(t *testing.T) {
 		t.Errorf("error code: got %d want %d", resp.Error.Code, rpc.CodeMethodNotFound)
 	}
 }
+
+// TestRPCGetBlockSummaries verifies that getBlockSummaries reports a block's
+// transaction count and total fees and stops at the tip.
+func TestRPCGetBlockSummaries(t *testing.T) {
+	db := testutil.NewMemDB()
+	bc := core.NewBlockchain(testutil.NewMemBlockStore())
+	handler := rpc.NewHandler(bc, core.NewMempool(), storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+
+	proposer, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	genesis := core.NewBlock(testChainID, 0, "", proposer.PubKey(), nil)
+	genesis.Sign(proposer.PrivKey())
+	var txs []*core.Transaction
+	for i, fee := range []uint64{3, 0, 12} {
+		tx, _ := proposer.Transfer(testChainID, recipient.PubKey(), 1, uint64(i), fee)
+		txs = append(txs, tx)
+	}
+	block := core.NewBlock(testChainID, 1, genesis.Hash, proposer.PubKey(), txs)
+	block.Sign(proposer.PrivKey())
+	for _, b := range []*core.Block{genesis, block} {
+		if err := bc.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := dispatch(handler, "getBlockSummaries", map[string]any{"from_height": 0, "limit": 10})
+	if resp.Error != nil {
+		t.Fatalf("getBlockSummaries: %v", resp.Error.Message)
+	}
+	var summaries []struct {
+		Height    int64  `json:"height"`
+		Hash      string `json:"hash"`
+		Proposer  string `json:"proposer"`
+		TxCount   int    `json:"tx_count"`
+		TotalFees uint64 `json:"total_fees"`
+	}
+	raw, _ := json.Marshal(resp.Result)
+	if err := json.Unmarshal(raw, &summaries); err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries want 2", len(summaries))
+	}
+	s := summaries[1]
+	if s.Height != 1 || s.Hash != block.Hash || s.Proposer != proposer.PubKey() || s.TxCount != 3 || s.TotalFees != 15 {
+		t.Errorf("block 1 summary: %+v", s)
+	}
+	if strings.Contains(string(raw), "transactions") {
+		t.Error("summaries should not include transaction bodies")
+	}
+}
+
+// TestRPCGetBlockDecode verifies that getBlock with decode=true includes a
+// typed decoded_payload for each transaction.
+func TestRPCGetBlockDecode(t *testing.T) {
+	db := testutil.NewMemDB()
+	bc := core.NewBlockchain(testutil.NewMemBlockStore())
+	handler := rpc.NewHandler(bc, core.NewMempool(), storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+
+	sender, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	tx, _ := sender.Transfer(testChainID, recipient.PubKey(), 42, 0, 0)
+	block := core.NewBlock(testChainID, 0, "", sender.PubKey(), []*core.Transaction{tx})
+	block.Sign(sender.PrivKey())
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := dispatch(handler, "getBlock", map[string]any{"height": 0, "decode": true})
+	if resp.Error != nil {
+		t.Fatalf("error: %v", resp.Error.Message)
+	}
+	raw, _ := json.Marshal(resp.Result)
+	var got struct {
+		Transactions []struct {
+			DecodedPayload core.TransferPayload `json:"decoded_payload"`
+		} `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Transactions) != 1 {
+		t.Fatalf("transactions: got %d want 1", len(got.Transactions))
+	}
+	if p := got.Transactions[0].DecodedPayload; p.To != recipient.PubKey() || p.Amount != 42 {
+		t.Errorf("decoded payload: got %+v", p)
+	}
+}
+
+// startTestRPCServer serves handler on a random port and returns its URL.
+func startTestRPCServer(t *testing.T, handler *rpc.Handler) string {
+	t.Helper()
+	server := rpc.NewServer("127.0.0.1:0", handler, "")
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	return "http://" + server.Addr().String()
+}
+
+// TestRPCNotification verifies that an id-less request is dispatched but
+// produces no response body, and is omitted from batch responses.
+func TestRPCNotification(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	url := startTestRPCServer(t, handler)
+
+	w, _ := wallet.Generate()
+	tx, _ := w.Transfer(testChainID, w.PubKey(), 1, 0, 0)
+	note, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": "sendTx", "params": tx})
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(note))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || len(body) != 0 {
+		t.Errorf("notification: got status %d body %q, want 204 and no body", resp.StatusCode, body)
+	}
+	if size := rpcCall(t, url, "getMempoolSize", nil); string(size) != "1" {
+		t.Errorf("notification was not dispatched: mempool size %s", size)
+	}
+
+	batch := `[{"jsonrpc":"2.0","method":"getMempoolSize"},{"jsonrpc":"2.0","method":"getBlockHeight","id":7}]`
+	resp, err = http.Post(url, "application/json", strings.NewReader(batch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out []rpc.Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].ID != float64(7) {
+		t.Errorf("batch: got %+v, want only the response for id 7", out)
+	}
+
+	call := `{"jsonrpc":"2.0","method":"getBlockHeight","id":1}`
+	oversized := "[" + strings.Repeat(call+",", rpc.MaxBatchSize) + call + "]"
+	resp, err = http.Post(url, "application/json", strings.NewReader(oversized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var refused rpc.Response
+	if err := json.NewDecoder(resp.Body).Decode(&refused); err != nil {
+		t.Fatal(err)
+	}
+	if refused.Error == nil || refused.Error.Code != rpc.CodeInvalidRequest {
+		t.Errorf("batch over MaxBatchSize: got %+v, want an invalid request error", refused)
+	}
+}
+
+// TestRPCDispatchCancellation verifies that cancelling the request context
+// aborts a long-running method promptly.
+func TestRPCDispatchCancellation(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	handler.RegisterMethod("slowScan", func(ctx context.Context, req rpc.Request) rpc.Response {
+		select {
+		case <-ctx.Done():
+			return rpc.Response{JSONRPC: "2.0", ID: req.ID, Error: &rpc.Error{Code: rpc.CodeRequestCancelled, Message: ctx.Err().Error()}}
+		case <-time.After(5 * time.Second):
+			return rpc.Response{JSONRPC: "2.0", ID: req.ID, Result: "done"}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	resp := handler.Dispatch(ctx, rpc.Request{JSONRPC: "2.0", ID: 1, Method: "slowScan"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled method ran for %s", elapsed)
+	}
+	if resp.Error == nil || resp.Error.Code != rpc.CodeRequestCancelled {
+		t.Errorf("expected cancellation error, got %+v", resp)
+	}
+
+	// An already-cancelled context is rejected before dispatch.
+	resp = handler.Dispatch(ctx, rpc.Request{JSONRPC: "2.0", ID: 2, Method: "getBlockHeight"})
+	if resp.Error == nil || resp.Error.Code != rpc.CodeRequestCancelled {
+		t.Errorf("expected cancellation error for cancelled context, got %+v", resp)
+	}
+}
+
+// TestRPCRequestTimeout verifies that a method outliving the server's
+// request timeout is answered with a timeout error instead of hanging the
+// client, and that slow requests are logged with their method name.
+func TestRPCRequestTimeout(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	release := make(chan struct{})
+	defer close(release)
+	handler.RegisterMethod("stall", func(_ context.Context, req rpc.Request) rpc.Response {
+		<-release // ignores its context
+		return rpc.Response{JSONRPC: "2.0", ID: req.ID, Result: "done"}
+	})
+	server := rpc.NewServer("127.0.0.1:0", handler, "")
+	server.SetRequestTimeout(100*time.Millisecond, 50*time.Millisecond)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Stop() })
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	start := time.Now()
+	body := `{"jsonrpc":"2.0","method":"stall","id":1}`
+	resp, err := http.Post("http://"+server.Addr().String(), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out rpc.Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed-out request took %s", elapsed)
+	}
+	if out.Error == nil || out.Error.Code != rpc.CodeRequestTimeout {
+		t.Fatalf("got %+v, want a timeout error", out)
+	}
+	if !strings.Contains(logs.String(), "slow request: stall") {
+		t.Errorf("slow request not logged: %q", logs.String())
+	}
+}
+
+// TestRPCAllowedMethods verifies that a listener with a method allow-list
+// rejects other methods while an unrestricted listener over the same
+// handler serves them.
+func TestRPCAllowedMethods(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	public := rpc.NewServer("127.0.0.1:0", handler, "")
+	public.SetAllowedMethods([]string{"getBlockHeight", "getBalance"})
+	internal := rpc.NewServer("127.0.0.1:0", handler, "")
+	for _, s := range []*rpc.Server{public, internal} {
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Stop() })
+	}
+
+	call := func(s *rpc.Server, method string) rpc.Response {
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"id":1}`, method)
+		resp, err := http.Post("http://"+s.Addr().String(), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out rpc.Response
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if out := call(public, "getBlockHeight"); out.Error != nil {
+		t.Errorf("public getBlockHeight: %v", out.Error.Message)
+	}
+	if out := call(public, "getMempoolSize"); out.Error == nil || out.Error.Code != rpc.CodeMethodNotAllowed {
+		t.Errorf("public getMempoolSize: got %+v, want CodeMethodNotAllowed", out)
+	}
+	if out := call(internal, "getMempoolSize"); out.Error != nil {
+		t.Errorf("internal getMempoolSize: %v", out.Error.Message)
+	}
+}
+
+// TestRPCUnixSocket verifies that the RPC server answers on a Unix socket,
+// optionally without bearer auth, and removes the socket file on stop.
+func TestRPCUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "rpc.sock")
+	server := rpc.NewServer("", newTestRPCHandler(t), "secret")
+	server.EnableUnixSocket(sock, true)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	body := `{"jsonrpc":"2.0","method":"getBlockHeight","id":1}`
+	resp, err := client.Post("http://unix/", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out rpc.Response
+	json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	if out.Error != nil {
+		t.Fatalf("error: %v", out.Error.Message)
+	}
+	if out.Result != float64(0) {
+		t.Errorf("height: got %v want 0", out.Result)
+	}
+
+	if err := server.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+}
+
+// TestRPCGetStateRootProof verifies that a hand-built Merkle inclusion proof
+// for an account checks out against the root returned by getStateRoot.
+func TestRPCGetStateRootProof(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	bc := core.NewBlockchain(testutil.NewMemBlockStore())
+	handler := rpc.NewHandler(bc, core.NewMempool(), state, indexer.New(db, events.NewEmitter()), testChainID)
+
+	// Three accounts with addresses chosen so the sorted leaf order is known.
+	accounts := []*core.Account{
+		{Address: "a", Balance: 10},
+		{Address: "b", Balance: 20},
+		{Address: "c", Balance: 30},
+	}
+	leaves := make([][]byte, len(accounts))
+	for i, acc := range accounts {
+		state.SetAccount(acc)
+		value, _ := json.Marshal(acc)
+		leaves[i] = crypto.MerkleLeaf([]byte("acct:"+acc.Address), value)
+	}
+	proposer, _ := wallet.Generate()
+	block := core.NewBlock(testChainID, 0, "", proposer.PubKey(), nil)
+	stateRoot, err := state.ComputeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Header.StateRoot = stateRoot
+	block.Sign(proposer.PrivKey())
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := dispatch(handler, "getStateRoot", nil)
+	if resp.Error != nil {
+		t.Fatalf("error: %v", resp.Error.Message)
+	}
+	root := resp.Result.(map[string]any)["state_root"].(string)
+
+	// Tree shape for three leaves: root = node(node(L0, L1), L2).
+	// Proof for "c" (L2) is the single left sibling node(L0, L1).
+	left := crypto.MerkleNode(leaves[0], leaves[1])
+	proof := []crypto.MerkleStep{{Hash: hex.EncodeToString(left), Left: true}}
+	if !crypto.VerifyMerkleProof(root, leaves[2], proof) {
+		t.Fatal("manual proof for account c does not verify against state root")
+	}
+	// Proof for "a" (L0): right sibling L1, then right sibling L2.
+	proof = []crypto.MerkleStep{
+		{Hash: hex.EncodeToString(leaves[1])},
+		{Hash: hex.EncodeToString(leaves[2])},
+	}
+	if !crypto.VerifyMerkleProof(root, leaves[0], proof) {
+		t.Fatal("manual proof for account a does not verify against state root")
+	}
+
+	// A tampered balance must not verify.
+	forged, _ := json.Marshal(&core.Account{Address: "a", Balance: 1_000_000})
+	if crypto.VerifyMerkleProof(root, crypto.MerkleLeaf([]byte("acct:a"), forged), proof) {
+		t.Error("proof verified for a forged account value")
+	}
+}
+
+// TestRPCEstimateFee verifies that estimateFee returns the floor for an empty
+// mempool and otherwise tracks the configured percentile of pending fees.
+func TestRPCEstimateFee(t *testing.T) {
+	db := testutil.NewMemDB()
+	mp := core.NewMempool()
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+	handler.SetFeePolicy(3, 90)
+
+	estimate := func() uint64 {
+		resp := dispatch(handler, "estimateFee", nil)
+		if resp.Error != nil {
+			t.Fatalf("error: %v", resp.Error.Message)
+		}
+		return resp.Result.(map[string]any)["fee"].(uint64)
+	}
+	if fee := estimate(); fee != 3 {
+		t.Errorf("empty mempool: got %d want floor 3", fee)
+	}
+
+	w, _ := wallet.Generate()
+	for i := uint64(1); i <= 20; i++ {
+		tx, _ := w.Transfer(testChainID, w.PubKey(), 1, i, i*10)
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Fees 10..200; the 90th percentile (nearest rank 18) is 180.
+	if fee := estimate(); fee != 180 {
+		t.Errorf("populated mempool: got %d want 180", fee)
+	}
+}
+
+// TestRPCGetEventsByType verifies that emitted events are persisted by the
+// event log and can be read back filtered by type and height range, and that
+// retention prunes old heights.
+func TestRPCGetEventsByType(t *testing.T) {
+	db := testutil.NewMemDB()
+	emitter := events.NewEmitter()
+	evlog := indexer.NewEventLog(db, emitter, 2)
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), storage.NewStateDB(db), indexer.New(db, emitter), testChainID)
+	handler.SetEventLog(evlog)
+
+	for h := int64(1); h <= 3; h++ {
+		emitter.Emit(events.Event{Type: events.EventTokenTransfer, TxID: "a", BlockHeight: h, Data: map[string]any{"amount": 1}})
+		emitter.Emit(events.Event{Type: events.EventAssetMinted, TxID: "b", BlockHeight: h})
+		emitter.Emit(events.Event{Type: events.EventTokenTransfer, TxID: "c", BlockHeight: h})
+		emitter.Emit(events.Event{Type: events.EventBlockCommit, BlockHeight: h})
+	}
+
+	getEvents := func(params map[string]any) []events.Event {
+		resp := dispatch(handler, "getEvents", params)
+		if resp.Error != nil {
+			t.Fatalf("getEvents: %v", resp.Error.Message)
+		}
+		return resp.Result.([]events.Event)
+	}
+
+	// Height 1 was pruned once height 3 committed (retention 2).
+	got := getEvents(map[string]any{"type": "token_transfer"})
+	var ids []string
+	for _, ev := range got {
+		if ev.Type != events.EventTokenTransfer {
+			t.Errorf("unexpected type %s", ev.Type)
+		}
+		ids = append(ids, fmt.Sprintf("%d/%s", ev.BlockHeight, ev.TxID))
+	}
+	if want := "2/a 2/c 3/a 3/c"; strings.Join(ids, " ") != want {
+		t.Errorf("events: got %v want %s", ids, want)
+	}
+
+	if got := getEvents(map[string]any{"type": "token_transfer", "from_height": 3, "to_height": 3, "limit": 1}); len(got) != 1 || got[0].TxID != "a" || got[0].BlockHeight != 3 {
+		t.Errorf("height-limited query: got %+v", got)
+	}
+	if got := getEvents(map[string]any{"type": "asset_minted", "to_height": 2}); len(got) != 1 || got[0].BlockHeight != 2 {
+		t.Errorf("asset_minted up to height 2: got %+v", got)
+	}
+}
+
+// TestRPCSendTxDisabledType verifies that a node enabling only transfers
+// rejects a session_open transaction at submission and during execution.
+func TestRPCSendTxDisabledType(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	exec := vm.NewExecutor(state, nil)
+	if err := exec.SetEnabledTxTypes([]core.TxType{core.TxTransfer}); err != nil {
+		t.Fatal(err)
+	}
+	mp := core.NewMempool()
+	mp.SetValidator(exec.CheckTx)
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, state, indexer.New(db, events.NewEmitter()), testChainID)
+
+	w, _ := wallet.Generate()
+	session, _ := w.NewTx(testChainID, core.TxSessionOpen, 0, 0, core.SessionOpenPayload{GameID: "g", Players: []string{w.PubKey()}})
+	resp := dispatch(handler, "sendTx", session)
+	if resp.Error == nil || !strings.Contains(resp.Error.Message, "disabled") {
+		t.Fatalf("session_open: expected disabled-type error, got %+v", resp)
+	}
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", w.PubKey(), nil), session); err == nil {
+		t.Error("executor should reject a disabled tx type")
+	}
+
+	transfer, _ := w.Transfer(testChainID, w.PubKey(), 1, 0, 0)
+	if resp := dispatch(handler, "sendTx", transfer); resp.Error != nil {
+		t.Fatalf("transfer: %v", resp.Error.Message)
+	}
+	if err := exec.SetEnabledTxTypes([]core.TxType{"no_such_type"}); err == nil {
+		t.Error("enabling an unregistered type should fail")
+	}
+}
+
+// TestRPCGetBalanceCommittedView verifies that getBalance serves committed
+// state by default and only exposes uncommitted writes with pending=true.
+func TestRPCGetBalanceCommittedView(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), state, indexer.New(db, events.NewEmitter()), testChainID)
+
+	balance := func(pending bool) uint64 {
+		resp := dispatch(handler, "getBalance", map[string]any{"address": "alice", "pending": pending})
+		if resp.Error != nil {
+			t.Fatalf("getBalance: %v", resp.Error.Message)
+		}
+		return resp.Result.(map[string]any)["balance"].(uint64)
+	}
+
+	_ = state.SetAccount(&core.Account{Address: "alice", Balance: 42}) // buffered, not committed
+	if got := balance(false); got != 0 {
+		t.Errorf("committed view sees uncommitted write: balance %d", got)
+	}
+	if got := balance(true); got != 42 {
+		t.Errorf("pending view: got %d want 42", got)
+	}
+	if err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := balance(false); got != 42 {
+		t.Errorf("committed view after commit: got %d want 42", got)
+	}
+}
+
+// TestRPCSendTxVerifyErrorCodes verifies that sendTx reports each
+// transaction verification failure with its own error code.
+func TestRPCSendTxVerifyErrorCodes(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	w, _ := wallet.Generate()
+	cases := []struct {
+		name   string
+		mutate func(tx *core.Transaction)
+		code   int
+	}{
+		{"missing from", func(tx *core.Transaction) { tx.From = "" }, rpc.CodeTxMissingFrom},
+		{"bad pubkey", func(tx *core.Transaction) { tx.From = "abcd" }, rpc.CodeTxBadPubkey},
+		{"bad signature", func(tx *core.Transaction) { tx.Fee = 7 }, rpc.CodeTxBadSignature},
+	}
+	for _, c := range cases {
+		tx, _ := w.Transfer(testChainID, w.PubKey(), 1, 0, 0)
+		c.mutate(tx)
+		resp := dispatch(handler, "sendTx", tx)
+		if resp.Error == nil || resp.Error.Code != c.code {
+			t.Errorf("%s: got %+v want code %d", c.name, resp.Error, c.code)
+		}
+	}
+}
+
+// TestRPCSendTxClientErrors verifies that transactions the mempool refuses
+// for what they contain are reported as client errors rather than
+// CodeInternalError.
+func TestRPCSendTxClientErrors(t *testing.T) {
+	db := testutil.NewMemDB()
+	mp := core.NewMempool()
+	mp.SetValidator(func(tx *core.Transaction) error {
+		if tx.Fee < 5 {
+			return errors.New("fee below the minimum 5")
+		}
+		return nil
+	})
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+	w, _ := wallet.Generate()
+	signed := func(nonce, fee uint64, mutate func(*core.Transaction)) *core.Transaction {
+		tx, _ := w.Transfer(testChainID, w.PubKey(), 1, nonce, fee)
+		mutate(tx)
+		tx.Sign(w.PrivKey())
+		return tx
+	}
+	none := func(*core.Transaction) {}
+
+	tampered := signed(0, 5, none)
+	tampered.Payload = json.RawMessage(`{"to":"` + w.PubKey() + `","amount":1000}`)
+	accepted := signed(1, 5, none)
+	if resp := dispatch(handler, "sendTx", accepted); resp.Error != nil {
+		t.Fatalf("valid tx: %+v", resp.Error)
+	}
+	cases := []struct {
+		name string
+		tx   *core.Transaction
+		code int
+	}{
+		{"tampered payload", tampered, rpc.CodeTxBadSignature},
+		{"expired", signed(2, 5, func(tx *core.Transaction) { tx.Timestamp -= int64(2 * time.Hour) }), rpc.CodeInvalidParams},
+		{"future", signed(2, 5, func(tx *core.Transaction) { tx.Timestamp += int64(time.Hour) }), rpc.CodeInvalidParams},
+		{"rejected by validator", signed(2, 1, none), rpc.CodeInvalidParams},
+		{"duplicate", accepted, rpc.CodeInvalidParams},
+	}
+	for _, c := range cases {
+		resp := dispatch(handler, "sendTx", c.tx)
+		if resp.Error == nil || resp.Error.Code != c.code {
+			t.Errorf("%s: got %+v want code %d", c.name, resp.Error, c.code)
+		}
+	}
+}
+
+// TestRPCGetTransactionsBySenderAndType verifies that executed transactions
+// are indexed by sender and type, returned in height order with pagination,
+// and that each list is bounded by the index limit.
+func TestRPCGetTransactionsBySenderAndType(t *testing.T) {
+	db := testutil.NewMemDB()
+	emitter := events.NewEmitter()
+	txidx := indexer.NewTxIndex(db, emitter, 3)
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), storage.NewStateDB(db), indexer.New(db, emitter), testChainID)
+	handler.SetTxIndex(txidx)
+
+	executed := func(id string, height int64, typ core.TxType, from string) {
+		emitter.Emit(events.Event{Type: events.EventTxExecuted, TxID: id, BlockHeight: height, Data: map[string]any{"type": string(typ), "from": from}})
+	}
+	executed("t1", 1, core.TxTransfer, "alice")
+	executed("m1", 1, core.TxMintAsset, "bob")
+	executed("t2", 2, core.TxTransfer, "bob")
+	executed("t3", 3, core.TxTransfer, "alice")
+	executed("t4", 4, core.TxTransfer, "alice")
+	executed("t5", 5, core.TxTransfer, "alice")
+
+	query := func(method string, params map[string]any) string {
+		resp := dispatch(handler, method, params)
+		if resp.Error != nil {
+			t.Fatalf("%s: %v", method, resp.Error.Message)
+		}
+		var ids []string
+		for _, ref := range resp.Result.([]indexer.TxRef) {
+			ids = append(ids, fmt.Sprintf("%d/%s", ref.Height, ref.TxID))
+		}
+		return strings.Join(ids, " ")
+	}
+
+	// t1 was dropped once alice's list exceeded the limit of 3.
+	if got, want := query("getTransactionsBySender", map[string]any{"sender": "alice"}), "3/t3 4/t4 5/t5"; got != want {
+		t.Errorf("by sender: got %q want %q", got, want)
+	}
+	if got, want := query("getTransactionsBySender", map[string]any{"sender": "bob"}), "1/m1 2/t2"; got != want {
+		t.Errorf("bob: got %q want %q", got, want)
+	}
+	if got, want := query("getTransactionsByType", map[string]any{"type": "transfer", "offset": 1, "limit": 1}), "4/t4"; got != want {
+		t.Errorf("by type page: got %q want %q", got, want)
+	}
+	if got, want := query("getTransactionsByType", map[string]any{"type": "mint_asset"}), "1/m1"; got != want {
+		t.Errorf("mints: got %q want %q", got, want)
+	}
+	if got := query("getTransactionsBySender", map[string]any{"sender": "carol"}); got != "" {
+		t.Errorf("unknown sender: got %q", got)
+	}
+	if resp := dispatch(handler, "getTransactionsByType", map[string]any{}); resp.Error == nil || resp.Error.Code != rpc.CodeInvalidParams {
+		t.Errorf("missing type: got %+v", resp.Error)
+	}
+}
+
+// TestRPCFaucet verifies that a faucet claim submits a signed transfer from
+// the faucet account, that a repeat claim within the interval is rate
+// limited, and that the faucet is unavailable unless configured.
+func TestRPCFaucet(t *testing.T) {
+	handler := newTestRPCHandler(t)
+	if resp := dispatch(handler, "faucet", map[string]string{"address": "x"}); resp.Error == nil || resp.Error.Code != rpc.CodeMethodNotFound {
+		t.Fatalf("disabled faucet: got %+v", resp.Error)
+	}
+
+	db := testutil.NewMemDB()
+	mp := core.NewMempool()
+	handler = rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+	treasury, _ := wallet.Generate()
+	handler.SetFaucet(rpc.NewFaucet(treasury.PrivKey(), 50, 10))
+	dev, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+
+	resp := dispatch(handler, "faucet", map[string]string{"address": dev.PubKey()})
+	if resp.Error != nil {
+		t.Fatalf("faucet claim: %v", resp.Error.Message)
+	}
+	txID := resp.Result.(map[string]any)["tx_id"].(string)
+	tx, ok := mp.Get(txID)
+	if !ok {
+		t.Fatal("faucet tx not in mempool")
+	}
+	var p core.TransferPayload
+	_ = json.Unmarshal(tx.Payload, &p)
+	if tx.From != treasury.PubKey() || p.To != dev.PubKey() || p.Amount != 50 || tx.Nonce != 0 {
+		t.Errorf("faucet tx: from %s to %s amount %d nonce %d", tx.From, p.To, p.Amount, tx.Nonce)
+	}
+
+	if resp := dispatch(handler, "faucet", map[string]string{"address": dev.PubKey()}); resp.Error == nil || resp.Error.Code != rpc.CodeRateLimited {
+		t.Errorf("repeat claim: expected rate limit, got %+v", resp.Error)
+	}
+
+	// Another address may claim; its transfer follows the pending one.
+	resp = dispatch(handler, "faucet", map[string]string{"address": other.PubKey()})
+	if resp.Error != nil {
+		t.Fatalf("second address claim: %v", resp.Error.Message)
+	}
+	if tx, _ := mp.Get(resp.Result.(map[string]any)["tx_id"].(string)); tx == nil || tx.Nonce != 1 {
+		t.Errorf("second faucet tx nonce: got %+v want 1", tx)
+	}
+}
+
+// TestRPCFaucetPaysMinFee verifies that a node whose chain charges a
+// minimum transfer fee has its faucet pay it, so claims pass the mempool's
+// fee check.
+func TestRPCFaucetPaysMinFee(t *testing.T) {
+	validator, _ := wallet.Generate()
+	treasury, _ := wallet.Generate()
+	dev, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+	cfg.Genesis.Alloc[treasury.PubKey()] = 1000
+	cfg.MinFees = map[string]uint64{string(core.TxTransfer): 3}
+	cfg.Faucet, cfg.FaucetAmount = true, 50
+
+	rt := node.New(cfg, validator.PrivKey(), testutil.NewMemDB(), testutil.NewMemBlockStore())
+	rt.SetFaucetKey(treasury.PrivKey())
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Stop(context.Background())
+	url := fmt.Sprintf("http://%s", rt.RPCAddr())
+
+	rpcCall(t, url, "faucet", map[string]string{"address": dev.PubKey()})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var bal struct {
+			Balance uint64 `json:"balance"`
+		}
+		_ = json.Unmarshal(rpcCall(t, url, "getBalance", map[string]string{"address": treasury.PubKey()}), &bal)
+		if bal.Balance == 1000-50-3 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("faucet claim was not mined with the minimum fee (treasury balance %d)", bal.Balance)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestRPCGetPendingNonce verifies that getPendingNonce advances the
+// committed nonce past consecutive pending transactions and stops at a gap.
+func TestRPCGetPendingNonce(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	mp := core.NewMempool()
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, state, indexer.New(db, events.NewEmitter()), testChainID)
+	sender, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000, Nonce: 5})
+	if err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := func() uint64 {
+		t.Helper()
+		resp := dispatch(handler, "getPendingNonce", map[string]string{"address": sender.PubKey()})
+		if resp.Error != nil {
+			t.Fatalf("getPendingNonce: %v", resp.Error.Message)
+		}
+		return resp.Result.(map[string]any)["nonce"].(uint64)
+	}
+	submit := func(n uint64) {
+		t.Helper()
+		tx, _ := sender.Transfer(testChainID, recipient.PubKey(), 1, n, 0)
+		if err := mp.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := nonce(); got != 5 {
+		t.Errorf("no pending txs: got %v want 5", got)
+	}
+	submit(5)
+	submit(6)
+	submit(8) // gap at 7
+	if got := nonce(); got != 7 {
+		t.Errorf("pending 5,6,8: got %v want 7", got)
+	}
+	if resp := dispatch(handler, "getPendingNonce", map[string]string{}); resp.Error == nil || resp.Error.Code != rpc.CodeInvalidParams {
+		t.Errorf("missing address: got %+v", resp.Error)
+	}
+}
+
+// TestRPCDropTx verifies that dropTx removes a pending transaction from the
+// mempool and reports whether it was present, and that it is refused
+// without the admin token.
+func TestRPCDropTx(t *testing.T) {
+	db := testutil.NewMemDB()
+	mp := core.NewMempool()
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), mp, storage.NewStateDB(db), indexer.New(db, events.NewEmitter()), testChainID)
+	server := rpc.NewServer("127.0.0.1:0", handler, "user-token")
+	server.SetAdminToken("admin-token")
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Stop() })
+	url := "http://" + server.Addr().String()
+
+	sender, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	tx, _ := sender.Transfer(testChainID, recipient.PubKey(), 1, 0, 0)
+	if err := mp.Add(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	drop := func(token string) rpc.Response {
+		t.Helper()
+		body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"dropTx","params":{"id":%q}}`, tx.ID)
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		httpResp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		var resp rpc.Response
+		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := drop("user-token"); resp.Error == nil || resp.Error.Code != rpc.CodeUnauthorized {
+		t.Fatalf("dropTx with the user token: got %+v want unauthorized", resp.Error)
+	}
+	if mp.Size() != 1 {
+		t.Fatal("unauthorized dropTx removed the transaction")
+	}
+
+	resp := drop("admin-token")
+	if resp.Error != nil {
+		t.Fatalf("dropTx: %v", resp.Error.Message)
+	}
+	if dropped := resp.Result.(map[string]any)["dropped"]; dropped != true {
+		t.Errorf("dropped: got %v want true", dropped)
+	}
+	if mp.Size() != 0 || len(mp.Pending(10)) != 0 {
+		t.Errorf("mempool after dropTx: size %d, pending %d", mp.Size(), len(mp.Pending(10)))
+	}
+
+	resp = drop("admin-token")
+	if resp.Error != nil || resp.Result.(map[string]any)["dropped"] != false {
+		t.Errorf("dropping an absent tx: got %+v", resp)
+	}
+}
+
+// TestRPCGetOpenSessions verifies that getOpenSessions lists sessions
+// opened on chain and drops them once they close, returning an empty array
+// when none are open.
+func TestRPCGetOpenSessions(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	emitter := events.NewEmitter()
+	handler := rpc.NewHandler(core.NewBlockchain(testutil.NewMemBlockStore()), core.NewMempool(), state, indexer.New(db, emitter), testChainID)
+	exec := vm.NewExecutor(state, emitter)
+
+	open := func() []string {
+		t.Helper()
+		resp := dispatch(handler, "getOpenSessions", map[string]any{})
+		if resp.Error != nil {
+			t.Fatalf("getOpenSessions: %v", resp.Error.Message)
+		}
+		return resp.Result.([]string)
+	}
+	if ids := open(); ids == nil || len(ids) != 0 {
+		t.Fatalf("no sessions: got %#v want empty array", ids)
+	}
+
+	server, _ := wallet.Generate()
+	player, _ := wallet.Generate()
+	block := core.NewBlock(testChainID, 1, "prev", server.PubKey(), nil)
+	nonce := uint64(0)
+	run := func(typ core.TxType, payload any) {
+		t.Helper()
+		tx, _ := server.NewTx(testChainID, typ, nonce, 0, payload)
+		if err := exec.ExecuteTx(block, tx); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		nonce++
+	}
+	for _, id := range []string{"match-1", "match-2"} {
+		run(core.TxSessionOpen, core.SessionOpenPayload{SessionID: id, GameID: "g", Players: []string{player.PubKey()}})
+	}
+	if ids := open(); !reflect.DeepEqual(ids, []string{"match-1", "match-2"}) {
+		t.Fatalf("two open sessions: got %v", ids)
+	}
+
+	run(core.TxSessionResult, core.SessionResultPayload{SessionID: "match-1", Outcome: map[string]uint64{}})
+	if ids := open(); !reflect.DeepEqual(ids, []string{"match-2"}) {
+		t.Errorf("after closing match-1: got %v want [match-2]", ids)
+	}
+	resp := dispatch(handler, "getOpenSessions", map[string]any{"offset": 1})
+	if ids := resp.Result.([]string); len(ids) != 0 {
+		t.Errorf("offset past the end: got %v", ids)
+	}
+}
+
+// TestRPCMaxConnections verifies that a connection opened while the server
+// already holds its limit gets 503, and that closing a connection frees a
+// slot.
+func TestRPCMaxConnections(t *testing.T) {
+	server := rpc.NewServer("127.0.0.1:0", newTestRPCHandler(t), "")
+	server.SetMaxConnections(2)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	addr := server.Addr().String()
+	body := `{"jsonrpc":"2.0","id":1,"method":"getBlockHeight"}`
+
+	// post sends one request on conn and returns the response status.
+	post := func(conn net.Conn) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://"+addr, strings.NewReader(body))
+		if err := req.Write(conn); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	dial := func() net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// Two keep-alive connections, each proven accepted by a request.
+	held := []net.Conn{dial(), dial()}
+	for i, conn := range held {
+		defer conn.Close()
+		if status := post(conn); status != http.StatusOK {
+			t.Fatalf("connection %d: status %d", i, status)
+		}
+	}
+	extra := dial()
+	if status := post(extra); status != http.StatusServiceUnavailable {
+		t.Errorf("third connection: got %d want 503", status)
+	}
+	extra.Close()
+
+	held[0].Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		conn := dial()
+		status := post(conn)
+		conn.Close()
+		if status == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("closing a connection did not free a slot (status %d)", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestPauseNode verifies that a node paused through the pauseNode admin
+// method neither produces blocks nor accepts sendTx, while reads keep
+// working, and that resumeNode restores both.
+func TestPauseNode(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	chain, _ := newTestChain(t, cfg, validator, nil)
+	handler := rpc.NewHandler(chain.bc, chain.mempool, chain.state, nil, testChainID)
+	handler.SetPauser(chain.poa)
+	admin := func(method string) rpc.Response {
+		return handler.Dispatch(rpc.WithAdmin(context.Background()), rpc.Request{JSONRPC: "2.0", ID: 1, Method: method})
+	}
+
+	if resp := dispatch(handler, "pauseNode", nil); resp.Error == nil || resp.Error.Code != rpc.CodeUnauthorized {
+		t.Fatalf("pauseNode without admin: got %+v want unauthorized", resp.Error)
+	}
+	if resp := admin("pauseNode"); resp.Error != nil || resp.Result.(map[string]bool)["paused"] != true {
+		t.Fatalf("pauseNode: %+v", resp)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go chain.poa.Run(10*time.Millisecond, done)
+	time.Sleep(150 * time.Millisecond)
+	if h := chain.bc.Height(); h != 0 {
+		t.Fatalf("paused node produced up to height %d", h)
+	}
+	recipient, _ := wallet.Generate()
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 1, 0, 0)
+	if resp := dispatch(handler, "sendTx", tx); resp.Error == nil || resp.Error.Code != rpc.CodeNodePaused {
+		t.Fatalf("sendTx while paused: got %+v want CodeNodePaused", resp.Error)
+	}
+	if resp := dispatch(handler, "getBalance", map[string]string{"address": validator.PubKey()}); resp.Error != nil {
+		t.Errorf("read while paused: %v", resp.Error.Message)
+	}
+
+	if resp := admin("resumeNode"); resp.Error != nil || resp.Result.(map[string]bool)["paused"] != false {
+		t.Fatalf("resumeNode: %+v", resp)
+	}
+	if resp := dispatch(handler, "sendTx", tx); resp.Error != nil {
+		t.Fatalf("sendTx after resume: %v", resp.Error.Message)
+	}
+	if !waitHeight(t, chain, 1, 5*time.Second) {
+		t.Fatal("node did not produce after resume")
+	}
+}
+
+// TestProposerScheduleRPC verifies that getValidators reports the weighted
+// validator set and that getProposerSchedule matches the proposers the
+// consensus engine derives for the next heights.
+func TestProposerScheduleRPC(t *testing.T) {
+	a, _ := wallet.Generate()
+	b, _ := wallet.Generate()
+	cfg := newTestConfig(a)
+	cfg.Validators = []config.Validator{{PubKey: a.PubKey(), Weight: 2}, {PubKey: b.PubKey()}}
+	chain, _ := newTestChain(t, cfg, a, nil)
+	handler := rpc.NewHandler(chain.bc, chain.mempool, chain.state, nil, testChainID)
+	handler.SetValidators([]string{a.PubKey(), b.PubKey()})
+	handler.SetProposerSchedule(chain.poa)
+
+	resp := dispatch(handler, "getValidators", nil)
+	if resp.Error != nil {
+		t.Fatal(resp.Error.Message)
+	}
+	raw, _ := json.Marshal(resp.Result)
+	var vals []struct {
+		PubKey string `json:"pubkey"`
+		Weight int    `json:"weight"`
+	}
+	json.Unmarshal(raw, &vals)
+	if len(vals) != 2 || vals[0].PubKey != a.PubKey() || vals[0].Weight != 2 || vals[1].Weight != 1 {
+		t.Errorf("getValidators: %s", raw)
+	}
+
+	resp = dispatch(handler, "getProposerSchedule", map[string]any{"count": 6})
+	if resp.Error != nil {
+		t.Fatal(resp.Error.Message)
+	}
+	raw, _ = json.Marshal(resp.Result)
+	var turns []struct {
+		Height   int64  `json:"height"`
+		Proposer string `json:"proposer"`
+	}
+	json.Unmarshal(raw, &turns)
+	tip := chain.bc.Tip()
+	if len(turns) != 6 {
+		t.Fatalf("schedule: %s", raw)
+	}
+	for i, turn := range turns {
+		height := tip.Header.Height + 1 + int64(i)
+		if want := chain.poa.ProposerFor(height, tip.Hash); turn.Height != height || turn.Proposer != want {
+			t.Errorf("turn %d: got %+v want height %d proposer %s", i, turn, height, want)
+		}
+	}
+	if isA := turns[0].Proposer == a.PubKey(); isA != chain.poa.IsProposer() {
+		t.Errorf("first turn %s disagrees with IsProposer %v", turns[0].Proposer, chain.poa.IsProposer())
+	}
+}
@@ -0,0 +1,277 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tolelom/tolchain/config"
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/node"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// TestRuntimeStartStop verifies that a Runtime starts all subsystems,
+// produces blocks and shuts down cleanly within the timeout.
+func TestRuntimeStartStop(t *testing.T) {
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+
+	rt := node.New(cfg, validator.PrivKey(), testutil.NewMemDB(), testutil.NewMemBlockStore())
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("http://%s", rt.RPCAddr())
+
+	deadline := time.Now().Add(3 * time.Second)
+	for rt.Blockchain().Height() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("runtime produced no blocks")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if h := rpcCall(t, url, "getBlockHeight", nil); string(h) == "0" {
+		t.Error("RPC not serving the running chain")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rt.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	// Consensus has drained: no further blocks after Stop returns.
+	height := rt.Blockchain().Height()
+	time.Sleep(150 * time.Millisecond)
+	if got := rt.Blockchain().Height(); got != height {
+		t.Errorf("height advanced after stop: %d → %d", height, got)
+	}
+	if _, err := http.Post(url, "application/json", strings.NewReader("{}")); err == nil {
+		t.Error("RPC still accepting connections after stop")
+	}
+}
+
+// TestRuntimeChainIDMismatch verifies that a node refuses to start on data
+// created for a different chain_id.
+func TestRuntimeChainIDMismatch(t *testing.T) {
+	validator, _ := wallet.Generate()
+	db, blocks := testutil.NewMemDB(), testutil.NewMemBlockStore()
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+
+	rt := node.New(cfg, validator.PrivKey(), db, blocks)
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestConfig(validator)
+	other.Genesis.ChainID = "other-chain"
+	err := node.New(other, validator.PrivKey(), db, blocks).Start()
+	if !errors.Is(err, core.ErrChainIDMismatch) {
+		t.Fatalf("start with foreign chain_id: got %v want ErrChainIDMismatch", err)
+	}
+}
+
+// TestRuntimeStateRootVersionMismatch verifies that the genesis block
+// records the state root version and that a node configured with another
+// version refuses to start on that chain's data.
+func TestRuntimeStateRootVersionMismatch(t *testing.T) {
+	validator, _ := wallet.Generate()
+	db, blocks := testutil.NewMemDB(), testutil.NewMemBlockStore()
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+	cfg.Genesis.StateRootVersion = core.StateRootFlat
+
+	rt := node.New(cfg, validator.PrivKey(), db, blocks)
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := rt.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Header.StateRootVersion != core.StateRootFlat {
+		t.Errorf("genesis state_root_version: got %d want %d", genesis.Header.StateRootVersion, core.StateRootFlat)
+	}
+	if err := rt.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestConfig(validator)
+	err = node.New(other, validator.PrivKey(), db, blocks).Start()
+	if !errors.Is(err, core.ErrStateRootVersionMismatch) {
+		t.Fatalf("start with default state_root_version: got %v want ErrStateRootVersionMismatch", err)
+	}
+}
+
+// TestRuntimeParamsMismatch verifies that the genesis block records the
+// consensus params hash and that a node restarted with other execution
+// settings refuses to start on that chain's data.
+func TestRuntimeParamsMismatch(t *testing.T) {
+	validator, _ := wallet.Generate()
+	db, blocks := testutil.NewMemDB(), testutil.NewMemBlockStore()
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+	cfg.BlockReward = 5
+
+	rt := node.New(cfg, validator.PrivKey(), db, blocks)
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := rt.Blockchain().GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if genesis.Header.ParamsHash != cfg.ParamsHash() {
+		t.Errorf("genesis params_hash: got %q want %q", genesis.Header.ParamsHash, cfg.ParamsHash())
+	}
+	if err := rt.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	same := newTestConfig(validator)
+	same.BlockIntervalMs = 50
+	same.BlockReward = 5
+	rt = node.New(same, validator.PrivKey(), db, blocks)
+	if err := rt.Start(); err != nil {
+		t.Fatalf("restart with the same params: %v", err)
+	}
+	if err := rt.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestConfig(validator)
+	other.BlockReward = 6
+	err = node.New(other, validator.PrivKey(), db, blocks).Start()
+	if !errors.Is(err, core.ErrParamsMismatch) {
+		t.Fatalf("start with another block_reward: got %v want ErrParamsMismatch", err)
+	}
+}
+
+// TestRuntimeSendTxGossip verifies that a transaction submitted over RPC
+// to a node that does not propose blocks is relayed to the proposer and
+// mined there.
+func TestRuntimeSendTxGossip(t *testing.T) {
+	validator, _ := wallet.Generate()
+	followerKey, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+
+	cfg := newTestConfig(validator)
+	cfg.BlockIntervalMs = 50
+	proposer := node.New(cfg, validator.PrivKey(), testutil.NewMemDB(), testutil.NewMemBlockStore())
+	if err := proposer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer proposer.Stop(context.Background())
+
+	followerCfg := newTestConfig(validator)
+	followerCfg.NodeID = "follower"
+	followerCfg.BlockIntervalMs = 50
+	followerCfg.SeedPeers = []config.SeedPeer{{ID: cfg.NodeID, Addr: proposer.P2PAddr().String()}}
+	follower := node.New(followerCfg, followerKey.PrivKey(), testutil.NewMemDB(), testutil.NewMemBlockStore())
+	if err := follower.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop(context.Background())
+
+	tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 77, 0, 0)
+	sendTx(t, fmt.Sprintf("http://%s", follower.RPCAddr()), tx)
+
+	proposerURL := fmt.Sprintf("http://%s", proposer.RPCAddr())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var bal struct {
+			Balance uint64 `json:"balance"`
+		}
+		_ = json.Unmarshal(rpcCall(t, proposerURL, "getBalance", map[string]string{"address": recipient.PubKey()}), &bal)
+		if bal.Balance == 77 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transaction submitted to the follower was not mined by the proposer (balance %d)", bal.Balance)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// syncRecordingDB wraps a MemDB and records whether each batch write was
+// requested as synchronous.
+type syncRecordingDB struct {
+	*testutil.MemDB
+	mu            sync.Mutex
+	sync          bool
+	synced, async int
+}
+
+func (d *syncRecordingDB) SetSync(sync bool) { d.sync = sync }
+
+func (d *syncRecordingDB) NewBatch() storage.Batch {
+	return &syncRecordingBatch{Batch: d.MemDB.NewBatch(), db: d, sync: d.sync}
+}
+
+type syncRecordingBatch struct {
+	storage.Batch
+	db   *syncRecordingDB
+	sync bool
+}
+
+func (b *syncRecordingBatch) Write() error {
+	b.db.mu.Lock()
+	if b.sync {
+		b.db.synced++
+	} else {
+		b.db.async++
+	}
+	b.db.mu.Unlock()
+	return b.Batch.Write()
+}
+
+// TestRuntimeSyncWrites verifies that sync_writes makes block and state
+// commits request synchronous writes, and that they stay asynchronous
+// by default.
+func TestRuntimeSyncWrites(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		validator, _ := wallet.Generate()
+		cfg := newTestConfig(validator)
+		cfg.BlockIntervalMs = 50
+		cfg.SyncWrites = enabled
+		db := &syncRecordingDB{MemDB: testutil.NewMemDB()}
+
+		rt := node.New(cfg, validator.PrivKey(), db, storage.NewLevelBlockStore(db))
+		if err := rt.Start(); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for rt.Blockchain().Height() < 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("runtime produced no blocks")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err := rt.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		db.mu.Lock()
+		synced, async := db.synced, db.async
+		db.mu.Unlock()
+		if enabled && (synced == 0 || async != 0) {
+			t.Errorf("sync_writes on: %d synced, %d async batch writes", synced, async)
+		}
+		if !enabled && (async == 0 || synced != 0) {
+			t.Errorf("sync_writes off: %d synced, %d async batch writes", synced, async)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package tests
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/internal/testutil"
+	"github.com/tolelom/tolchain/storage"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+// memBackend is a storage backend registered through the backend registry
+// so that the storage tests also run against a second engine. Every open
+// returns a fresh, empty MemDB.
+const memBackend = "memdb"
+
+func init() {
+	storage.RegisterBackend(memBackend, func(string) (storage.DB, error) { return testutil.NewMemDB(), nil })
+}
+
+// openBackends opens a database with each storage backend under test,
+// keyed by backend name, and closes them when the test ends.
+func openBackends(t *testing.T) map[string]storage.DB {
+	t.Helper()
+	dbs := make(map[string]storage.DB)
+	for _, name := range []string{storage.DefaultBackend, memBackend} {
+		db, err := storage.Open(name, filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		t.Cleanup(func() { db.Close() })
+		dbs[name] = db
+	}
+	return dbs
+}
+
+// TestBatchDeleteRange verifies on every backend that DeleteRange removes
+// exactly the keys in [start, end), including keys set earlier in the same
+// batch, while keys set after it survive.
+func TestBatchDeleteRange(t *testing.T) {
+	for name, db := range openBackends(t) {
+		for _, k := range []string{"a:1", "b:1", "b:2", "b:3", "c:1"} {
+			if err := db.Set([]byte(k), []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		batch := db.NewBatch()
+		batch.Set([]byte("b:25"), []byte("v"))
+		batch.DeleteRange([]byte("b:2"), []byte("b:3"))
+		batch.Set([]byte("b:29"), []byte("v"))
+		start, end := storage.PrefixRange([]byte("c:"))
+		batch.DeleteRange(start, end)
+		if err := batch.Write(); err != nil {
+			t.Fatalf("%s: write: %v", name, err)
+		}
+
+		want := map[string]bool{"a:1": true, "b:1": true, "b:2": false, "b:25": false, "b:29": true, "b:3": true, "c:1": false}
+		for k, present := range want {
+			_, err := db.Get([]byte(k))
+			if present && err != nil {
+				t.Errorf("%s: %s should remain: %v", name, k, err)
+			}
+			if !present && !errors.Is(err, core.ErrNotFound) {
+				t.Errorf("%s: %s should be deleted, got err %v", name, k, err)
+			}
+		}
+	}
+}
+
+// TestStorageBackends verifies that backends are selected by name through
+// the registry, and that the DB contract holds on each: point reads and
+// writes, ordered prefix iteration, batches, and identical state roots and
+// block storage on top.
+func TestStorageBackends(t *testing.T) {
+	if _, err := storage.Open("nosuchdb", t.TempDir()); err == nil || !strings.Contains(err.Error(), "unknown storage backend") {
+		t.Errorf("unknown backend: got %v", err)
+	}
+	if _, err := storage.Open(storage.PebbleBackend, t.TempDir()); err == nil {
+		t.Error("pebble stub should refuse to open")
+	}
+	if !storage.HasBackend(memBackend) || !storage.HasBackend(storage.DefaultBackend) {
+		t.Errorf("registered backends: %v", storage.Backends())
+	}
+	validator, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	cfg.RPCPort, cfg.P2PPort = 8545, 30303
+	cfg.StorageBackend = memBackend
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("config with a registered backend: %v", err)
+	}
+	cfg.StorageBackend = "nosuchdb"
+	if err := cfg.Validate(); err == nil {
+		t.Error("config with an unregistered backend should not validate")
+	}
+
+	block := core.NewBlock(testChainID, 1, "prev", "proposer", nil)
+	block.Hash = block.ComputeHash()
+	roots := make(map[string]string)
+	for name, db := range openBackends(t) {
+		if _, err := db.Get([]byte("missing")); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("%s: missing key: got %v want ErrNotFound", name, err)
+		}
+		for _, k := range []string{"p:b", "q:a", "p:a", "p:c"} {
+			if err := db.Set([]byte(k), []byte("v-"+k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v, err := db.Get([]byte("p:b")); err != nil || string(v) != "v-p:b" {
+			t.Errorf("%s: get: %q, %v", name, v, err)
+		}
+		if err := db.Delete([]byte("p:c")); err != nil {
+			t.Fatal(err)
+		}
+		batch := db.NewBatch()
+		batch.Set([]byte("p:d"), []byte("v-p:d"))
+		batch.Delete([]byte("p:a"))
+		if err := batch.Write(); err != nil {
+			t.Fatalf("%s: batch: %v", name, err)
+		}
+		var keys []string
+		it := db.NewIterator([]byte("p:"))
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(keys, ","); got != "p:b,p:d" {
+			t.Errorf("%s: iteration: got %s want p:b,p:d", name, got)
+		}
+
+		state := storage.NewStateDB(db)
+		_ = state.SetAccount(&core.Account{Address: "alice", Balance: 10})
+		_ = state.SetAsset(&core.Asset{ID: "sword", Owner: "alice"})
+		root, err := state.ComputeRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := state.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		roots[name] = root
+
+		blocks := storage.NewLevelBlockStore(db)
+		if err := blocks.CommitBlock(block); err != nil {
+			t.Fatalf("%s: commit block: %v", name, err)
+		}
+		if got, err := blocks.GetBlockByHeight(1); err != nil || got.Hash != block.Hash {
+			t.Errorf("%s: block by height: %v", name, err)
+		}
+	}
+	if roots[storage.DefaultBackend] != roots[memBackend] {
+		t.Errorf("state roots differ across backends: %v", roots)
+	}
+}
+
+// crashingDB wraps a MemDB and simulates a crash during batch commits: a
+// batch Write applies nothing and fails. Direct writes are counted so a
+// test can assert nothing bypassed the batch.
+type crashingDB struct {
+	*testutil.MemDB
+	directWrites int
+}
+
+func (d *crashingDB) Set(key, value []byte) error {
+	d.directWrites++
+	return d.MemDB.Set(key, value)
+}
+
+func (d *crashingDB) NewBatch() storage.Batch { return crashingBatch{d.MemDB.NewBatch()} }
+
+type crashingBatch struct{ storage.Batch }
+
+func (crashingBatch) Write() error { return errors.New("simulated crash") }
+
+// TestCommitBlockAtomic verifies that LevelBlockStore.CommitBlock writes the
+// block body, height index and tip in one batch: a commit that dies before
+// the batch lands leaves none of them behind, and a completed commit makes
+// all three visible.
+func TestCommitBlockAtomic(t *testing.T) {
+	block := core.NewBlock(testChainID, 1, "prev", "proposer", nil)
+	block.Hash = block.ComputeHash()
+
+	crashing := &crashingDB{MemDB: testutil.NewMemDB()}
+	store := storage.NewLevelBlockStore(crashing)
+	if err := store.CommitBlock(block); err == nil {
+		t.Fatal("expected commit to fail")
+	}
+	if crashing.directWrites != 0 {
+		t.Errorf("CommitBlock made %d writes outside the batch", crashing.directWrites)
+	}
+	if _, err := store.GetBlock(block.Hash); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("block body written despite failed commit: %v", err)
+	}
+	if _, err := store.GetBlockByHeight(1); !errors.Is(err, core.ErrNotFound) {
+		t.Errorf("height index written despite failed commit: %v", err)
+	}
+	if tip, _ := store.GetTip(); tip != "" {
+		t.Errorf("tip moved to %s despite failed commit", tip)
+	}
+
+	store = storage.NewLevelBlockStore(testutil.NewMemDB())
+	if err := store.CommitBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.GetBlockByHeight(1); err != nil || got.Hash != block.Hash {
+		t.Errorf("height index: got %v, %v", got, err)
+	}
+	if tip, _ := store.GetTip(); tip != block.Hash {
+		t.Errorf("tip: got %s want %s", tip, block.Hash)
+	}
+}
+
+// recordingDB wraps a MemDB and records the operations of every batch
+// written through it, in the order they were added.
+type recordingDB struct {
+	*testutil.MemDB
+	ops []string
+}
+
+func (d *recordingDB) NewBatch() storage.Batch {
+	return &recordingBatch{Batch: d.MemDB.NewBatch(), db: d}
+}
+
+type recordingBatch struct {
+	storage.Batch
+	db *recordingDB
+}
+
+func (b *recordingBatch) Set(key, value []byte) {
+	b.db.ops = append(b.db.ops, "set "+string(key))
+	b.Batch.Set(key, value)
+}
+
+func (b *recordingBatch) Delete(key []byte) {
+	b.db.ops = append(b.db.ops, "del "+string(key))
+	b.Batch.Delete(key)
+}
+
+// TestStateDBCommitSortedOrder verifies that Commit hands writes and
+// deletes to the batch in ascending key order.
+func TestStateDBCommitSortedOrder(t *testing.T) {
+	db := &recordingDB{MemDB: testutil.NewMemDB()}
+	state := storage.NewStateDB(db)
+	for _, id := range []string{"m", "c", "x", "a"} {
+		if err := state.SetAsset(&core.Asset{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = state.SetAccount(&core.Account{Address: "zed", Balance: 1})
+	_ = state.SetAccount(&core.Account{Address: "bob", Balance: 1})
+	_ = state.DeleteAsset("c")
+	_ = state.DeleteAsset("k")
+	if err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "set acct:bob,set acct:zed,set asset:a,del asset:c,del asset:k,set asset:m,set asset:x"
+	if got := strings.Join(db.ops, ","); got != want {
+		t.Errorf("batch order:\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestStateRootVersions verifies that the flat and Merkle state root
+// algorithms yield different roots for the same state, that each is
+// deterministic, and that unknown versions are refused.
+func TestStateRootVersions(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	for _, addr := range []string{"alice", "bob"} {
+		if err := state.SetAccount(&core.Account{Address: addr, Balance: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := func() string {
+		t.Helper()
+		r, err := state.ComputeRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	merkle := root()
+	if err := state.SetRootVersion(core.StateRootFlat); err != nil {
+		t.Fatal(err)
+	}
+	flat := root()
+	if flat == merkle {
+		t.Fatal("flat and Merkle roots must differ")
+	}
+	if again := root(); again != flat {
+		t.Errorf("flat root not deterministic: %s != %s", again, flat)
+	}
+	if err := state.SetRootVersion(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := root(); got != merkle {
+		t.Errorf("version 0 root: got %s want the Merkle root %s", got, merkle)
+	}
+	if err := state.SetRootVersion(99); err == nil {
+		t.Error("unknown state root version should be refused")
+	}
+}
+
+// failingDB is a storage.DB whose iterators stop after the first entry and
+// report err, as a LevelDB iterator does on a corrupt table.
+type failingDB struct {
+	storage.DB
+	err error
+}
+
+func (db failingDB) NewIterator(prefix []byte) storage.Iterator {
+	return &failingIter{Iterator: db.DB.NewIterator(prefix), err: db.err}
+}
+
+type failingIter struct {
+	storage.Iterator
+	err  error
+	read bool
+}
+
+func (it *failingIter) Next() bool {
+	if it.read {
+		return false
+	}
+	it.read = true
+	return it.Iterator.Next()
+}
+
+func (it *failingIter) Error() error {
+	if it.read {
+		return it.err
+	}
+	return nil
+}
+
+// TestComputeRootIteratorError verifies that a DB read error during the
+// state scan is surfaced by ComputeRoot and VerifySupply instead of
+// producing a root over the truncated state.
+func TestComputeRootIteratorError(t *testing.T) {
+	db := testutil.NewMemDB()
+	state := storage.NewStateDB(db)
+	for _, addr := range []string{"alice", "bob", "carol"} {
+		if err := state.SetAccount(&core.Account{Address: addr, Balance: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := state.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := state.ComputeRoot(); err != nil {
+		t.Fatalf("healthy DB: %v", err)
+	}
+
+	errCorrupt := errors.New("corrupt table")
+	broken := storage.NewStateDB(failingDB{DB: db, err: errCorrupt})
+	if root, err := broken.ComputeRoot(); !errors.Is(err, errCorrupt) {
+		t.Errorf("ComputeRoot: got root %q err %v, want %v", root, err, errCorrupt)
+	}
+	if err := broken.VerifySupply(); !errors.Is(err, errCorrupt) {
+		t.Errorf("VerifySupply: got %v want %v", err, errCorrupt)
+	}
+}
@@ -1,11 +1,19 @@
 package tests
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/tolelom/tolchain/config"
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/crypto"
 	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/indexer"
 	"github.com/tolelom/tolchain/internal/testutil"
 	"github.com/tolelom/tolchain/storage"
 	"github.com/tolelom/tolchain/vm"
@@ -13,6 +21,7 @@ import (
 
 	// Register VM modules
 	_ "github.com/tolelom/tolchain/vm/modules/asset"
+	_ "github.com/tolelom/tolchain/vm/modules/custom"
 	_ "github.com/tolelom/tolchain/vm/modules/economy"
 	_ "github.com/tolelom/tolchain/vm/modules/market"
 	_ "github.com/tolelom/tolchain/vm/modules/session"
@@ -110,6 +119,44 @@ func TestMintAsset(t *testing.T) {
 	}
 }
 
+// TestMintAssetPropertyLimits verifies that mint_asset rejects properties
+// over the configured key count or encoded size and accepts those within.
+func TestMintAssetPropertyLimits(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	cfg := &config.Config{MaxAssetPropertiesBytes: 100, MaxAssetPropertyKeys: 3}
+	exec.SetParams(cfg.VMParams())
+
+	creator, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: creator.PubKey(), Balance: 1000})
+	_ = state.SetTemplate(&core.AssetTemplate{ID: "sword-template", Name: "Sword"})
+	block := core.NewBlock(testChainID, 1, "prev", creator.PubKey(), nil)
+
+	nonce := uint64(0)
+	mint := func(props map[string]any) error {
+		t.Helper()
+		tx, _ := creator.NewTx(testChainID, core.TxMintAsset, nonce, 0, core.MintAssetPayload{
+			TemplateID: "sword-template",
+			Properties: props,
+		})
+		err := exec.ExecuteTx(block, tx)
+		if err == nil {
+			nonce++
+		}
+		return err
+	}
+
+	if err := mint(map[string]any{"lore": strings.Repeat("x", 100)}); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("over-size properties: got %v", err)
+	}
+	if err := mint(map[string]any{"a": 1, "b": 2, "c": 3, "d": 4}); err == nil || !strings.Contains(err.Error(), "too many") {
+		t.Errorf("too many keys: got %v", err)
+	}
+	if err := mint(map[string]any{"attack": 50, "lore": strings.Repeat("x", 50)}); err != nil {
+		t.Errorf("properties within limits: %v", err)
+	}
+}
+
 // TestNonceReplay verifies that replaying a transaction with the same nonce fails.
 func TestNonceReplay(t *testing.T) {
 	state := newInMemState(t)
@@ -130,3 +177,1284 @@ func TestNonceReplay(t *testing.T) {
 		t.Error("replay should fail due to nonce mismatch")
 	}
 }
+
+// txSlow is a test-only TxType whose handler ignores cancellation, sleeps,
+// then tries to overwrite the sender's balance.
+const txSlow core.TxType = "test_slow"
+
+func init() {
+	vm.Register(txSlow, func(ctx *vm.Context, _ json.RawMessage) error {
+		time.Sleep(300 * time.Millisecond)
+		return ctx.State.SetAccount(&core.Account{Address: ctx.Tx.From, Balance: 999_999})
+	})
+}
+
+// TestExecutorTxTimeout verifies that a handler exceeding the timeout while
+// proposing is aborted, its transaction reported and reverted, and its late
+// writes discarded.
+func TestExecutorTxTimeout(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	exec.SetTxTimeout(50 * time.Millisecond)
+
+	sender, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	tx, _ := sender.NewTx(testChainID, txSlow, 0, 10, struct{}{})
+	block := core.NewBlock(testChainID, 1, "prev", sender.PubKey(), []*core.Transaction{tx})
+
+	start := time.Now()
+	var txErr *vm.TxError
+	if err := exec.ExecuteProposal(block); !errors.As(err, &txErr) || txErr.Tx != tx {
+		t.Fatalf("expected a timeout TxError, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("executor waited %s for a timed-out handler", elapsed)
+	}
+
+	time.Sleep(400 * time.Millisecond) // let the abandoned handler attempt its write
+	acc, _ := state.GetAccount(sender.PubKey())
+	if acc.Balance != 1000 || acc.Nonce != 0 {
+		t.Errorf("state not reverted: balance=%d nonce=%d", acc.Balance, acc.Nonce)
+	}
+}
+
+// TestSessionOpenPlayerLimit verifies that session_open rejects player lists
+// above the configured limit.
+func TestSessionOpenPlayerLimit(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	exec.SetParams(vm.Params{MaxSessionPlayers: 2})
+
+	opener, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: opener.PubKey(), Balance: 1000})
+	players := []string{"p1", "p2", "p3"}
+	tx, _ := opener.NewTx(testChainID, core.TxSessionOpen, 0, 0, core.SessionOpenPayload{
+		SessionID: "s1", GameID: "g", Players: players,
+	})
+	block := core.NewBlock(testChainID, 1, "prev", opener.PubKey(), nil)
+	if err := exec.ExecuteTx(block, tx); err == nil {
+		t.Fatal("expected error for too many players")
+	}
+	if _, err := state.GetSession("s1"); err == nil {
+		t.Error("session should not exist after rejected open")
+	}
+}
+
+// TestSessionOpenStakesOverflow verifies that session_open rejects sessions
+// whose total stakes would overflow uint64.
+func TestSessionOpenStakesOverflow(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+
+	opener, _ := wallet.Generate()
+	p1, _ := wallet.Generate()
+	p2, _ := wallet.Generate()
+	stakes := uint64(math.MaxUint64/2 + 1)
+	for _, w := range []*wallet.Wallet{opener, p1, p2} {
+		_ = state.SetAccount(&core.Account{Address: w.PubKey(), Balance: stakes})
+	}
+	tx, _ := opener.NewTx(testChainID, core.TxSessionOpen, 0, 0, core.SessionOpenPayload{
+		SessionID: "s1", GameID: "g", Players: []string{p1.PubKey(), p2.PubKey()}, Stakes: stakes,
+	})
+	block := core.NewBlock(testChainID, 1, "prev", opener.PubKey(), nil)
+	if err := exec.ExecuteTx(block, tx); err == nil {
+		t.Fatal("expected stakes overflow error")
+	}
+	acc, _ := state.GetAccount(p1.PubKey())
+	if acc.Balance != stakes {
+		t.Errorf("player stake should not be locked: balance=%d", acc.Balance)
+	}
+}
+
+// TestSessionRewardChecks verifies that session_open enforces the stake
+// limit, that a staked session only closes with an outcome distributing
+// exactly its stakes, and that a free session only closes with an all-zero
+// outcome.
+func TestSessionRewardChecks(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	params := vm.DefaultParams()
+	params.MaxSessionStakes = 100
+	exec.SetParams(params)
+
+	opener, _ := wallet.Generate()
+	p1, _ := wallet.Generate()
+	p2, _ := wallet.Generate()
+	for _, w := range []*wallet.Wallet{opener, p1, p2} {
+		_ = state.SetAccount(&core.Account{Address: w.PubKey(), Balance: 1000})
+	}
+	players := []string{p1.PubKey(), p2.PubKey()}
+	block := core.NewBlock(testChainID, 1, "prev", opener.PubKey(), nil)
+	nonce := uint64(0)
+	run := func(typ core.TxType, payload any) error {
+		tx, _ := opener.NewTx(testChainID, typ, nonce, 0, payload)
+		err := exec.ExecuteTx(block, tx)
+		if err == nil {
+			nonce++
+		}
+		return err
+	}
+
+	if err := run(core.TxSessionOpen, core.SessionOpenPayload{SessionID: "big", Players: players, Stakes: 101}); err == nil {
+		t.Error("stakes above the limit should be rejected")
+	}
+	if err := run(core.TxSessionOpen, core.SessionOpenPayload{SessionID: "s1", Players: players, Stakes: 100}); err != nil {
+		t.Fatalf("open staked session: %v", err)
+	}
+	partial := map[string]uint64{p1.PubKey(): 150}
+	if err := run(core.TxSessionResult, core.SessionResultPayload{SessionID: "s1", Outcome: partial}); err == nil {
+		t.Error("outcome stranding 50 tokens should be rejected")
+	}
+	balanced := map[string]uint64{p1.PubKey(): 150, p2.PubKey(): 50}
+	if err := run(core.TxSessionResult, core.SessionResultPayload{SessionID: "s1", Outcome: balanced}); err != nil {
+		t.Fatalf("balanced outcome: %v", err)
+	}
+	if acc, _ := state.GetAccount(p1.PubKey()); acc.Balance != 1050 {
+		t.Errorf("winner balance: got %d want 1050", acc.Balance)
+	}
+
+	if err := run(core.TxSessionOpen, core.SessionOpenPayload{SessionID: "free", Players: players}); err != nil {
+		t.Fatalf("open free session: %v", err)
+	}
+	if err := run(core.TxSessionResult, core.SessionResultPayload{SessionID: "free", Outcome: map[string]uint64{p2.PubKey(): 1}}); err == nil {
+		t.Error("reward from a free session should be rejected")
+	}
+	zero := map[string]uint64{p1.PubKey(): 0, p2.PubKey(): 0}
+	if err := run(core.TxSessionResult, core.SessionResultPayload{SessionID: "free", Outcome: zero}); err != nil {
+		t.Errorf("all-zero outcome of a free session: %v", err)
+	}
+}
+
+// TestBlockReward verifies that ExecuteBlock mints the block reward to the
+// proposer in addition to fees.
+func TestBlockReward(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	exec.SetParams(vm.Params{BlockReward: 50})
+
+	proposer, _ := wallet.Generate()
+	sender, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	tx, _ := sender.Transfer(testChainID, proposer.PubKey(), 100, 0, 5)
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), []*core.Transaction{tx})
+	if err := exec.ExecuteBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ := state.GetAccount(proposer.PubKey())
+	if acc.Balance != 100+5+50 {
+		t.Errorf("proposer balance: got %d want %d", acc.Balance, 155)
+	}
+}
+
+// TestTotalSupply verifies that genesis records the allocated supply, that
+// block rewards add to it, transfers leave it unchanged and account
+// creation deposits burn from it, and that the supply invariant holds
+// throughout, including while stakes are locked in a session.
+func TestTotalSupply(t *testing.T) {
+	proposer, _ := wallet.Generate()
+	alice, _ := wallet.Generate()
+	bob, _ := wallet.Generate()
+	cfg := newTestConfig(proposer)
+	cfg.Genesis.Alloc[alice.PubKey()] = 5_000
+	state := storage.NewStateDB(testutil.NewMemDB())
+	if _, err := config.CreateGenesisBlock(cfg, state, proposer.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+
+	supply := func() uint64 {
+		t.Helper()
+		if err := state.VerifySupply(); err != nil {
+			t.Fatal(err)
+		}
+		n, err := state.GetTotalSupply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if got := supply(); got != 10_000_000+5_000 {
+		t.Fatalf("genesis supply: got %d want %d", got, 10_005_000)
+	}
+
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	height := int64(0)
+	run := func(params vm.Params, txs ...*core.Transaction) {
+		t.Helper()
+		exec.SetParams(params)
+		height++
+		if err := exec.ExecuteBlock(core.NewBlock(testChainID, height, "prev", proposer.PubKey(), txs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(vm.Params{BlockReward: 50})
+	if got := supply(); got != 10_005_050 {
+		t.Errorf("after block reward: got %d want %d", got, 10_005_050)
+	}
+
+	tx, _ := alice.Transfer(testChainID, proposer.PubKey(), 100, 0, 3)
+	run(vm.Params{}, tx)
+	if got := supply(); got != 10_005_050 {
+		t.Errorf("after transfer: got %d want unchanged %d", got, 10_005_050)
+	}
+
+	tx, _ = alice.Transfer(testChainID, bob.PubKey(), 100, 1, 0)
+	run(vm.Params{AccountCreationDeposit: 7}, tx)
+	if got := supply(); got != 10_005_043 {
+		t.Errorf("after account creation deposit: got %d want %d", got, 10_005_043)
+	}
+
+	tx, _ = alice.NewTx(testChainID, core.TxSessionOpen, 2, 0, core.SessionOpenPayload{
+		SessionID: "s1", GameID: "g", Players: []string{alice.PubKey(), bob.PubKey()}, Stakes: 40,
+	})
+	run(vm.Params{}, tx)
+	if got := supply(); got != 10_005_043 {
+		t.Errorf("with stakes locked: got %d want %d", got, 10_005_043)
+	}
+
+	// Tokens appearing without accounting break the invariant.
+	_ = state.SetAccount(&core.Account{Address: bob.PubKey(), Balance: 1_000_000})
+	if err := state.VerifySupply(); err == nil {
+		t.Error("VerifySupply accepted unaccounted tokens")
+	}
+}
+
+// TestAssetLock verifies that a locked asset cannot be transferred, that the
+// owner cannot unlock early, and that the lock lapses at its expiry.
+func TestAssetLock(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+
+	owner, _ := wallet.Generate()
+	holder, _ := wallet.Generate()
+	buyer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: owner.PubKey(), Balance: 1000})
+	_ = state.SetAsset(&core.Asset{ID: "sword", Owner: owner.PubKey(), Tradeable: true})
+
+	at := func(ts int64) *core.Block {
+		b := core.NewBlock(testChainID, 1, "prev", owner.PubKey(), nil)
+		b.Header.Timestamp = ts
+		return b
+	}
+	nonce := uint64(0)
+	run := func(ts int64, typ core.TxType, payload any) error {
+		tx, _ := owner.NewTx(testChainID, typ, nonce, 0, payload)
+		err := exec.ExecuteTx(at(ts), tx)
+		if err == nil {
+			nonce++
+		}
+		return err
+	}
+
+	if err := run(100, core.TxLockAsset, core.LockAssetPayload{AssetID: "sword", Holder: holder.PubKey(), Expiry: 200}); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := run(150, core.TxTransferAsset, core.TransferAssetPayload{AssetID: "sword", To: buyer.PubKey()}); err == nil {
+		t.Error("transfer of locked asset should fail")
+	}
+	if err := run(150, core.TxUnlockAsset, core.UnlockAssetPayload{AssetID: "sword"}); err == nil {
+		t.Error("owner should not unlock before expiry")
+	}
+
+	// At expiry the lock lapses without an explicit unlock.
+	if err := run(200, core.TxTransferAsset, core.TransferAssetPayload{AssetID: "sword", To: buyer.PubKey()}); err != nil {
+		t.Fatalf("transfer after expiry: %v", err)
+	}
+	asset, _ := state.GetAsset("sword")
+	if asset.Owner != buyer.PubKey() {
+		t.Errorf("owner: got %s want %s", asset.Owner, buyer.PubKey())
+	}
+	if asset.LockedBy != "" {
+		t.Errorf("lapsed lock should be cleared on transfer, got holder %s", asset.LockedBy)
+	}
+}
+
+// TestPurchaseClearsLapsedLock verifies that buying an asset through a
+// market listing or a direct purchase drops a lock that lapsed before the
+// sale, so the old holder does not carry over to the new owner.
+func TestPurchaseClearsLapsedLock(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	seller, _ := wallet.Generate()
+	buyer, _ := wallet.Generate()
+	holder, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: seller.PubKey(), Balance: 1000})
+	_ = state.SetAccount(&core.Account{Address: buyer.PubKey(), Balance: 1000})
+	for _, id := range []string{"listed", "direct"} {
+		_ = state.SetAsset(&core.Asset{ID: id, Owner: seller.PubKey(), Tradeable: true, LockedBy: holder.PubKey(), LockExpiry: 50})
+	}
+	block := core.NewBlock(testChainID, 1, "prev", seller.PubKey(), nil)
+	block.Header.Timestamp = 100
+
+	list, _ := seller.NewTx(testChainID, core.TxListMarket, 0, 0, core.ListMarketPayload{AssetID: "listed", Price: 10})
+	if err := exec.ExecuteTx(block, list); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	listingID := crypto.Hash([]byte(list.ID + ":listing:listed"))
+	buy, _ := buyer.NewTx(testChainID, core.TxBuyMarket, 0, 0, core.BuyMarketPayload{ListingID: listingID})
+	if err := exec.ExecuteTx(block, buy); err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	direct, _ := buyer.NewCosignedTx(testChainID, core.TxDirectPurchase, []string{seller.PubKey()}, 1, 0,
+		core.DirectPurchasePayload{AssetID: "direct", Seller: seller.PubKey(), Price: 10})
+	seller.Countersign(direct)
+	if err := exec.ExecuteTx(block, direct); err != nil {
+		t.Fatalf("direct purchase: %v", err)
+	}
+
+	for _, id := range []string{"listed", "direct"} {
+		asset, _ := state.GetAsset(id)
+		if asset.Owner != buyer.PubKey() || asset.LockedBy != "" || asset.LockExpiry != 0 {
+			t.Errorf("%s: owner %s, lock %q until %d; want the buyer and no lock", id, asset.Owner, asset.LockedBy, asset.LockExpiry)
+		}
+	}
+}
+
+// TestTransferMinimumAmount verifies that transfers below the configured
+// minimum are rejected.
+func TestTransferMinimumAmount(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	exec.SetParams(vm.Params{MinTransferAmount: 10})
+
+	sender, _ := wallet.Generate()
+	receiver, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", sender.PubKey(), nil)
+
+	tx, _ := sender.Transfer(testChainID, receiver.PubKey(), 9, 0, 0)
+	if err := exec.ExecuteTx(block, tx); err == nil {
+		t.Fatal("expected below-minimum transfer to fail")
+	}
+	tx, _ = sender.Transfer(testChainID, receiver.PubKey(), 10, 0, 0)
+	if err := exec.ExecuteTx(block, tx); err != nil {
+		t.Fatalf("transfer at minimum: %v", err)
+	}
+}
+
+// TestTransferAccountCreationDeposit verifies that the deposit is burned from
+// the sender only for the transfer that creates the recipient account.
+func TestTransferAccountCreationDeposit(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	exec.SetParams(vm.Params{AccountCreationDeposit: 5})
+
+	sender, _ := wallet.Generate()
+	receiver, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", sender.PubKey(), nil)
+
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		tx, _ := sender.Transfer(testChainID, receiver.PubKey(), 100, nonce, 0)
+		if err := exec.ExecuteTx(block, tx); err != nil {
+			t.Fatalf("transfer %d: %v", nonce, err)
+		}
+	}
+	s, _ := state.GetAccount(sender.PubKey())
+	r, _ := state.GetAccount(receiver.PubKey())
+	if s.Balance != 1000-200-5 {
+		t.Errorf("sender balance: got %d want %d", s.Balance, 795)
+	}
+	if r.Balance != 200 {
+		t.Errorf("receiver balance: got %d want 200", r.Balance)
+	}
+}
+
+// setupBatchTransfer returns an executor over a state holding three
+// tradeable assets owned by owner.
+func setupBatchTransfer(t *testing.T, owner *wallet.Wallet, emitter *events.Emitter) (core.State, *vm.Executor, []string) {
+	t.Helper()
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, emitter)
+	_ = state.SetAccount(&core.Account{Address: owner.PubKey(), Balance: 1000})
+	ids := []string{"sword", "shield", "helm"}
+	for _, id := range ids {
+		_ = state.SetAsset(&core.Asset{ID: id, Owner: owner.PubKey(), Tradeable: true})
+	}
+	return state, exec, ids
+}
+
+// TestBatchTransferAsset verifies that all assets in a batch move to the
+// recipient with one transfer event each.
+func TestBatchTransferAsset(t *testing.T) {
+	owner, _ := wallet.Generate()
+	friend, _ := wallet.Generate()
+	emitter := events.NewEmitter()
+	state, exec, ids := setupBatchTransfer(t, owner, emitter)
+	var moved []string
+	emitter.Subscribe(events.EventAssetTransfer, func(ev events.Event) {
+		moved = append(moved, ev.Data["asset_id"].(string))
+	})
+
+	tx, _ := owner.NewTx(testChainID, core.TxBatchTransferAsset, 0, 0, core.BatchTransferAssetPayload{AssetIDs: ids, To: friend.PubKey()})
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", owner.PubKey(), nil), tx); err != nil {
+		t.Fatalf("batch transfer: %v", err)
+	}
+	for _, id := range ids {
+		if a, _ := state.GetAsset(id); a.Owner != friend.PubKey() {
+			t.Errorf("%s owner: got %s want %s", id, a.Owner, friend.PubKey())
+		}
+	}
+	if len(moved) != len(ids) {
+		t.Errorf("transfer events: got %v want one per asset", moved)
+	}
+}
+
+// TestBatchTransferAssetRevertsOnListed verifies that one listed asset makes
+// the whole batch fail with no asset moved.
+func TestBatchTransferAssetRevertsOnListed(t *testing.T) {
+	owner, _ := wallet.Generate()
+	friend, _ := wallet.Generate()
+	state, exec, ids := setupBatchTransfer(t, owner, events.NewEmitter())
+	listed, _ := state.GetAsset(ids[2])
+	listed.ActiveListingID = "listing-1"
+	_ = state.SetAsset(listed)
+
+	tx, _ := owner.NewTx(testChainID, core.TxBatchTransferAsset, 0, 0, core.BatchTransferAssetPayload{AssetIDs: ids, To: friend.PubKey()})
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", owner.PubKey(), nil), tx); err == nil {
+		t.Fatal("batch containing a listed asset should fail")
+	}
+	for _, id := range ids {
+		if a, _ := state.GetAsset(id); a.Owner != owner.PubKey() {
+			t.Errorf("%s owner changed to %s despite failed batch", id, a.Owner)
+		}
+	}
+}
+
+// setupDirectPurchase funds buyer and gives seller a tradeable asset.
+func setupDirectPurchase(t *testing.T, buyer, seller *wallet.Wallet, emitter *events.Emitter) (core.State, *vm.Executor) {
+	t.Helper()
+	state := newInMemState(t)
+	_ = state.SetAccount(&core.Account{Address: buyer.PubKey(), Balance: 1000})
+	_ = state.SetAsset(&core.Asset{ID: "sword-1", TemplateID: "sword", Owner: seller.PubKey(), Tradeable: true})
+	return state, vm.NewExecutor(state, emitter)
+}
+
+// TestDirectPurchase verifies that a buyer-sent, seller-cosigned purchase
+// moves the price and the asset in one transaction.
+func TestDirectPurchase(t *testing.T) {
+	buyer, _ := wallet.Generate()
+	seller, _ := wallet.Generate()
+	emitter := events.NewEmitter()
+	state, exec := setupDirectPurchase(t, buyer, seller, emitter)
+	var purchases []events.Event
+	emitter.Subscribe(events.EventDirectPurchase, func(ev events.Event) { purchases = append(purchases, ev) })
+
+	tx, _ := buyer.NewCosignedTx(testChainID, core.TxDirectPurchase, []string{seller.PubKey()}, 0, 0,
+		core.DirectPurchasePayload{AssetID: "sword-1", Seller: seller.PubKey(), Price: 300})
+	seller.Countersign(tx)
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", buyer.PubKey(), nil), tx); err != nil {
+		t.Fatalf("direct purchase: %v", err)
+	}
+	if a, _ := state.GetAsset("sword-1"); a.Owner != buyer.PubKey() {
+		t.Errorf("asset owner: got %s want buyer", a.Owner)
+	}
+	if acc, _ := state.GetAccount(buyer.PubKey()); acc.Balance != 700 {
+		t.Errorf("buyer balance: got %d want 700", acc.Balance)
+	}
+	if acc, _ := state.GetAccount(seller.PubKey()); acc.Balance != 300 {
+		t.Errorf("seller balance: got %d want 300", acc.Balance)
+	}
+	if len(purchases) != 1 || purchases[0].Data["seller"] != seller.PubKey() {
+		t.Errorf("direct_purchase events: %+v", purchases)
+	}
+}
+
+// TestDirectPurchaseRejected verifies that a purchase fails without the
+// seller's consent to the exact price, or once the asset has moved.
+func TestDirectPurchaseRejected(t *testing.T) {
+	buyer, _ := wallet.Generate()
+	seller, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	state, exec := setupDirectPurchase(t, buyer, seller, events.NewEmitter())
+	block := core.NewBlock(testChainID, 1, "prev", buyer.PubKey(), nil)
+	purchase := func(price uint64) *core.Transaction {
+		tx, _ := buyer.NewTx(testChainID, core.TxDirectPurchase, 0, 0,
+			core.DirectPurchasePayload{AssetID: "sword-1", Seller: seller.PubKey(), Price: price})
+		return tx
+	}
+
+	// The seller agreed to 300; the buyer re-signs the tx with a price of 100.
+	repriced := purchase(300)
+	seller.Countersign(repriced)
+	repriced.Payload, _ = json.Marshal(core.DirectPurchasePayload{AssetID: "sword-1", Seller: seller.PubKey(), Price: 100})
+	repriced.Sign(buyer.PrivKey())
+	if err := exec.ExecuteTx(block, repriced); !errors.Is(err, core.ErrBadCosignature) {
+		t.Errorf("mismatched price: got %v want %v", err, core.ErrBadCosignature)
+	}
+
+	if err := exec.ExecuteTx(block, purchase(300)); err == nil || !strings.Contains(err.Error(), "cosigned") {
+		t.Errorf("missing seller cosignature: got %v", err)
+	}
+
+	moved, _ := state.GetAsset("sword-1")
+	moved.Owner = other.PubKey()
+	_ = state.SetAsset(moved)
+	tx := purchase(300)
+	seller.Countersign(tx)
+	if err := exec.ExecuteTx(block, tx); err == nil || !strings.Contains(err.Error(), "not owned by seller") {
+		t.Errorf("moved asset: got %v", err)
+	}
+	if acc, _ := state.GetAccount(buyer.PubKey()); acc.Balance != 1000 || acc.Nonce != 0 {
+		t.Errorf("buyer changed by rejected purchases: %+v", acc)
+	}
+}
+
+// TestExecuteTxForeignChainID verifies that a transaction signed for another
+// chain is rejected when executed in this chain's block.
+func TestExecuteTxForeignChainID(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	sender, _ := wallet.Generate()
+	receiver, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", sender.PubKey(), nil)
+
+	tx, _ := sender.Transfer("other-chain", receiver.PubKey(), 10, 0, 0)
+	if err := exec.ExecuteTx(block, tx); err == nil {
+		t.Fatal("expected foreign-chain transaction to be rejected")
+	}
+	if acc, _ := state.GetAccount(sender.PubKey()); acc.Nonce != 0 || acc.Balance != 1000 {
+		t.Errorf("sender changed by rejected tx: %+v", acc)
+	}
+}
+
+// TestSponsoredTransaction verifies that a fee payer can cover the fee of a
+// sender with no balance, and that the fee goes to the proposer.
+func TestSponsoredTransaction(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	player, _ := wallet.Generate()
+	sponsor, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sponsor.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+
+	tx, err := player.NewSponsoredTx(testChainID, core.TxRegisterTemplate, sponsor.PubKey(), 0, 5,
+		core.RegisterTemplatePayload{ID: "badge", Name: "Badge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sponsor.CoSign(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.ExecuteTx(block, tx); err != nil {
+		t.Fatalf("ExecuteTx: %v", err)
+	}
+	if acc, _ := state.GetAccount(player.PubKey()); acc.Nonce != 1 || acc.Balance != 0 {
+		t.Errorf("player: got %+v want nonce 1, balance 0", acc)
+	}
+	if acc, _ := state.GetAccount(sponsor.PubKey()); acc.Nonce != 0 || acc.Balance != 995 {
+		t.Errorf("sponsor: got %+v want nonce 0, balance 995", acc)
+	}
+	if acc, _ := state.GetAccount(proposer.PubKey()); acc.Balance != 5 {
+		t.Errorf("proposer balance: got %d want 5", acc.Balance)
+	}
+	if _, err := state.GetTemplate("badge"); err != nil {
+		t.Errorf("template not registered: %v", err)
+	}
+}
+
+// TestSponsoredTransactionSignature verifies that a sponsored transaction
+// without the fee payer's valid co-signature is rejected untouched.
+func TestSponsoredTransactionSignature(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, events.NewEmitter())
+	player, _ := wallet.Generate()
+	sponsor, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sponsor.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", sponsor.PubKey(), nil)
+
+	newTx := func() *core.Transaction {
+		tx, _ := player.NewSponsoredTx(testChainID, core.TxRegisterTemplate, sponsor.PubKey(), 0, 5,
+			core.RegisterTemplatePayload{ID: "badge", Name: "Badge"})
+		return tx
+	}
+	missing := newTx()
+	forged := newTx()
+	forged.SignFeePayer(other.PrivKey())
+	if err := other.CoSign(newTx()); err == nil {
+		t.Error("CoSign by a wallet other than the fee payer should fail")
+	}
+	for name, tx := range map[string]*core.Transaction{"missing": missing, "forged": forged} {
+		if err := exec.ExecuteTx(block, tx); !errors.Is(err, core.ErrBadFeePayerSignature) {
+			t.Errorf("%s co-signature: got %v want %v", name, err, core.ErrBadFeePayerSignature)
+		}
+	}
+	if acc, _ := state.GetAccount(sponsor.PubKey()); acc.Balance != 1000 {
+		t.Errorf("sponsor charged by rejected tx: %+v", acc)
+	}
+	if acc, _ := state.GetAccount(player.PubKey()); acc.Nonce != 0 {
+		t.Errorf("player nonce advanced by rejected tx: %+v", acc)
+	}
+}
+
+// TestScheduleTransferVesting verifies that a scheduled transfer locks the
+// full amount, that claiming before any tranche matures is rejected, and
+// that the recipient receives each tranche once it matures.
+func TestScheduleTransferVesting(t *testing.T) {
+	funder, _ := wallet.Generate()
+	member, _ := wallet.Generate()
+	state := newInMemState(t)
+	emitter := events.NewEmitter()
+	exec := vm.NewExecutor(state, emitter)
+	_ = state.SetAccount(&core.Account{Address: funder.PubKey(), Balance: 1000})
+	var vestingID string
+	emitter.Subscribe(events.EventVestingScheduled, func(ev events.Event) {
+		vestingID = ev.Data["vesting_id"].(string)
+	})
+	block := func(height int64) *core.Block {
+		return core.NewBlock(testChainID, height, "prev", funder.PubKey(), nil)
+	}
+
+	schedule, _ := funder.NewTx(testChainID, core.TxScheduleTransfer, 0, 0, core.ScheduleTransferPayload{
+		To:       member.PubKey(),
+		Tranches: []core.VestingTranche{{Height: 5, Amount: 100}, {Height: 10, Amount: 200}},
+	})
+	if err := exec.ExecuteTx(block(1), schedule); err != nil {
+		t.Fatalf("schedule_transfer: %v", err)
+	}
+	if acc, _ := state.GetAccount(funder.PubKey()); acc.Balance != 700 {
+		t.Errorf("funder balance: got %d want 700", acc.Balance)
+	}
+
+	claim := func(nonce uint64, height int64) error {
+		tx, _ := member.NewTx(testChainID, core.TxClaimVested, nonce, 0, core.ClaimVestedPayload{VestingID: vestingID})
+		return exec.ExecuteTx(block(height), tx)
+	}
+	if err := claim(0, 4); err == nil {
+		t.Fatal("claim before the first tranche matures should be rejected")
+	}
+	if err := claim(0, 5); err != nil {
+		t.Fatalf("claim first tranche: %v", err)
+	}
+	if acc, _ := state.GetAccount(member.PubKey()); acc.Balance != 100 {
+		t.Errorf("member balance after first tranche: got %d want 100", acc.Balance)
+	}
+	if err := claim(1, 9); err == nil {
+		t.Error("second claim before the next tranche matures should be rejected")
+	}
+	if err := claim(1, 12); err != nil {
+		t.Fatalf("claim remaining tranche: %v", err)
+	}
+	if acc, _ := state.GetAccount(member.PubKey()); acc.Balance != 300 {
+		t.Errorf("member balance after all tranches: got %d want 300", acc.Balance)
+	}
+	if v, _ := state.GetVesting(vestingID); v.Claimed != v.Total() {
+		t.Errorf("vesting claimed %d of %d", v.Claimed, v.Total())
+	}
+	if err := claim(2, 20); err == nil {
+		t.Error("claim of a fully released vesting should be rejected")
+	}
+}
+
+// TestScheduleTransferRejectsMaturedTranche verifies that every tranche
+// must mature after the scheduling block.
+func TestScheduleTransferRejectsMaturedTranche(t *testing.T) {
+	funder, _ := wallet.Generate()
+	member, _ := wallet.Generate()
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	_ = state.SetAccount(&core.Account{Address: funder.PubKey(), Balance: 1000})
+
+	tx, _ := funder.NewTx(testChainID, core.TxScheduleTransfer, 0, 0, core.ScheduleTransferPayload{
+		To:       member.PubKey(),
+		Tranches: []core.VestingTranche{{Height: 3, Amount: 100}},
+	})
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 3, "prev", funder.PubKey(), nil), tx); err == nil {
+		t.Fatal("a tranche already matured at the scheduling block should be rejected")
+	}
+	if acc, _ := state.GetAccount(funder.PubKey()); acc.Balance != 1000 {
+		t.Errorf("funder balance: got %d want 1000", acc.Balance)
+	}
+}
+
+// TestApplyBasisPoints verifies that basis-point math floors exactly,
+// including amounts where float arithmetic rounds differently, and that
+// SplitBasisPoints never loses or creates dust.
+func TestApplyBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount, bps, want uint64
+		floatDiffers      bool // naive float math gives a different answer
+	}{
+		{amount: 100, bps: 2900, want: 29, floatDiffers: true}, // 100 × 0.29 = 28.999…
+		{amount: 1<<53 + 1, bps: 10_000, want: 1<<53 + 1, floatDiffers: true},
+		{amount: math.MaxUint64, bps: 1, want: math.MaxUint64 / 10_000},
+		{amount: math.MaxUint64, bps: 10_000, want: math.MaxUint64}, // product needs 128 bits
+		{amount: 9_999, bps: 1, want: 0},
+		{amount: 19_999, bps: 5_000, want: 9_999},
+		{amount: 0, bps: 10_000, want: 0},
+	}
+	for _, tc := range tests {
+		got := vm.ApplyBasisPoints(tc.amount, tc.bps)
+		if got != tc.want {
+			t.Errorf("ApplyBasisPoints(%d, %d): got %d want %d", tc.amount, tc.bps, got, tc.want)
+		}
+		naive := uint64(math.Floor(float64(tc.amount) * (float64(tc.bps) / 10_000)))
+		if tc.floatDiffers && naive == tc.want {
+			t.Errorf("ApplyBasisPoints(%d, %d): float math also gives %d; case proves nothing", tc.amount, tc.bps, naive)
+		}
+		share, rest := vm.SplitBasisPoints(tc.amount, tc.bps)
+		if share != got || share+rest != tc.amount {
+			t.Errorf("SplitBasisPoints(%d, %d): got %d + %d", tc.amount, tc.bps, share, rest)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("bps above 10000 should panic")
+		}
+	}()
+	vm.ApplyBasisPoints(1, 10_001)
+}
+
+// TestCustomTransactions verifies that a custom transaction is stored when
+// its data matches the schema registered in the config, and rejected
+// without a record otherwise.
+func TestCustomTransactions(t *testing.T) {
+	cfg := &config.Config{CustomSchemas: map[string]map[string]string{
+		"match_result": {"winner": "string", "score": "int", "replay": "string?"},
+	}}
+	if err := vm.Schema(cfg.CustomSchemas["match_result"]).Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (vm.Schema{"x": "date"}).Check(); err == nil {
+		t.Error("unknown type hint should be refused")
+	}
+
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	exec.SetParams(cfg.VMParams())
+	game, _ := wallet.Generate()
+	block := core.NewBlock(testChainID, 1, "prev", game.PubKey(), nil)
+
+	nonce := uint64(0)
+	run := func(schema, data string) (*core.Transaction, error) {
+		t.Helper()
+		tx, _ := game.NewTx(testChainID, core.TxCustom, nonce, 0, core.CustomPayload{Schema: schema, Data: json.RawMessage(data)})
+		err := exec.ExecuteTx(block, tx)
+		if err == nil {
+			nonce++
+		}
+		return tx, err
+	}
+
+	tx, err := run("match_result", `{"winner": "alice", "score": 42}`)
+	if err != nil {
+		t.Fatalf("conforming payload: %v", err)
+	}
+	rec, err := state.GetCustomRecord(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Schema != "match_result" || rec.From != game.PubKey() || string(rec.Data) != `{"winner":"alice","score":42}` {
+		t.Errorf("stored record: %+v", rec)
+	}
+
+	for name, c := range map[string]struct{ schema, data string }{
+		"missing field":  {"match_result", `{"winner": "alice"}`},
+		"wrong type":     {"match_result", `{"winner": "alice", "score": "42"}`},
+		"fractional int": {"match_result", `{"winner": "alice", "score": 4.2}`},
+		"unknown field":  {"match_result", `{"winner": "alice", "score": 1, "cheat": true}`},
+		"not an object":  {"match_result", `[1, 2]`},
+		"unknown schema": {"trade", `{}`},
+	} {
+		tx, err := run(c.schema, c.data)
+		if err == nil || !strings.Contains(err.Error(), "custom schema") {
+			t.Errorf("%s: got %v, want a schema error", name, err)
+			continue
+		}
+		if _, err := state.GetCustomRecord(tx.ID); !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("%s: record stored for a rejected transaction (%v)", name, err)
+		}
+	}
+}
+
+// TestReplayChain verifies that replaying a valid chain into a fresh state
+// finds no divergence and that a stored block with a tampered state root
+// is reported at its height.
+func TestReplayChain(t *testing.T) {
+	validator, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+	cfg := newTestConfig(validator)
+	cfg.BlockReward = 7
+	chain, _ := newTestChain(t, cfg, validator, nil)
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx, _ := validator.Transfer(testChainID, recipient.PubKey(), 10+nonce, nonce, 0)
+		if err := chain.mempool.Add(tx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.poa.ProduceBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replay := func(bc *core.Blockchain) (int64, error) {
+		fresh := testutil.NewStateDB()
+		if _, err := config.CreateGenesisBlock(cfg, fresh, validator.PrivKey()); err != nil {
+			t.Fatal(err)
+		}
+		exec := vm.NewExecutor(fresh, nil)
+		exec.SetParams(cfg.VMParams())
+		return vm.ReplayChain(bc, exec, fresh)
+	}
+	if h, err := replay(chain.bc); h != -1 || err != nil {
+		t.Fatalf("valid chain: diverged at %d, %v", h, err)
+	}
+
+	// Copy the chain with block 2's state root altered; hashes stay intact,
+	// so the copy still links.
+	tampered := core.NewBlockchain(testutil.NewMemBlockStore())
+	for h := int64(0); h <= chain.bc.Height(); h++ {
+		b, _ := chain.bc.GetBlockByHeight(h)
+		if h == 2 {
+			altered := *b
+			altered.Header.StateRoot = strings.Repeat("0", 64)
+			b = &altered
+		}
+		if err := tampered.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h, err := replay(tampered); h != 2 || err != nil {
+		t.Errorf("tampered chain: diverged at %d, %v; want 2", h, err)
+	}
+}
+
+// TestMinFeesPerType verifies that a transaction below its type's minimum
+// fee is refused by the mempool and by execution, while one paying the
+// minimum of its own type is accepted and its fee goes to the proposer.
+func TestMinFeesPerType(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	cfg := &config.Config{MinFees: map[string]uint64{"register_template": 100, "transfer": 2}}
+	exec.SetParams(cfg.VMParams())
+	mp := core.NewMempool()
+	mp.SetValidator(exec.CheckTx)
+
+	sender, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+
+	cheap, _ := sender.NewTx(testChainID, core.TxRegisterTemplate, 0, 99, core.RegisterTemplatePayload{ID: "sword", Name: "Sword"})
+	if err := mp.Add(cheap); err == nil || !strings.Contains(err.Error(), "below the minimum") {
+		t.Errorf("mempool: register_template at fee 99: got %v", err)
+	}
+	if err := exec.ExecuteTx(block, cheap); err == nil || !strings.Contains(err.Error(), "below the minimum") {
+		t.Errorf("execute: register_template at fee 99: got %v", err)
+	}
+
+	transfer, _ := sender.Transfer(testChainID, proposer.PubKey(), 10, 0, 2)
+	if err := mp.Add(transfer); err != nil {
+		t.Fatalf("mempool: transfer at its minimum: %v", err)
+	}
+	if err := exec.ExecuteTx(block, transfer); err != nil {
+		t.Fatalf("execute: transfer at its minimum: %v", err)
+	}
+	if acc, _ := state.GetAccount(proposer.PubKey()); acc.Balance != 12 {
+		t.Errorf("proposer balance: got %d want 12 (amount plus fee)", acc.Balance)
+	}
+}
+
+// TestUnknownTxVersion verifies that a correctly signed transaction in an
+// unknown serialization version is rejected by both the mempool and the
+// executor, and that an unversioned transaction, signed over the bare hash,
+// is refused by the mempool but still executes as part of old history.
+func TestUnknownTxVersion(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	mp := core.NewMempool()
+	mp.SetValidator(exec.CheckTx)
+
+	sender, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+
+	future, _ := sender.Transfer(testChainID, proposer.PubKey(), 10, 0, 0)
+	if future.Version != core.TxVersion {
+		t.Fatalf("new tx version: got %d want %d", future.Version, core.TxVersion)
+	}
+	future.Version = core.TxVersion + 1
+	future.Sign(sender.PrivKey())
+	if err := mp.Add(future); !errors.Is(err, core.ErrUnknownVersion) {
+		t.Errorf("mempool: got %v want ErrUnknownVersion", err)
+	}
+	if err := exec.ExecuteTx(block, future); !errors.Is(err, core.ErrUnknownVersion) {
+		t.Errorf("execute: got %v want ErrUnknownVersion", err)
+	}
+
+	legacy, _ := sender.Transfer(testChainID, proposer.PubKey(), 10, 0, 0)
+	legacy.Version = 0
+	legacy.Sign(sender.PrivKey())
+	if err := mp.Add(legacy); !errors.Is(err, core.ErrLegacySignature) {
+		t.Errorf("mempool: unversioned tx: got %v want ErrLegacySignature", err)
+	}
+	if err := exec.ExecuteTx(block, legacy); err != nil {
+		t.Fatalf("execute: unversioned tx: %v", err)
+	}
+
+	block2 := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+	block2.Header.Version = core.BlockVersion + 1
+	block2.Sign(proposer.PrivKey())
+	if err := block2.VerifyIntegrity(); !errors.Is(err, core.ErrUnknownVersion) {
+		t.Errorf("block integrity: got %v want ErrUnknownVersion", err)
+	}
+}
+
+// TestBurnTombstone verifies that a burned asset is kept as a burned record
+// in tombstone mode and deleted otherwise, and leaves its owner's index in
+// both modes.
+func TestBurnTombstone(t *testing.T) {
+	for _, tombstones := range []bool{false, true} {
+		db := testutil.NewMemDB()
+		state := storage.NewStateDB(db)
+		emitter := events.NewEmitter()
+		idx := indexer.New(db, emitter)
+		exec := vm.NewExecutor(state, emitter)
+		params := vm.DefaultParams()
+		params.BurnTombstones = tombstones
+		exec.SetParams(params)
+
+		owner, _ := wallet.Generate()
+		block := core.NewBlock(testChainID, 1, "prev", owner.PubKey(), nil)
+		run := func(nonce uint64, typ core.TxType, payload any) *core.Transaction {
+			t.Helper()
+			tx, _ := owner.NewTx(testChainID, typ, nonce, 0, payload)
+			if err := exec.ExecuteTx(block, tx); err != nil {
+				t.Fatalf("tombstones=%v: %s: %v", tombstones, typ, err)
+			}
+			return tx
+		}
+		run(0, core.TxRegisterTemplate, core.RegisterTemplatePayload{ID: "sword", Name: "Sword", Tradeable: true})
+		mint := run(1, core.TxMintAsset, core.MintAssetPayload{TemplateID: "sword"})
+		assetID := crypto.Hash([]byte(mint.ID + ":asset:sword"))
+		run(2, core.TxBurnAsset, core.BurnAssetPayload{AssetID: assetID})
+
+		asset, err := state.GetAsset(assetID)
+		if tombstones {
+			if err != nil || !asset.Burned || asset.Owner != "" || asset.BurnedAt != block.Header.Timestamp || asset.TemplateID != "sword" {
+				t.Errorf("tombstone: got %+v, %v", asset, err)
+			}
+			tx, _ := owner.NewTx(testChainID, core.TxTransferAsset, 3, 0, core.TransferAssetPayload{AssetID: assetID, To: owner.PubKey()})
+			if err := exec.ExecuteTx(block, tx); err == nil {
+				t.Error("transfer of a burned asset succeeded")
+			}
+		} else if !errors.Is(err, core.ErrNotFound) {
+			t.Errorf("hard delete: got %+v, %v want ErrNotFound", asset, err)
+		}
+		if ids, _ := idx.GetAssetsByOwner(owner.PubKey()); len(ids) != 0 {
+			t.Errorf("tombstones=%v: owner still indexed with %v", tombstones, ids)
+		}
+	}
+}
+
+// TestTransferCooldown verifies that an asset of a template with a transfer
+// cooldown cannot be transferred or listed again until the cooldown has
+// elapsed, that the error names the unlock height, and that an asset whose
+// template is missing transfers freely.
+func TestTransferCooldown(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	alice, _ := wallet.Generate()
+	bob, _ := wallet.Generate()
+	nonces := map[string]uint64{}
+	run := func(w *wallet.Wallet, height int64, typ core.TxType, payload any) (*core.Transaction, error) {
+		tx, _ := w.NewTx(testChainID, typ, nonces[w.PubKey()], 0, payload)
+		block := core.NewBlock(testChainID, height, "prev", alice.PubKey(), nil)
+		err := exec.ExecuteTx(block, tx)
+		if err == nil {
+			nonces[w.PubKey()]++
+		}
+		return tx, err
+	}
+
+	if _, err := run(alice, 1, core.TxRegisterTemplate, core.RegisterTemplatePayload{ID: "card", Tradeable: true, TransferCooldownBlocks: 10}); err != nil {
+		t.Fatal(err)
+	}
+	mint, err := run(alice, 1, core.TxMintAsset, core.MintAssetPayload{TemplateID: "card"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetID := crypto.Hash([]byte(mint.ID + ":asset:card"))
+
+	// Minting does not start a cooldown.
+	if _, err := run(alice, 2, core.TxTransferAsset, core.TransferAssetPayload{AssetID: assetID, To: bob.PubKey()}); err != nil {
+		t.Fatalf("first transfer: %v", err)
+	}
+	_, err = run(bob, 11, core.TxTransferAsset, core.TransferAssetPayload{AssetID: assetID, To: alice.PubKey()})
+	if err == nil || !strings.Contains(err.Error(), "transfer cooldown until block 12") {
+		t.Errorf("transfer during cooldown: got %v", err)
+	}
+	if _, err := run(bob, 11, core.TxListMarket, core.ListMarketPayload{AssetID: assetID, Price: 5}); err == nil || !strings.Contains(err.Error(), "until block 12") {
+		t.Errorf("listing during cooldown: got %v", err)
+	}
+	if _, err := run(bob, 12, core.TxTransferAsset, core.TransferAssetPayload{AssetID: assetID, To: alice.PubKey()}); err != nil {
+		t.Fatalf("transfer after cooldown: %v", err)
+	}
+	if asset, _ := state.GetAsset(assetID); asset.Owner != alice.PubKey() || asset.LastTransferHeight != 12 {
+		t.Errorf("asset after transfer: %+v", asset)
+	}
+
+	if _, err := run(alice, 12, core.TxRegisterTemplate, core.RegisterTemplatePayload{ID: "bad", TransferCooldownBlocks: -1}); err == nil {
+		t.Error("negative cooldown accepted")
+	}
+
+	// An asset whose template is not in state has no cooldown.
+	orphan := &core.Asset{ID: "orphan", TemplateID: "gone", Owner: alice.PubKey(), Tradeable: true, LastTransferHeight: 12}
+	if err := state.SetAsset(orphan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(alice, 12, core.TxTransferAsset, core.TransferAssetPayload{AssetID: "orphan", To: bob.PubKey()}); err != nil {
+		t.Errorf("transfer of an asset without a template: %v", err)
+	}
+}
+
+// TestIdempotencyKey verifies that a sender's transaction reusing a recent
+// idempotency key is rejected whatever its nonce, that keys are scoped per
+// sender, that a failed transaction does not consume its key, and that
+// only the most recent keys are remembered.
+func TestIdempotencyKey(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	params := vm.DefaultParams()
+	params.IdempotencyKeys = 2
+	exec.SetParams(params)
+
+	sender, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	_ = state.SetAccount(&core.Account{Address: other.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+	keyed := func(w *wallet.Wallet, amount, nonce uint64, key string) *core.Transaction {
+		tx, _ := w.Transfer(testChainID, proposer.PubKey(), amount, nonce, 0)
+		tx.IdempotencyKey = key
+		tx.Sign(w.PrivKey())
+		return tx
+	}
+
+	if err := exec.ExecuteTx(block, keyed(sender, 10, 0, "mint-1")); err != nil {
+		t.Fatalf("first keyed tx: %v", err)
+	}
+	if err := exec.ExecuteTx(block, keyed(sender, 10, 1, "mint-1")); !errors.Is(err, core.ErrDuplicateIdempotencyKey) {
+		t.Fatalf("same key, fresh nonce: got %v want ErrDuplicateIdempotencyKey", err)
+	}
+	if acc, _ := state.GetAccount(sender.PubKey()); acc.Nonce != 1 || acc.Balance != 990 {
+		t.Errorf("rejected tx changed the account: nonce %d balance %d", acc.Nonce, acc.Balance)
+	}
+	if err := exec.ExecuteTx(block, keyed(other, 10, 0, "mint-1")); err != nil {
+		t.Errorf("same key from another sender: %v", err)
+	}
+
+	if err := exec.ExecuteTx(block, keyed(sender, 5000, 1, "buy-1")); err == nil {
+		t.Fatal("overdrawn transfer should fail")
+	}
+	if err := exec.ExecuteTx(block, keyed(sender, 10, 1, "buy-1")); err != nil {
+		t.Fatalf("retry after a failed tx with the same key: %v", err)
+	}
+
+	// With a limit of two, a third key pushes out the oldest.
+	if err := exec.ExecuteTx(block, keyed(sender, 10, 2, "buy-2")); err != nil {
+		t.Fatal(err)
+	}
+	acc, _ := state.GetAccount(sender.PubKey())
+	if want := []string{"buy-1", "buy-2"}; !reflect.DeepEqual(acc.IdempotencyKeys, want) {
+		t.Errorf("remembered keys: got %v want %v", acc.IdempotencyKeys, want)
+	}
+	if err := exec.ExecuteTx(block, keyed(sender, 10, 3, "mint-1")); err != nil {
+		t.Errorf("key no longer remembered: %v", err)
+	}
+
+	long := keyed(sender, 10, 4, strings.Repeat("k", core.MaxIdempotencyKeyLength+1))
+	if err := exec.CheckTx(long); err == nil {
+		t.Error("over-long idempotency key should fail CheckTx")
+	}
+	tampered := keyed(sender, 10, 4, "a")
+	tampered.IdempotencyKey = "b"
+	if err := tampered.Verify(); err == nil {
+		t.Error("idempotency key should be covered by the signature")
+	}
+}
+
+// TestTimeLockedTx verifies that a transaction is rejected in a block below
+// its ValidFrom height without touching state, and executes from it on.
+func TestTimeLockedTx(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	sender, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+
+	tx, _ := sender.Transfer(testChainID, proposer.PubKey(), 10, 0, 0)
+	tx.ValidFrom = 3
+	tx.Sign(sender.PrivKey())
+
+	early := core.NewBlock(testChainID, 2, "prev", proposer.PubKey(), nil)
+	if err := exec.ExecuteTx(early, tx); !errors.Is(err, core.ErrTxNotYetValid) {
+		t.Fatalf("before valid_from: got %v want ErrTxNotYetValid", err)
+	}
+	if acc, _ := state.GetAccount(sender.PubKey()); acc.Nonce != 0 || acc.Balance != 1000 {
+		t.Errorf("rejected tx changed the account: nonce %d balance %d", acc.Nonce, acc.Balance)
+	}
+	block := core.NewBlock(testChainID, 3, "prev", proposer.PubKey(), nil)
+	if err := exec.ExecuteTx(block, tx); err != nil {
+		t.Fatalf("at valid_from: %v", err)
+	}
+
+	negative, _ := sender.Transfer(testChainID, proposer.PubKey(), 10, 1, 0)
+	negative.ValidFrom = -1
+	negative.Sign(sender.PrivKey())
+	if err := exec.CheckTx(negative); err == nil {
+		t.Error("negative valid_from should fail CheckTx")
+	}
+}
+
+// batchOp builds a batch operation with payload p marshalled to JSON.
+func batchOp(typ core.TxType, p any) core.BatchOp {
+	raw, _ := json.Marshal(p)
+	return core.BatchOp{Type: typ, Payload: raw}
+}
+
+// TestTxBatch verifies that a batch applies every operation under one nonce
+// and fee, giving operations of the same type distinct derived IDs.
+func TestTxBatch(t *testing.T) {
+	state := newInMemState(t)
+	emitter := events.NewEmitter()
+	exec := vm.NewExecutor(state, emitter)
+	var minted []string
+	emitter.Subscribe(events.EventAssetMinted, func(ev events.Event) {
+		minted = append(minted, ev.Data["asset_id"].(string))
+	})
+
+	server, _ := wallet.Generate()
+	player, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: server.PubKey(), Balance: 1000})
+
+	tx, _ := server.NewTx(testChainID, core.TxBatch, 0, 5, core.BatchPayload{Ops: []core.BatchOp{
+		batchOp(core.TxRegisterTemplate, core.RegisterTemplatePayload{ID: "sword", Name: "Sword", Tradeable: true}),
+		batchOp(core.TxMintAsset, core.MintAssetPayload{TemplateID: "sword", Owner: player.PubKey()}),
+		batchOp(core.TxMintAsset, core.MintAssetPayload{TemplateID: "sword", Owner: player.PubKey()}),
+		batchOp(core.TxTransfer, core.TransferPayload{To: player.PubKey(), Amount: 100}),
+	}})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+	if err := exec.ExecuteTx(block, tx); err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+
+	if acc, _ := state.GetAccount(server.PubKey()); acc.Nonce != 1 || acc.Balance != 895 {
+		t.Errorf("sender: nonce %d balance %d, want 1 and 895 (one fee)", acc.Nonce, acc.Balance)
+	}
+	if acc, _ := state.GetAccount(player.PubKey()); acc.Balance != 100 {
+		t.Errorf("player balance: got %d want 100", acc.Balance)
+	}
+	if len(minted) != 2 || minted[0] == minted[1] {
+		t.Fatalf("minted assets: got %v want two distinct IDs", minted)
+	}
+	for _, id := range minted {
+		if a, err := state.GetAsset(id); err != nil || a.Owner != player.PubKey() {
+			t.Errorf("asset %s: %+v, %v", id, a, err)
+		}
+	}
+}
+
+// TestTxBatchReverts verifies that a failing operation reverts the whole
+// batch, fee and nonce included, and that CheckTx enforces the batch shape
+// and the operations' minimum fees.
+func TestTxBatchReverts(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	sender, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: sender.PubKey(), Balance: 1000})
+	block := core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil)
+
+	transfer := func(amount uint64) core.BatchOp {
+		return batchOp(core.TxTransfer, core.TransferPayload{To: other.PubKey(), Amount: amount})
+	}
+	tx, _ := sender.NewTx(testChainID, core.TxBatch, 0, 5, core.BatchPayload{Ops: []core.BatchOp{
+		transfer(100), transfer(100), transfer(5000),
+	}})
+	err := exec.ExecuteTx(block, tx)
+	if err == nil || !strings.Contains(err.Error(), "op 2") {
+		t.Fatalf("batch with an overdrawn third op: got %v", err)
+	}
+	if acc, _ := state.GetAccount(sender.PubKey()); acc.Nonce != 0 || acc.Balance != 1000 {
+		t.Errorf("sender after failed batch: nonce %d balance %d", acc.Nonce, acc.Balance)
+	}
+	if ok, _ := state.HasAccount(other.PubKey()); ok {
+		t.Error("recipient credited by a failed batch")
+	}
+
+	params := vm.DefaultParams()
+	params.MinFees = map[core.TxType]uint64{core.TxTransfer: 2}
+	exec.SetParams(params)
+	for name, ops := range map[string][]core.BatchOp{
+		"empty":     nil,
+		"too large": make([]core.BatchOp, core.MaxBatchOps+1),
+		"nested":    {batchOp(core.TxBatch, core.BatchPayload{Ops: []core.BatchOp{transfer(1)}})},
+		"underpaid": {transfer(1), transfer(1), transfer(1)},
+	} {
+		bad, _ := sender.NewTx(testChainID, core.TxBatch, 0, 5, core.BatchPayload{Ops: ops})
+		if err := exec.CheckTx(bad); err == nil {
+			t.Errorf("%s batch should fail CheckTx", name)
+		}
+	}
+	paid, _ := sender.NewTx(testChainID, core.TxBatch, 0, 6, core.BatchPayload{Ops: []core.BatchOp{transfer(1), transfer(1), transfer(1)}})
+	if err := exec.CheckTx(paid); err != nil {
+		t.Errorf("batch paying its operations' minimum fees: %v", err)
+	}
+}
+
+// TestSameAccountRoles verifies correct balances when one account plays
+// several roles in a transaction: sender and recipient, sender and
+// proposer, or fee payer and recipient.
+func TestSameAccountRoles(t *testing.T) {
+	state := newInMemState(t)
+	exec := vm.NewExecutor(state, nil)
+	alice, _ := wallet.Generate()
+	bob, _ := wallet.Generate()
+	proposer, _ := wallet.Generate()
+	_ = state.SetAccount(&core.Account{Address: alice.PubKey(), Balance: 1000})
+	_ = state.SetAccount(&core.Account{Address: bob.PubKey(), Balance: 1000})
+	balance := func(w *wallet.Wallet) uint64 {
+		acc, _ := state.GetAccount(w.PubKey())
+		return acc.Balance
+	}
+
+	// From == To: only the fee leaves the account.
+	self, _ := alice.Transfer(testChainID, alice.PubKey(), 300, 0, 5)
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil), self); err != nil {
+		t.Fatalf("transfer to self: %v", err)
+	}
+	if acc, _ := state.GetAccount(alice.PubKey()); acc.Balance != 995 || acc.Nonce != 1 {
+		t.Errorf("transfer to self: balance %d nonce %d, want 995 and 1", acc.Balance, acc.Nonce)
+	}
+
+	// Sender == proposer: the fee comes back, the amount leaves.
+	own, _ := alice.Transfer(testChainID, bob.PubKey(), 100, 1, 5)
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", alice.PubKey(), nil), own); err != nil {
+		t.Fatalf("transfer by the proposer: %v", err)
+	}
+	if balance(alice) != 895 || balance(bob) != 1100 {
+		t.Errorf("transfer by the proposer: alice %d bob %d, want 895 and 1100", balance(alice), balance(bob))
+	}
+
+	// Fee payer == recipient: bob pays the fee and receives the amount.
+	sponsored, _ := alice.NewSponsoredTx(testChainID, core.TxTransfer, bob.PubKey(), 2, 5,
+		core.TransferPayload{To: bob.PubKey(), Amount: 50})
+	if err := bob.CoSign(sponsored); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.ExecuteTx(core.NewBlock(testChainID, 1, "prev", proposer.PubKey(), nil), sponsored); err != nil {
+		t.Fatalf("sponsored transfer to the fee payer: %v", err)
+	}
+	if balance(alice) != 845 || balance(bob) != 1145 || balance(proposer) != 10 {
+		t.Errorf("sponsored transfer: alice %d bob %d proposer %d, want 845, 1145 and 10",
+			balance(alice), balance(bob), balance(proposer))
+	}
+}
@@ -0,0 +1,277 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/wallet"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	w, _ := wallet.Generate()
+	for _, kdf := range []string{wallet.KDFPBKDF2, wallet.KDFScrypt} {
+		t.Run(kdf, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key.json")
+			if err := wallet.SaveKeyWithKDF(path, "hunter2", w.PrivKey(), kdf); err != nil {
+				t.Fatal(err)
+			}
+			priv, err := wallet.LoadKey(path, "hunter2")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if priv.Public().Hex() != w.PubKey() {
+				t.Error("loaded key does not match saved key")
+			}
+			if _, err := wallet.LoadKey(path, "wrong"); err == nil {
+				t.Error("expected error for wrong password")
+			}
+		})
+	}
+}
+
+func TestKeystoreDefaultsToScrypt(t *testing.T) {
+	w, _ := wallet.Generate()
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := wallet.SaveKey(path, "pw", w.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var ks map[string]any
+	json.Unmarshal(data, &ks)
+	if ks["kdf"] != wallet.KDFScrypt {
+		t.Errorf("kdf: got %v want %s", ks["kdf"], wallet.KDFScrypt)
+	}
+}
+
+// TestKeystoreLegacyPBKDF2 verifies that files written before the kdf field
+// existed are still readable.
+func TestKeystoreLegacyPBKDF2(t *testing.T) {
+	w, _ := wallet.Generate()
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := wallet.SaveKeyWithKDF(path, "pw", w.PrivKey(), wallet.KDFPBKDF2); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var ks map[string]any
+	json.Unmarshal(data, &ks)
+	delete(ks, "kdf")
+	delete(ks, "kdf_params")
+	data, _ = json.Marshal(ks)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := wallet.LoadKey(path, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.Public().Hex() != w.PubKey() {
+		t.Error("loaded key does not match saved key")
+	}
+}
+
+// TestKeystorePubKeyMismatch verifies that LoadKey rejects a keystore whose
+// pub_key was altered to name a different key.
+func TestKeystorePubKeyMismatch(t *testing.T) {
+	w, _ := wallet.Generate()
+	other, _ := wallet.Generate()
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := wallet.SaveKey(path, "pw", w.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	var ks map[string]any
+	json.Unmarshal(data, &ks)
+	ks["pub_key"] = other.PubKey()
+	data, _ = json.Marshal(ks)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := wallet.LoadKey(path, "pw"); !errors.Is(err, wallet.ErrPubKeyMismatch) {
+		t.Fatalf("expected ErrPubKeyMismatch, got %v", err)
+	}
+}
+
+// TestKeystoreKDFParamBounds verifies that LoadKey refuses a keystore whose
+// KDF parameters are oversized or malformed before deriving anything.
+func TestKeystoreKDFParamBounds(t *testing.T) {
+	w, _ := wallet.Generate()
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := wallet.SaveKey(path, "pw", w.PrivKey()); err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := os.ReadFile(path)
+
+	for name, params := range map[string]map[string]any{
+		"huge n":         {"n": 1 << 40, "r": 8, "p": 1},
+		"n not pow2":     {"n": 3 << 10, "r": 8, "p": 1},
+		"huge r":         {"n": 1 << 15, "r": 1 << 20, "p": 1},
+		"zero p":         {"n": 1 << 15, "r": 8, "p": 0},
+		"memory too big": {"n": 1 << 20, "r": 32, "p": 1},
+	} {
+		var ks map[string]any
+		json.Unmarshal(orig, &ks)
+		ks["kdf_params"] = params
+		data, _ := json.Marshal(ks)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wallet.LoadKey(path, "pw"); !errors.Is(err, wallet.ErrKDFParams) {
+			t.Errorf("%s: got %v want ErrKDFParams", name, err)
+		}
+	}
+}
+
+// TestKeyStoreNamedKeys verifies that a KeyStore holds several independently
+// encrypted keys, lists them by name and signs with one selected by name.
+func TestKeyStoreNamedKeys(t *testing.T) {
+	ks, err := wallet.NewKeyStore(filepath.Join(t.TempDir(), "keys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubs := map[string]string{}
+	for _, name := range []string{"validator", "treasury", "game-server"} {
+		w, err := ks.Generate(name, name+"-pw")
+		if err != nil {
+			t.Fatalf("generate %s: %v", name, err)
+		}
+		pubs[name] = w.PubKey()
+	}
+	if _, err := ks.Generate("treasury", "x"); err == nil {
+		t.Error("duplicate name should be rejected")
+	}
+
+	keys, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.Name)
+		if k.PubKey != pubs[k.Name] {
+			t.Errorf("%s pubkey: got %s want %s", k.Name, k.PubKey, pubs[k.Name])
+		}
+	}
+	if got := strings.Join(names, ","); got != "game-server,treasury,validator" {
+		t.Errorf("list: got %s", got)
+	}
+
+	tx, err := ks.NewTx("treasury", "treasury-pw", "test-chain", core.TxTransfer, 0, 0, core.TransferPayload{To: pubs["validator"], Amount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.From != pubs["treasury"] || tx.Verify() != nil {
+		t.Errorf("tx not signed by treasury: from %s", tx.From)
+	}
+	if _, err := ks.Get("treasury", "validator-pw"); err == nil {
+		t.Error("keys must be encrypted independently")
+	}
+
+	if err := ks.Remove("game-server"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("game-server", "game-server-pw"); !errors.Is(err, wallet.ErrKeyNotFound) {
+		t.Errorf("removed key: got %v want ErrKeyNotFound", err)
+	}
+}
+
+// TestDetachedSigning verifies the air-gapped flow: a transaction built
+// without the key is carried as JSON to the signer, signed detached, and
+// the returned signature attached back yields a valid transaction that a
+// node accepts, while a signature from another key or over altered
+// content is refused.
+func TestDetachedSigning(t *testing.T) {
+	treasury, _ := wallet.Generate()
+	recipient, _ := wallet.Generate()
+
+	// Online: build the unsigned transaction from the public key alone.
+	tx, err := core.NewTransaction("test-chain", core.TxTransfer, treasury.PubKey(), 0, 0, core.TransferPayload{To: recipient.PubKey(), Amount: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	carried, _ := json.Marshal(tx)
+
+	// Offline: decode and sign without modifying the transaction.
+	var offline core.Transaction
+	if err := json.Unmarshal(carried, &offline); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := treasury.SignDetached(&offline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offline.Signature != "" || offline.ID != "" {
+		t.Error("SignDetached must not modify the transaction")
+	}
+	if _, err := recipient.SignDetached(&offline); err == nil {
+		t.Error("SignDetached by a wallet other than the sender should fail")
+	}
+
+	// Online: attach and submit.
+	if err := tx.AttachSignature(sig); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if tx.ID != tx.Hash() {
+		t.Errorf("ID: got %s want %s", tx.ID, tx.Hash())
+	}
+	if resp := dispatch(newTestRPCHandler(t), "sendTx", tx); resp.Error != nil {
+		t.Fatalf("sendTx: %v", resp.Error.Message)
+	}
+
+	wrong, _ := recipient.SignDetached(&core.Transaction{From: recipient.PubKey()})
+	if err := tx.AttachSignature(wrong); !errors.Is(err, core.ErrBadSignature) {
+		t.Errorf("foreign signature: got %v want %v", err, core.ErrBadSignature)
+	}
+	tx.Fee = 1
+	if err := tx.AttachSignature(sig); !errors.Is(err, core.ErrBadSignature) {
+		t.Errorf("altered transaction: got %v want %v", err, core.ErrBadSignature)
+	}
+}
+
+// TestImportKey verifies that a raw hex ed25519 private key is saved to an
+// encrypted keystore under the expected public key, and that malformed keys
+// are refused without writing a file.
+func TestImportKey(t *testing.T) {
+	// RFC 8032 test vector 1: seed followed by its public key.
+	const pub = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	const priv = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60" + pub
+
+	path := filepath.Join(t.TempDir(), "imported.key")
+	w, err := wallet.ImportKey(path, "pw", priv+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.PubKey() != pub {
+		t.Errorf("pubkey: got %s want %s", w.PubKey(), pub)
+	}
+	loaded, err := wallet.LoadKey(path, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := wallet.New(loaded).PubKey(); got != pub {
+		t.Errorf("reloaded pubkey: got %s want %s", got, pub)
+	}
+
+	other, _ := wallet.Generate()
+	for name, key := range map[string]string{
+		"not hex":      strings.Repeat("zz", 64),
+		"seed only":    priv[:64],
+		"too long":     priv + "00",
+		"wrong pubkey": priv[:64] + other.PubKey(),
+		"empty":        "",
+	} {
+		bad := filepath.Join(t.TempDir(), "bad.key")
+		if _, err := wallet.ImportKey(bad, "pw", key); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := os.Stat(bad); !os.IsNotExist(err) {
+			t.Errorf("%s: keystore written for a malformed key", name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Package version reports the build of the running binary. The variables
+// are set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/tolelom/tolchain/version.Version=v1.2.0 \
+//	  -X github.com/tolelom/tolchain/version.GitCommit=$(git rev-parse --short HEAD)"
+package version
+
+import "fmt"
+
+// Build information; the defaults identify an unversioned development build.
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+// String returns the build information on one line, for logs.
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, GitCommit, BuildTime)
+}
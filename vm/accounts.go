@@ -0,0 +1,40 @@
+package vm
+
+import "github.com/tolelom/tolchain/core"
+
+// accountCache wraps the executor's state for the duration of one
+// transaction so that every read of an address returns the same
+// *core.Account. Two loads of one account, e.g. the sender and recipient of
+// a transfer to oneself or a fee payer who is also the proposer, then share
+// a single struct, and saving one can never overwrite the other's changes
+// with a stale copy. SetAccount writes through to the underlying state, so
+// the executor's snapshot still reverts a failed transaction; the cache
+// itself is discarded when the transaction ends.
+type accountCache struct {
+	core.State
+	accounts map[string]*core.Account
+}
+
+func newAccountCache(state core.State) *accountCache {
+	return &accountCache{State: state, accounts: make(map[string]*core.Account)}
+}
+
+func (c *accountCache) GetAccount(address string) (*core.Account, error) {
+	if acc, ok := c.accounts[address]; ok {
+		return acc, nil
+	}
+	acc, err := c.State.GetAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	c.accounts[address] = acc
+	return acc, nil
+}
+
+func (c *accountCache) SetAccount(acc *core.Account) error {
+	if err := c.State.SetAccount(acc); err != nil {
+		return err
+	}
+	c.accounts[acc.Address] = acc
+	return nil
+}
@@ -0,0 +1,41 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// CheckTemplate checks the fields of a template registration that do not
+// depend on state. The register_template handler and the genesis templates
+// share it.
+func CheckTemplate(p *core.RegisterTemplatePayload) error {
+	if p.ID == "" {
+		return errors.New("template id required")
+	}
+	if p.TransferCooldownBlocks < 0 {
+		return errors.New("transfer_cooldown_blocks must not be negative")
+	}
+	return nil
+}
+
+// CheckProperties enforces the params' key-count and encoded-size limits on
+// asset properties, which bound what an asset costs to keep in state. The
+// mint_asset handler and the genesis assets share it.
+func CheckProperties(params Params, props map[string]any) error {
+	if limit := params.MaxAssetPropertyKeys; limit > 0 && len(props) > limit {
+		return fmt.Errorf("too many properties: %d exceeds limit %d", len(props), limit)
+	}
+	if limit := params.MaxAssetPropertiesBytes; limit > 0 {
+		data, err := json.Marshal(props)
+		if err != nil {
+			return fmt.Errorf("encode properties: %w", err)
+		}
+		if len(data) > limit {
+			return fmt.Errorf("properties too large: %d bytes exceeds limit %d", len(data), limit)
+		}
+	}
+	return nil
+}
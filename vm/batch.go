@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+func init() {
+	Register(core.TxBatch, handleBatch)
+	RegisterPayload(core.TxBatch, func() any { return new(core.BatchPayload) })
+}
+
+// decodeBatch unmarshals a batch payload and checks its shape: between one
+// and core.MaxBatchOps operations, none of them a batch itself.
+func decodeBatch(payload json.RawMessage) (*core.BatchPayload, error) {
+	var p core.BatchPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("decode batch payload: %w", err)
+	}
+	if len(p.Ops) == 0 {
+		return nil, fmt.Errorf("batch has no operations")
+	}
+	if len(p.Ops) > core.MaxBatchOps {
+		return nil, fmt.Errorf("batch has %d operations, limit %d", len(p.Ops), core.MaxBatchOps)
+	}
+	for i, op := range p.Ops {
+		if op.Type == core.TxBatch {
+			return nil, fmt.Errorf("op %d: batches cannot be nested", i)
+		}
+	}
+	return &p, nil
+}
+
+// handleBatch dispatches each operation to its registered handler in order.
+// The executor applies the batch under one snapshot, so an operation's
+// failure reverts the operations before it along with the fee and nonce,
+// and the events they emitted are never published.
+//
+// Every operation runs with the batch's Context except that Tx is a copy
+// carrying the operation's Type and Payload and the ID "<batch id>/<index>",
+// so that IDs handlers derive from the transaction ID (assets, listings,
+// vesting records) stay distinct between operations.
+func handleBatch(ctx *Context, payload json.RawMessage) error {
+	p, err := decodeBatch(payload)
+	if err != nil {
+		return err
+	}
+	for i, op := range p.Ops {
+		if err := ctx.Ctx.Err(); err != nil {
+			return err
+		}
+		tx := *ctx.Tx
+		tx.ID = ctx.Tx.ID + "/" + strconv.Itoa(i)
+		tx.Type = op.Type
+		tx.Payload = op.Payload
+		opCtx := *ctx
+		opCtx.Tx = &tx
+		if err := globalRegistry.Execute(op.Type, &opCtx, op.Payload); err != nil {
+			return fmt.Errorf("op %d (%s): %w", i, op.Type, err)
+		}
+	}
+	return nil
+}
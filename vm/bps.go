@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BasisPoints is the denominator of basis-point rates: 10000 bps = 100%.
+const BasisPoints = 10_000
+
+// ApplyBasisPoints returns amount × bps / 10000 rounded down. All
+// percentage-based economics (royalties, fee splits, burns) must go through
+// it or SplitBasisPoints: the result is part of consensus state, so every
+// node has to round the same way, and integer floor division is the only
+// rule that does not depend on the platform. The product is computed in 128
+// bits, so no amount overflows. bps above BasisPoints is a programming
+// error (rates are validated when configured) and panics.
+func ApplyBasisPoints(amount, bps uint64) uint64 {
+	if bps > BasisPoints {
+		panic(fmt.Sprintf("basis points %d exceed %d", bps, BasisPoints))
+	}
+	hi, lo := bits.Mul64(amount, bps)
+	q, _ := bits.Div64(hi, lo, BasisPoints)
+	return q
+}
+
+// SplitBasisPoints divides amount into the bps share, rounded down, and
+// the remainder, so the two parts always add up to amount and the rounding
+// dust stays with the remainder.
+func SplitBasisPoints(amount, bps uint64) (share, rest uint64) {
+	share = ApplyBasisPoints(amount, bps)
+	return share, amount - share
+}
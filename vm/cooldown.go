@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// CheckTransferCooldown looks up the template of asset and returns an error
+// if the asset is still inside its template's transfer cooldown at the
+// height of the block being executed. An asset whose template is not in
+// state has no cooldown.
+func CheckTransferCooldown(ctx *Context, asset *core.Asset) error {
+	tmpl, err := ctx.State.GetTemplate(asset.TemplateID)
+	if errors.Is(err, core.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("template %q of asset %q: %w", asset.TemplateID, asset.ID, err)
+	}
+	return asset.CheckCooldown(tmpl, ctx.Block.Header.Height)
+}
@@ -1,8 +1,10 @@
 package vm
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/events"
@@ -10,57 +12,264 @@ import (
 
 // Context is passed to every Handler and provides access to the chain state,
 // the current block, the triggering transaction, and the event emitter.
+// Events emitted on Emitter are held back until the transaction succeeds,
+// so a failed and reverted transaction publishes none.
+// Ctx is cancelled when the executor's per-transaction timeout expires
+// while the node builds a block (see ExecuteProposal); long-running
+// handlers should check it and return early.
+//
+// Within one transaction State.GetAccount returns the same *core.Account
+// for an address every time, shared with the executor's fee and nonce
+// handling. A handler must therefore not modify an account it does not
+// mean to save, though a failed transaction is reverted as a whole.
 type Context struct {
+	Ctx     context.Context
 	State   core.State
 	Block   *core.Block
 	Tx      *core.Transaction
 	Emitter *events.Emitter
+	Params  Params
 }
 
 // Executor applies transactions to the state using the global Handler registry.
 type Executor struct {
-	state   core.State
-	emitter *events.Emitter
+	state     core.State
+	emitter   *events.Emitter
+	txTimeout time.Duration // handler deadline in ExecuteProposal; 0 → none
+	params    Params
+	enabled   map[core.TxType]bool // nil → every registered type is enabled
+	pending   *events.Emitter      // events of the last executed block, until PublishEvents
 }
 
 // NewExecutor creates an Executor with the given state and event emitter.
 func NewExecutor(state core.State, emitter *events.Emitter) *Executor {
-	return &Executor{state: state, emitter: emitter}
+	return &Executor{state: state, emitter: emitter, params: DefaultParams()}
 }
 
-// ExecuteBlock applies all transactions in block sequentially.
-// A failing transaction causes the whole block to be rejected.
-// EventBlockCommit is emitted by the caller (consensus) after signing so
-// the event carries the correct block hash.
+// SetParams replaces the execution limits passed to handlers.
+func (e *Executor) SetParams(p Params) {
+	e.params = p
+}
+
+// SetEnabledTxTypes restricts execution to the given transaction types;
+// transactions of any other type are rejected by CheckTx and ExecuteTx.
+// An empty list enables every registered type. Because disabled types also
+// fail in synced blocks, all validators of a chain must agree on the list.
+func (e *Executor) SetEnabledTxTypes(types []core.TxType) error {
+	if len(types) == 0 {
+		e.enabled = nil
+		return nil
+	}
+	enabled := make(map[core.TxType]bool, len(types))
+	for _, typ := range types {
+		if !IsRegistered(typ) {
+			return fmt.Errorf("unknown tx type %q", typ)
+		}
+		enabled[typ] = true
+	}
+	e.enabled = enabled
+	return nil
+}
+
+// CheckTx applies the executor's stateless admission policy to tx: its type
+// must be enabled, its fee at least the type's minimum, its idempotency key
+// no longer than core.MaxIdempotencyKeyLength and its ValidFrom height not
+// negative. It is suitable as a mempool validator, and ExecuteTx applies it
+// before charging the fee.
+//
+// Every operation of a batch must be of an enabled type too, and the
+// batch's fee must also cover the sum of its operations' minimum fees.
+func (e *Executor) CheckTx(tx *core.Transaction) error {
+	if e.enabled != nil && !e.enabled[tx.Type] {
+		return fmt.Errorf("tx type %q is disabled on this chain", tx.Type)
+	}
+	if len(tx.IdempotencyKey) > core.MaxIdempotencyKeyLength {
+		return fmt.Errorf("idempotency key is %d bytes, limit %d", len(tx.IdempotencyKey), core.MaxIdempotencyKeyLength)
+	}
+	if tx.ValidFrom < 0 {
+		return fmt.Errorf("valid_from must not be negative, got %d", tx.ValidFrom)
+	}
+	minFee := e.params.MinFees[tx.Type]
+	if tx.Type == core.TxBatch {
+		batch, err := decodeBatch(tx.Payload)
+		if err != nil {
+			return err
+		}
+		var opsFee uint64
+		for i, op := range batch.Ops {
+			if e.enabled != nil && !e.enabled[op.Type] {
+				return fmt.Errorf("op %d: tx type %q is disabled on this chain", i, op.Type)
+			}
+			opFee := e.params.MinFees[op.Type]
+			if opsFee > math.MaxUint64-opFee {
+				return fmt.Errorf("minimum fee of the batch overflows")
+			}
+			opsFee += opFee
+		}
+		minFee = max(minFee, opsFee)
+	}
+	if tx.Fee < minFee {
+		return fmt.Errorf("fee %d below the minimum %d for %s transactions", tx.Fee, minFee, tx.Type)
+	}
+	return nil
+}
+
+// SetTxTimeout bounds how long a single transaction handler may run while
+// the node executes a block it is proposing (see ExecuteProposal). A
+// handler exceeding d is abandoned and the transaction fails and is
+// reverted. The abandoned goroutine is leaked until the handler returns,
+// but can no longer read or write state. d <= 0 disables the timeout.
+//
+// Blocks from peers are never held to it: how long a handler takes depends
+// on the local machine and its load, so a deadline there would let a slow
+// node reject a block the proposer accepted and fork.
+func (e *Executor) SetTxTimeout(d time.Duration) {
+	e.txTimeout = d
+}
+
+// TxError reports the transaction that caused ExecuteBlock to fail.
+type TxError struct {
+	Tx  *core.Transaction
+	Err error
+}
+
+func (e *TxError) Error() string { return fmt.Sprintf("tx %s failed: %v", e.Tx.ID, e.Err) }
+func (e *TxError) Unwrap() error { return e.Err }
+
+// ExecuteBlock applies all transactions in block sequentially, then credits
+// the proposer with the block reward. A failing transaction causes the
+// whole block to be rejected and is reported as *TxError.
+//
+// The block's events are held until the caller has committed the signed
+// block and calls PublishEvents.
 func (e *Executor) ExecuteBlock(block *core.Block) error {
+	return e.executeBlock(block, 0)
+}
+
+// ExecuteProposal is ExecuteBlock for a block the local node is building:
+// each handler is bounded by the tx timeout (see SetTxTimeout), and one
+// exceeding it fails the block with *TxError so the proposer can evict the
+// transaction and try again without it.
+func (e *Executor) ExecuteProposal(block *core.Block) error {
+	return e.executeBlock(block, e.txTimeout)
+}
+
+// executeBlock executes block with handlers bounded by timeout (<= 0 →
+// unbounded).
+func (e *Executor) executeBlock(block *core.Block, timeout time.Duration) error {
+	e.pending = nil
+	buf := e.emitter.Buffer()
 	for _, tx := range block.Transactions {
-		if err := e.ExecuteTx(block, tx); err != nil {
-			return fmt.Errorf("tx %s failed: %w", tx.ID, err)
+		if err := e.executeTx(block, tx, timeout, buf); err != nil {
+			return &TxError{Tx: tx, Err: err}
 		}
 	}
+	if err := e.creditBlockReward(block, buf); err != nil {
+		return err
+	}
+	e.pending = buf
+	return nil
+}
+
+// PublishEvents delivers the events of block, last executed by ExecuteBlock
+// or ExecuteProposal, followed by EventBlockCommit carrying its hash.
+// Callers invoke it once the block and its state are committed, so
+// subscribers never see events of a block that is rebuilt, reverted or
+// rejected; the events of a block that is not committed are dropped by the
+// next execution.
+func (e *Executor) PublishEvents(block *core.Block) {
+	e.pending.Flush()
+	e.pending = nil
+	if e.emitter != nil {
+		e.emitter.Emit(events.Event{
+			Type:        events.EventBlockCommit,
+			BlockHeight: block.Header.Height,
+			Data:        map[string]any{"hash": block.Hash, "txs": len(block.Transactions)},
+		})
+	}
+}
+
+// creditBlockReward mints params.BlockReward to the block proposer. It runs
+// on both the producing and the syncing path, so the reward is captured by
+// the state root and every node must agree on it.
+func (e *Executor) creditBlockReward(block *core.Block, emitter *events.Emitter) error {
+	reward := e.params.BlockReward
+	if reward == 0 || block.Header.Proposer == "" {
+		return nil
+	}
+	acc, err := e.state.GetAccount(block.Header.Proposer)
+	if err != nil {
+		return fmt.Errorf("get proposer account: %w", err)
+	}
+	if acc.Balance > math.MaxUint64-reward {
+		return fmt.Errorf("proposer balance overflow")
+	}
+	acc.Balance += reward
+	if err := e.state.SetAccount(acc); err != nil {
+		return fmt.Errorf("set proposer account: %w", err)
+	}
+	supply, err := e.state.GetTotalSupply()
+	if err != nil {
+		return fmt.Errorf("get total supply: %w", err)
+	}
+	if supply > math.MaxUint64-reward {
+		return fmt.Errorf("total supply overflow")
+	}
+	if err := e.state.SetTotalSupply(supply + reward); err != nil {
+		return fmt.Errorf("set total supply: %w", err)
+	}
+	if emitter != nil {
+		emitter.Emit(events.Event{
+			Type:        events.EventBlockReward,
+			BlockHeight: block.Header.Height,
+			Data:        map[string]any{"to": block.Header.Proposer, "amount": reward},
+		})
+	}
 	return nil
 }
 
 // ExecuteTx verifies and executes a single transaction with snapshot/rollback.
+// A transaction below its ValidFrom height fails with core.ErrTxNotYetValid.
+// Its events are published as soon as it succeeds.
 func (e *Executor) ExecuteTx(block *core.Block, tx *core.Transaction) error {
-	if err := tx.Verify(); err != nil {
+	return e.executeTx(block, tx, 0, e.emitter)
+}
+
+// executeTx is ExecuteTx with the handler bounded by timeout (<= 0 →
+// unbounded), emitting the transaction's events on emitter once it
+// succeeds.
+func (e *Executor) executeTx(block *core.Block, tx *core.Transaction, timeout time.Duration, emitter *events.Emitter) error {
+	// Both IDs are signed, so a transaction cannot be replayed into a
+	// block of another network.
+	if tx.ChainID != block.Header.ChainID {
+		return fmt.Errorf("chain ID mismatch: tx %q block %q", tx.ChainID, block.Header.ChainID)
+	}
+	if err := tx.VerifyChain(block.Header.ChainID); err != nil {
 		return fmt.Errorf("signature: %w", err)
 	}
+	if !tx.EligibleAt(block.Header.Height) {
+		return fmt.Errorf("%w: valid from height %d, block %d", core.ErrTxNotYetValid, tx.ValidFrom, block.Header.Height)
+	}
+	if err := e.CheckTx(tx); err != nil {
+		return err
+	}
 
 	snapID, err := e.state.Snapshot()
 	if err != nil {
 		return fmt.Errorf("snapshot: %w", err)
 	}
 
-	if err := e.applyTx(block, tx); err != nil {
+	buf := emitter.Buffer()
+	if err := e.applyTx(block, tx, timeout, buf); err != nil {
 		if revertErr := e.state.RevertToSnapshot(snapID); revertErr != nil {
 			return fmt.Errorf("revert snapshot after tx failure: %w (revert: %v)", err, revertErr)
 		}
 		return err
 	}
 
-	if e.emitter != nil {
-		e.emitter.Emit(events.Event{
+	buf.Flush()
+	if emitter != nil {
+		emitter.Emit(events.Event{
 			Type:        events.EventTxExecuted,
 			TxID:        tx.ID,
 			BlockHeight: block.Header.Height,
@@ -70,33 +279,55 @@ func (e *Executor) ExecuteTx(block *core.Block, tx *core.Transaction) error {
 	return nil
 }
 
-// applyTx deducts the fee, increments the nonce, then dispatches to the handler.
-func (e *Executor) applyTx(block *core.Block, tx *core.Transaction) error {
-	acc, err := e.state.GetAccount(tx.From)
+// applyTx deducts the fee, increments the nonce, records the idempotency
+// key, then dispatches to the handler, which emits its events on emitter. A
+// failed transaction is reverted by the caller, so its key may be used
+// again. Accounts are read through one
+// accountCache for the whole transaction, so the sender, fee payer,
+// proposer and whatever the handler touches are each a single struct even
+// when they are the same address.
+func (e *Executor) applyTx(block *core.Block, tx *core.Transaction, timeout time.Duration, emitter *events.Emitter) error {
+	st := newAccountCache(e.state)
+	acc, err := st.GetAccount(tx.From)
 	if err != nil {
 		return fmt.Errorf("get account: %w", err)
 	}
 	if acc.Nonce != tx.Nonce {
 		return fmt.Errorf("invalid nonce: expected %d got %d", acc.Nonce, tx.Nonce)
 	}
-	if acc.Balance < tx.Fee {
-		return fmt.Errorf("insufficient balance for fee: have %d need %d", acc.Balance, tx.Fee)
-	}
 	if acc.Nonce == math.MaxUint64 {
 		return fmt.Errorf("nonce overflow for account %s", tx.From)
 	}
-	acc.Balance -= tx.Fee
 	acc.Nonce++
+	if key := tx.IdempotencyKey; key != "" {
+		if acc.HasIdempotencyKey(key) {
+			return fmt.Errorf("%w %q from %s", core.ErrDuplicateIdempotencyKey, key, tx.From)
+		}
+		acc.AddIdempotencyKey(key, max(e.params.IdempotencyKeys, 1))
+	}
+	if err := st.SetAccount(acc); err != nil {
+		return err
+	}
 
-	// (D) Credit fee to block proposer instead of burning it.
-	// When sender IS the proposer, both adjustments must be applied to the
-	// same in-memory struct to avoid a later SetAccount overwriting the first.
-	if tx.Fee > 0 && block.Header.Proposer != "" && tx.From != block.Header.Proposer {
-		// Different accounts: save sender, then load & credit proposer.
-		if err := e.state.SetAccount(acc); err != nil {
-			return err
+	// A sponsored transaction charges the fee to the fee payer, whose
+	// co-signature ExecuteTx has already verified.
+	payer := acc
+	if tx.FeePayer != "" {
+		if payer, err = st.GetAccount(tx.FeePayer); err != nil {
+			return fmt.Errorf("get fee payer account: %w", err)
 		}
-		proposer, err := e.state.GetAccount(block.Header.Proposer)
+	}
+	if payer.Balance < tx.Fee {
+		return fmt.Errorf("insufficient balance for fee: have %d need %d", payer.Balance, tx.Fee)
+	}
+	payer.Balance -= tx.Fee
+	if err := st.SetAccount(payer); err != nil {
+		return err
+	}
+
+	// (D) Credit fee to block proposer instead of burning it.
+	if tx.Fee > 0 && block.Header.Proposer != "" {
+		proposer, err := st.GetAccount(block.Header.Proposer)
 		if err != nil {
 			return fmt.Errorf("get proposer account: %w", err)
 		}
@@ -104,25 +335,55 @@ func (e *Executor) applyTx(block *core.Block, tx *core.Transaction) error {
 			return fmt.Errorf("proposer balance overflow")
 		}
 		proposer.Balance += tx.Fee
-		if err := e.state.SetAccount(proposer); err != nil {
+		if err := st.SetAccount(proposer); err != nil {
 			return fmt.Errorf("set proposer account: %w", err)
 		}
-	} else {
-		// Same account (or fee==0): fee deduction and credit cancel out on
-		// the same struct, so just save the nonce increment.
-		if tx.Fee > 0 && tx.From == block.Header.Proposer {
-			acc.Balance += tx.Fee
-		}
-		if err := e.state.SetAccount(acc); err != nil {
-			return err
+	}
+
+	if timeout <= 0 {
+		ctx := &Context{
+			Ctx:     context.Background(),
+			State:   st,
+			Block:   block,
+			Tx:      tx,
+			Emitter: emitter,
+			Params:  e.params,
 		}
+		return globalRegistry.Execute(tx.Type, ctx, tx.Payload)
 	}
+	return e.executeWithTimeout(block, tx, st, timeout, emitter)
+}
+
+// executeWithTimeout runs the handler on st in a goroutine and gives up on
+// it once timeout elapses. The caller reverts the snapshot on error.
+func (e *Executor) executeWithTimeout(block *core.Block, tx *core.Transaction, st core.State, timeout time.Duration, emitter *events.Emitter) error {
+	runCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
+	guard := &guardedState{State: st}
 	ctx := &Context{
-		State:   e.state,
+		Ctx:     runCtx,
+		State:   guard,
 		Block:   block,
 		Tx:      tx,
-		Emitter: e.emitter,
+		Emitter: emitter,
+		Params:  e.params,
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("handler panic: %v", r)
+			}
+		}()
+		done <- globalRegistry.Execute(tx.Type, ctx, tx.Payload)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-runCtx.Done():
+		guard.abort()
+		return fmt.Errorf("handler for %s exceeded timeout %s", tx.Type, timeout)
 	}
-	return globalRegistry.Execute(tx.Type, ctx, tx.Payload)
 }
@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// errTxAborted is returned to a handler that touches state after its
+// transaction was aborted by the executor.
+var errTxAborted = errors.New("vm: transaction aborted")
+
+// guardedState wraps the executor's state for a handler running under a
+// timeout. Once abort returns, every call fails with errTxAborted, so a
+// handler that outlives its deadline cannot mutate state after the executor
+// has reverted the snapshot. Calls are also serialised with abort so the
+// revert never races an in-flight write.
+type guardedState struct {
+	core.State
+	mu      sync.Mutex
+	aborted bool
+}
+
+func (g *guardedState) abort() {
+	g.mu.Lock()
+	g.aborted = true
+	g.mu.Unlock()
+}
+
+// do runs fn unless the guard has been aborted.
+func (g *guardedState) do(fn func() error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.aborted {
+		return errTxAborted
+	}
+	return fn()
+}
+
+func (g *guardedState) GetAccount(address string) (acc *core.Account, err error) {
+	err = g.do(func() error { acc, err = g.State.GetAccount(address); return err })
+	return acc, err
+}
+
+func (g *guardedState) SetAccount(account *core.Account) error {
+	return g.do(func() error { return g.State.SetAccount(account) })
+}
+
+func (g *guardedState) HasAccount(address string) (ok bool, err error) {
+	err = g.do(func() error { ok, err = g.State.HasAccount(address); return err })
+	return ok, err
+}
+
+func (g *guardedState) GetAsset(id string) (asset *core.Asset, err error) {
+	err = g.do(func() error { asset, err = g.State.GetAsset(id); return err })
+	return asset, err
+}
+
+func (g *guardedState) SetAsset(asset *core.Asset) error {
+	return g.do(func() error { return g.State.SetAsset(asset) })
+}
+
+func (g *guardedState) DeleteAsset(id string) error {
+	return g.do(func() error { return g.State.DeleteAsset(id) })
+}
+
+func (g *guardedState) GetTemplate(id string) (t *core.AssetTemplate, err error) {
+	err = g.do(func() error { t, err = g.State.GetTemplate(id); return err })
+	return t, err
+}
+
+func (g *guardedState) SetTemplate(t *core.AssetTemplate) error {
+	return g.do(func() error { return g.State.SetTemplate(t) })
+}
+
+func (g *guardedState) GetSession(id string) (s *core.Session, err error) {
+	err = g.do(func() error { s, err = g.State.GetSession(id); return err })
+	return s, err
+}
+
+func (g *guardedState) SetSession(s *core.Session) error {
+	return g.do(func() error { return g.State.SetSession(s) })
+}
+
+func (g *guardedState) GetListing(id string) (l *core.MarketListing, err error) {
+	err = g.do(func() error { l, err = g.State.GetListing(id); return err })
+	return l, err
+}
+
+func (g *guardedState) SetListing(l *core.MarketListing) error {
+	return g.do(func() error { return g.State.SetListing(l) })
+}
+
+func (g *guardedState) GetVesting(id string) (v *core.Vesting, err error) {
+	err = g.do(func() error { v, err = g.State.GetVesting(id); return err })
+	return v, err
+}
+
+func (g *guardedState) SetVesting(v *core.Vesting) error {
+	return g.do(func() error { return g.State.SetVesting(v) })
+}
+
+func (g *guardedState) GetCustomRecord(id string) (r *core.CustomRecord, err error) {
+	err = g.do(func() error { r, err = g.State.GetCustomRecord(id); return err })
+	return r, err
+}
+
+func (g *guardedState) SetCustomRecord(r *core.CustomRecord) error {
+	return g.do(func() error { return g.State.SetCustomRecord(r) })
+}
+
+func (g *guardedState) GetValidatorBond(validator string) (b *core.ValidatorBond, err error) {
+	err = g.do(func() error { b, err = g.State.GetValidatorBond(validator); return err })
+	return b, err
+}
+
+func (g *guardedState) SetValidatorBond(b *core.ValidatorBond) error {
+	return g.do(func() error { return g.State.SetValidatorBond(b) })
+}
+
+func (g *guardedState) GetTotalSupply() (supply uint64, err error) {
+	err = g.do(func() error { supply, err = g.State.GetTotalSupply(); return err })
+	return supply, err
+}
+
+func (g *guardedState) SetTotalSupply(supply uint64) error {
+	return g.do(func() error { return g.State.SetTotalSupply(supply) })
+}
+
+// Handlers must not snapshot, commit or compute roots themselves; the
+// executor owns those operations.
+
+func (g *guardedState) Snapshot() (int, error) {
+	return 0, errors.New("vm: Snapshot not allowed in handler")
+}
+
+func (g *guardedState) RevertToSnapshot(int) error {
+	return errors.New("vm: RevertToSnapshot not allowed in handler")
+}
+
+func (g *guardedState) Commit() error { return errors.New("vm: Commit not allowed in handler") }
@@ -15,6 +15,11 @@ func init() {
 	vm.Register(core.TxMintAsset, handleMintAsset)
 	vm.Register(core.TxBurnAsset, handleBurnAsset)
 	vm.Register(core.TxTransferAsset, handleTransferAsset)
+	vm.Register(core.TxBatchTransferAsset, handleBatchTransferAsset)
+	vm.RegisterPayload(core.TxMintAsset, func() any { return new(core.MintAssetPayload) })
+	vm.RegisterPayload(core.TxBurnAsset, func() any { return new(core.BurnAssetPayload) })
+	vm.RegisterPayload(core.TxTransferAsset, func() any { return new(core.TransferAssetPayload) })
+	vm.RegisterPayload(core.TxBatchTransferAsset, func() any { return new(core.BatchTransferAssetPayload) })
 }
 
 func handleMintAsset(ctx *vm.Context, payload json.RawMessage) error {
@@ -26,6 +31,10 @@ func handleMintAsset(ctx *vm.Context, payload json.RawMessage) error {
 		return errors.New("template_id required")
 	}
 
+	if err := vm.CheckProperties(ctx.Params, p.Properties); err != nil {
+		return err
+	}
+
 	tmpl, err := ctx.State.GetTemplate(p.TemplateID)
 	if err != nil {
 		return fmt.Errorf("template %q not found: %w", p.TemplateID, err)
@@ -80,11 +89,22 @@ func handleBurnAsset(ctx *vm.Context, payload json.RawMessage) error {
 	if asset.Owner != ctx.Tx.From {
 		return errors.New("only the asset owner can burn it")
 	}
-	if asset.ActiveListingID != "" {
-		return fmt.Errorf("asset %q has an active listing; cancel it before burning", p.AssetID)
+	if err := asset.CheckMovable(ctx.Block.Header.Timestamp); err != nil {
+		return err
 	}
 
-	if err := ctx.State.DeleteAsset(p.AssetID); err != nil {
+	owner := asset.Owner
+	if ctx.Params.BurnTombstones {
+		// Keep the record so the asset reads as burned rather than
+		// unknown; its template and properties stay for provenance.
+		asset.Owner = ""
+		asset.Burned = true
+		asset.BurnedAt = ctx.Block.Header.Timestamp
+		err = ctx.State.SetAsset(asset)
+	} else {
+		err = ctx.State.DeleteAsset(p.AssetID)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -93,7 +113,7 @@ func handleBurnAsset(ctx *vm.Context, payload json.RawMessage) error {
 			Type:        events.EventAssetBurned,
 			TxID:        ctx.Tx.ID,
 			BlockHeight: ctx.Block.Header.Height,
-			Data:        map[string]any{"asset_id": p.AssetID, "owner": asset.Owner},
+			Data:        map[string]any{"asset_id": p.AssetID, "owner": owner, "template_id": asset.TemplateID},
 		})
 	}
 	return nil
@@ -122,11 +142,16 @@ func handleTransferAsset(ctx *vm.Context, payload json.RawMessage) error {
 	if !asset.Tradeable {
 		return errors.New("asset is not tradeable")
 	}
-	if asset.ActiveListingID != "" {
-		return fmt.Errorf("asset %q has an active listing; cancel it before transferring", p.AssetID)
+	if err := asset.CheckMovable(ctx.Block.Header.Timestamp); err != nil {
+		return err
+	}
+	if err := vm.CheckTransferCooldown(ctx, asset); err != nil {
+		return err
 	}
 
 	asset.Owner = p.To
+	asset.LockedBy, asset.LockExpiry = "", 0 // drop any lapsed lock
+	asset.LastTransferHeight = ctx.Block.Header.Height
 	if err := ctx.State.SetAsset(asset); err != nil {
 		return err
 	}
@@ -141,3 +166,70 @@ func handleTransferAsset(ctx *vm.Context, payload json.RawMessage) error {
 	}
 	return nil
 }
+
+func handleBatchTransferAsset(ctx *vm.Context, payload json.RawMessage) error {
+	var p core.BatchTransferAssetPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode batch_transfer_asset payload: %w", err)
+	}
+	if p.To == "" {
+		return errors.New("to address required")
+	}
+	if _, err := crypto.PubKeyFromHex(p.To); err != nil {
+		return fmt.Errorf("invalid to pubkey: %w", err)
+	}
+	if len(p.AssetIDs) == 0 {
+		return errors.New("asset_ids required")
+	}
+	if len(p.AssetIDs) > core.MaxBatchTransferAssets {
+		return fmt.Errorf("batch of %d assets exceeds limit %d", len(p.AssetIDs), core.MaxBatchTransferAssets)
+	}
+
+	// Check every asset before moving any, so a rejected batch emits no
+	// events; the executor's snapshot reverts the state either way.
+	assets := make([]*core.Asset, 0, len(p.AssetIDs))
+	seen := make(map[string]bool, len(p.AssetIDs))
+	for _, id := range p.AssetIDs {
+		if seen[id] {
+			return fmt.Errorf("asset %q listed twice", id)
+		}
+		seen[id] = true
+		asset, err := ctx.State.GetAsset(id)
+		if err != nil {
+			return fmt.Errorf("asset %q not found: %w", id, err)
+		}
+		if asset.Owner != ctx.Tx.From {
+			return fmt.Errorf("asset %q: only the asset owner can transfer it", id)
+		}
+		if !asset.Tradeable {
+			return fmt.Errorf("asset %q is not tradeable", id)
+		}
+		if err := asset.CheckMovable(ctx.Block.Header.Timestamp); err != nil {
+			return err
+		}
+		if err := vm.CheckTransferCooldown(ctx, asset); err != nil {
+			return err
+		}
+		assets = append(assets, asset)
+	}
+
+	for _, asset := range assets {
+		asset.Owner = p.To
+		asset.LockedBy, asset.LockExpiry = "", 0 // drop any lapsed lock
+		asset.LastTransferHeight = ctx.Block.Header.Height
+		if err := ctx.State.SetAsset(asset); err != nil {
+			return err
+		}
+	}
+	if ctx.Emitter != nil {
+		for _, asset := range assets {
+			ctx.Emitter.Emit(events.Event{
+				Type:        events.EventAssetTransfer,
+				TxID:        ctx.Tx.ID,
+				BlockHeight: ctx.Block.Header.Height,
+				Data:        map[string]any{"asset_id": asset.ID, "from": ctx.Tx.From, "to": p.To},
+			})
+		}
+	}
+	return nil
+}
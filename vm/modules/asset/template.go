@@ -12,6 +12,7 @@ import (
 
 func init() {
 	vm.Register(core.TxRegisterTemplate, handleRegisterTemplate)
+	vm.RegisterPayload(core.TxRegisterTemplate, func() any { return new(core.RegisterTemplatePayload) })
 }
 
 func handleRegisterTemplate(ctx *vm.Context, payload json.RawMessage) error {
@@ -19,8 +20,8 @@ func handleRegisterTemplate(ctx *vm.Context, payload json.RawMessage) error {
 	if err := json.Unmarshal(payload, &p); err != nil {
 		return fmt.Errorf("decode register_template payload: %w", err)
 	}
-	if p.ID == "" {
-		return errors.New("template id required")
+	if err := vm.CheckTemplate(&p); err != nil {
+		return err
 	}
 
 	// Prevent overwriting an existing template
@@ -38,6 +39,8 @@ func handleRegisterTemplate(ctx *vm.Context, payload json.RawMessage) error {
 		Schema:    p.Schema,
 		Tradeable: p.Tradeable,
 		Creator:   ctx.Tx.From,
+
+		TransferCooldownBlocks: p.TransferCooldownBlocks,
 	}
 	if err := ctx.State.SetTemplate(t); err != nil {
 		return err
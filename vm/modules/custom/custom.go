@@ -0,0 +1,41 @@
+package custom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/vm"
+)
+
+func init() {
+	vm.Register(core.TxCustom, handleCustom)
+	vm.RegisterPayload(core.TxCustom, func() any { return new(core.CustomPayload) })
+}
+
+// handleCustom validates the payload data against its registered schema and
+// stores it as a custom record under the transaction ID.
+func handleCustom(ctx *vm.Context, payload json.RawMessage) error {
+	var p core.CustomPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode custom payload: %w", err)
+	}
+	if p.Schema == "" {
+		return errors.New("schema required")
+	}
+	schema, ok := ctx.Params.CustomSchemas[p.Schema]
+	if !ok {
+		return fmt.Errorf("unknown custom schema %q", p.Schema)
+	}
+	if err := schema.Validate(p.Data); err != nil {
+		return fmt.Errorf("custom schema %q: %w", p.Schema, err)
+	}
+	return ctx.State.SetCustomRecord(&core.CustomRecord{
+		ID:        ctx.Tx.ID,
+		Schema:    p.Schema,
+		From:      ctx.Tx.From,
+		Data:      p.Data,
+		CreatedAt: ctx.Block.Header.Timestamp,
+	})
+}
@@ -13,6 +13,7 @@ import (
 
 func init() {
 	vm.Register(core.TxTransfer, handleTransfer)
+	vm.RegisterPayload(core.TxTransfer, func() any { return new(core.TransferPayload) })
 }
 
 func handleTransfer(ctx *vm.Context, payload json.RawMessage) error {
@@ -29,15 +30,35 @@ func handleTransfer(ctx *vm.Context, payload json.RawMessage) error {
 	if _, err := crypto.PubKeyFromHex(p.To); err != nil {
 		return fmt.Errorf("invalid to address: %w", err)
 	}
+	if minAmount := ctx.Params.MinTransferAmount; p.Amount < minAmount {
+		return fmt.Errorf("transfer amount %d below minimum %d", p.Amount, minAmount)
+	}
+
+	// Creating a recipient account costs a deposit, burned from the sender,
+	// to make state-bloating dust transfers to fresh addresses expensive.
+	var deposit uint64
+	if ctx.Params.AccountCreationDeposit > 0 && p.To != ctx.Tx.From {
+		exists, err := ctx.State.HasAccount(p.To)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			deposit = ctx.Params.AccountCreationDeposit
+		}
+	}
+	if p.Amount > math.MaxUint64-deposit {
+		return fmt.Errorf("transfer amount plus deposit overflows")
+	}
+	total := p.Amount + deposit
 
 	sender, err := ctx.State.GetAccount(ctx.Tx.From)
 	if err != nil {
 		return err
 	}
-	if sender.Balance < p.Amount {
-		return fmt.Errorf("insufficient balance: have %d, need %d", sender.Balance, p.Amount)
+	if sender.Balance < total {
+		return fmt.Errorf("insufficient balance: have %d, need %d", sender.Balance, total)
 	}
-	sender.Balance -= p.Amount
+	sender.Balance -= total
 	if err := ctx.State.SetAccount(sender); err != nil {
 		return err
 	}
@@ -53,6 +74,16 @@ func handleTransfer(ctx *vm.Context, payload json.RawMessage) error {
 	if err := ctx.State.SetAccount(recipient); err != nil {
 		return err
 	}
+	if deposit > 0 {
+		supply, err := ctx.State.GetTotalSupply()
+		if err != nil {
+			return err
+		}
+		// Chains started before supply accounting have no counter to burn from.
+		if err := ctx.State.SetTotalSupply(supply - min(deposit, supply)); err != nil {
+			return err
+		}
+	}
 
 	if ctx.Emitter != nil {
 		ctx.Emitter.Emit(events.Event{
@@ -60,9 +91,10 @@ func handleTransfer(ctx *vm.Context, payload json.RawMessage) error {
 			TxID:        ctx.Tx.ID,
 			BlockHeight: ctx.Block.Header.Height,
 			Data: map[string]any{
-				"from":   ctx.Tx.From,
-				"to":     p.To,
-				"amount": p.Amount,
+				"from":    ctx.Tx.From,
+				"to":      p.To,
+				"amount":  p.Amount,
+				"deposit": deposit,
 			},
 		})
 	}
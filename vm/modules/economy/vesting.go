@@ -0,0 +1,135 @@
+package economy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
+	"github.com/tolelom/tolchain/events"
+	"github.com/tolelom/tolchain/vm"
+)
+
+func init() {
+	vm.Register(core.TxScheduleTransfer, handleScheduleTransfer)
+	vm.Register(core.TxClaimVested, handleClaimVested)
+	vm.RegisterPayload(core.TxScheduleTransfer, func() any { return new(core.ScheduleTransferPayload) })
+	vm.RegisterPayload(core.TxClaimVested, func() any { return new(core.ClaimVestedPayload) })
+}
+
+// handleScheduleTransfer locks the sum of all tranches from the sender into
+// a new vesting record. Every tranche must mature after the current block,
+// so release is driven only by later block heights and timestamps.
+func handleScheduleTransfer(ctx *vm.Context, payload json.RawMessage) error {
+	var p core.ScheduleTransferPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode schedule_transfer payload: %w", err)
+	}
+	if _, err := crypto.PubKeyFromHex(p.To); err != nil {
+		return fmt.Errorf("invalid to address: %w", err)
+	}
+	if len(p.Tranches) == 0 {
+		return errors.New("at least one tranche required")
+	}
+	if len(p.Tranches) > core.MaxVestingTranches {
+		return fmt.Errorf("too many tranches: %d exceeds limit %d", len(p.Tranches), core.MaxVestingTranches)
+	}
+	height, now := ctx.Block.Header.Height, ctx.Block.Header.Timestamp
+	var total uint64
+	for i, t := range p.Tranches {
+		if t.Amount == 0 {
+			return fmt.Errorf("tranche %d: amount must be > 0", i)
+		}
+		if t.Height < 0 || t.Timestamp < 0 {
+			return fmt.Errorf("tranche %d: height and timestamp must not be negative", i)
+		}
+		if t.Matured(height, now) {
+			return fmt.Errorf("tranche %d: must mature after block %d (time %d)", i, height, now)
+		}
+		if t.Amount > math.MaxUint64-total {
+			return errors.New("vesting total overflows")
+		}
+		total += t.Amount
+	}
+
+	sender, err := ctx.State.GetAccount(ctx.Tx.From)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < total {
+		return fmt.Errorf("insufficient balance: have %d, need %d", sender.Balance, total)
+	}
+	sender.Balance -= total
+	if err := ctx.State.SetAccount(sender); err != nil {
+		return err
+	}
+
+	v := &core.Vesting{
+		ID:        crypto.Hash([]byte(ctx.Tx.ID + ":vesting")),
+		From:      ctx.Tx.From,
+		To:        p.To,
+		Tranches:  p.Tranches,
+		CreatedAt: now,
+	}
+	if err := ctx.State.SetVesting(v); err != nil {
+		return err
+	}
+
+	if ctx.Emitter != nil {
+		ctx.Emitter.Emit(events.Event{
+			Type:        events.EventVestingScheduled,
+			TxID:        ctx.Tx.ID,
+			BlockHeight: height,
+			Data:        map[string]any{"vesting_id": v.ID, "from": v.From, "to": v.To, "amount": total, "tranches": len(v.Tranches)},
+		})
+	}
+	return nil
+}
+
+// handleClaimVested pays the recipient every matured tranche not yet claimed.
+// A claim with nothing matured is rejected.
+func handleClaimVested(ctx *vm.Context, payload json.RawMessage) error {
+	var p core.ClaimVestedPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode claim_vested payload: %w", err)
+	}
+	v, err := ctx.State.GetVesting(p.VestingID)
+	if err != nil {
+		return fmt.Errorf("vesting %q not found: %w", p.VestingID, err)
+	}
+	if v.To != ctx.Tx.From {
+		return errors.New("only the vesting recipient can claim")
+	}
+	amount := v.Claimable(ctx.Block.Header.Height, ctx.Block.Header.Timestamp)
+	if amount == 0 {
+		return fmt.Errorf("vesting %q has no matured unclaimed tokens", p.VestingID)
+	}
+
+	recipient, err := ctx.State.GetAccount(v.To)
+	if err != nil {
+		return err
+	}
+	if recipient.Balance > math.MaxUint64-amount {
+		return errors.New("recipient balance overflow")
+	}
+	recipient.Balance += amount
+	if err := ctx.State.SetAccount(recipient); err != nil {
+		return err
+	}
+	v.Claimed += amount
+	if err := ctx.State.SetVesting(v); err != nil {
+		return err
+	}
+
+	if ctx.Emitter != nil {
+		ctx.Emitter.Emit(events.Event{
+			Type:        events.EventVestingClaimed,
+			TxID:        ctx.Tx.ID,
+			BlockHeight: ctx.Block.Header.Height,
+			Data:        map[string]any{"vesting_id": v.ID, "to": v.To, "amount": amount, "remaining": v.Total() - v.Claimed},
+		})
+	}
+	return nil
+}
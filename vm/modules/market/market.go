@@ -15,6 +15,10 @@ import (
 func init() {
 	vm.Register(core.TxListMarket, handleListMarket)
 	vm.Register(core.TxBuyMarket, handleBuyMarket)
+	vm.Register(core.TxDirectPurchase, handleDirectPurchase)
+	vm.RegisterPayload(core.TxListMarket, func() any { return new(core.ListMarketPayload) })
+	vm.RegisterPayload(core.TxBuyMarket, func() any { return new(core.BuyMarketPayload) })
+	vm.RegisterPayload(core.TxDirectPurchase, func() any { return new(core.DirectPurchasePayload) })
 }
 
 func handleListMarket(ctx *vm.Context, payload json.RawMessage) error {
@@ -36,9 +40,12 @@ func handleListMarket(ctx *vm.Context, payload json.RawMessage) error {
 	if !asset.Tradeable {
 		return errors.New("asset is not tradeable")
 	}
-	// Prevent double-listing the same asset.
-	if asset.ActiveListingID != "" {
-		return fmt.Errorf("asset %q is already listed (listing %s)", p.AssetID, asset.ActiveListingID)
+	// Prevent double-listing the same asset, or listing a locked one.
+	if err := asset.CheckMovable(ctx.Block.Header.Timestamp); err != nil {
+		return err
+	}
+	if err := vm.CheckTransferCooldown(ctx, asset); err != nil {
+		return err
 	}
 
 	listingID := crypto.Hash([]byte(ctx.Tx.ID + ":listing:" + p.AssetID))
@@ -66,7 +73,13 @@ func handleListMarket(ctx *vm.Context, payload json.RawMessage) error {
 			Type:        events.EventMarketList,
 			TxID:        ctx.Tx.ID,
 			BlockHeight: ctx.Block.Header.Height,
-			Data:        map[string]any{"listing_id": listingID, "asset_id": p.AssetID, "price": p.Price},
+			Data: map[string]any{
+				"listing_id": listingID,
+				"asset_id":   p.AssetID,
+				"seller":     ctx.Tx.From,
+				"price":      p.Price,
+				"timestamp":  ctx.Block.Header.Timestamp,
+			},
 		})
 	}
 	return nil
@@ -122,6 +135,8 @@ func handleBuyMarket(ctx *vm.Context, payload json.RawMessage) error {
 	}
 	asset.Owner = ctx.Tx.From
 	asset.ActiveListingID = ""
+	asset.LockedBy, asset.LockExpiry = "", 0 // drop any lapsed lock
+	asset.LastTransferHeight = ctx.Block.Header.Height
 	if err := ctx.State.SetAsset(asset); err != nil {
 		return err
 	}
@@ -143,6 +158,85 @@ func handleBuyMarket(ctx *vm.Context, payload json.RawMessage) error {
 				"buyer":      ctx.Tx.From,
 				"seller":     listing.Seller,
 				"price":      listing.Price,
+				"timestamp":  ctx.Block.Header.Timestamp,
+			},
+		})
+	}
+	return nil
+}
+
+// handleDirectPurchase atomically pays the agreed price from the buyer
+// (the sender) to the seller and moves the asset to the buyer. The seller's
+// cosignature over the transaction is their consent to asset and price.
+func handleDirectPurchase(ctx *vm.Context, payload json.RawMessage) error {
+	var p core.DirectPurchasePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("decode direct_purchase payload: %w", err)
+	}
+	if p.Seller == "" || p.Seller == ctx.Tx.From {
+		return errors.New("seller must be set and differ from the buyer")
+	}
+	if !ctx.Tx.SignedBy(p.Seller) {
+		return fmt.Errorf("direct_purchase must be cosigned by seller %s", p.Seller)
+	}
+
+	asset, err := ctx.State.GetAsset(p.AssetID)
+	if err != nil {
+		return fmt.Errorf("asset %q not found: %w", p.AssetID, err)
+	}
+	if asset.Owner != p.Seller {
+		return fmt.Errorf("asset %q is not owned by seller %s", p.AssetID, p.Seller)
+	}
+	if !asset.Tradeable {
+		return errors.New("asset is not tradeable")
+	}
+	if err := asset.CheckMovable(ctx.Block.Header.Timestamp); err != nil {
+		return err
+	}
+	if err := vm.CheckTransferCooldown(ctx, asset); err != nil {
+		return err
+	}
+
+	buyer, err := ctx.State.GetAccount(ctx.Tx.From)
+	if err != nil {
+		return err
+	}
+	if buyer.Balance < p.Price {
+		return fmt.Errorf("insufficient balance: have %d need %d", buyer.Balance, p.Price)
+	}
+	buyer.Balance -= p.Price
+	if err := ctx.State.SetAccount(buyer); err != nil {
+		return err
+	}
+	seller, err := ctx.State.GetAccount(p.Seller)
+	if err != nil {
+		return err
+	}
+	if seller.Balance > math.MaxUint64-p.Price {
+		return fmt.Errorf("seller balance overflow")
+	}
+	seller.Balance += p.Price
+	if err := ctx.State.SetAccount(seller); err != nil {
+		return err
+	}
+
+	asset.Owner = ctx.Tx.From
+	asset.LockedBy, asset.LockExpiry = "", 0 // drop any lapsed lock
+	asset.LastTransferHeight = ctx.Block.Header.Height
+	if err := ctx.State.SetAsset(asset); err != nil {
+		return err
+	}
+
+	if ctx.Emitter != nil {
+		ctx.Emitter.Emit(events.Event{
+			Type:        events.EventDirectPurchase,
+			TxID:        ctx.Tx.ID,
+			BlockHeight: ctx.Block.Header.Height,
+			Data: map[string]any{
+				"asset_id": p.AssetID,
+				"buyer":    ctx.Tx.From,
+				"seller":   p.Seller,
+				"price":    p.Price,
 			},
 		})
 	}
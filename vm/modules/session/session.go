@@ -14,6 +14,8 @@ import (
 func init() {
 	vm.Register(core.TxSessionOpen, handleSessionOpen)
 	vm.Register(core.TxSessionResult, handleSessionResult)
+	vm.RegisterPayload(core.TxSessionOpen, func() any { return new(core.SessionOpenPayload) })
+	vm.RegisterPayload(core.TxSessionResult, func() any { return new(core.SessionResultPayload) })
 }
 
 func handleSessionOpen(ctx *vm.Context, payload json.RawMessage) error {
@@ -27,6 +29,16 @@ func handleSessionOpen(ctx *vm.Context, payload json.RawMessage) error {
 	if len(p.Players) == 0 {
 		return errors.New("at least one player required")
 	}
+	if limit := ctx.Params.MaxSessionPlayers; limit > 0 && len(p.Players) > limit {
+		return fmt.Errorf("too many players: %d exceeds limit %d", len(p.Players), limit)
+	}
+	if limit := ctx.Params.MaxSessionStakes; limit > 0 && p.Stakes > limit {
+		return fmt.Errorf("stakes %d exceed limit %d per player", p.Stakes, limit)
+	}
+	// Reject stake totals that could not be paid out by session_result.
+	if p.Stakes > 0 && uint64(len(p.Players)) > math.MaxUint64/p.Stakes {
+		return fmt.Errorf("total stakes overflow: %d players × %d", len(p.Players), p.Stakes)
+	}
 
 	// Check session doesn't already exist; distinguish DB errors from not-found.
 	if _, err := ctx.State.GetSession(p.SessionID); err == nil {
@@ -107,6 +119,15 @@ func handleSessionResult(ctx *vm.Context, payload json.RawMessage) error {
 		}
 	}
 
+	// A free session has nothing to distribute.
+	if sess.Stakes == 0 {
+		for _, player := range sess.Players {
+			if p.Outcome[player] != 0 {
+				return fmt.Errorf("session %q has no stakes; reward %d to %q not allowed", p.SessionID, p.Outcome[player], player)
+			}
+		}
+	}
+
 	// Validate total rewards do not exceed total locked stakes (no token creation).
 	// Each addition is checked for overflow before proceeding.
 	nPlayers := uint64(len(sess.Players))
@@ -123,7 +144,7 @@ func handleSessionResult(ctx *vm.Context, payload json.RawMessage) error {
 	}
 	// (E) Require all staked tokens to be distributed — prevents accidental loss.
 	if totalRewards != totalStakes {
-		return fmt.Errorf("rewards (%d) must equal total stakes (%d); undistributed tokens would be lost", totalRewards, totalStakes)
+		return fmt.Errorf("rewards (%d) must equal total stakes (%d); %d undistributed tokens would be stranded", totalRewards, totalStakes, totalStakes-totalRewards)
 	}
 
 	// Distribute rewards
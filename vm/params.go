@@ -0,0 +1,49 @@
+package vm
+
+import "github.com/tolelom/tolchain/core"
+
+// DefaultMaxSessionPlayers is the default limit on players per game session.
+const DefaultMaxSessionPlayers = 100
+
+// Default limits on the properties of a minted asset, which stay in state
+// for the asset's whole life.
+const (
+	DefaultMaxAssetPropertiesBytes = 16 * 1024 // JSON-encoded size
+	DefaultMaxAssetPropertyKeys    = 64        // top-level keys
+)
+
+// DefaultIdempotencyKeys is the default number of recent idempotency keys
+// remembered per sender.
+const DefaultIdempotencyKeys = 64
+
+// Params holds chain-wide execution limits that handlers enforce. Every node
+// must run with identical Params or they will disagree on block validity.
+type Params struct {
+	MaxSessionPlayers int    // max players in one session_open
+	MaxSessionStakes  uint64 // max per-player stake in one session_open; 0 → unlimited
+	BlockReward       uint64 // tokens minted to the proposer of every block
+
+	MaxAssetPropertiesBytes int // max JSON-encoded size of a minted asset's properties; 0 → unlimited
+	MaxAssetPropertyKeys    int // max top-level keys of a minted asset's properties; 0 → unlimited
+
+	MinTransferAmount      uint64 // smallest allowed transfer; 0 → any positive amount
+	AccountCreationDeposit uint64 // burned from the sender when a transfer creates a new account
+
+	CustomSchemas map[string]Schema // schema name → data layout accepted by custom transactions
+
+	MinFees map[core.TxType]uint64 // smallest fee accepted per tx type; absent → 0
+
+	BurnTombstones bool // burn_asset keeps a Burned record instead of deleting the asset
+
+	IdempotencyKeys int // recent idempotency keys remembered per sender
+}
+
+// DefaultParams returns the built-in execution limits.
+func DefaultParams() Params {
+	return Params{
+		MaxSessionPlayers:       DefaultMaxSessionPlayers,
+		MaxAssetPropertiesBytes: DefaultMaxAssetPropertiesBytes,
+		MaxAssetPropertyKeys:    DefaultMaxAssetPropertyKeys,
+		IdempotencyKeys:         DefaultIdempotencyKeys,
+	}
+}
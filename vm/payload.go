@@ -0,0 +1,44 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// payloadTypes maps TxTypes to constructors for their payload structs.
+// It lets tooling (e.g. RPC introspection) decode payloads without
+// knowing about every module.
+var payloadTypes = struct {
+	mu  sync.RWMutex
+	new map[core.TxType]func() any
+}{new: make(map[core.TxType]func() any)}
+
+// RegisterPayload associates typ with a constructor returning a pointer to
+// its payload struct. Module init() functions call this next to Register.
+// Panics on duplicate registration.
+func RegisterPayload(typ core.TxType, newPayload func() any) {
+	payloadTypes.mu.Lock()
+	defer payloadTypes.mu.Unlock()
+	if _, exists := payloadTypes.new[typ]; exists {
+		panic(fmt.Sprintf("vm: payload already registered for TxType %q", typ))
+	}
+	payloadTypes.new[typ] = newPayload
+}
+
+// DecodePayload unmarshals raw into the payload struct registered for typ.
+func DecodePayload(typ core.TxType, raw json.RawMessage) (any, error) {
+	payloadTypes.mu.RLock()
+	newPayload, ok := payloadTypes.new[typ]
+	payloadTypes.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("vm: no payload registered for TxType %q", typ)
+	}
+	p := newPayload()
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("decode %s payload: %w", typ, err)
+	}
+	return p, nil
+}
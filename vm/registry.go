@@ -43,6 +43,14 @@ func (r *Registry) Execute(typ core.TxType, ctx *Context, payload json.RawMessag
 	return h(ctx, payload)
 }
 
+// Has reports whether a handler is registered for typ.
+func (r *Registry) Has(typ core.TxType) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.handlers[typ]
+	return ok
+}
+
 // globalRegistry is the package-level singleton that modules register into.
 var globalRegistry = NewRegistry()
 
@@ -51,3 +59,8 @@ var globalRegistry = NewRegistry()
 func Register(typ core.TxType, h Handler) {
 	globalRegistry.Register(typ, h)
 }
+
+// IsRegistered reports whether a module has registered a handler for typ.
+func IsRegistered(typ core.TxType) bool {
+	return globalRegistry.Has(typ)
+}
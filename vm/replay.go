@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/tolelom/tolchain/core"
+)
+
+// ReplayChain re-executes the stored chain into fresh and compares each
+// recomputed state root against the stored header, to pinpoint where a
+// node's state diverged from the chain. fresh must already hold the genesis
+// state (e.g. from config.CreateGenesisBlock) and exec must execute into
+// fresh. Block 0 is checked as is; blocks 1..tip are executed with
+// ExecuteBlock and committed one at a time.
+//
+// It returns the height of the first block whose root does not match, or
+// -1 if every root matches. A block that fails to execute is a divergence
+// too and is returned with the execution error; other errors return -1.
+func ReplayChain(bc *core.Blockchain, exec *Executor, fresh core.State) (int64, error) {
+	diverged := int64(-1)
+	err := bc.IterateBlocks(0, -1, func(block *core.Block) error {
+		h := block.Header.Height
+		if h > 0 {
+			if err := exec.ExecuteBlock(block); err != nil {
+				diverged = h
+				return fmt.Errorf("execute block %d: %w", h, err)
+			}
+		}
+		root, err := fresh.ComputeRoot()
+		if err != nil {
+			return fmt.Errorf("block %d: compute state root: %w", h, err)
+		}
+		if block.Header.StateRoot != "" && root != block.Header.StateRoot {
+			diverged = h
+			return core.ErrStopIteration
+		}
+		if err := fresh.Commit(); err != nil {
+			return fmt.Errorf("block %d: commit state: %w", h, err)
+		}
+		return nil
+	})
+	return diverged, err
+}
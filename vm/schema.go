@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema describes the data of a custom transaction as a map of field name
+// to type hint, in the style of asset template schemas. The hints are
+// "string", "int", "number", "bool", "object" and "array"; a trailing "?"
+// makes the field optional. Fields not in the schema are rejected.
+type Schema map[string]string
+
+var schemaTypes = map[string]bool{
+	"string": true, "int": true, "number": true, "bool": true, "object": true, "array": true,
+}
+
+// Check reports an unknown type hint in s.
+func (s Schema) Check() error {
+	for _, field := range s.fields() {
+		if hint := strings.TrimSuffix(s[field], "?"); !schemaTypes[hint] {
+			return fmt.Errorf("field %q: unknown type %q", field, s[field])
+		}
+	}
+	return nil
+}
+
+// Validate checks that data is a JSON object holding every required field
+// of s, only fields of s, and each with a value of its declared type.
+func (s Schema) Validate(data json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("data must be a JSON object: %w", err)
+	}
+	if obj == nil {
+		return errors.New("data must be a JSON object")
+	}
+	for _, field := range s.fields() {
+		hint, optional := strings.CutSuffix(s[field], "?")
+		v, ok := obj[field]
+		if !ok {
+			if optional {
+				continue
+			}
+			return fmt.Errorf("missing field %q", field)
+		}
+		if !matchesType(hint, v) {
+			return fmt.Errorf("field %q must be %s", field, hint)
+		}
+	}
+	for field := range obj {
+		if _, ok := s[field]; !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// fields returns the field names of s in sorted order, so that the first
+// error reported is the same on every node.
+func (s Schema) fields() []string {
+	fields := make([]string, 0, len(s))
+	for f := range s {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// matchesType reports whether v, decoded with json.Decoder.UseNumber, is a
+// value of type hint.
+func matchesType(hint string, v any) bool {
+	switch hint {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "int":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	}
+	return false
+}
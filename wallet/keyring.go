@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tolelom/tolchain/core"
+	"github.com/tolelom/tolchain/crypto"
+)
+
+// keyFileExt is the extension of each named key file in a KeyStore directory.
+const keyFileExt = ".json"
+
+// validKeyName restricts key names to characters safe in a file name.
+var validKeyName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ErrKeyNotFound is returned when a KeyStore has no key of the given name.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyInfo describes a stored key without decrypting it.
+type KeyInfo struct {
+	Name   string `json:"name"`
+	PubKey string `json:"pub_key"`
+}
+
+// KeyStore manages several named keys in one directory. Each key is kept in
+// its own file, written with SaveKey and encrypted under its own password.
+type KeyStore struct {
+	dir string
+}
+
+// NewKeyStore opens the keystore directory dir, creating it if necessary.
+func NewKeyStore(dir string) (*KeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create keystore dir: %w", err)
+	}
+	return &KeyStore{dir: dir}, nil
+}
+
+func (ks *KeyStore) path(name string) (string, error) {
+	if !validKeyName.MatchString(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid key name %q", name)
+	}
+	return filepath.Join(ks.dir, name+keyFileExt), nil
+}
+
+// Add encrypts priv with password and stores it under name. It fails if a
+// key of that name already exists.
+func (ks *KeyStore) Add(name, password string, priv crypto.PrivateKey) error {
+	path, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("key %q already exists", name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return SaveKey(path, password, priv)
+}
+
+// Generate creates a new key pair, stores it under name and returns it as
+// a Wallet.
+func (ks *KeyStore) Generate(name, password string) (*Wallet, error) {
+	w, err := Generate()
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.Add(name, password, w.PrivKey()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Get decrypts the key stored under name and returns it as a Wallet.
+func (ks *KeyStore) Get(name, password string) (*Wallet, error) {
+	path, err := ks.path(name)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := LoadKey(path, password)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", name, err)
+	}
+	return New(priv), nil
+}
+
+// List returns the stored keys sorted by name.
+func (ks *KeyStore) List() ([]KeyInfo, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []KeyInfo
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), keyFileExt)
+		if !ok || e.IsDir() || !validKeyName.MatchString(name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(ks.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var f keystoreFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("key %q: %w", name, err)
+		}
+		keys = append(keys, KeyInfo{Name: name, PubKey: f.PubKey})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys, nil
+}
+
+// Remove deletes the key stored under name.
+func (ks *KeyStore) Remove(name string) error {
+	path, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// NewTx builds a transaction signed by the key stored under name.
+func (ks *KeyStore) NewTx(name, password, chainID string, typ core.TxType, nonce, fee uint64, payload any) (*core.Transaction, error) {
+	w, err := ks.Get(name, password)
+	if err != nil {
+		return nil, err
+	}
+	return w.NewTx(chainID, typ, nonce, fee, payload)
+}
@@ -9,28 +9,109 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/tolelom/tolchain/crypto"
 	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
 )
 
+// Supported key derivation functions.
+const (
+	KDFPBKDF2 = "pbkdf2"
+	KDFScrypt = "scrypt"
+)
+
+// Default KDF parameters for newly written keystores.
+const (
+	pbkdf2Iterations = 210_000
+	scryptN          = 1 << 15 // 32 MiB of memory with r=8
+	scryptR          = 8
+	scryptP          = 1
+)
+
+// Upper bounds on the KDF parameters LoadKey accepts, so that a corrupt or
+// tampered keystore cannot make it allocate unbounded memory or spin for
+// hours. They leave ample room above the defaults.
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxScryptN          = 1 << 20
+	maxScryptR          = 32
+	maxScryptP          = 16
+	maxScryptMemory     = 1 << 30 // bytes; scrypt uses 128·N·R
+)
+
+// ErrKDFParams is returned by LoadKey for a keystore whose KDF parameters
+// are invalid or beyond the accepted bounds.
+var ErrKDFParams = errors.New("invalid keystore kdf params")
+
+// KDFParams holds the cost parameters of a keystore's KDF.
+// Iterations applies to pbkdf2; N, R and P apply to scrypt.
+type KDFParams struct {
+	Iterations int `json:"iterations,omitempty"`
+	N          int `json:"n,omitempty"`
+	R          int `json:"r,omitempty"`
+	P          int `json:"p,omitempty"`
+}
+
+// ErrPubKeyMismatch is returned by LoadKey when the key decrypted from a
+// keystore does not belong to the public key recorded beside it. The
+// ciphertext is authenticated but pub_key is not, so this reveals a
+// corrupted or tampered file.
+var ErrPubKeyMismatch = errors.New("keystore pub_key does not match the decrypted key")
+
 type keystoreFile struct {
-	PubKey     string `json:"pub_key"`
-	Salt       string `json:"salt"`
-	Nonce      string `json:"nonce"`
-	CipherText string `json:"cipher_text"`
+	PubKey     string    `json:"pub_key"`
+	KDF        string    `json:"kdf,omitempty"` // empty → legacy pbkdf2 file
+	KDFParams  KDFParams `json:"kdf_params"`
+	Salt       string    `json:"salt"`
+	Nonce      string    `json:"nonce"`
+	CipherText string    `json:"cipher_text"`
 }
 
-// SaveKey encrypts priv with password and writes it to path.
-// Key derivation: SHA-256(password || salt) — simple, sufficient for this chain.
+// SaveKey encrypts priv with password and writes it to path using scrypt.
 func SaveKey(path, password string, priv crypto.PrivateKey) error {
+	return SaveKeyWithKDF(path, password, priv, KDFScrypt)
+}
+
+// ImportKey decodes a hex-encoded 64-byte ed25519 private key, e.g. one
+// generated by another tool, and saves it encrypted to path like SaveKey.
+// Nothing is written if the key is malformed.
+func ImportKey(path, password, privHex string) (*Wallet, error) {
+	priv, err := crypto.PrivKeyFromHex(strings.TrimSpace(privHex))
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveKey(path, password, priv); err != nil {
+		return nil, err
+	}
+	return New(priv), nil
+}
+
+// SaveKeyWithKDF is like SaveKey but derives the encryption key with kdf
+// (KDFPBKDF2 or KDFScrypt) using its default parameters.
+func SaveKeyWithKDF(path, password string, priv crypto.PrivateKey, kdf string) error {
+	var params KDFParams
+	switch kdf {
+	case KDFPBKDF2:
+		params = KDFParams{Iterations: pbkdf2Iterations}
+	case KDFScrypt:
+		params = KDFParams{N: scryptN, R: scryptR, P: scryptP}
+	default:
+		return fmt.Errorf("unsupported kdf %q", kdf)
+	}
+
 	salt := make([]byte, 16)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		return err
 	}
-	key := deriveKey(password, salt)
+	key, err := deriveKey(kdf, params, password, salt)
+	if err != nil {
+		return err
+	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -48,6 +129,8 @@ func SaveKey(path, password string, priv crypto.PrivateKey) error {
 
 	ks := keystoreFile{
 		PubKey:     priv.Public().Hex(),
+		KDF:        kdf,
+		KDFParams:  params,
 		Salt:       hex.EncodeToString(salt),
 		Nonce:      hex.EncodeToString(nonce),
 		CipherText: hex.EncodeToString(cipherText),
@@ -59,7 +142,8 @@ func SaveKey(path, password string, priv crypto.PrivateKey) error {
 	return os.WriteFile(path, data, 0600)
 }
 
-// LoadKey decrypts the keystore at path using password.
+// LoadKey decrypts the keystore at path using password and checks that
+// the key matches the file's pub_key (ErrPubKeyMismatch otherwise).
 func LoadKey(path, password string) (crypto.PrivateKey, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -82,7 +166,14 @@ func LoadKey(path, password string) (crypto.PrivateKey, error) {
 		return nil, err
 	}
 
-	key := deriveKey(password, salt)
+	kdf, params := ks.KDF, ks.KDFParams
+	if kdf == "" {
+		kdf, params = KDFPBKDF2, KDFParams{Iterations: pbkdf2Iterations}
+	}
+	key, err := deriveKey(kdf, params, password, salt)
+	if err != nil {
+		return nil, err
+	}
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -95,9 +186,46 @@ func LoadKey(path, password string) (crypto.PrivateKey, error) {
 	if err != nil {
 		return nil, errors.New("wrong password or corrupted keystore")
 	}
-	return crypto.PrivateKey(privBytes), nil
+	priv, err := crypto.PrivKeyFromHex(hex.EncodeToString(privBytes))
+	if err != nil {
+		return nil, fmt.Errorf("keystore holds an invalid key: %w", err)
+	}
+	if pub := priv.Public().Hex(); pub != ks.PubKey {
+		return nil, fmt.Errorf("%w: file says %q, key is %s", ErrPubKeyMismatch, ks.PubKey, pub)
+	}
+	return priv, nil
 }
 
-func deriveKey(password string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(password), salt, 210_000, 32, sha256.New)
+// checkScryptParams rejects scrypt parameters that scrypt.Key would refuse
+// or that exceed the accepted bounds.
+func checkScryptParams(p KDFParams) error {
+	switch {
+	case p.N < 2 || p.N > maxScryptN || p.N&(p.N-1) != 0:
+		return fmt.Errorf("%w: scrypt n %d must be a power of two in 2..%d", ErrKDFParams, p.N, maxScryptN)
+	case p.R < 1 || p.R > maxScryptR:
+		return fmt.Errorf("%w: scrypt r %d not in 1..%d", ErrKDFParams, p.R, maxScryptR)
+	case p.P < 1 || p.P > maxScryptP:
+		return fmt.Errorf("%w: scrypt p %d not in 1..%d", ErrKDFParams, p.P, maxScryptP)
+	case 128*p.N*p.R > maxScryptMemory:
+		return fmt.Errorf("%w: scrypt n %d and r %d need more than %d bytes", ErrKDFParams, p.N, p.R, maxScryptMemory)
+	}
+	return nil
+}
+
+// deriveKey derives a 32-byte AES key from password and salt using kdf.
+func deriveKey(kdf string, params KDFParams, password string, salt []byte) ([]byte, error) {
+	switch kdf {
+	case KDFPBKDF2:
+		if params.Iterations <= 0 || params.Iterations > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("%w: pbkdf2 iterations %d not in 1..%d", ErrKDFParams, params.Iterations, maxPBKDF2Iterations)
+		}
+		return pbkdf2.Key([]byte(password), salt, params.Iterations, 32, sha256.New), nil
+	case KDFScrypt:
+		if err := checkScryptParams(params); err != nil {
+			return nil, err
+		}
+		return scrypt.Key([]byte(password), salt, params.N, params.R, params.P, 32)
+	default:
+		return nil, fmt.Errorf("unsupported kdf %q", kdf)
+	}
 }
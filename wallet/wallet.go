@@ -1,6 +1,8 @@
 package wallet
 
 import (
+	"fmt"
+
 	"github.com/tolelom/tolchain/core"
 	"github.com/tolelom/tolchain/crypto"
 )
@@ -51,6 +53,59 @@ func (w *Wallet) NewTx(chainID string, typ core.TxType, nonce, fee uint64, paylo
 	return tx, nil
 }
 
+// NewSponsoredTx creates a transaction whose fee is paid by feePayer
+// (a pubkey hex). It is signed by w and still needs the fee payer's
+// co-signature, see CoSign.
+func (w *Wallet) NewSponsoredTx(chainID string, typ core.TxType, feePayer string, nonce, fee uint64, payload any) (*core.Transaction, error) {
+	tx, err := core.NewTransaction(chainID, typ, w.pub.Hex(), nonce, fee, payload)
+	if err != nil {
+		return nil, err
+	}
+	tx.FeePayer = feePayer
+	tx.Sign(w.priv)
+	return tx, nil
+}
+
+// NewCosignedTx creates a transaction signed by w that names cosigners
+// (pubkey hex) as parties whose approval it needs, e.g. the seller of a
+// direct_purchase. Each of them must add theirs with Countersign before it
+// is submitted.
+func (w *Wallet) NewCosignedTx(chainID string, typ core.TxType, cosigners []string, nonce, fee uint64, payload any) (*core.Transaction, error) {
+	tx, err := core.NewTransaction(chainID, typ, w.pub.Hex(), nonce, fee, payload)
+	if err != nil {
+		return nil, err
+	}
+	tx.Cosigners = cosigners
+	tx.Sign(w.priv)
+	return tx, nil
+}
+
+// CoSign adds w's fee payer signature to a sponsored transaction naming w
+// as its fee payer.
+func (w *Wallet) CoSign(tx *core.Transaction) error {
+	if tx.FeePayer != w.pub.Hex() {
+		return fmt.Errorf("transaction fee payer is %q, not this wallet", tx.FeePayer)
+	}
+	tx.SignFeePayer(w.priv)
+	return nil
+}
+
+// SignDetached returns w's signature of an unsigned transaction sent from
+// w without modifying it, so the signing key never has to be on the machine
+// that built or submits the transaction; see core.Transaction.AttachSignature.
+func (w *Wallet) SignDetached(tx *core.Transaction) (string, error) {
+	if tx.From != w.pub.Hex() {
+		return "", fmt.Errorf("transaction sender is %q, not this wallet", tx.From)
+	}
+	return crypto.Sign(w.priv, tx.SigningHash()), nil
+}
+
+// Countersign adds w's approval to a transaction sent by someone else,
+// e.g. the seller's consent to a direct_purchase.
+func (w *Wallet) Countersign(tx *core.Transaction) {
+	tx.Cosign(w.priv)
+}
+
 // Transfer creates a signed transfer transaction.
 func (w *Wallet) Transfer(chainID, to string, amount, nonce, fee uint64) (*core.Transaction, error) {
 	return w.NewTx(chainID, core.TxTransfer, nonce, fee, core.TransferPayload{